@@ -0,0 +1,183 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/bryonbaker/beacon/internal/audit"
+	"github.com/bryonbaker/beacon/internal/config"
+	"github.com/bryonbaker/beacon/internal/database"
+)
+
+// Exit codes of the maintenance commands.
+const (
+	exitOK     = 0
+	exitFailed = 1
+	exitUsage  = 2
+)
+
+// usage describes the maintenance commands.
+const usage = `Usage: beacon [command]
+
+Without a command, beacon runs the service.
+
+Commands:
+  audit verify [file]  Verify the hash chain of the audit log, including its
+                       rotated files. file defaults to audit.path from the
+                       configuration at CONFIG_PATH.
+  db migrate [-dry-run] [-db path]
+                       Apply pending schema migrations, or with -dry-run list
+                       them without changing the database. The database
+                       defaults to storage.dbPath from the configuration at
+                       CONFIG_PATH.
+  db restore [-db path] backup
+                       Replace the database with a backup after checking its
+                       integrity and schema version. The database defaults to
+                       storage.dbPath from the configuration at CONFIG_PATH.
+                       Beacon must be stopped.
+`
+
+// runCommand runs the maintenance command in args, writing its output to
+// stdout and stderr, and returns the process exit code.
+func runCommand(args []string, stdout, stderr io.Writer) int {
+	switch {
+	case len(args) >= 2 && args[0] == "audit" && args[1] == "verify":
+		return auditVerify(args[2:], stdout, stderr)
+	case len(args) >= 2 && args[0] == "db" && args[1] == "migrate":
+		return dbMigrate(args[2:], stdout, stderr)
+	case len(args) >= 2 && args[0] == "db" && args[1] == "restore":
+		return dbRestore(args[2:], stdout, stderr)
+	case args[0] == "help" || args[0] == "-h" || args[0] == "--help":
+		fmt.Fprint(stdout, usage)
+		return exitOK
+	default:
+		fmt.Fprintf(stderr, "unknown command: %s\n\n%s", strings.Join(args, " "), usage)
+		return exitUsage
+	}
+}
+
+// auditVerify verifies an audit log and reports the result.
+func auditVerify(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("audit verify", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	if err := fs.Parse(args); err != nil || fs.NArg() > 1 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+
+	path := fs.Arg(0)
+	if path == "" {
+		cfg, err := config.Load(configPath())
+		if err != nil {
+			fmt.Fprintf(stderr, "failed to load config: %v\n", err)
+			return exitUsage
+		}
+		path = cfg.Audit.Path
+	}
+
+	result, err := audit.Verify(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "audit log verification failed: %v\n", err)
+		return exitFailed
+	}
+	fmt.Fprintf(stdout, "audit log verified: %d entries in %d files, head %s\n",
+		result.Entries, len(result.Files), result.Head)
+	return exitOK
+}
+
+// dbMigrate applies the pending schema migrations to the database, or lists
+// them on a dry run.
+func dbMigrate(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("db migrate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	dbPath := fs.String("db", "", "database file to migrate")
+	dryRun := fs.Bool("dry-run", false, "list pending migrations without applying them")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+
+	if *dbPath == "" {
+		cfg, err := config.Load(configPath())
+		if err != nil {
+			fmt.Fprintf(stderr, "failed to load config: %v\n", err)
+			return exitUsage
+		}
+		*dbPath = cfg.Storage.DBPath
+	}
+
+	version, pending, err := database.PendingMigrations(*dbPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "migration failed: %v\n", err)
+		return exitFailed
+	}
+	fmt.Fprintf(stdout, "%s is at schema version %d of %d\n", *dbPath, version, database.SchemaVersion)
+	if len(pending) == 0 {
+		fmt.Fprintln(stdout, "no migrations to apply")
+		return exitOK
+	}
+	if *dryRun {
+		for _, m := range pending {
+			fmt.Fprintf(stdout, "would apply migration %d: %s\n", m.Version, m.Description)
+		}
+		return exitOK
+	}
+
+	db, err := database.NewSQLiteDB(*dbPath, zap.NewNop())
+	if err != nil {
+		fmt.Fprintf(stderr, "migration failed: %v\n", err)
+		return exitFailed
+	}
+	if err := db.Close(); err != nil {
+		fmt.Fprintf(stderr, "closing database: %v\n", err)
+		return exitFailed
+	}
+	for _, m := range pending {
+		fmt.Fprintf(stdout, "applied migration %d: %s\n", m.Version, m.Description)
+	}
+	return exitOK
+}
+
+// dbRestore restores the database from a backup.
+func dbRestore(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("db restore", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	dbPath := fs.String("db", "", "database file to replace")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+
+	if *dbPath == "" {
+		cfg, err := config.Load(configPath())
+		if err != nil {
+			fmt.Fprintf(stderr, "failed to load config: %v\n", err)
+			return exitUsage
+		}
+		*dbPath = cfg.Storage.DBPath
+	}
+
+	previous, err := database.Restore(fs.Arg(0), *dbPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "restore failed: %v\n", err)
+		return exitFailed
+	}
+	fmt.Fprintf(stdout, "restored %s to %s\n", fs.Arg(0), *dbPath)
+	if previous != "" {
+		fmt.Fprintf(stdout, "previous database kept at %s\n", previous)
+	}
+	return exitOK
+}
+
+// configPath returns the path of the configuration file.
+func configPath() string {
+	if path := os.Getenv("CONFIG_PATH"); path != "" {
+		return path
+	}
+	return "/config/config.yaml"
+}
@@ -15,33 +15,36 @@ import (
 	"go.uber.org/zap/zapcore"
 	"golang.org/x/sync/errgroup"
 
+	"github.com/bryonbaker/beacon/internal/audit"
+	"github.com/bryonbaker/beacon/internal/backup"
 	"github.com/bryonbaker/beacon/internal/cleaner"
 	"github.com/bryonbaker/beacon/internal/config"
 	"github.com/bryonbaker/beacon/internal/database"
 	"github.com/bryonbaker/beacon/internal/metrics"
 	"github.com/bryonbaker/beacon/internal/notifier"
 	"github.com/bryonbaker/beacon/internal/reconciler"
+	"github.com/bryonbaker/beacon/internal/schema"
 	"github.com/bryonbaker/beacon/internal/storage"
+	"github.com/bryonbaker/beacon/internal/tracing"
 	"github.com/bryonbaker/beacon/internal/watcher"
 	k8sclient "github.com/bryonbaker/beacon/pkg/kubernetes"
 )
 
 func main() {
-	// Determine config path
-	configPath := os.Getenv("CONFIG_PATH")
-	if configPath == "" {
-		configPath = "/config/config.yaml"
+	// Maintenance commands run instead of the service.
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:], os.Stdout, os.Stderr))
 	}
 
 	// Load configuration
-	cfg, err := config.Load(configPath)
+	cfg, err := config.Load(configPath())
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
 		os.Exit(1)
 	}
 
 	// Initialize logger
-	logger, err := newLogger(cfg.App.LogLevel, cfg.App.LogFormat)
+	logger, logLevel, err := newLogger(cfg.App.LogLevel, cfg.App.LogFormat)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to initialize logger: %v\n", err)
 		os.Exit(1)
@@ -54,6 +57,12 @@ func main() {
 		zap.String("log_level", cfg.App.LogLevel),
 	)
 
+	// Initialize tracing
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg, logger)
+	if err != nil {
+		logger.Fatal("failed to initialize tracing", zap.Error(err))
+	}
+
 	// Open database
 	db, err := database.NewSQLiteDB(cfg.Storage.DBPath, logger)
 	if err != nil {
@@ -69,50 +78,105 @@ func main() {
 	registry := prometheus.NewRegistry()
 	m := metrics.NewMetrics(registry)
 
-	// Start metrics/health server
-	metricsServer := metrics.NewServer(
-		cfg.Metrics.Port,
-		cfg.Metrics.Path,
-		cfg.Health.LivenessPath,
-		cfg.Health.ReadinessPath,
-		registry,
-	)
-	metricsServer.UpdateHealthCheck("database", "ok")
+	// Create metrics/health server
+	metricsServer, err := metrics.NewServer(cfg, registry, logger)
+	if err != nil {
+		logger.Fatal("failed to create metrics server", zap.Error(err))
+	}
+	metricsServer.Handle(cfg.CloudEvents.Schema.Path, schema.Handler())
+	metricsServer.HandleAdmin("/admin/loglevel", logLevel)
+
+	// Components report their health and heartbeats through the metrics.
+	// Readiness waits for the database, the watcher's initial sync and the
+	// notifier's first poll; liveness fails if a periodic loop stops.
+	m.SetHealthChecks(metricsServer.HealthChecks())
+	for _, component := range []string{"database", "watcher", "notifier"} {
+		metricsServer.UpdateHealthCheck(component, "starting")
+	}
+	metricsServer.HealthChecks().ExpectHeartbeat("notifier",
+		cfg.Worker.PollInterval.Duration+cfg.Health.HeartbeatTimeout.Duration)
+	if cfg.Reconciliation.Enabled {
+		metricsServer.HealthChecks().ExpectHeartbeat("reconciler",
+			cfg.Reconciliation.Interval.Duration+cfg.Health.HeartbeatTimeout.Duration)
+	}
 
 	// Create Kubernetes clients
 	typedClient, dynClient, err := k8sclient.NewClients(logger)
 	if err != nil {
 		logger.Fatal("failed to create kubernetes clients", zap.Error(err))
 	}
-	metricsServer.UpdateHealthCheck("kubernetes", "ok")
 
 	// Create context with cancellation for shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Create components
-	w := watcher.NewWatcher(db, typedClient, dynClient, cfg, m, logger)
-	n := notifier.NewNotifier(db, &http.Client{Timeout: cfg.Endpoint.Timeout.Duration}, cfg, m, logger)
-	r := reconciler.NewReconciler(db, typedClient, dynClient, cfg, m, logger)
-	c := cleaner.NewCleaner(db, cfg, m, logger)
-	sm := storage.NewMonitor(db, cfg, m, logger)
+	// Create components. They share a database handle that records the
+	// duration and errors of every operation, and spans for the queries made
+	// within a trace.
+	tdb := database.NewTracedDB(database.NewInstrumentedDB(db, m))
+	w := watcher.NewWatcher(tdb, typedClient, dynClient, cfg, m, logger)
+	sinks, err := newSinks(cfg, logger)
+	if err != nil {
+		logger.Fatal("failed to create notification sink", zap.Error(err))
+	}
+	var n *notifier.Notifier
+	if cfg.Routed() {
+		n = notifier.NewRoutingNotifier(tdb, sinks, cfg, m, logger)
+	} else {
+		n = notifier.NewNotifierWithSink(tdb, sinks[""], cfg, m, logger)
+	}
+	if cfg.Endpoint.Ack.Enabled {
+		metricsServer.Handle(cfg.Endpoint.Ack.Path, n.AckHandler())
+	}
+	n.OnCircuitStateChange(func(endpoint, state string) {
+		component := "endpointCircuit"
+		if endpoint != "" {
+			component += "." + endpoint
+		}
+		metricsServer.SetDetail(component, state)
+	})
+	if cfg.Audit.Enabled {
+		auditLog, err := audit.Open(cfg.Audit, logger)
+		if err != nil {
+			logger.Fatal("failed to open audit log", zap.Error(err))
+		}
+		defer auditLog.Close()
+		n.SetAuditLog(auditLog)
+	}
+	r := reconciler.NewReconciler(tdb, typedClient, dynClient, cfg, m, logger)
+	c := cleaner.NewCleaner(tdb, cfg, m, logger)
+	sm := storage.NewMonitor(tdb, cfg, m, logger)
+	if cfg.Retention.Enabled {
+		// Under storage pressure the monitor cleans up early.
+		sm.SetCleaner(c)
+	}
+	bk := backup.NewBackup(tdb, cfg, m, logger)
 
 	// Use errgroup for goroutine lifecycle
 	g, gCtx := errgroup.WithContext(ctx)
 
 	// Start metrics server
 	g.Go(func() error {
-		logger.Info("starting metrics server", zap.Int("port", cfg.Metrics.Port))
+		logger.Info("starting metrics server",
+			zap.Int("health_port", cfg.Health.Port),
+			zap.Bool("metrics_enabled", cfg.Metrics.Enabled),
+			zap.Int("metrics_port", cfg.Metrics.Port),
+		)
 		return metricsServer.Start()
 	})
 
 	// Start watcher
 	g.Go(func() error {
 		logger.Info("starting watcher")
-		metricsServer.UpdateHealthCheck("watchers", "ok")
 		return w.Start(gCtx)
 	})
 
+	// Start database health checks
+	g.Go(func() error {
+		database.MonitorHealth(gCtx, tdb, cfg.Health.DatabasePingInterval.Duration, m, logger)
+		return nil
+	})
+
 	// Start notifier
 	g.Go(func() error {
 		logger.Info("starting notifier")
@@ -153,7 +217,16 @@ func main() {
 		return nil
 	})
 
-	// Mark as ready
+	// Start database backups if enabled
+	if cfg.Backup.Enabled {
+		g.Go(func() error {
+			bk.Start(gCtx)
+			return nil
+		})
+	}
+
+	// Mark as ready; the readiness probe passes once the components have
+	// also reported healthy
 	metricsServer.SetReady(true)
 	logger.Info("beacon is ready")
 
@@ -193,10 +266,23 @@ func main() {
 		logger.Error("error during shutdown", zap.Error(err))
 	}
 
+	for name, sink := range sinks {
+		if err := sink.Close(); err != nil {
+			logger.Error("notification sink close error", zap.String("endpoint", name), zap.Error(err))
+		}
+	}
+
+	// Flush spans still buffered for export
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		logger.Error("tracing shutdown error", zap.Error(err))
+	}
+
 	logger.Info("beacon shutdown complete")
 }
 
-func newLogger(level, format string) (*zap.Logger, error) {
+// newLogger builds the logger, returning with it the level that the
+// /admin/loglevel route changes at runtime.
+func newLogger(level, format string) (*zap.Logger, zap.AtomicLevel, error) {
 	var cfg zap.Config
 	if format == "json" {
 		cfg = zap.NewProductionConfig()
@@ -217,5 +303,28 @@ func newLogger(level, format string) (*zap.Logger, error) {
 		cfg.Level = zap.NewAtomicLevelAt(zapcore.InfoLevel)
 	}
 
-	return cfg.Build()
+	logger, err := cfg.Build()
+	return logger, cfg.Level, err
+}
+
+// newSinks creates the notification sinks keyed by endpoint name: one for
+// each named endpoint when routing, otherwise the sink selected by sink.type
+// under the empty name.
+func newSinks(cfg *config.Config, logger *zap.Logger) (map[string]notifier.Sink, error) {
+	if cfg.Routed() {
+		sinks := make(map[string]notifier.Sink, len(cfg.Endpoints))
+		for _, ep := range cfg.Endpoints {
+			client := &http.Client{Timeout: ep.Timeout.Duration}
+			sinks[ep.Name] = notifier.NewHTTPSink(client, cfg.ForEndpoint(ep.Name), logger.With(zap.String("endpoint", ep.Name)))
+		}
+		return sinks, nil
+	}
+	if cfg.Sink.Type == config.SinkTypeKafka {
+		sink, err := notifier.NewKafkaSink(cfg, logger)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]notifier.Sink{"": sink}, nil
+	}
+	return map[string]notifier.Sink{"": notifier.NewHTTPSink(&http.Client{Timeout: cfg.Endpoint.Timeout.Duration}, cfg, logger)}, nil
 }
@@ -0,0 +1,419 @@
+// Package audit writes the delivery audit log: an append-only record of every
+// notification attempt and state transition, one JSON object per line. Each
+// entry carries the SHA-256 hash of the entry before it, so removing,
+// reordering or editing an entry breaks the chain that Verify checks.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/bryonbaker/beacon/internal/config"
+)
+
+// Entry kinds.
+const (
+	KindAttempt    = "attempt"    // an event was handed to the sink
+	KindTransition = "transition" // an object's notification state changed
+)
+
+// GenesisHash is the previous hash of the first entry in a log.
+var GenesisHash = strings.Repeat("0", sha256.Size*2)
+
+// rotatedTimeFormat names rotated files so that they sort in rotation order.
+const rotatedTimeFormat = "20060102T150405.000000000Z"
+
+// Entry is one line of the audit log. Seq, Time, PrevHash and Hash are set
+// by Record.
+type Entry struct {
+	Seq  uint64    `json:"seq"`
+	Time time.Time `json:"time"`
+	Kind string    `json:"kind"`
+
+	// The object and event concerned.
+	ObjectID     string `json:"object_id"`
+	ResourceUID  string `json:"resource_uid,omitempty"`
+	ResourceType string `json:"resource_type,omitempty"`
+	Namespace    string `json:"namespace,omitempty"`
+	Name         string `json:"name,omitempty"`
+	EventType    string `json:"event_type,omitempty"`
+	EventID      string `json:"event_id,omitempty"`
+
+	// Where the event was sent: the endpoint name, empty for the single
+	// endpoint, and the URL or topic.
+	Endpoint    string `json:"endpoint,omitempty"`
+	Destination string `json:"destination,omitempty"`
+
+	// Attempt details.
+	Attempt         int               `json:"attempt,omitempty"`
+	Event           json.RawMessage   `json:"event,omitempty"` // the CloudEvent sent
+	Result          string            `json:"result,omitempty"`
+	StatusCode      int               `json:"status_code,omitempty"`
+	ResponseBody    string            `json:"response_body,omitempty"`
+	ResponseHeaders map[string]string `json:"response_headers,omitempty"`
+	Error           string            `json:"error,omitempty"`
+	LatencyMS       int64             `json:"latency_ms,omitempty"`
+
+	// Transition details: the state entered and, for a retry, when the next
+	// attempt is due.
+	State         string     `json:"state,omitempty"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+
+	PrevHash string `json:"prev_hash"`
+	Hash     string `json:"hash,omitempty"`
+}
+
+// Log is an audit log file. It is safe for concurrent use; a nil *Log
+// discards entries.
+type Log struct {
+	cfg    config.AuditConfig
+	logger *zap.Logger
+	now    func() time.Time
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time // time of the first entry in the active file
+	seq      uint64
+	prevHash string
+}
+
+// Open opens the audit log at cfg.Path for appending, creating it and its
+// directory if needed, and continues the hash chain from the last entry
+// written. An incomplete final line, left by a crash mid-write, is removed.
+func Open(cfg config.AuditConfig, logger *zap.Logger) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(cfg.Path), 0o750); err != nil {
+		return nil, fmt.Errorf("creating audit log directory: %w", err)
+	}
+	f, err := os.OpenFile(cfg.Path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("opening audit log: %w", err)
+	}
+
+	l := &Log{cfg: cfg, logger: logger, now: time.Now, file: f, prevHash: GenesisHash}
+	if err := l.recover(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	logger.Info("audit log opened",
+		zap.String("path", cfg.Path),
+		zap.Uint64("seq", l.seq),
+	)
+	return l, nil
+}
+
+// recover restores the chain head and the active file's size and age.
+func (l *Log) recover() error {
+	data, err := io.ReadAll(l.file)
+	if err != nil {
+		return fmt.Errorf("reading audit log: %w", err)
+	}
+	if end := bytes.LastIndexByte(data, '\n') + 1; end < len(data) {
+		l.logger.Warn("truncating incomplete audit log entry",
+			zap.String("path", l.cfg.Path),
+			zap.Int("bytes", len(data)-end),
+		)
+		if err := l.file.Truncate(int64(end)); err != nil {
+			return fmt.Errorf("truncating audit log: %w", err)
+		}
+		data = data[:end]
+	}
+	l.size = int64(len(data))
+
+	if len(data) > 0 {
+		lines := bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n"))
+		first, err := parseLine(lines[0])
+		if err != nil {
+			return fmt.Errorf("reading audit log %s:1: %w", l.cfg.Path, err)
+		}
+		last, err := parseLine(lines[len(lines)-1])
+		if err != nil {
+			return fmt.Errorf("reading audit log %s:%d: %w", l.cfg.Path, len(lines), err)
+		}
+		l.openedAt = first.Time
+		l.seq, l.prevHash = last.Seq, last.Hash
+		return nil
+	}
+
+	// The active file is new or was just rotated; the chain continues from
+	// the most recent rotated file.
+	rotated, err := rotatedFiles(l.cfg.Path)
+	if err != nil {
+		return err
+	}
+	if len(rotated) == 0 {
+		return nil
+	}
+	path := rotated[len(rotated)-1]
+	var last *Entry
+	err = readLines(path, func(_ int, line []byte) error {
+		e, err := parseLine(line)
+		last = e
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("reading rotated audit log %s: %w", path, err)
+	}
+	if last != nil {
+		l.seq, l.prevHash = last.Seq, last.Hash
+	}
+	return nil
+}
+
+// Record appends e to the log, rotating the file first if it is due. The
+// entry is synced to disk before Record returns.
+func (l *Log) Record(e *Entry) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return errors.New("audit log is closed")
+	}
+
+	now := l.now().UTC()
+	e.Seq = l.seq + 1
+	if e.Time.IsZero() {
+		e.Time = now
+	}
+	e.Time = e.Time.UTC()
+	e.PrevHash = l.prevHash
+	line, hash, err := encode(e)
+	if err != nil {
+		return fmt.Errorf("encoding audit entry: %w", err)
+	}
+
+	if l.size > 0 && (l.size+int64(len(line)) > l.cfg.MaxBytes || now.Sub(l.openedAt) >= l.cfg.MaxAge.Duration) {
+		if err := l.rotate(now); err != nil {
+			return err
+		}
+	}
+
+	if _, err := l.file.Write(line); err != nil {
+		return fmt.Errorf("writing audit entry: %w", err)
+	}
+	if err := l.file.Sync(); err != nil {
+		return fmt.Errorf("syncing audit log: %w", err)
+	}
+	if l.size == 0 {
+		l.openedAt = e.Time
+	}
+	l.size += int64(len(line))
+	l.seq, l.prevHash = e.Seq, hash
+	e.Hash = hash
+	return nil
+}
+
+// rotate renames the active file aside, compressing it if configured, and
+// starts a new one.
+func (l *Log) rotate(now time.Time) error {
+	// The open file is renamed, so a failure here leaves it in use.
+	rotated := l.rotatedPath(now)
+	if err := os.Rename(l.cfg.Path, rotated); err != nil {
+		return fmt.Errorf("rotating audit log: %w", err)
+	}
+	f, err := os.OpenFile(l.cfg.Path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("opening audit log: %w", err)
+	}
+	if err := l.file.Close(); err != nil {
+		l.logger.Warn("failed to close rotated audit log", zap.String("path", rotated), zap.Error(err))
+	}
+	l.file, l.size = f, 0
+
+	if l.cfg.Compress {
+		if err := compress(rotated); err != nil {
+			// The rotated file is intact, just not compressed.
+			l.logger.Warn("failed to compress rotated audit log",
+				zap.String("path", rotated),
+				zap.Error(err),
+			)
+		} else {
+			rotated += ".gz"
+		}
+	}
+	l.logger.Info("audit log rotated",
+		zap.String("rotated_path", rotated),
+		zap.Uint64("seq", l.seq),
+	)
+	return nil
+}
+
+// rotatedPath returns an unused name for the active file rotated at now.
+func (l *Log) rotatedPath(now time.Time) string {
+	ext := filepath.Ext(l.cfg.Path)
+	for {
+		path := strings.TrimSuffix(l.cfg.Path, ext) + "-" + now.Format(rotatedTimeFormat) + ext
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			if _, err := os.Stat(path + ".gz"); errors.Is(err, os.ErrNotExist) {
+				return path
+			}
+		}
+		now = now.Add(time.Nanosecond)
+	}
+}
+
+// Close closes the log file. Entries recorded afterwards are rejected.
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// encode returns the line for e, whose PrevHash is set, and the entry's hash:
+// the SHA-256 of the previous hash followed by the entry's JSON without its
+// hash. The hash is then appended as the last field of the object.
+func encode(e *Entry) ([]byte, string, error) {
+	e.Hash = ""
+	body, err := json.Marshal(e)
+	if err != nil {
+		return nil, "", err
+	}
+	hash := chainHash(e.PrevHash, body)
+	line := make([]byte, 0, len(body)+len(hash)+12)
+	line = append(line, body[:len(body)-1]...)
+	line = append(line, `,"hash":"`...)
+	line = append(line, hash...)
+	line = append(line, "\"}\n"...)
+	return line, hash, nil
+}
+
+// chainHash hashes an entry body onto the previous hash.
+func chainHash(prevHash string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(prevHash))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// parseLine decodes an audit log line.
+func parseLine(line []byte) (*Entry, error) {
+	var e Entry
+	if err := json.Unmarshal(line, &e); err != nil {
+		return nil, fmt.Errorf("invalid entry: %w", err)
+	}
+	return &e, nil
+}
+
+// compress gzips path to path.gz and removes path.
+func compress(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := path + ".gz.tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o640)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path+".gz")
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(path)
+}
+
+// rotatedFiles returns the rotated files of the log at path, oldest first.
+func rotatedFiles(path string) ([]string, error) {
+	ext := filepath.Ext(path)
+	prefix := strings.TrimSuffix(path, ext) + "-"
+	matches, err := filepath.Glob(globEscape(prefix) + "*")
+	if err != nil {
+		return nil, fmt.Errorf("listing rotated audit logs: %w", err)
+	}
+	var files []string
+	for _, m := range matches {
+		stamp, ok := strings.CutSuffix(strings.TrimSuffix(m[len(prefix):], ".gz"), ext)
+		if !ok {
+			continue
+		}
+		if _, err := time.Parse(rotatedTimeFormat, stamp); err != nil {
+			continue
+		}
+		files = append(files, m)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// globEscape escapes the glob metacharacters in s.
+func globEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// readLines calls fn with each line of the file at path, decompressing it if
+// its name ends in .gz. Line numbers start at 1.
+func readLines(path string, fn func(n int, line []byte) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), 64<<20)
+	for n := 1; scanner.Scan(); n++ {
+		if err := fn(n, scanner.Bytes()); err != nil {
+			return fmt.Errorf("line %d: %w", n, err)
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,242 @@
+package audit
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/bryonbaker/beacon/internal/config"
+)
+
+func testConfig(t *testing.T) config.AuditConfig {
+	t.Helper()
+	return config.AuditConfig{
+		Enabled:  true,
+		Path:     filepath.Join(t.TempDir(), "audit", "audit.jsonl"),
+		MaxBytes: 1 << 20,
+		MaxAge:   config.Duration{Duration: time.Hour},
+	}
+}
+
+func openLog(t *testing.T, cfg config.AuditConfig, now *time.Time) *Log {
+	t.Helper()
+	l, err := Open(cfg, zap.NewNop())
+	require.NoError(t, err)
+	l.now = func() time.Time { return *now }
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+func attempt(objectID string) *Entry {
+	return &Entry{
+		Kind:        KindAttempt,
+		ObjectID:    objectID,
+		EventType:   "created",
+		Destination: "https://example.com/events",
+		Event:       []byte(`{"specversion":"1.0","id":"` + objectID + `"}`),
+		Result:      "success",
+		StatusCode:  200,
+	}
+}
+
+func TestRecordChainsEntries(t *testing.T) {
+	cfg := testConfig(t)
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	l := openLog(t, cfg, &now)
+
+	first := attempt("obj-1")
+	require.NoError(t, l.Record(first))
+	second := &Entry{Kind: KindTransition, ObjectID: "obj-1", State: "sent"}
+	require.NoError(t, l.Record(second))
+
+	assert.Equal(t, uint64(1), first.Seq)
+	assert.Equal(t, GenesisHash, first.PrevHash)
+	assert.Equal(t, uint64(2), second.Seq)
+	assert.Equal(t, first.Hash, second.PrevHash)
+	assert.Equal(t, now, second.Time)
+
+	data, err := os.ReadFile(cfg.Path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[0], `"event":{"specversion":"1.0","id":"obj-1"}`)
+	assert.True(t, strings.HasSuffix(lines[1], `"hash":"`+second.Hash+`"}`))
+
+	result, err := Verify(cfg.Path)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), result.Entries)
+	assert.Equal(t, second.Hash, result.Head)
+}
+
+func TestRecordRotatesBySize(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.MaxBytes = 400
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	l := openLog(t, cfg, &now)
+
+	for i := 0; i < 5; i++ {
+		now = now.Add(time.Second)
+		require.NoError(t, l.Record(attempt("obj-1")))
+	}
+
+	rotated, err := rotatedFiles(cfg.Path)
+	require.NoError(t, err)
+	assert.Len(t, rotated, 4, "each entry fills a file")
+
+	result, err := Verify(cfg.Path)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), result.Entries)
+	assert.Len(t, result.Files, 5)
+}
+
+func TestRecordRotatesByAgeAndCompresses(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Compress = true
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	l := openLog(t, cfg, &now)
+
+	require.NoError(t, l.Record(attempt("obj-1")))
+	now = now.Add(30 * time.Minute)
+	require.NoError(t, l.Record(attempt("obj-2")))
+	now = now.Add(30 * time.Minute)
+	require.NoError(t, l.Record(attempt("obj-3")))
+
+	rotated, err := rotatedFiles(cfg.Path)
+	require.NoError(t, err)
+	require.Len(t, rotated, 1)
+	assert.Equal(t, "audit-20260102T040405.000000000Z.jsonl.gz", filepath.Base(rotated[0]))
+
+	result, err := Verify(cfg.Path)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), result.Entries)
+}
+
+func TestOpenContinuesChain(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.MaxBytes = 400
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	l := openLog(t, cfg, &now)
+	require.NoError(t, l.Record(attempt("obj-1")))
+	require.NoError(t, l.Record(attempt("obj-2")))
+	require.NoError(t, l.Close())
+
+	// A crash mid-write leaves an incomplete line.
+	f, err := os.OpenFile(cfg.Path, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"seq":3,"time":`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	l = openLog(t, cfg, &now)
+	e := attempt("obj-3")
+	require.NoError(t, l.Record(e))
+	assert.Equal(t, uint64(3), e.Seq)
+
+	result, err := Verify(cfg.Path)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), result.Entries)
+}
+
+func TestOpenContinuesChainAfterRotation(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Compress = true
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	l := openLog(t, cfg, &now)
+	require.NoError(t, l.Record(attempt("obj-1")))
+	now = now.Add(time.Hour)
+	require.NoError(t, l.Record(attempt("obj-2")))
+	require.NoError(t, l.Close())
+
+	// The active file is empty when the log was rotated and nothing has
+	// been written since.
+	now = now.Add(time.Hour)
+	require.NoError(t, os.Rename(cfg.Path, l.rotatedPath(now)))
+
+	l = openLog(t, cfg, &now)
+	e := attempt("obj-3")
+	require.NoError(t, l.Record(e))
+	assert.Equal(t, uint64(3), e.Seq)
+
+	result, err := Verify(cfg.Path)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), result.Entries)
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name    string
+		tamper  func(lines [][]byte) [][]byte
+		wantErr string
+	}{
+		{
+			name: "edited entry",
+			tamper: func(lines [][]byte) [][]byte {
+				lines[1] = bytes.Replace(lines[1], []byte(`"status_code":200`), []byte(`"status_code":500`), 1)
+				return lines
+			},
+			wantErr: "audit.jsonl: line 2: seq 2: hash does not match entry content",
+		},
+		{
+			name: "removed entry",
+			tamper: func(lines [][]byte) [][]byte {
+				return append(lines[:1], lines[2:]...)
+			},
+			wantErr: "line 2: expected seq 2, found 3",
+		},
+		{
+			name: "reordered entries",
+			tamper: func(lines [][]byte) [][]byte {
+				lines[1], lines[2] = lines[2], lines[1]
+				return lines
+			},
+			wantErr: "line 2: expected seq 2, found 3",
+		},
+		{
+			name: "missing hash",
+			tamper: func(lines [][]byte) [][]byte {
+				lines[0] = []byte(`{"seq":1}`)
+				return lines
+			},
+			wantErr: "line 1: entry has no hash",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+			l := openLog(t, cfg, &now)
+			for _, id := range []string{"obj-1", "obj-2", "obj-3"} {
+				require.NoError(t, l.Record(attempt(id)))
+			}
+			require.NoError(t, l.Close())
+
+			data, err := os.ReadFile(cfg.Path)
+			require.NoError(t, err)
+			lines := tc.tamper(bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n")))
+			require.NoError(t, os.WriteFile(cfg.Path, append(bytes.Join(lines, []byte("\n")), '\n'), 0o640))
+
+			_, err = Verify(cfg.Path)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.wantErr)
+		})
+	}
+}
+
+func TestVerifyMissingLog(t *testing.T) {
+	_, err := Verify(filepath.Join(t.TempDir(), "audit.jsonl"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no audit log found")
+}
+
+func TestNilLogDiscardsEntries(t *testing.T) {
+	var l *Log
+	assert.NoError(t, l.Record(attempt("obj-1")))
+	assert.NoError(t, l.Close())
+}
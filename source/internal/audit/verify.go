@@ -0,0 +1,86 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// hashSuffix matches the hash field that ends every audit log line.
+var hashSuffix = regexp.MustCompile(`,"hash":"([0-9a-f]{64})"}$`)
+
+// VerifyResult summarises a verified audit log.
+type VerifyResult struct {
+	Files   []string // files verified, oldest first
+	Entries uint64   // entries verified
+	Head    string   // hash of the last entry
+}
+
+// Verify checks the hash chain of the audit log at path, including its
+// rotated files, from the first entry written. It returns an error naming
+// the file and line of the first entry that is malformed, out of sequence,
+// not linked to the entry before it, or whose content does not match its
+// hash.
+func Verify(path string) (*VerifyResult, error) {
+	files, err := rotatedFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); err == nil {
+		files = append(files, path)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("reading audit log: %w", err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no audit log found at %s", path)
+	}
+
+	result := &VerifyResult{Files: files, Head: GenesisHash}
+	for _, file := range files {
+		err := readLines(file, func(_ int, line []byte) error {
+			hash, err := verifyLine(line, result.Entries+1, result.Head)
+			if err != nil {
+				return err
+			}
+			result.Entries++
+			result.Head = hash
+			return nil
+		})
+		if err != nil {
+			return result, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	return result, nil
+}
+
+// verifyLine checks that line is entry seq and chains onto prevHash, and
+// returns its hash.
+func verifyLine(line []byte, seq uint64, prevHash string) (string, error) {
+	m := hashSuffix.FindSubmatchIndex(line)
+	if m == nil {
+		return "", errors.New("entry has no hash")
+	}
+	hash := string(line[m[2]:m[3]])
+	body := append(bytes.Clone(line[:m[0]]), '}')
+
+	var e struct {
+		Seq      uint64 `json:"seq"`
+		PrevHash string `json:"prev_hash"`
+	}
+	if err := json.Unmarshal(body, &e); err != nil {
+		return "", fmt.Errorf("invalid entry: %w", err)
+	}
+	if e.Seq != seq {
+		return "", fmt.Errorf("expected seq %d, found %d", seq, e.Seq)
+	}
+	if e.PrevHash != prevHash {
+		return "", fmt.Errorf("seq %d: prev_hash does not match the hash of the previous entry", seq)
+	}
+	if chainHash(prevHash, body) != hash {
+		return "", fmt.Errorf("seq %d: hash does not match entry content", seq)
+	}
+	return hash, nil
+}
@@ -0,0 +1,189 @@
+// Package backup implements scheduled online backups of the beacon database.
+// Each backup is a consistent copy taken while the service runs, checked for
+// integrity, kept in a local directory with a bounded number of copies, and
+// optionally uploaded to S3-compatible object storage.
+package backup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/bryonbaker/beacon/internal/config"
+	"github.com/bryonbaker/beacon/internal/database"
+	"github.com/bryonbaker/beacon/internal/metrics"
+)
+
+// timeFormat names backups so that they sort in the order they were taken.
+const timeFormat = "20060102T150405Z"
+
+// Backup periodically writes backups of the database.
+type Backup struct {
+	db       database.Database
+	cfg      *config.Config
+	uploader *s3Uploader
+	metrics  *metrics.Metrics
+	logger   *zap.Logger
+	now      func() time.Time
+}
+
+// NewBackup creates a Backup of db. When S3 upload is enabled, each backup is
+// also uploaded to the configured bucket.
+func NewBackup(db database.Database, cfg *config.Config, m *metrics.Metrics, logger *zap.Logger) *Backup {
+	b := &Backup{
+		db:      db,
+		cfg:     cfg,
+		metrics: m,
+		logger:  logger,
+		now:     time.Now,
+	}
+	if cfg.Backup.S3.Enabled {
+		b.uploader = newS3Uploader(cfg.Backup.S3)
+	}
+	return b
+}
+
+// Start begins the backup loop, running at the configured backup interval.
+// The loop stops when ctx is cancelled.
+func (b *Backup) Start(ctx context.Context) {
+	ticker := time.NewTicker(b.cfg.Backup.Interval.Duration)
+	defer ticker.Stop()
+
+	b.logger.Info("backup started",
+		zap.Duration("interval", b.cfg.Backup.Interval.Duration),
+		zap.String("dir", b.cfg.Backup.Dir),
+		zap.Int("retain", b.cfg.Backup.Retain),
+		zap.Bool("s3", b.uploader != nil),
+	)
+
+	for {
+		select {
+		case <-ctx.Done():
+			b.logger.Info("backup stopping", zap.Error(ctx.Err()))
+			return
+		case <-ticker.C:
+			if _, err := b.Run(ctx); err != nil {
+				b.logger.Error("backup failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Run takes one backup, checks it, uploads it if configured, and removes the
+// oldest local backups beyond the number to retain. It returns the path of
+// the backup. A backup that fails its check is removed; one that fails to
+// upload is kept.
+func (b *Backup) Run(ctx context.Context) (string, error) {
+	start := time.Now()
+	path, size, err := b.run(ctx)
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	// Backups report through their own metrics rather than the component
+	// health, so that an unreachable object store does not fail readiness.
+	b.metrics.RecordBackup(status, time.Since(start), size)
+	if err != nil {
+		return path, err
+	}
+
+	b.logger.Info("backup completed",
+		zap.String("path", path),
+		zap.Int64("size_bytes", size),
+		zap.Duration("duration", time.Since(start)),
+	)
+	return path, nil
+}
+
+func (b *Backup) run(ctx context.Context) (string, int64, error) {
+	dir := b.cfg.Backup.Dir
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return "", 0, fmt.Errorf("creating backup directory: %w", err)
+	}
+
+	// Write to a temporary name so that an interrupted backup is never
+	// mistaken for a complete one.
+	name := fmt.Sprintf("%s-%s.db", b.stem(), b.now().UTC().Format(timeFormat))
+	path := filepath.Join(dir, name)
+	tmp := path + ".tmp"
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return "", 0, fmt.Errorf("removing incomplete backup: %w", err)
+	}
+	if err := b.db.BackupTo(tmp); err != nil {
+		os.Remove(tmp)
+		return "", 0, fmt.Errorf("writing backup: %w", err)
+	}
+	if _, err := database.VerifyFile(tmp); err != nil {
+		os.Remove(tmp)
+		return "", 0, fmt.Errorf("checking backup: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", 0, fmt.Errorf("saving backup: %w", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return path, 0, fmt.Errorf("reading backup: %w", err)
+	}
+
+	b.prune()
+
+	if b.uploader != nil {
+		key := b.cfg.Backup.S3.Prefix + name
+		if err := b.uploader.upload(ctx, key, path); err != nil {
+			return path, info.Size(), fmt.Errorf("uploading backup to s3://%s/%s: %w", b.cfg.Backup.S3.Bucket, key, err)
+		}
+		b.logger.Info("backup uploaded",
+			zap.String("bucket", b.cfg.Backup.S3.Bucket),
+			zap.String("key", key),
+		)
+	}
+	return path, info.Size(), nil
+}
+
+// prune removes the oldest local backups beyond the number to retain.
+func (b *Backup) prune() {
+	backups, err := b.List()
+	if err != nil {
+		b.logger.Warn("failed to list backups for pruning", zap.Error(err))
+		return
+	}
+	for len(backups) > b.cfg.Backup.Retain {
+		if err := os.Remove(backups[0]); err != nil {
+			b.logger.Warn("failed to remove old backup", zap.String("path", backups[0]), zap.Error(err))
+		} else {
+			b.logger.Info("removed old backup", zap.String("path", backups[0]))
+		}
+		backups = backups[1:]
+	}
+}
+
+// List returns the paths of the local backups, oldest first.
+func (b *Backup) List() ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(b.cfg.Backup.Dir, b.stem()+"-*.db"))
+	if err != nil {
+		return nil, err
+	}
+	var backups []string
+	for _, m := range matches {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(m), b.stem()+"-"), ".db")
+		if _, err := time.Parse(timeFormat, stamp); err == nil {
+			backups = append(backups, m)
+		}
+	}
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// stem returns the database file name without its extension, which names
+// its backups.
+func (b *Backup) stem() string {
+	base := filepath.Base(b.cfg.Storage.DBPath)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
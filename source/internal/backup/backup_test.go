@@ -0,0 +1,216 @@
+package backup
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/bryonbaker/beacon/internal/config"
+	"github.com/bryonbaker/beacon/internal/database"
+	"github.com/bryonbaker/beacon/internal/metrics"
+	"github.com/bryonbaker/beacon/internal/models"
+)
+
+func testConfig(t *testing.T) *config.Config {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Storage.DBPath = filepath.Join(dir, "events.db")
+	cfg.Backup = config.BackupConfig{
+		Enabled:  true,
+		Interval: config.Duration{Duration: time.Hour},
+		Dir:      filepath.Join(dir, "backups"),
+		Retain:   2,
+	}
+	return cfg
+}
+
+func newTestBackup(t *testing.T, cfg *config.Config) (*Backup, *metrics.Metrics) {
+	t.Helper()
+	db, err := database.NewSQLiteDB(cfg.Storage.DBPath, zap.NewNop())
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	require.NoError(t, db.InsertManagedObject(&models.ManagedObject{
+		ID:           "id-1",
+		ResourceUID:  "uid-1",
+		ResourceType: "Pod",
+		ResourceName: "web",
+		ClusterState: models.ClusterStateExists,
+		CreatedAt:    time.Now(),
+	}))
+
+	m := metrics.NewMetrics(prometheus.NewRegistry())
+	return NewBackup(db, cfg, m, zap.NewNop()), m
+}
+
+func TestRunWritesCheckedBackup(t *testing.T) {
+	cfg := testConfig(t)
+	b, m := newTestBackup(t, cfg)
+	b.now = func() time.Time { return time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	path, err := b.Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(cfg.Backup.Dir, "events-20260102T030405Z.db"), path)
+	assert.NoFileExists(t, path+".tmp")
+
+	version, err := database.VerifyFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, database.SchemaVersion, version)
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.BackupRunsTotal.WithLabelValues("success")))
+	assert.Greater(t, testutil.ToFloat64(m.BackupSizeBytes), float64(0))
+}
+
+func TestRunKeepsNewestBackups(t *testing.T) {
+	cfg := testConfig(t)
+	b, _ := newTestBackup(t, cfg)
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	b.now = func() time.Time { return now }
+
+	var paths []string
+	for i := 0; i < 4; i++ {
+		path, err := b.Run(context.Background())
+		require.NoError(t, err)
+		paths = append(paths, path)
+		now = now.Add(time.Hour)
+	}
+
+	// Files that are not backups are left alone.
+	other := filepath.Join(cfg.Backup.Dir, "events-notes.db")
+	require.NoError(t, os.WriteFile(other, nil, 0o640))
+
+	backups, err := b.List()
+	require.NoError(t, err)
+	assert.Equal(t, paths[2:], backups)
+	assert.FileExists(t, other)
+}
+
+func TestRunRecordsFailure(t *testing.T) {
+	cfg := testConfig(t)
+	b, m := newTestBackup(t, cfg)
+	require.NoError(t, os.WriteFile(filepath.Join(filepath.Dir(cfg.Backup.Dir), "blocker"), nil, 0o640))
+	cfg.Backup.Dir = filepath.Join(filepath.Dir(cfg.Backup.Dir), "blocker", "backups")
+
+	_, err := b.Run(context.Background())
+	require.Error(t, err)
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.BackupRunsTotal.WithLabelValues("error")))
+	assert.Equal(t, float64(0), testutil.ToFloat64(m.BackupLastSuccess))
+}
+
+// fakeS3 is an S3 endpoint that checks the Signature Version 4 signature of
+// PUT Object requests and stores the objects.
+type fakeS3 struct {
+	secret string
+	region string
+
+	mu      sync.Mutex
+	objects map[string][]byte
+	status  int
+}
+
+var authorizationPattern = regexp.MustCompile(`^AWS4-HMAC-SHA256 Credential=([^/]+)/(\d{8})/([^/]+)/s3/aws4_request, SignedHeaders=([^,]+), Signature=([0-9a-f]{64})$`)
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	m := authorizationPattern.FindStringSubmatch(r.Header.Get("Authorization"))
+	if m == nil || m[3] != s.region || m[4] != "host;x-amz-content-sha256;x-amz-date" {
+		http.Error(w, "malformed authorization", http.StatusForbidden)
+		return
+	}
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash != sha256Hex(body) {
+		http.Error(w, "content hash mismatch", http.StatusBadRequest)
+		return
+	}
+	canonical := strings.Join([]string{r.Method, r.URL.EscapedPath(), "",
+		"host:" + r.Host, "x-amz-content-sha256:" + payloadHash, "x-amz-date:" + r.Header.Get("X-Amz-Date"), "",
+		m[4], payloadHash}, "\n")
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", r.Header.Get("X-Amz-Date"),
+		m[2] + "/" + m[3] + "/s3/aws4_request", sha256Hex([]byte(canonical))}, "\n")
+	if hex.EncodeToString(hmacSHA256(signingKey(s.secret, m[2], m[3], "s3"), []byte(stringToSign))) != m[5] {
+		http.Error(w, "signature mismatch", http.StatusForbidden)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.status != 0 {
+		http.Error(w, "<Error><Code>SlowDown</Code></Error>", s.status)
+		return
+	}
+	s.objects[r.URL.Path] = body
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestRunUploadsToS3(t *testing.T) {
+	s3 := &fakeS3{secret: "minio-secret", region: "us-east-1", objects: map[string][]byte{}}
+	srv := httptest.NewServer(s3)
+	defer srv.Close()
+
+	cfg := testConfig(t)
+	cfg.Backup.S3 = config.BackupS3Config{
+		Enabled:         true,
+		Endpoint:        srv.URL,
+		Region:          "us-east-1",
+		Bucket:          "beacon-backups",
+		Prefix:          "prod/",
+		PathStyle:       true,
+		Timeout:         config.Duration{Duration: time.Minute},
+		AccessKeyID:     "minioadmin",
+		SecretAccessKey: "minio-secret",
+	}
+	b, m := newTestBackup(t, cfg)
+	b.now = func() time.Time { return time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	path, err := b.Run(context.Background())
+	require.NoError(t, err)
+	local, err := os.ReadFile(path)
+	require.NoError(t, err)
+	s3.mu.Lock()
+	assert.Equal(t, local, s3.objects["/beacon-backups/prod/events-20260102T030405Z.db"])
+	// A failed upload fails the run but keeps the local backup.
+	s3.status = http.StatusServiceUnavailable
+	s3.mu.Unlock()
+	b.now = func() time.Time { return time.Date(2026, 1, 2, 4, 4, 5, 0, time.UTC) }
+	path, err = b.Run(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unexpected status 503")
+	assert.FileExists(t, path)
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.BackupRunsTotal.WithLabelValues("error")))
+}
+
+func TestObjectURL(t *testing.T) {
+	u := newS3Uploader(config.BackupS3Config{Endpoint: "https://s3.eu-west-1.amazonaws.com", Bucket: "backups"})
+	assert.Equal(t, "https://backups.s3.eu-west-1.amazonaws.com/prod/events%2B1.db", u.objectURL("prod/events+1.db"))
+
+	u.cfg.PathStyle = true
+	u.cfg.Endpoint = "http://minio:9000/"
+	assert.Equal(t, "http://minio:9000/backups/events.db", u.objectURL("events.db"))
+}
+
+// TestSigningKey checks key derivation against the example in the AWS
+// Signature Version 4 documentation.
+func TestSigningKey(t *testing.T) {
+	key := signingKey("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "20120215", "us-east-1", "iam")
+	assert.Equal(t, "f4780e2d9f65fa895f9c67b32ce1baf0b0d8a43505a000a1a9e090d414db404d", hex.EncodeToString(key))
+}
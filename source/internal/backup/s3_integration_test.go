@@ -0,0 +1,47 @@
+//go:build integration
+
+package backup
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bryonbaker/beacon/internal/config"
+)
+
+// TestUploadToS3Compatible uploads a backup to a real S3-compatible store,
+// such as a local MinIO:
+//
+//	podman run -d -p 9000:9000 quay.io/minio/minio server /data
+//	mc alias set local http://localhost:9000 minioadmin minioadmin
+//	mc mb local/beacon-backups
+//	BACKUP_S3_TEST_ENDPOINT=http://localhost:9000 BACKUP_S3_TEST_BUCKET=beacon-backups \
+//	BACKUP_S3_ACCESS_KEY_ID=minioadmin BACKUP_S3_SECRET_ACCESS_KEY=minioadmin \
+//	go test -tags integration ./internal/backup/ -run TestUploadToS3Compatible
+func TestUploadToS3Compatible(t *testing.T) {
+	endpoint := os.Getenv("BACKUP_S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("BACKUP_S3_TEST_ENDPOINT is not set")
+	}
+
+	cfg := testConfig(t)
+	cfg.Backup.S3 = config.BackupS3Config{
+		Enabled:         true,
+		Endpoint:        endpoint,
+		Region:          "us-east-1",
+		Bucket:          os.Getenv("BACKUP_S3_TEST_BUCKET"),
+		Prefix:          "integration/",
+		PathStyle:       true,
+		Timeout:         config.Duration{Duration: time.Minute},
+		AccessKeyID:     os.Getenv("BACKUP_S3_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("BACKUP_S3_SECRET_ACCESS_KEY"),
+	}
+	b, _ := newTestBackup(t, cfg)
+
+	_, err := b.Run(context.Background())
+	require.NoError(t, err)
+}
@@ -0,0 +1,51 @@
+package cleaner
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bryonbaker/beacon/internal/models"
+)
+
+// archivedRecord is a line of an archive file.
+type archivedRecord struct {
+	ArchivedAt time.Time             `json:"archived_at"`
+	Policy     string                `json:"policy"`
+	Record     *models.ManagedObject `json:"record"`
+}
+
+// archive appends records to a JSON Lines file in dir, one file per
+// retention policy and UTC day, e.g. failed-2025-06-01.jsonl. A batch is
+// synced to disk before write returns, so records are deleted only once they
+// are archived. A batch whose deletion fails is archived again by the next
+// run, so a record may appear more than once.
+func archive(dir, policy string, objs []*models.ManagedObject, now time.Time) error {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return fmt.Errorf("creating archive directory: %w", err)
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s.jsonl", policy, now.UTC().Format("2006-01-02")))
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("opening archive: %w", err)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, obj := range objs {
+		if err := enc.Encode(archivedRecord{ArchivedAt: now, Policy: policy, Record: obj}); err != nil {
+			return fmt.Errorf("writing archive: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("writing archive: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("syncing archive: %w", err)
+	}
+	return f.Close()
+}
@@ -1,11 +1,13 @@
-// Package cleaner implements the periodic cleanup loop that removes old,
-// fully-notified deleted records from the database to prevent unbounded
-// growth of the managed_objects table.
+// Package cleaner implements the periodic cleanup loop that removes old
+// records from the database to prevent unbounded growth of the
+// managed_objects table. Each record state has its own retention policy, and
+// records may be archived to JSON Lines files before they are removed.
 package cleaner
 
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
@@ -13,15 +15,19 @@ import (
 	"github.com/bryonbaker/beacon/internal/config"
 	"github.com/bryonbaker/beacon/internal/database"
 	"github.com/bryonbaker/beacon/internal/metrics"
+	"github.com/bryonbaker/beacon/internal/models"
 )
 
-// Cleaner periodically removes database records that have been in the deleted
-// state long enough and whose notifications have been successfully sent.
+// Cleaner periodically removes database records that have outlived their
+// retention policy: delivered records deleted long enough ago and, if
+// configured, permanently failed and stale records.
 type Cleaner struct {
 	db      database.Database
 	cfg     *config.Config
 	metrics *metrics.Metrics
 	logger  *zap.Logger
+
+	mu sync.Mutex // held for a cleanup pass
 }
 
 // NewCleaner creates a new Cleaner with the provided dependencies.
@@ -58,66 +64,59 @@ func (c *Cleaner) Start(ctx context.Context) {
 	}
 }
 
-// Cleanup performs a single cleanup pass. It queries for records that are
-// eligible for deletion (deleted, fully notified, and older than the retention
-// period), removes them, runs an incremental vacuum to reclaim space, and
-// updates metrics.
+// Cleanup performs a single cleanup pass. Each retention policy removes the
+// records it expires: delivered records deleted longer ago than the retention
+// period, and permanently failed and stale records if their policies are
+// enabled. Records are archived first where configured. The pass then runs
+// an incremental vacuum to reclaim space and updates metrics.
 func (c *Cleaner) Cleanup(ctx context.Context) error {
-	start := time.Now()
-
-	// Query records eligible for cleanup.
-	eligible, err := c.db.GetCleanupEligible(c.cfg.Retention.RetentionPeriod.Duration)
-	if err != nil {
-		c.metrics.CleanupRunsTotal.WithLabelValues("error").Inc()
-		return fmt.Errorf("querying cleanup-eligible records: %w", err)
-	}
-
-	c.metrics.CleanupRecordsEligible.Set(float64(len(eligible)))
+	return c.CleanupOlderThan(ctx, c.cfg.Retention.RetentionPeriod.Duration)
+}
 
-	if len(eligible) == 0 {
-		c.logger.Debug("no records eligible for cleanup")
-		c.metrics.CleanupRunsTotal.WithLabelValues("success").Inc()
-		c.metrics.CleanupDuration.Observe(time.Since(start).Seconds())
-		return nil
-	}
+// CleanupOlderThan performs a cleanup pass with retention in place of the
+// configured retention period of delivered records. The storage monitor uses
+// it to free space early under storage pressure. Passes run one at a time.
+func (c *Cleaner) CleanupOlderThan(ctx context.Context, retention time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	// Track the oldest record age for metrics.
-	var oldestAge time.Duration
-	for _, obj := range eligible {
-		if obj.DeletedAt != nil {
-			age := time.Since(*obj.DeletedAt)
-			if age > oldestAge {
-				oldestAge = age
-			}
-		}
+	start := time.Now()
+	policies := c.policies(retention)
+	if err := c.countEligible(policies, start); err != nil {
+		c.metrics.CleanupRunsTotal.WithLabelValues("error").Inc()
+		c.metrics.RecordComponentHealth("cleaner", false)
+		return err
 	}
-	c.metrics.CleanupOldestRecordAge.Set(oldestAge.Seconds())
 
-	// Delete each eligible record.
 	deleted := 0
-	for _, obj := range eligible {
-		select {
-		case <-ctx.Done():
+	var oldestAge time.Duration
+	for _, p := range policies {
+		n, age, err := c.cleanupPolicy(ctx, p, start)
+		deleted += n
+		oldestAge = max(oldestAge, age)
+		if ctx.Err() != nil {
 			c.logger.Info("cleanup interrupted by context cancellation",
 				zap.Int("deleted_so_far", deleted),
 			)
 			c.metrics.CleanupRunsTotal.WithLabelValues("interrupted").Inc()
 			return ctx.Err()
-		default:
 		}
-
-		if err := c.db.DeleteRecord(obj.ID); err != nil {
-			c.logger.Error("failed to delete record",
-				zap.String("id", obj.ID),
-				zap.String("resource_uid", obj.ResourceUID),
-				zap.Error(err),
-			)
-			continue
+		if err != nil {
+			c.metrics.CleanupRunsTotal.WithLabelValues("error").Inc()
+			c.metrics.RecordComponentHealth("cleaner", false)
+			return fmt.Errorf("cleaning up %s records: %w", p.name, err)
 		}
-		deleted++
 	}
 
-	c.metrics.CleanupRecordsDeleted.Add(float64(deleted))
+	c.metrics.CleanupOldestRecordAge.Set(oldestAge.Seconds())
+
+	if deleted == 0 {
+		c.logger.Debug("no records eligible for cleanup")
+		c.metrics.CleanupRunsTotal.WithLabelValues("success").Inc()
+		c.metrics.CleanupDuration.Observe(time.Since(start).Seconds())
+		c.metrics.RecordComponentHealth("cleaner", true)
+		return nil
+	}
 
 	// Run incremental vacuum to reclaim disk space.
 	if err := c.db.RunIncrementalVacuum(); err != nil {
@@ -128,12 +127,131 @@ func (c *Cleaner) Cleanup(ctx context.Context) error {
 	duration := time.Since(start)
 	c.metrics.CleanupDuration.Observe(duration.Seconds())
 	c.metrics.CleanupRunsTotal.WithLabelValues("success").Inc()
+	c.metrics.RecordComponentHealth("cleaner", true)
 
 	c.logger.Info("cleanup completed",
-		zap.Int("eligible", len(eligible)),
+		zap.Duration("retention", retention),
 		zap.Int("deleted", deleted),
 		zap.Duration("duration", duration),
 	)
 
 	return nil
 }
+
+// policy is a retention policy: the records in state name expire period
+// after the time returned by expiredSince.
+type policy struct {
+	name    string
+	period  time.Duration
+	archive bool
+}
+
+// policies returns the enabled retention policies, with delivered records
+// kept for retention.
+func (c *Cleaner) policies(retention time.Duration) []policy {
+	r := c.cfg.Retention
+	policies := []policy{{name: models.RetentionDelivered, period: retention, archive: r.Archive}}
+	if r.Failed.Period.Duration > 0 {
+		policies = append(policies, policy{name: models.RetentionFailed, period: r.Failed.Period.Duration, archive: r.Failed.Archive})
+	}
+	if period := c.cfg.StalePeriod(); period > 0 {
+		policies = append(policies, policy{name: models.RetentionStale, period: period, archive: r.Stale.Archive})
+	}
+	return policies
+}
+
+// countEligible sets the eligible records metric to the number of records
+// that policies expire at now.
+func (c *Cleaner) countEligible(policies []policy, now time.Time) error {
+	eligible := 0
+	for _, p := range policies {
+		n, err := c.db.CountExpiredRecords(p.name, now.Add(-p.period), c.cfg.ResourceKinds())
+		if err != nil {
+			return fmt.Errorf("counting expired %s records: %w", p.name, err)
+		}
+		eligible += n
+	}
+	c.metrics.CleanupRecordsEligible.Set(float64(eligible))
+	return nil
+}
+
+// cleanupPolicy removes the records that p expires at now, oldest first. Each
+// batch of at most retention.batchSize records is read, archived if p says
+// so, and deleted in one transaction, so that memory use is bounded and a
+// record is never deleted without being archived. It returns the number of
+// records deleted and the age of the oldest.
+func (c *Cleaner) cleanupPolicy(ctx context.Context, p policy, now time.Time) (int, time.Duration, error) {
+	cutoff := now.Add(-p.period)
+	watched := c.cfg.ResourceKinds()
+	limit := c.cfg.Retention.BatchSize
+	deleted := 0
+	var oldestAge time.Duration
+	for ctx.Err() == nil {
+		var batch []*models.ManagedObject
+		err := c.db.WithTx(func(tx database.Database) error {
+			var err error
+			batch, err = tx.GetExpiredRecords(p.name, cutoff, watched, limit)
+			if err != nil || len(batch) == 0 {
+				return err
+			}
+			if p.archive {
+				if err := archive(c.cfg.Retention.ArchiveDir, p.name, batch, now); err != nil {
+					return err
+				}
+			}
+			for _, obj := range batch {
+				if err := tx.DeleteRecord(obj.ID); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return deleted, oldestAge, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		if deleted == 0 {
+			oldestAge = now.Sub(expiredSince(p.name, batch[0]))
+		}
+		deleted += len(batch)
+		c.metrics.CleanupRecordsDeleted.Add(float64(len(batch)))
+		c.metrics.CleanupPolicyRecords.WithLabelValues(p.name, "deleted").Add(float64(len(batch)))
+		if p.archive {
+			c.metrics.CleanupPolicyRecords.WithLabelValues(p.name, "archived").Add(float64(len(batch)))
+		}
+		if len(batch) < limit {
+			break
+		}
+	}
+
+	if deleted > 0 {
+		c.logger.Info("removed expired records",
+			zap.String("policy", p.name),
+			zap.Duration("period", p.period),
+			zap.Int("deleted", deleted),
+			zap.Bool("archived", p.archive),
+		)
+	}
+	return deleted, oldestAge, ctx.Err()
+}
+
+// expiredSince returns the time from which the retention policy named policy
+// measures the age of obj.
+func expiredSince(policy string, obj *models.ManagedObject) time.Time {
+	var since *time.Time
+	switch policy {
+	case models.RetentionDelivered:
+		since = obj.DeletedAt
+	case models.RetentionFailed:
+		since = obj.LastNotificationAttempt
+	case models.RetentionStale:
+		since = obj.LastReconciled
+	}
+	if since == nil {
+		return obj.CreatedAt
+	}
+	return *since
+}
@@ -2,10 +2,14 @@ package cleaner
 
 import (
 	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -23,6 +27,7 @@ func newTestCleaner(mockDB *database.MockDatabase) *Cleaner {
 	cfg.Retention.Enabled = true
 	cfg.Retention.CleanupInterval.Duration = 1 * time.Hour
 	cfg.Retention.RetentionPeriod.Duration = 48 * time.Hour
+	cfg.Retention.BatchSize = 500
 
 	logger := zap.NewNop()
 	m := metrics.NewMetrics(prometheus.NewRegistry())
@@ -30,6 +35,13 @@ func newTestCleaner(mockDB *database.MockDatabase) *Cleaner {
 	return NewCleaner(mockDB, cfg, m, logger)
 }
 
+// cutoff matches the cutoff of a retention period that starts now.
+func cutoff(period time.Duration) interface{} {
+	return mock.MatchedBy(func(t time.Time) bool {
+		return time.Since(t.Add(period)).Abs() < time.Minute
+	})
+}
+
 // ---------------------------------------------------------------------------
 // Tests
 // ---------------------------------------------------------------------------
@@ -60,7 +72,8 @@ func TestCleanup_DeletesEligibleRecords(t *testing.T) {
 		},
 	}
 
-	mockDB.On("GetCleanupEligible", 48*time.Hour).Return(eligible, nil).Once()
+	mockDB.On("CountExpiredRecords", models.RetentionDelivered, cutoff(48*time.Hour), []string{}).Return(2, nil).Once()
+	mockDB.On("GetExpiredRecords", models.RetentionDelivered, cutoff(48*time.Hour), []string{}, 500).Return(eligible, nil).Once()
 	mockDB.On("DeleteRecord", "rec-1").Return(nil).Once()
 	mockDB.On("DeleteRecord", "rec-2").Return(nil).Once()
 	mockDB.On("RunIncrementalVacuum").Return(nil).Once()
@@ -69,6 +82,7 @@ func TestCleanup_DeletesEligibleRecords(t *testing.T) {
 
 	require.NoError(t, err)
 	mockDB.AssertExpectations(t)
+	assert.Equal(t, float64(2), testutil.ToFloat64(c.metrics.CleanupRecordsEligible))
 }
 
 func TestCleanup_VacuumCalledAfterDeletion(t *testing.T) {
@@ -87,7 +101,8 @@ func TestCleanup_VacuumCalledAfterDeletion(t *testing.T) {
 		},
 	}
 
-	mockDB.On("GetCleanupEligible", 48*time.Hour).Return(eligible, nil).Once()
+	mockDB.On("CountExpiredRecords", models.RetentionDelivered, cutoff(48*time.Hour), []string{}).Return(1, nil).Once()
+	mockDB.On("GetExpiredRecords", models.RetentionDelivered, cutoff(48*time.Hour), []string{}, 500).Return(eligible, nil).Once()
 	mockDB.On("DeleteRecord", "rec-v").Return(nil).Once()
 	mockDB.On("RunIncrementalVacuum").Return(nil).Once()
 
@@ -103,7 +118,8 @@ func TestCleanup_NoEligibleRecords_NoOp(t *testing.T) {
 	mockDB := new(database.MockDatabase)
 	c := newTestCleaner(mockDB)
 
-	mockDB.On("GetCleanupEligible", 48*time.Hour).Return([]*models.ManagedObject{}, nil).Once()
+	mockDB.On("CountExpiredRecords", models.RetentionDelivered, cutoff(48*time.Hour), []string{}).Return(0, nil).Once()
+	mockDB.On("GetExpiredRecords", models.RetentionDelivered, cutoff(48*time.Hour), []string{}, 500).Return([]*models.ManagedObject{}, nil).Once()
 
 	err := c.Cleanup(context.Background())
 
@@ -114,6 +130,112 @@ func TestCleanup_NoEligibleRecords_NoOp(t *testing.T) {
 	mockDB.AssertNotCalled(t, "RunIncrementalVacuum")
 }
 
+func TestCleanupOlderThan_UsesGivenRetention(t *testing.T) {
+	mockDB := new(database.MockDatabase)
+	c := newTestCleaner(mockDB)
+
+	deletedAt := time.Now().Add(-2 * time.Hour)
+	eligible := []*models.ManagedObject{
+		{ID: "rec-1", ResourceUID: "uid-1", ClusterState: models.ClusterStateDeleted, NotifiedDeleted: true, DeletedAt: &deletedAt},
+	}
+	mockDB.On("CountExpiredRecords", models.RetentionDelivered, cutoff(time.Hour), []string{}).Return(1, nil).Once()
+	mockDB.On("GetExpiredRecords", models.RetentionDelivered, cutoff(time.Hour), []string{}, 500).Return(eligible, nil).Once()
+	mockDB.On("DeleteRecord", "rec-1").Return(nil).Once()
+	mockDB.On("RunIncrementalVacuum").Return(nil).Once()
+
+	require.NoError(t, c.CleanupOlderThan(context.Background(), time.Hour))
+	mockDB.AssertExpectations(t)
+}
+
+func TestCleanup_DeletesInBatches(t *testing.T) {
+	mockDB := new(database.MockDatabase)
+	c := newTestCleaner(mockDB)
+	c.cfg.Retention.BatchSize = 2
+
+	deletedAt := time.Now().Add(-72 * time.Hour)
+	record := func(id string) *models.ManagedObject {
+		return &models.ManagedObject{ID: id, ClusterState: models.ClusterStateDeleted, NotifiedDeleted: true, DeletedAt: &deletedAt}
+	}
+	mockDB.On("CountExpiredRecords", models.RetentionDelivered, cutoff(48*time.Hour), []string{}).Return(3, nil).Once()
+	mockDB.On("GetExpiredRecords", models.RetentionDelivered, cutoff(48*time.Hour), []string{}, 2).
+		Return([]*models.ManagedObject{record("rec-1"), record("rec-2")}, nil).Once()
+	mockDB.On("GetExpiredRecords", models.RetentionDelivered, cutoff(48*time.Hour), []string{}, 2).
+		Return([]*models.ManagedObject{record("rec-3")}, nil).Once()
+	for _, id := range []string{"rec-1", "rec-2", "rec-3"} {
+		mockDB.On("DeleteRecord", id).Return(nil).Once()
+	}
+	mockDB.On("RunIncrementalVacuum").Return(nil).Once()
+
+	require.NoError(t, c.Cleanup(context.Background()))
+	mockDB.AssertExpectations(t)
+	assert.Equal(t, float64(3), testutil.ToFloat64(c.metrics.CleanupPolicyRecords.WithLabelValues(models.RetentionDelivered, "deleted")))
+	assert.InDelta(t, (72 * time.Hour).Seconds(), testutil.ToFloat64(c.metrics.CleanupOldestRecordAge), 60)
+}
+
+func TestCleanup_FailedAndStalePolicies(t *testing.T) {
+	mockDB := new(database.MockDatabase)
+	c := newTestCleaner(mockDB)
+	c.cfg.Retention.ArchiveDir = t.TempDir()
+	c.cfg.Retention.Failed.Period.Duration = 7 * 24 * time.Hour
+	c.cfg.Retention.Failed.Archive = true
+	c.cfg.Reconciliation.Interval.Duration = 15 * time.Minute
+	c.cfg.Retention.Stale.Intervals = 4
+	c.cfg.Resources = []config.ResourceConfig{{APIVersion: "v1", Kind: "Pod"}}
+
+	failed := &models.ManagedObject{ID: "rec-failed", ResourceName: "broken", NotificationFailed: true, NotificationFailedCode: 403}
+	stale := &models.ManagedObject{ID: "rec-stale", ClusterState: models.ClusterStateExists}
+	watched := []string{"Pod"}
+	mockDB.On("CountExpiredRecords", models.RetentionDelivered, cutoff(48*time.Hour), watched).Return(0, nil).Once()
+	mockDB.On("CountExpiredRecords", models.RetentionFailed, cutoff(7*24*time.Hour), watched).Return(1, nil).Once()
+	mockDB.On("CountExpiredRecords", models.RetentionStale, cutoff(time.Hour), watched).Return(1, nil).Once()
+	mockDB.On("GetExpiredRecords", models.RetentionDelivered, cutoff(48*time.Hour), watched, 500).Return([]*models.ManagedObject{}, nil).Once()
+	mockDB.On("GetExpiredRecords", models.RetentionFailed, cutoff(7*24*time.Hour), watched, 500).Return([]*models.ManagedObject{failed}, nil).Once()
+	mockDB.On("GetExpiredRecords", models.RetentionStale, cutoff(time.Hour), watched, 500).Return([]*models.ManagedObject{stale}, nil).Once()
+	mockDB.On("DeleteRecord", "rec-failed").Return(nil).Once()
+	mockDB.On("DeleteRecord", "rec-stale").Return(nil).Once()
+	mockDB.On("RunIncrementalVacuum").Return(nil).Once()
+
+	require.NoError(t, c.Cleanup(context.Background()))
+	mockDB.AssertExpectations(t)
+	assert.Equal(t, float64(2), testutil.ToFloat64(c.metrics.CleanupRecordsEligible))
+
+	// Only the failed policy archives its records.
+	files, err := filepath.Glob(filepath.Join(c.cfg.Retention.ArchiveDir, "*.jsonl"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "failed-"+time.Now().UTC().Format("2006-01-02")+".jsonl", filepath.Base(files[0]))
+	data, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	var line archivedRecord
+	require.NoError(t, json.Unmarshal(data, &line))
+	assert.Equal(t, models.RetentionFailed, line.Policy)
+	assert.Equal(t, "broken", line.Record.ResourceName)
+	assert.Equal(t, 403, line.Record.NotificationFailedCode)
+	assert.Equal(t, float64(1), testutil.ToFloat64(c.metrics.CleanupPolicyRecords.WithLabelValues(models.RetentionFailed, "archived")))
+}
+
+func TestCleanup_ArchiveFailure_KeepsRecords(t *testing.T) {
+	mockDB := new(database.MockDatabase)
+	c := newTestCleaner(mockDB)
+	c.cfg.Retention.Archive = true
+	// A file where the archive directory should be.
+	c.cfg.Retention.ArchiveDir = filepath.Join(t.TempDir(), "archive")
+	require.NoError(t, os.WriteFile(c.cfg.Retention.ArchiveDir, nil, 0o600))
+
+	deletedAt := time.Now().Add(-72 * time.Hour)
+	eligible := []*models.ManagedObject{{ID: "rec-1", ClusterState: models.ClusterStateDeleted, DeletedAt: &deletedAt}}
+	mockDB.On("CountExpiredRecords", models.RetentionDelivered, cutoff(48*time.Hour), []string{}).Return(1, nil).Once()
+	mockDB.On("GetExpiredRecords", models.RetentionDelivered, cutoff(48*time.Hour), []string{}, 500).Return(eligible, nil).Once()
+
+	err := c.Cleanup(context.Background())
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cleaning up delivered records: creating archive directory")
+	mockDB.AssertExpectations(t)
+	mockDB.AssertNotCalled(t, "DeleteRecord", mock.Anything)
+	assert.Equal(t, float64(0), testutil.ToFloat64(c.metrics.ComponentUp.WithLabelValues("cleaner")))
+}
+
 func TestNewCleaner_ReturnsNonNil(t *testing.T) {
 	mockDB := new(database.MockDatabase)
 	c := newTestCleaner(mockDB)
@@ -5,10 +5,20 @@ package config
 
 import (
 	"fmt"
+	"math"
+	"net/url"
 	"os"
+	"path"
+	"regexp"
+	"strings"
+	"text/template"
 	"time"
 
 	"gopkg.in/yaml.v3"
+	"k8s.io/client-go/util/jsonpath"
+
+	"github.com/bryonbaker/beacon/internal/models"
+	"github.com/bryonbaker/beacon/pkg/webhook"
 )
 
 // Duration is a wrapper around time.Duration that implements yaml.Unmarshaler
@@ -36,20 +46,101 @@ func (d Duration) MarshalYAML() (interface{}, error) {
 	return d.Duration.String(), nil
 }
 
-// PayloadConfig controls which annotations and labels are included in
-// notification payloads. Empty slices give backward-compatible behaviour:
-// all labels are sent and no annotations are sent.
+// PayloadConfig controls which annotations, labels, and extracted fields are
+// included in notification payloads. Empty slices give backward-compatible
+// behaviour: all labels are sent and no annotations or fields are sent.
 type PayloadConfig struct {
-	Annotations []string `yaml:"annotations"` // Annotation keys to include in payload
-	Labels      []string `yaml:"labels"`       // Label keys to include (empty = all)
+	Annotations      []string        `yaml:"annotations"`      // Annotation keys to include in payload
+	Labels           []string        `yaml:"labels"`           // Label keys to include (empty = all)
+	LabelFilter      KeyFilterConfig `yaml:"labelFilter"`      // Pattern-based label allow/deny rules
+	AnnotationFilter KeyFilterConfig `yaml:"annotationFilter"` // Pattern-based annotation allow/deny rules
+	Redact           []RedactConfig  `yaml:"redact"`           // Value redaction rules for labels and annotations
+	Fields           []FieldConfig   `yaml:"fields"`           // JSONPath expressions evaluated against the full object
+}
+
+// KeyFilterConfig selects label or annotation keys by pattern. A pattern is an
+// exact key, a glob such as "*.kubernetes.io/*", or a regular expression
+// prefixed with "regex:". Allow patterns extend the exact-key list; deny
+// patterns are applied last and always win.
+type KeyFilterConfig struct {
+	Allow []string `yaml:"allow"`
+	Deny  []string `yaml:"deny"`
+}
+
+// RedactConfig replaces the values of matching label and annotation keys.
+// Action is "redact" (replace with a fixed marker) or "sha256" (replace with
+// the hex SHA-256 digest so values can still be correlated).
+type RedactConfig struct {
+	Keys   []string `yaml:"keys"`
+	Action string   `yaml:"action"`
+}
+
+// FieldConfig names a value extracted from the watched object with a JSONPath
+// expression. The result is emitted under data.fields.<name>.
+type FieldConfig struct {
+	Name     string `yaml:"name"`
+	JSONPath string `yaml:"jsonPath"`
 }
 
+// Template returns the JSONPath expression in the braced template form
+// expected by k8s.io/client-go/util/jsonpath. Expressions may be written as
+// "{.spec.replicas}", ".spec.replicas", or "$.spec.replicas".
+func (f FieldConfig) Template() string {
+	expr := strings.TrimSpace(f.JSONPath)
+	if strings.HasPrefix(expr, "{") && strings.HasSuffix(expr, "}") {
+		return expr
+	}
+	expr = strings.TrimPrefix(expr, "$")
+	if !strings.HasPrefix(expr, ".") && !strings.HasPrefix(expr, "[") {
+		expr = "." + expr
+	}
+	return "{" + expr + "}"
+}
+
+// CloudEvents content modes.
+const (
+	CloudEventsModeStructured = "structured"
+	CloudEventsModeBinary     = "binary"
+)
+
 // CloudEventsConfig controls CloudEvents v1.0 envelope attributes.
 type CloudEventsConfig struct {
-	Source     string `yaml:"source"`     // URI-reference prefix for the "source" attribute
-	TypePrefix string `yaml:"typePrefix"` // Reverse-DNS prefix for the "type" attribute
+	Source     string            `yaml:"source"`     // URI-reference prefix for the "source" attribute
+	TypePrefix string            `yaml:"typePrefix"` // Reverse-DNS prefix for the "type" attribute
+	Mode       string            `yaml:"mode"`       // HTTP content mode: structured or binary
+	DataSchema string            `yaml:"dataSchema"` // Optional URI for the "dataschema" attribute
+	Extensions []ExtensionConfig `yaml:"extensions"` // Extension context attributes added to every event
+	Schema     SchemaConfig      `yaml:"schema"`     // Publication and validation of the data JSON Schema
 }
 
+// ExtensionConfig defines a CloudEvents extension attribute. Exactly one of
+// Value (a static string) or Template (a Go text/template evaluated per event)
+// must be set.
+type ExtensionConfig struct {
+	Name     string `yaml:"name"`
+	Value    string `yaml:"value"`
+	Template string `yaml:"template"`
+}
+
+// SchemaConfig controls the JSON Schema describing the CloudEvent data payload.
+type SchemaConfig struct {
+	Path     string `yaml:"path"`     // HTTP path on the metrics server where the schema is published
+	Validate bool   `yaml:"validate"` // Validate every payload against the schema before sending
+}
+
+// reservedCloudEventAttributes are context attribute names that extensions
+// may not override. sequence is set by beacon on every event, and
+// traceparent and tracestate when tracing is enabled.
+var reservedCloudEventAttributes = map[string]struct{}{
+	"specversion": {}, "id": {}, "source": {}, "type": {}, "subject": {},
+	"time": {}, "datacontenttype": {}, "dataschema": {}, "data": {}, "data_base64": {},
+	"sequence": {}, "traceparent": {}, "tracestate": {},
+}
+
+// extensionNamePattern is the CloudEvents attribute naming rule: lower-case
+// ASCII letters and digits only.
+var extensionNamePattern = regexp.MustCompile(`^[a-z0-9]{1,20}$`)
+
 // Config is the top-level configuration for the beacon service.
 type Config struct {
 	App            AppConfig            `yaml:"app"`
@@ -57,13 +148,19 @@ type Config struct {
 	Annotation     AnnotationConfig     `yaml:"annotation"`
 	Payload        PayloadConfig        `yaml:"payload"`
 	CloudEvents    CloudEventsConfig    `yaml:"cloudEvents"`
+	Sink           SinkConfig           `yaml:"sink"`
 	Endpoint       EndpointConfig       `yaml:"endpoint"`
+	Endpoints      []EndpointConfig     `yaml:"endpoints"`
+	Routes         []RouteConfig        `yaml:"routes"`
 	Worker         WorkerConfig         `yaml:"worker"`
 	Reconciliation ReconciliationConfig `yaml:"reconciliation"`
 	Retention      RetentionConfig      `yaml:"retention"`
 	Storage        StorageConfig        `yaml:"storage"`
 	Metrics        MetricsConfig        `yaml:"metrics"`
 	Health         HealthConfig         `yaml:"health"`
+	Tracing        TracingConfig        `yaml:"tracing"`
+	Audit          AuditConfig          `yaml:"audit"`
+	Backup         BackupConfig         `yaml:"backup"`
 
 	// AuthToken is populated from the ENDPOINT_AUTH_TOKEN environment variable.
 	// It is never read from the config file.
@@ -80,10 +177,37 @@ type AppConfig struct {
 
 // ResourceConfig describes a single Kubernetes resource type to watch.
 type ResourceConfig struct {
-	APIVersion string   `yaml:"apiVersion"`
-	Kind       string   `yaml:"kind"`
-	Resource   string   `yaml:"resource"`
-	Namespaces []string `yaml:"namespaces"`
+	APIVersion string         `yaml:"apiVersion"`
+	Kind       string         `yaml:"kind"`
+	Resource   string         `yaml:"resource"`
+	Namespaces []string       `yaml:"namespaces"`
+	Coalesce   CoalesceConfig `yaml:"coalesce"`
+}
+
+// Coalescing modes.
+const (
+	CoalesceModeSuppress  = "suppress"
+	CoalesceModeEphemeral = "ephemeral"
+)
+
+// CoalesceConfig coalesces the events of short-lived resources. Created
+// events are held for Window; a resource deleted within that time gets no
+// created and deleted events, and with the ephemeral mode gets a single
+// ephemeral event instead.
+type CoalesceConfig struct {
+	Window Duration `yaml:"window"` // 0 disables coalescing
+	Mode   string   `yaml:"mode"`   // suppress or ephemeral
+}
+
+// CoalesceFor returns the coalescing settings for resources of the given
+// kind, or nil if their events are not coalesced.
+func (c *Config) CoalesceFor(kind string) *CoalesceConfig {
+	for i := range c.Resources {
+		if c.Resources[i].Kind == kind && c.Resources[i].Coalesce.Window.Duration > 0 {
+			return &c.Resources[i].Coalesce
+		}
+	}
+	return nil
 }
 
 // AnnotationConfig specifies the annotation key and accepted values used
@@ -93,14 +217,267 @@ type AnnotationConfig struct {
 	Values []string `yaml:"values"`
 }
 
+// Sink types.
+const (
+	SinkTypeHTTP  = "http"
+	SinkTypeKafka = "kafka"
+)
+
+// SinkConfig selects the destination notifications are delivered to. The
+// HTTP sink is configured by the endpoint section; other sinks have their own
+// sub-section. Retry behaviour (endpoint.retry) applies to every sink.
+type SinkConfig struct {
+	Type  string      `yaml:"type"` // http or kafka
+	Kafka KafkaConfig `yaml:"kafka"`
+}
+
+// Kafka record key sources.
+const (
+	KafkaKeyUID            = "uid"
+	KafkaKeyNamespacedName = "namespacedName"
+	KafkaKeyPartitionKey   = "partitionkey"
+	KafkaKeyNone           = "none"
+)
+
+// Kafka acknowledgement levels.
+const (
+	KafkaAcksAll    = "all"
+	KafkaAcksLeader = "leader"
+	KafkaAcksNone   = "none"
+)
+
+// KafkaConfig configures the Kafka sink.
+type KafkaConfig struct {
+	Brokers            []string        `yaml:"brokers"`
+	Topic              string          `yaml:"topic"`
+	ClientID           string          `yaml:"clientID"`
+	Key                string          `yaml:"key"`                // Record key source: uid, namespacedName, partitionkey, none
+	Acks               string          `yaml:"acks"`               // all, leader, none
+	DisableIdempotence bool            `yaml:"disableIdempotence"` // Idempotent writes are on unless disabled
+	ProduceTimeout     Duration        `yaml:"produceTimeout"`     // Upper bound on producing one poll cycle's records
+	SASL               KafkaSASLConfig `yaml:"sasl"`
+	TLS                KafkaTLSConfig  `yaml:"tls"`
+}
+
+// KafkaSASLConfig configures SASL authentication to the brokers.
+type KafkaSASLConfig struct {
+	Mechanism string `yaml:"mechanism"` // PLAIN, SCRAM-SHA-256, or SCRAM-SHA-512; empty disables SASL
+	Username  string `yaml:"username"`
+
+	// Password is populated from the KAFKA_SASL_PASSWORD environment variable.
+	// It is never read from the config file.
+	Password string `yaml:"-"`
+}
+
+// KafkaTLSConfig configures TLS connections to the brokers.
+type KafkaTLSConfig struct {
+	Enabled            bool   `yaml:"enabled"`
+	CAFile             string `yaml:"caFile"`
+	CertFile           string `yaml:"certFile"` // Client certificate for mutual TLS
+	KeyFile            string `yaml:"keyFile"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify"`
+}
+
 // EndpointConfig configures the HTTP endpoint that receives notifications.
+// Entries in the endpoints list are the same settings plus a name.
 type EndpointConfig struct {
+	Name    string            `yaml:"name"` // Only used in the endpoints list
 	URL     string            `yaml:"url"`
 	Method  string            `yaml:"method"`
 	Timeout Duration          `yaml:"timeout"`
 	Retry   RetryConfig       `yaml:"retry"`
 	Headers map[string]string `yaml:"headers"`
 	TLS     TLSConfig         `yaml:"tls"`
+	Batch   BatchConfig       `yaml:"batch"`
+	Signing SigningConfig     `yaml:"signing"`
+	Auth    AuthConfig        `yaml:"auth"`
+
+	RetryAfter     RetryAfterConfig     `yaml:"retryAfter"`
+	RateLimit      RateLimitConfig      `yaml:"rateLimit"`
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuitBreaker"`
+	Diagnostics    DiagnosticsConfig    `yaml:"diagnostics"`
+	Ack            AckConfig            `yaml:"ack"`
+
+	// AuthToken is populated from the ENDPOINT_<NAME>_AUTH_TOKEN environment
+	// variable for a named endpoint. It is never read from the config file.
+	AuthToken string `yaml:"-"`
+}
+
+// RouteConfig sends the events of matching resources to the named endpoints.
+// An event is delivered to the endpoints of every route it matches.
+type RouteConfig struct {
+	Match     RouteMatch `yaml:"match"`
+	Endpoints []string   `yaml:"endpoints"`
+}
+
+// RouteMatch selects resources by type, namespace, labels, and annotation
+// value. Every non-empty criterion must match; an empty match selects all
+// resources. Labels are matched against the labels stored for the resource.
+type RouteMatch struct {
+	ResourceTypes    []string          `yaml:"resourceTypes"`
+	Namespaces       []string          `yaml:"namespaces"`
+	Labels           map[string]string `yaml:"labels"`
+	AnnotationValues []string          `yaml:"annotationValues"`
+}
+
+// Routed reports whether events are routed to the endpoints list rather than
+// sent to the single endpoint.
+func (c *Config) Routed() bool {
+	return len(c.Endpoints) > 0
+}
+
+// ForEndpoint returns a copy of c whose endpoint section and static bearer
+// token are those of the named endpoint, so components written for a single
+// endpoint can serve one of several. It returns nil for an unknown name.
+func (c *Config) ForEndpoint(name string) *Config {
+	for i := range c.Endpoints {
+		if c.Endpoints[i].Name == name {
+			out := *c
+			out.Endpoint = c.Endpoints[i]
+			out.AuthToken = c.Endpoints[i].AuthToken
+			return &out
+		}
+	}
+	return nil
+}
+
+// endpointNamePattern restricts endpoint names to DNS-label style names, as
+// they appear in metric labels and environment variable names.
+var endpointNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+// endpointEnvPrefix returns the prefix of the environment variables that
+// hold the secrets of the named endpoint: ENDPOINT_ for the single endpoint
+// and ENDPOINT_<NAME>_ for a named one.
+func endpointEnvPrefix(name string) string {
+	if name == "" {
+		return "ENDPOINT_"
+	}
+	return "ENDPOINT_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+}
+
+// CircuitBreakerConfig stops deliveries to an endpoint that keeps failing.
+// The breaker opens after ConsecutiveFailures failed requests in a row, or
+// when the failure rate over the last WindowSize requests reaches
+// FailureRate. After OpenDuration a single probe event is sent; success
+// closes the breaker and failure opens it again.
+type CircuitBreakerConfig struct {
+	Enabled             bool     `yaml:"enabled"`
+	ConsecutiveFailures int      `yaml:"consecutiveFailures"` // Failures in a row that open the breaker
+	FailureRate         float64  `yaml:"failureRate"`         // Failure ratio (0-1] that opens the breaker; 0 disables
+	WindowSize          int      `yaml:"windowSize"`          // Requests the failure rate is measured over
+	OpenDuration        Duration `yaml:"openDuration"`        // Time to wait before probing
+}
+
+// RetryAfterConfig controls how Retry-After headers on retriable responses
+// are honoured. A requested delay longer than the computed backoff postpones
+// the event's next attempt; for the listed statuses it also pauses all
+// deliveries to the endpoint.
+type RetryAfterConfig struct {
+	MaxDelay      Duration `yaml:"maxDelay"`      // Upper bound on a requested delay
+	PauseStatuses []int    `yaml:"pauseStatuses"` // Statuses whose Retry-After pauses the whole endpoint
+}
+
+// RateLimitConfig is a token-bucket limit on requests sent to the endpoint.
+type RateLimitConfig struct {
+	RequestsPerSecond float64 `yaml:"requestsPerSecond"` // 0 disables rate limiting
+	Burst             int     `yaml:"burst"`             // Requests allowed at once
+}
+
+// Endpoint authentication types.
+const (
+	AuthTypeBearer              = "bearer"
+	AuthTypeOAuth2              = "oauth2"
+	AuthTypeServiceAccountToken = "serviceAccountToken"
+)
+
+// AuthConfig selects how requests to the endpoint are authenticated. The
+// bearer type sends the static ENDPOINT_AUTH_TOKEN, if set.
+type AuthConfig struct {
+	Type                string                    `yaml:"type"` // bearer, oauth2, or serviceAccountToken
+	OAuth2              OAuth2Config              `yaml:"oauth2"`
+	ServiceAccountToken ServiceAccountTokenConfig `yaml:"serviceAccountToken"`
+}
+
+// ServiceAccountTokenConfig configures authentication with a projected,
+// audience-scoped Kubernetes ServiceAccount token, which in-cluster receivers
+// can validate with the TokenReview API.
+type ServiceAccountTokenConfig struct {
+	Path string `yaml:"path"` // Projected token file; re-read when the kubelet rotates it
+}
+
+// OAuth2Config configures the OAuth2 client credentials grant used to obtain
+// short-lived access tokens for the endpoint.
+type OAuth2Config struct {
+	TokenURL         string   `yaml:"tokenURL"`
+	ClientID         string   `yaml:"clientID"`
+	ClientSecretFile string   `yaml:"clientSecretFile"` // Re-read on every token request
+	Scopes           []string `yaml:"scopes"`
+	Audience         string   `yaml:"audience"`
+	RefreshBefore    Duration `yaml:"refreshBefore"` // Refresh tokens this long before they expire
+}
+
+// SigningConfig controls Standard Webhooks HMAC-SHA256 signing of requests to
+// the endpoint. Secrets use the Standard Webhooks format ("whsec_" followed by
+// base64). Every configured secret signs each request, so receivers can
+// rotate secrets without downtime.
+type SigningConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	SecretsFile string `yaml:"secretsFile"` // One secret per line; re-read when it changes
+
+	// Secrets is populated from the ENDPOINT_SIGNING_SECRETS environment
+	// variable (comma- or space-separated). It is never read from the config
+	// file.
+	Secrets []string `yaml:"-"`
+}
+
+// Partial failure policies for batched delivery.
+const (
+	BatchPartialFailureAllOrNothing = "allOrNothing"
+	BatchPartialFailurePerItem      = "perItem"
+)
+
+// BatchConfig controls opt-in delivery of several events per request using
+// the CloudEvents JSON batch format (application/cloudevents-batch+json).
+type BatchConfig struct {
+	Enabled        bool   `yaml:"enabled"`
+	MaxEvents      int    `yaml:"maxEvents"`      // Maximum events per request
+	MaxBytes       int    `yaml:"maxBytes"`       // Maximum request body size in bytes
+	PartialFailure string `yaml:"partialFailure"` // allOrNothing or perItem
+}
+
+// Actions taken when an acknowledgement does not arrive in time.
+const (
+	AckOnTimeoutRetry = "retry"
+	AckOnTimeoutFail  = "fail"
+)
+
+// AckConfig enables asynchronous acknowledgement for receivers that reply
+// 202 Accepted and confirm the event later. An accepted event waits for the
+// receiver to confirm or reject it through beacon's callback endpoint, which
+// is served on the health port.
+type AckConfig struct {
+	Enabled   bool     `yaml:"enabled"`
+	Path      string   `yaml:"path"`      // Callback path
+	Timeout   Duration `yaml:"timeout"`   // How long to wait for the callback
+	OnTimeout string   `yaml:"onTimeout"` // retry or fail
+
+	// Token is populated from the ENDPOINT_ACK_TOKEN environment variable.
+	// Callbacks must present it as a bearer token. It is never read from the
+	// config file.
+	Token string `yaml:"-"`
+}
+
+// maxDiagnosticsBodyBytes is the largest response body prefix that can be
+// stored for a failed delivery attempt.
+const maxDiagnosticsBodyBytes = 64 << 10
+
+// DiagnosticsConfig bounds what is stored about failed delivery attempts.
+// Each failed attempt is recorded with its status code, latency, and error,
+// a truncated response body, and the selected response headers.
+type DiagnosticsConfig struct {
+	MaxBodyBytes int      `yaml:"maxBodyBytes"` // Response body bytes kept; longer bodies are truncated
+	Headers      []string `yaml:"headers"`      // Response headers kept
+	MaxAttempts  int      `yaml:"maxAttempts"`  // Most recent failed attempts kept per event
 }
 
 // RetryConfig controls the retry behaviour for endpoint calls.
@@ -123,6 +500,7 @@ type WorkerConfig struct {
 	PollInterval Duration `yaml:"pollInterval"`
 	BatchSize    int      `yaml:"batchSize"`
 	Concurrency  int      `yaml:"concurrency"`
+	OrderingKey  string   `yaml:"orderingKey"` // uid or name; events sharing a key are delivered in order
 }
 
 // ReconciliationConfig controls the periodic reconciliation loop.
@@ -133,27 +511,129 @@ type ReconciliationConfig struct {
 	Timeout   Duration `yaml:"timeout"`
 }
 
-// RetentionConfig controls old-record cleanup.
+// RetentionConfig controls old-record cleanup. Each record state has its
+// own retention policy. Delivered records, deleted from the cluster with
+// every event delivered, are removed RetentionPeriod after the deletion.
+// Permanently failed records and stale records, which exist but have not
+// been reconciled for a number of reconciliation intervals, are kept unless
+// their policy sets a period. Records of a policy with archiving enabled are
+// appended to a file in ArchiveDir before they are removed.
 type RetentionConfig struct {
-	Enabled         bool     `yaml:"enabled"`
-	CleanupInterval Duration `yaml:"cleanupInterval"`
-	RetentionPeriod Duration `yaml:"retentionPeriod"`
+	Enabled         bool                 `yaml:"enabled"`
+	CleanupInterval Duration             `yaml:"cleanupInterval"`
+	RetentionPeriod Duration             `yaml:"retentionPeriod"`
+	Archive         bool                 `yaml:"archive"` // Archive delivered records
+	Failed          RetentionPolicy      `yaml:"failed"`
+	Stale           StaleRetentionPolicy `yaml:"stale"`
+	BatchSize       int                  `yaml:"batchSize"`
+	ArchiveDir      string               `yaml:"archiveDir"`
+}
+
+// RetentionPolicy controls the cleanup of permanently failed records, which
+// are removed Period after their last delivery attempt. A zero Period keeps
+// them.
+type RetentionPolicy struct {
+	Period  Duration `yaml:"period"`
+	Archive bool     `yaml:"archive"`
+}
+
+// StaleRetentionPolicy controls the cleanup of records that exist, whose
+// created event was delivered and whose resource type is no longer
+// configured, and that have not been reconciled, or created, for Intervals
+// reconciliation intervals. Zero Intervals keeps them.
+type StaleRetentionPolicy struct {
+	Intervals int  `yaml:"intervals"`
+	Archive   bool `yaml:"archive"`
+}
+
+// StalePeriod returns how long a record that exists may go without being
+// reconciled before the stale policy removes it, or zero if it is kept.
+func (c *Config) StalePeriod() time.Duration {
+	return time.Duration(c.Retention.Stale.Intervals) * c.Reconciliation.Interval.Duration
+}
+
+// ResourceKinds returns the kinds of the configured resources, which records
+// store as their resource type.
+func (c *Config) ResourceKinds() []string {
+	kinds := make([]string, 0, len(c.Resources))
+	for _, res := range c.Resources {
+		kinds = append(kinds, res.Kind)
+	}
+	return kinds
 }
 
 // StorageConfig controls the SQLite database and volume monitoring.
 type StorageConfig struct {
-	MonitorInterval    Duration `yaml:"monitorInterval"`
-	DBPath             string   `yaml:"dbPath"`
-	VolumePath         string   `yaml:"volumePath"`
-	WarningThreshold   int      `yaml:"warningThreshold"`
-	CriticalThreshold  int      `yaml:"criticalThreshold"`
+	MonitorInterval   Duration              `yaml:"monitorInterval"`
+	DBPath            string                `yaml:"dbPath"`
+	VolumePath        string                `yaml:"volumePath"`
+	WarningThreshold  int                   `yaml:"warningThreshold"`
+	CriticalThreshold int                   `yaml:"criticalThreshold"`
+	Pressure          StoragePressureConfig `yaml:"pressure"`
 }
 
-// MetricsConfig controls the Prometheus metrics endpoint.
+// StoragePressureConfig controls how beacon frees space when the volume
+// usage crosses the storage thresholds. At the warning threshold, records
+// are cleaned up early with WarningRetention in place of the retention
+// period. At the critical threshold they are cleaned up with
+// CriticalRetention, the optional data of delivered records is dropped, the
+// WAL is truncated, and readiness fails. New events are always recorded.
+type StoragePressureConfig struct {
+	Enabled           bool     `yaml:"enabled"` // Defaults to true when omitted
+	WarningRetention  Duration `yaml:"warningRetention"`
+	CriticalRetention Duration `yaml:"criticalRetention"`
+}
+
+// MetricsConfig controls the Prometheus metrics endpoint. Metrics are served
+// on their own listener when Port differs from health.port, and on the health
+// listener otherwise; TLS, when configured, applies to whichever listener
+// serves them.
 type MetricsConfig struct {
-	Enabled bool   `yaml:"enabled"`
-	Port    int    `yaml:"port"`
-	Path    string `yaml:"path"`
+	Enabled bool              `yaml:"enabled"` // Defaults to true when omitted
+	Port    int               `yaml:"port"`
+	Path    string            `yaml:"path"`
+	TLS     ServerTLSConfig   `yaml:"tls"`
+	Auth    MetricsAuthConfig `yaml:"auth"`
+	Admin   AdminConfig       `yaml:"admin"`
+}
+
+// ServerTLSConfig serves a listener over HTTPS. With ClientCAFile, client
+// certificates are requested and verified against it, but only routes
+// protected by mtls authentication require one.
+type ServerTLSConfig struct {
+	CertFile     string `yaml:"certFile"`
+	KeyFile      string `yaml:"keyFile"`
+	ClientCAFile string `yaml:"clientCAFile"`
+}
+
+// Enabled reports whether the listener is served over HTTPS.
+func (t ServerTLSConfig) Enabled() bool {
+	return t.CertFile != ""
+}
+
+// Metrics authentication types.
+const (
+	MetricsAuthNone   = "none"
+	MetricsAuthBearer = "bearer"
+	MetricsAuthMTLS   = "mtls"
+)
+
+// MetricsAuthConfig protects the metrics and admin routes. The bearer type
+// accepts the token in TokenFile, re-read on every request so that it can be
+// rotated, or the static METRICS_AUTH_TOKEN. The mtls type accepts clients
+// presenting a certificate signed by tls.clientCAFile.
+type MetricsAuthConfig struct {
+	Type      string `yaml:"type"` // none, bearer, or mtls
+	TokenFile string `yaml:"tokenFile"`
+
+	// Token is populated from the METRICS_AUTH_TOKEN environment variable.
+	Token string `yaml:"-"`
+}
+
+// AdminConfig exposes the pprof profiles under /debug/pprof/ and the admin
+// routes under /admin/ alongside the metrics, behind the same protection.
+type AdminConfig struct {
+	Enabled bool `yaml:"enabled"`
 }
 
 // HealthConfig controls the health/readiness probe endpoints.
@@ -161,6 +641,65 @@ type HealthConfig struct {
 	LivenessPath  string `yaml:"livenessPath"`
 	ReadinessPath string `yaml:"readinessPath"`
 	Port          int    `yaml:"port"`
+
+	// HeartbeatTimeout is how long a periodic loop may go past its interval
+	// without completing a cycle before the liveness probe fails.
+	HeartbeatTimeout Duration `yaml:"heartbeatTimeout"`
+
+	// DatabasePingInterval is how often the database connection is checked.
+	DatabasePingInterval Duration `yaml:"databasePingInterval"`
+}
+
+// TracingConfig controls OpenTelemetry tracing. Spans are exported with
+// OTLP over HTTP to Endpoint, a traces URL such as
+// http://otel-collector:4318/v1/traces; when it is empty the standard
+// OTEL_EXPORTER_OTLP_* environment variables apply.
+type TracingConfig struct {
+	Enabled     bool    `yaml:"enabled"`
+	Endpoint    string  `yaml:"endpoint"`
+	ServiceName string  `yaml:"serviceName"`
+	SampleRatio float64 `yaml:"sampleRatio"` // fraction of new traces recorded
+}
+
+// AuditConfig controls the delivery audit log: one JSON line per delivery
+// attempt and state transition, hash-chained for tamper evidence. The file at
+// Path is rotated when it would grow past MaxBytes or is older than MaxAge;
+// rotated files are kept alongside it and never deleted by Beacon.
+type AuditConfig struct {
+	Enabled  bool     `yaml:"enabled"`
+	Path     string   `yaml:"path"`
+	MaxBytes int64    `yaml:"maxBytes"`
+	MaxAge   Duration `yaml:"maxAge"`
+	Compress bool     `yaml:"compress"` // gzip rotated files
+}
+
+// BackupConfig controls scheduled online backups of the database. Every
+// Interval a consistent copy is written to Dir and checked for integrity; the
+// newest Retain copies are kept.
+type BackupConfig struct {
+	Enabled  bool           `yaml:"enabled"`
+	Interval Duration       `yaml:"interval"`
+	Dir      string         `yaml:"dir"`
+	Retain   int            `yaml:"retain"`
+	S3       BackupS3Config `yaml:"s3"`
+}
+
+// BackupS3Config uploads each backup to an S3-compatible object store such as
+// AWS S3 or MinIO.
+type BackupS3Config struct {
+	Enabled   bool     `yaml:"enabled"`
+	Endpoint  string   `yaml:"endpoint"` // e.g. https://s3.eu-west-1.amazonaws.com or http://minio:9000
+	Region    string   `yaml:"region"`
+	Bucket    string   `yaml:"bucket"`
+	Prefix    string   `yaml:"prefix"`    // prepended to the object key
+	PathStyle bool     `yaml:"pathStyle"` // address the bucket in the path rather than the host name
+	Timeout   Duration `yaml:"timeout"`
+
+	// AccessKeyID and SecretAccessKey are populated from the
+	// BACKUP_S3_ACCESS_KEY_ID and BACKUP_S3_SECRET_ACCESS_KEY environment
+	// variables. They are never read from the config file.
+	AccessKeyID     string `yaml:"-"`
+	SecretAccessKey string `yaml:"-"`
 }
 
 // Load reads the YAML configuration file at path, applies defaults, applies
@@ -171,7 +710,12 @@ func Load(path string) (*Config, error) {
 		return nil, fmt.Errorf("reading config file: %w", err)
 	}
 
-	cfg := &Config{}
+	// Metrics and the responses to storage pressure are enabled unless the
+	// file disables them.
+	cfg := &Config{
+		Metrics: MetricsConfig{Enabled: true},
+		Storage: StorageConfig{Pressure: StoragePressureConfig{Enabled: true}},
+	}
 	if err := yaml.Unmarshal(data, cfg); err != nil {
 		return nil, fmt.Errorf("parsing config file: %w", err)
 	}
@@ -196,6 +740,13 @@ func (c *Config) applyDefaults() {
 		c.App.LogFormat = "json"
 	}
 
+	// Resource defaults
+	for i := range c.Resources {
+		if c.Resources[i].Coalesce.Mode == "" {
+			c.Resources[i].Coalesce.Mode = CoalesceModeEphemeral
+		}
+	}
+
 	// Annotation defaults
 	if c.Annotation.Key == "" {
 		c.Annotation.Key = "bakerapps.net.maas"
@@ -208,30 +759,34 @@ func (c *Config) applyDefaults() {
 	if c.CloudEvents.TypePrefix == "" {
 		c.CloudEvents.TypePrefix = "net.bakerapps.beacon.resource"
 	}
-
-	// Endpoint defaults
-	if c.Endpoint.Method == "" {
-		c.Endpoint.Method = "POST"
+	if c.CloudEvents.Mode == "" {
+		c.CloudEvents.Mode = CloudEventsModeStructured
 	}
-	if c.Endpoint.Timeout.Duration == 0 {
-		c.Endpoint.Timeout.Duration = 30 * time.Second
+	if c.CloudEvents.Schema.Path == "" {
+		c.CloudEvents.Schema.Path = "/schemas/data.json"
 	}
 
-	// Retry defaults
-	if c.Endpoint.Retry.MaxAttempts == 0 {
-		c.Endpoint.Retry.MaxAttempts = 10
+	// Sink defaults
+	if c.Sink.Type == "" {
+		c.Sink.Type = SinkTypeHTTP
+	}
+	if c.Sink.Kafka.ClientID == "" {
+		c.Sink.Kafka.ClientID = "beacon"
 	}
-	if c.Endpoint.Retry.InitialBackoff.Duration == 0 {
-		c.Endpoint.Retry.InitialBackoff.Duration = 1 * time.Second
+	if c.Sink.Kafka.Key == "" {
+		c.Sink.Kafka.Key = KafkaKeyUID
 	}
-	if c.Endpoint.Retry.MaxBackoff.Duration == 0 {
-		c.Endpoint.Retry.MaxBackoff.Duration = 5 * time.Minute
+	if c.Sink.Kafka.Acks == "" {
+		c.Sink.Kafka.Acks = KafkaAcksAll
 	}
-	if c.Endpoint.Retry.BackoffMultiplier == 0 {
-		c.Endpoint.Retry.BackoffMultiplier = 2.0
+	if c.Sink.Kafka.ProduceTimeout.Duration == 0 {
+		c.Sink.Kafka.ProduceTimeout.Duration = 30 * time.Second
 	}
-	if c.Endpoint.Retry.Jitter == 0 {
-		c.Endpoint.Retry.Jitter = 0.1
+
+	// Endpoint defaults
+	c.Endpoint.applyDefaults()
+	for i := range c.Endpoints {
+		c.Endpoints[i].applyDefaults()
 	}
 
 	// Worker defaults
@@ -244,6 +799,9 @@ func (c *Config) applyDefaults() {
 	if c.Worker.Concurrency == 0 {
 		c.Worker.Concurrency = 5
 	}
+	if c.Worker.OrderingKey == "" {
+		c.Worker.OrderingKey = models.OrderingKeyUID
+	}
 
 	// Reconciliation defaults - use a pointer-like approach for booleans
 	// Since Go zero-value for bool is false, we always default Enabled and
@@ -273,6 +831,12 @@ func (c *Config) applyDefaults() {
 			c.Retention.RetentionPeriod.Duration = 48 * time.Hour
 		}
 	}
+	if c.Retention.BatchSize == 0 {
+		c.Retention.BatchSize = 500
+	}
+	if c.Retention.ArchiveDir == "" {
+		c.Retention.ArchiveDir = "/data/archive"
+	}
 
 	// Storage defaults
 	if c.Storage.MonitorInterval.Duration == 0 {
@@ -290,16 +854,22 @@ func (c *Config) applyDefaults() {
 	if c.Storage.CriticalThreshold == 0 {
 		c.Storage.CriticalThreshold = 90
 	}
+	if c.Storage.Pressure.WarningRetention.Duration == 0 {
+		c.Storage.Pressure.WarningRetention.Duration = c.Retention.RetentionPeriod.Duration / 4
+	}
+	if c.Storage.Pressure.CriticalRetention.Duration == 0 {
+		c.Storage.Pressure.CriticalRetention.Duration = min(time.Hour, c.Storage.Pressure.WarningRetention.Duration)
+	}
 
 	// Metrics defaults
 	if c.Metrics.Port == 0 {
-		c.Metrics.Enabled = true
 		c.Metrics.Port = 8080
+	}
+	if c.Metrics.Path == "" {
 		c.Metrics.Path = "/metrics"
-	} else {
-		if c.Metrics.Path == "" {
-			c.Metrics.Path = "/metrics"
-		}
+	}
+	if c.Metrics.Auth.Type == "" {
+		c.Metrics.Auth.Type = MetricsAuthNone
 	}
 
 	// Health defaults
@@ -312,6 +882,129 @@ func (c *Config) applyDefaults() {
 	if c.Health.Port == 0 {
 		c.Health.Port = 8080
 	}
+	if c.Health.HeartbeatTimeout.Duration == 0 {
+		c.Health.HeartbeatTimeout.Duration = 5 * time.Minute
+	}
+	if c.Health.DatabasePingInterval.Duration == 0 {
+		c.Health.DatabasePingInterval.Duration = 30 * time.Second
+	}
+
+	// Tracing defaults
+	if c.Tracing.ServiceName == "" {
+		c.Tracing.ServiceName = "beacon"
+	}
+	if c.Tracing.SampleRatio == 0 {
+		c.Tracing.SampleRatio = 1.0
+	}
+
+	// Audit defaults
+	if c.Audit.Path == "" {
+		c.Audit.Path = "/data/audit/audit.jsonl"
+	}
+	if c.Audit.MaxBytes == 0 {
+		c.Audit.MaxBytes = 100 << 20
+	}
+	if c.Audit.MaxAge.Duration == 0 {
+		c.Audit.MaxAge.Duration = 24 * time.Hour
+	}
+
+	// Backup defaults
+	if c.Backup.Interval.Duration == 0 {
+		c.Backup.Interval.Duration = 6 * time.Hour
+	}
+	if c.Backup.Dir == "" {
+		c.Backup.Dir = "/data/backups"
+	}
+	if c.Backup.Retain == 0 {
+		c.Backup.Retain = 7
+	}
+	if c.Backup.S3.Region == "" {
+		c.Backup.S3.Region = "us-east-1"
+	}
+	if c.Backup.S3.Timeout.Duration == 0 {
+		c.Backup.S3.Timeout.Duration = 5 * time.Minute
+	}
+}
+
+// applyDefaults fills in zero-valued endpoint and retry settings.
+func (e *EndpointConfig) applyDefaults() {
+	if e.Method == "" {
+		e.Method = "POST"
+	}
+	if e.Timeout.Duration == 0 {
+		e.Timeout.Duration = 30 * time.Second
+	}
+	if e.Batch.MaxEvents == 0 {
+		e.Batch.MaxEvents = 100
+	}
+	if e.Batch.MaxBytes == 0 {
+		e.Batch.MaxBytes = 1 << 20
+	}
+	if e.Batch.PartialFailure == "" {
+		e.Batch.PartialFailure = BatchPartialFailureAllOrNothing
+	}
+	if e.RetryAfter.MaxDelay.Duration == 0 {
+		e.RetryAfter.MaxDelay.Duration = time.Hour
+	}
+	if e.RetryAfter.PauseStatuses == nil {
+		e.RetryAfter.PauseStatuses = []int{429, 503}
+	}
+	if e.RateLimit.RequestsPerSecond > 0 && e.RateLimit.Burst == 0 {
+		e.RateLimit.Burst = int(math.Max(1, math.Ceil(e.RateLimit.RequestsPerSecond)))
+	}
+	if e.CircuitBreaker.ConsecutiveFailures == 0 {
+		e.CircuitBreaker.ConsecutiveFailures = 5
+	}
+	if e.CircuitBreaker.WindowSize == 0 {
+		e.CircuitBreaker.WindowSize = 20
+	}
+	if e.CircuitBreaker.OpenDuration.Duration == 0 {
+		e.CircuitBreaker.OpenDuration.Duration = 30 * time.Second
+	}
+	if e.Diagnostics.MaxBodyBytes == 0 {
+		e.Diagnostics.MaxBodyBytes = 2048
+	}
+	if e.Diagnostics.Headers == nil {
+		e.Diagnostics.Headers = []string{"Content-Type", "Retry-After", "X-Request-ID"}
+	}
+	if e.Diagnostics.MaxAttempts == 0 {
+		e.Diagnostics.MaxAttempts = 5
+	}
+	if e.Ack.Path == "" {
+		e.Ack.Path = "/ack"
+	}
+	if e.Ack.Timeout.Duration == 0 {
+		e.Ack.Timeout.Duration = 10 * time.Minute
+	}
+	if e.Ack.OnTimeout == "" {
+		e.Ack.OnTimeout = AckOnTimeoutRetry
+	}
+	if e.Auth.Type == "" {
+		e.Auth.Type = AuthTypeBearer
+	}
+	if e.Auth.ServiceAccountToken.Path == "" {
+		e.Auth.ServiceAccountToken.Path = "/var/run/secrets/beacon/token"
+	}
+	if e.Auth.OAuth2.RefreshBefore.Duration == 0 {
+		e.Auth.OAuth2.RefreshBefore.Duration = 60 * time.Second
+	}
+
+	// Retry defaults
+	if e.Retry.MaxAttempts == 0 {
+		e.Retry.MaxAttempts = 10
+	}
+	if e.Retry.InitialBackoff.Duration == 0 {
+		e.Retry.InitialBackoff.Duration = 1 * time.Second
+	}
+	if e.Retry.MaxBackoff.Duration == 0 {
+		e.Retry.MaxBackoff.Duration = 5 * time.Minute
+	}
+	if e.Retry.BackoffMultiplier == 0 {
+		e.Retry.BackoffMultiplier = 2.0
+	}
+	if e.Retry.Jitter == 0 {
+		e.Retry.Jitter = 0.1
+	}
 }
 
 // applyEnvOverrides applies environment variable overrides to the configuration.
@@ -325,17 +1018,66 @@ func (c *Config) applyEnvOverrides() {
 	if v := os.Getenv("ENDPOINT_URL"); v != "" {
 		c.Endpoint.URL = v
 	}
+	if v := os.Getenv("KAFKA_SASL_PASSWORD"); v != "" {
+		c.Sink.Kafka.SASL.Password = v
+	}
+	if v := os.Getenv("ENDPOINT_SIGNING_SECRETS"); v != "" {
+		c.Endpoint.Signing.Secrets = webhook.SplitSecrets(v)
+	}
+	if v := os.Getenv("METRICS_AUTH_TOKEN"); v != "" {
+		c.Metrics.Auth.Token = v
+	}
+	if v := os.Getenv("ENDPOINT_ACK_TOKEN"); v != "" {
+		c.Endpoint.Ack.Token = v
+	}
+	if v := os.Getenv("BACKUP_S3_ACCESS_KEY_ID"); v != "" {
+		c.Backup.S3.AccessKeyID = v
+	}
+	if v := os.Getenv("BACKUP_S3_SECRET_ACCESS_KEY"); v != "" {
+		c.Backup.S3.SecretAccessKey = v
+	}
+	for i := range c.Endpoints {
+		prefix := endpointEnvPrefix(c.Endpoints[i].Name)
+		if v := os.Getenv(prefix + "AUTH_TOKEN"); v != "" {
+			c.Endpoints[i].AuthToken = v
+		}
+		if v := os.Getenv(prefix + "SIGNING_SECRETS"); v != "" {
+			c.Endpoints[i].Signing.Secrets = webhook.SplitSecrets(v)
+		}
+	}
 }
 
 // validate checks that all required fields are populated and that enum values
 // are within the allowed set.
 func (c *Config) validate() error {
-	if c.Endpoint.URL == "" {
-		return fmt.Errorf("endpoint.url is required")
+	switch c.Sink.Type {
+	case SinkTypeHTTP:
+		if c.Endpoint.URL == "" && !c.Routed() {
+			return fmt.Errorf("endpoint.url is required")
+		}
+	case SinkTypeKafka:
+		if err := c.Sink.Kafka.validate(); err != nil {
+			return err
+		}
+		if c.Endpoint.Ack.Enabled {
+			return fmt.Errorf("endpoint.ack can only be used with sink.type http")
+		}
+	default:
+		return fmt.Errorf("sink.type must be one of: http, kafka; got %q", c.Sink.Type)
 	}
 	if len(c.Resources) == 0 {
 		return fmt.Errorf("at least one resource must be configured")
 	}
+	for i, res := range c.Resources {
+		if res.Coalesce.Window.Duration < 0 {
+			return fmt.Errorf("resources[%d].coalesce.window must not be negative", i)
+		}
+		switch res.Coalesce.Mode {
+		case CoalesceModeSuppress, CoalesceModeEphemeral:
+		default:
+			return fmt.Errorf("resources[%d].coalesce.mode must be one of: suppress, ephemeral; got %q", i, res.Coalesce.Mode)
+		}
+	}
 
 	// Validate log level
 	switch c.App.LogLevel {
@@ -353,13 +1095,487 @@ func (c *Config) validate() error {
 		return fmt.Errorf("app.logFormat must be one of: json, text; got %q", c.App.LogFormat)
 	}
 
-	// Validate endpoint method
-	switch c.Endpoint.Method {
+	// Validate endpoints and routes
+	if err := c.Endpoint.validate("endpoint", c.CloudEvents.Mode); err != nil {
+		return err
+	}
+	if err := c.validateRoutes(); err != nil {
+		return err
+	}
+
+	// Validate CloudEvents settings
+	switch c.CloudEvents.Mode {
+	case CloudEventsModeStructured, CloudEventsModeBinary:
+		// valid
+	default:
+		return fmt.Errorf("cloudEvents.mode must be one of: structured, binary; got %q", c.CloudEvents.Mode)
+	}
+	extNames := make(map[string]struct{}, len(c.CloudEvents.Extensions))
+	for i, ext := range c.CloudEvents.Extensions {
+		if !extensionNamePattern.MatchString(ext.Name) {
+			return fmt.Errorf("cloudEvents.extensions[%d].name %q must be 1-20 lower-case letters or digits", i, ext.Name)
+		}
+		if _, ok := reservedCloudEventAttributes[ext.Name]; ok {
+			return fmt.Errorf("cloudEvents.extensions[%d].name %q is a reserved CloudEvents attribute", i, ext.Name)
+		}
+		if _, dup := extNames[ext.Name]; dup {
+			return fmt.Errorf("cloudEvents.extensions[%d].name %q is duplicated", i, ext.Name)
+		}
+		extNames[ext.Name] = struct{}{}
+		if (ext.Value == "") == (ext.Template == "") {
+			return fmt.Errorf("cloudEvents.extensions[%d] must set exactly one of value or template", i)
+		}
+		if ext.Template != "" {
+			if _, err := template.New(ext.Name).Option("missingkey=error").Parse(ext.Template); err != nil {
+				return fmt.Errorf("cloudEvents.extensions[%d].template: %w", i, err)
+			}
+		}
+	}
+
+	// Validate worker ordering
+	switch c.Worker.OrderingKey {
+	case models.OrderingKeyUID, models.OrderingKeyName:
+	default:
+		return fmt.Errorf("worker.orderingKey must be one of: uid, name; got %q", c.Worker.OrderingKey)
+	}
+
+	// Validate tracing
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		return fmt.Errorf("tracing.sampleRatio must be between 0 and 1; got %v", c.Tracing.SampleRatio)
+	}
+	if c.Tracing.Endpoint != "" {
+		u, err := url.Parse(c.Tracing.Endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("tracing.endpoint must be an http or https URL; got %q", c.Tracing.Endpoint)
+		}
+	}
+
+	if err := c.validateServers(); err != nil {
+		return err
+	}
+
+	// Validate audit log
+	if c.Audit.MaxBytes < 0 {
+		return fmt.Errorf("audit.maxBytes must be positive; got %d", c.Audit.MaxBytes)
+	}
+	if c.Audit.MaxAge.Duration < 0 {
+		return fmt.Errorf("audit.maxAge must be positive; got %s", c.Audit.MaxAge.Duration)
+	}
+
+	if err := c.validateRetention(); err != nil {
+		return err
+	}
+
+	if err := c.validateStorage(); err != nil {
+		return err
+	}
+
+	if err := c.validateBackup(); err != nil {
+		return err
+	}
+
+	if !strings.HasPrefix(c.CloudEvents.Schema.Path, "/") {
+		return fmt.Errorf("cloudEvents.schema.path must start with /; got %q", c.CloudEvents.Schema.Path)
+	}
+
+	// Validate payload key patterns and redaction rules
+	patterns := map[string][]string{
+		"payload.labelFilter.allow":      c.Payload.LabelFilter.Allow,
+		"payload.labelFilter.deny":       c.Payload.LabelFilter.Deny,
+		"payload.annotationFilter.allow": c.Payload.AnnotationFilter.Allow,
+		"payload.annotationFilter.deny":  c.Payload.AnnotationFilter.Deny,
+	}
+	for i, r := range c.Payload.Redact {
+		if len(r.Keys) == 0 {
+			return fmt.Errorf("payload.redact[%d].keys is required", i)
+		}
+		switch r.Action {
+		case "", "redact", "sha256":
+			// valid
+		default:
+			return fmt.Errorf("payload.redact[%d].action must be one of: redact, sha256; got %q", i, r.Action)
+		}
+		patterns[fmt.Sprintf("payload.redact[%d].keys", i)] = r.Keys
+	}
+	for field, list := range patterns {
+		if err := validateKeyPatterns(field, list); err != nil {
+			return err
+		}
+	}
+
+	// Validate payload fields
+	seenFields := make(map[string]struct{}, len(c.Payload.Fields))
+	for i, f := range c.Payload.Fields {
+		if f.Name == "" {
+			return fmt.Errorf("payload.fields[%d].name is required", i)
+		}
+		if _, dup := seenFields[f.Name]; dup {
+			return fmt.Errorf("payload.fields[%d].name %q is duplicated", i, f.Name)
+		}
+		seenFields[f.Name] = struct{}{}
+		if strings.TrimSpace(f.JSONPath) == "" {
+			return fmt.Errorf("payload.fields[%d].jsonPath is required", i)
+		}
+		if err := jsonpath.New(f.Name).Parse(f.Template()); err != nil {
+			return fmt.Errorf("payload.fields[%d].jsonPath %q is invalid: %w", i, f.JSONPath, err)
+		}
+	}
+
+	return nil
+}
+
+// validateRetention checks the retention policies.
+func (c *Config) validateRetention() error {
+	r := c.Retention
+	if r.BatchSize < 0 {
+		return fmt.Errorf("retention.batchSize must be positive; got %d", r.BatchSize)
+	}
+	if r.Failed.Period.Duration < 0 {
+		return fmt.Errorf("retention.failed.period must be positive; got %s", r.Failed.Period.Duration)
+	}
+	if r.Stale.Intervals < 0 {
+		return fmt.Errorf("retention.stale.intervals must be positive; got %d", r.Stale.Intervals)
+	}
+	if r.Stale.Intervals > 0 && !c.Reconciliation.Enabled {
+		return fmt.Errorf("retention.stale.intervals requires reconciliation.enabled, which keeps the records of existing resources reconciled")
+	}
+	return nil
+}
+
+// validateStorage checks the storage thresholds and pressure settings.
+func (c *Config) validateStorage() error {
+	st := c.Storage
+	if st.WarningThreshold < 1 || st.WarningThreshold > 100 || st.CriticalThreshold < 1 || st.CriticalThreshold > 100 {
+		return fmt.Errorf("storage.warningThreshold and storage.criticalThreshold must be percentages between 1 and 100; got %d and %d", st.WarningThreshold, st.CriticalThreshold)
+	}
+	if st.WarningThreshold > st.CriticalThreshold {
+		return fmt.Errorf("storage.warningThreshold (%d) must not exceed storage.criticalThreshold (%d)", st.WarningThreshold, st.CriticalThreshold)
+	}
+	p := st.Pressure
+	if p.WarningRetention.Duration < 0 || p.CriticalRetention.Duration < 0 {
+		return fmt.Errorf("storage.pressure retention periods must be positive")
+	}
+	if p.WarningRetention.Duration > c.Retention.RetentionPeriod.Duration {
+		return fmt.Errorf("storage.pressure.warningRetention (%s) must not exceed retention.retentionPeriod (%s)", p.WarningRetention.Duration, c.Retention.RetentionPeriod.Duration)
+	}
+	if p.CriticalRetention.Duration > p.WarningRetention.Duration {
+		return fmt.Errorf("storage.pressure.criticalRetention (%s) must not exceed storage.pressure.warningRetention (%s)", p.CriticalRetention.Duration, p.WarningRetention.Duration)
+	}
+	return nil
+}
+
+// validateBackup checks the backup settings.
+func (c *Config) validateBackup() error {
+	b := c.Backup
+	if b.Interval.Duration < 0 {
+		return fmt.Errorf("backup.interval must be positive; got %s", b.Interval.Duration)
+	}
+	if b.Retain < 0 {
+		return fmt.Errorf("backup.retain must be at least 1; got %d", b.Retain)
+	}
+	if !b.S3.Enabled {
+		return nil
+	}
+	u, err := url.Parse(b.S3.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("backup.s3.endpoint must be an http or https URL; got %q", b.S3.Endpoint)
+	}
+	if b.S3.Bucket == "" {
+		return fmt.Errorf("backup.s3.bucket is required when backup.s3.enabled is true")
+	}
+	if b.S3.AccessKeyID == "" || b.S3.SecretAccessKey == "" {
+		return fmt.Errorf("backup.s3.enabled requires the BACKUP_S3_ACCESS_KEY_ID and BACKUP_S3_SECRET_ACCESS_KEY environment variables")
+	}
+	return nil
+}
+
+// validateServers checks the metrics and health listener settings.
+func (c *Config) validateServers() error {
+	if c.Metrics.Port < 0 || c.Metrics.Port > 65535 {
+		return fmt.Errorf("metrics.port must be between 1 and 65535; got %d", c.Metrics.Port)
+	}
+	if c.Health.Port < 0 || c.Health.Port > 65535 {
+		return fmt.Errorf("health.port must be between 1 and 65535; got %d", c.Health.Port)
+	}
+	for field, path := range map[string]string{
+		"metrics.path":         c.Metrics.Path,
+		"health.livenessPath":  c.Health.LivenessPath,
+		"health.readinessPath": c.Health.ReadinessPath,
+	} {
+		if !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("%s must start with /; got %q", field, path)
+		}
+	}
+
+	tlsCfg := c.Metrics.TLS
+	if (tlsCfg.CertFile == "") != (tlsCfg.KeyFile == "") {
+		return fmt.Errorf("metrics.tls.certFile and metrics.tls.keyFile must be set together")
+	}
+	if tlsCfg.ClientCAFile != "" && !tlsCfg.Enabled() {
+		return fmt.Errorf("metrics.tls.clientCAFile requires metrics.tls.certFile")
+	}
+	if tlsCfg.Enabled() && c.Metrics.Enabled && c.Metrics.Port == c.Health.Port {
+		// The probes and acknowledgement callbacks stay on plain HTTP.
+		return fmt.Errorf("metrics.tls requires metrics.port to differ from health.port; both are %d", c.Health.Port)
+	}
+
+	switch c.Metrics.Auth.Type {
+	case MetricsAuthNone:
+	case MetricsAuthBearer:
+		if c.Metrics.Auth.TokenFile == "" && c.Metrics.Auth.Token == "" {
+			return fmt.Errorf("metrics.auth.type bearer requires metrics.auth.tokenFile or METRICS_AUTH_TOKEN")
+		}
+	case MetricsAuthMTLS:
+		if tlsCfg.ClientCAFile == "" {
+			return fmt.Errorf("metrics.auth.type mtls requires metrics.tls.clientCAFile")
+		}
+	default:
+		return fmt.Errorf("metrics.auth.type must be one of: none, bearer, mtls; got %q", c.Metrics.Auth.Type)
+	}
+
+	if c.Metrics.Admin.Enabled && !c.Metrics.Enabled {
+		return fmt.Errorf("metrics.admin.enabled requires metrics.enabled")
+	}
+	if c.Metrics.Admin.Enabled && c.Metrics.Auth.Type == MetricsAuthNone {
+		return fmt.Errorf("metrics.admin.enabled requires metrics.auth.type bearer or mtls")
+	}
+	return nil
+}
+
+// validateRoutes checks the named endpoints and the routes that select them.
+func (c *Config) validateRoutes() error {
+	if !c.Routed() {
+		if len(c.Routes) > 0 {
+			return fmt.Errorf("routes require at least one entry in endpoints")
+		}
+		return nil
+	}
+	if c.Sink.Type != SinkTypeHTTP {
+		return fmt.Errorf("endpoints can only be used with sink.type http; got %q", c.Sink.Type)
+	}
+	if c.Endpoint.Ack.Enabled {
+		return fmt.Errorf("endpoint.ack cannot be used with endpoints; acknowledgement mode applies to the single endpoint only")
+	}
+	names := make(map[string]struct{}, len(c.Endpoints))
+	for i := range c.Endpoints {
+		e := &c.Endpoints[i]
+		field := fmt.Sprintf("endpoints[%d]", i)
+		if !endpointNamePattern.MatchString(e.Name) {
+			return fmt.Errorf("%s.name %q must be a lower-case DNS label (letters, digits, and hyphens)", field, e.Name)
+		}
+		if _, dup := names[e.Name]; dup {
+			return fmt.Errorf("%s.name %q is duplicated", field, e.Name)
+		}
+		names[e.Name] = struct{}{}
+		if e.URL == "" {
+			return fmt.Errorf("%s.url is required", field)
+		}
+		if e.Ack.Enabled {
+			return fmt.Errorf("%s.ack is not supported; acknowledgement mode applies to the single endpoint only", field)
+		}
+		if err := e.validate(field, c.CloudEvents.Mode); err != nil {
+			return err
+		}
+	}
+	if len(c.Routes) == 0 {
+		return fmt.Errorf("routes must contain at least one route when endpoints are configured")
+	}
+	for i, r := range c.Routes {
+		if len(r.Endpoints) == 0 {
+			return fmt.Errorf("routes[%d].endpoints is required", i)
+		}
+		for j, name := range r.Endpoints {
+			if _, ok := names[name]; !ok {
+				return fmt.Errorf("routes[%d].endpoints[%d] %q is not a configured endpoint", i, j, name)
+			}
+		}
+	}
+	return nil
+}
+
+// validate checks the settings of one endpoint. field is its position in the
+// configuration, used as the prefix of error messages.
+func (e *EndpointConfig) validate(field string, cloudEventsMode string) error {
+	// Validate method
+	switch e.Method {
 	case "POST", "PUT", "PATCH":
 		// valid
 	default:
-		return fmt.Errorf("endpoint.method must be one of: POST, PUT, PATCH; got %q", c.Endpoint.Method)
+		return fmt.Errorf("%s.method must be one of: POST, PUT, PATCH; got %q", field, e.Method)
+	}
+
+	// Validate batching
+	if e.Batch.MaxEvents < 1 {
+		return fmt.Errorf("%s.batch.maxEvents must be at least 1; got %d", field, e.Batch.MaxEvents)
+	}
+	if e.Batch.MaxBytes < 1 {
+		return fmt.Errorf("%s.batch.maxBytes must be at least 1; got %d", field, e.Batch.MaxBytes)
+	}
+	switch e.Batch.PartialFailure {
+	case BatchPartialFailureAllOrNothing, BatchPartialFailurePerItem:
+		// valid
+	default:
+		return fmt.Errorf("%s.batch.partialFailure must be one of: allOrNothing, perItem; got %q", field, e.Batch.PartialFailure)
+	}
+	if e.Batch.Enabled && cloudEventsMode == CloudEventsModeBinary {
+		return fmt.Errorf("%s.batch cannot be enabled with cloudEvents.mode binary; the batch format is structured only", field)
+	}
+
+	// Validate Retry-After handling and rate limiting
+	if e.RetryAfter.MaxDelay.Duration < 0 {
+		return fmt.Errorf("%s.retryAfter.maxDelay must not be negative", field)
+	}
+	for i, code := range e.RetryAfter.PauseStatuses {
+		if code < 400 || code > 599 {
+			return fmt.Errorf("%s.retryAfter.pauseStatuses[%d] must be an HTTP error status; got %d", field, i, code)
+		}
+	}
+	if e.RateLimit.RequestsPerSecond < 0 {
+		return fmt.Errorf("%s.rateLimit.requestsPerSecond must not be negative; got %g", field, e.RateLimit.RequestsPerSecond)
+	}
+	if e.RateLimit.Burst < 0 {
+		return fmt.Errorf("%s.rateLimit.burst must not be negative; got %d", field, e.RateLimit.Burst)
 	}
 
+	// Validate circuit breaker
+	cb := e.CircuitBreaker
+	if cb.ConsecutiveFailures < 0 {
+		return fmt.Errorf("%s.circuitBreaker.consecutiveFailures must not be negative; got %d", field, cb.ConsecutiveFailures)
+	}
+	if cb.FailureRate < 0 || cb.FailureRate > 1 {
+		return fmt.Errorf("%s.circuitBreaker.failureRate must be between 0 and 1; got %g", field, cb.FailureRate)
+	}
+	if cb.WindowSize < 1 {
+		return fmt.Errorf("%s.circuitBreaker.windowSize must be at least 1; got %d", field, cb.WindowSize)
+	}
+	if cb.OpenDuration.Duration < 0 {
+		return fmt.Errorf("%s.circuitBreaker.openDuration must not be negative", field)
+	}
+
+	// Validate asynchronous acknowledgement
+	if e.Ack.Enabled {
+		if !strings.HasPrefix(e.Ack.Path, "/") {
+			return fmt.Errorf("%s.ack.path must start with /; got %q", field, e.Ack.Path)
+		}
+		if e.Ack.Timeout.Duration < 0 {
+			return fmt.Errorf("%s.ack.timeout must not be negative", field)
+		}
+		switch e.Ack.OnTimeout {
+		case AckOnTimeoutRetry, AckOnTimeoutFail:
+			// valid
+		default:
+			return fmt.Errorf("%s.ack.onTimeout must be one of: retry, fail; got %q", field, e.Ack.OnTimeout)
+		}
+		if e.Ack.Token == "" {
+			return fmt.Errorf("%s.ack requires the ENDPOINT_ACK_TOKEN environment variable to authenticate callbacks", field)
+		}
+	}
+
+	// Validate diagnostics
+	if d := e.Diagnostics.MaxBodyBytes; d < 1 || d > maxDiagnosticsBodyBytes {
+		return fmt.Errorf("%s.diagnostics.maxBodyBytes must be between 1 and %d; got %d", field, maxDiagnosticsBodyBytes, d)
+	}
+	if e.Diagnostics.MaxAttempts < 1 {
+		return fmt.Errorf("%s.diagnostics.maxAttempts must be at least 1; got %d", field, e.Diagnostics.MaxAttempts)
+	}
+
+	// Validate authentication
+	switch e.Auth.Type {
+	case AuthTypeBearer, AuthTypeServiceAccountToken:
+		// valid
+	case AuthTypeOAuth2:
+		if err := e.Auth.OAuth2.validate(field + ".auth.oauth2"); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%s.auth.type must be one of: bearer, oauth2, serviceAccountToken; got %q", field, e.Auth.Type)
+	}
+
+	// Validate request signing
+	if e.Signing.Enabled {
+		if len(e.Signing.Secrets) == 0 && e.Signing.SecretsFile == "" {
+			return fmt.Errorf("%s.signing requires %s.signing.secretsFile or the %sSIGNING_SECRETS environment variable", field, field, endpointEnvPrefix(e.Name))
+		}
+		for i, secret := range e.Signing.Secrets {
+			if _, err := webhook.ParseSecret(secret); err != nil {
+				return fmt.Errorf("%sSIGNING_SECRETS entry %d: %w", endpointEnvPrefix(e.Name), i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validate checks the Kafka sink settings.
+func (k *KafkaConfig) validate() error {
+	if len(k.Brokers) == 0 {
+		return fmt.Errorf("sink.kafka.brokers is required")
+	}
+	if k.Topic == "" {
+		return fmt.Errorf("sink.kafka.topic is required")
+	}
+	switch k.Key {
+	case KafkaKeyUID, KafkaKeyNamespacedName, KafkaKeyPartitionKey, KafkaKeyNone:
+		// valid
+	default:
+		return fmt.Errorf("sink.kafka.key must be one of: uid, namespacedName, partitionkey, none; got %q", k.Key)
+	}
+	switch k.Acks {
+	case KafkaAcksAll, KafkaAcksLeader, KafkaAcksNone:
+		// valid
+	default:
+		return fmt.Errorf("sink.kafka.acks must be one of: all, leader, none; got %q", k.Acks)
+	}
+	if k.Acks != KafkaAcksAll && !k.DisableIdempotence {
+		return fmt.Errorf("sink.kafka.acks must be all unless sink.kafka.disableIdempotence is set")
+	}
+	switch k.SASL.Mechanism {
+	case "":
+		// SASL disabled
+	case "PLAIN", "SCRAM-SHA-256", "SCRAM-SHA-512":
+		if k.SASL.Username == "" {
+			return fmt.Errorf("sink.kafka.sasl.username is required when sasl.mechanism is set")
+		}
+	default:
+		return fmt.Errorf("sink.kafka.sasl.mechanism must be one of: PLAIN, SCRAM-SHA-256, SCRAM-SHA-512; got %q", k.SASL.Mechanism)
+	}
+	if (k.TLS.CertFile == "") != (k.TLS.KeyFile == "") {
+		return fmt.Errorf("sink.kafka.tls.certFile and sink.kafka.tls.keyFile must be set together")
+	}
+	return nil
+}
+
+// validate checks the OAuth2 client credentials settings.
+func (o *OAuth2Config) validate(field string) error {
+	if o.TokenURL == "" {
+		return fmt.Errorf("%s.tokenURL is required", field)
+	}
+	if u, err := url.Parse(o.TokenURL); err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("%s.tokenURL must be an absolute URL; got %q", field, o.TokenURL)
+	}
+	if o.ClientID == "" {
+		return fmt.Errorf("%s.clientID is required", field)
+	}
+	if o.ClientSecretFile == "" {
+		return fmt.Errorf("%s.clientSecretFile is required", field)
+	}
+	if o.RefreshBefore.Duration < 0 {
+		return fmt.Errorf("%s.refreshBefore must not be negative", field)
+	}
+	return nil
+}
+
+// validateKeyPatterns checks that every glob and "regex:" pattern compiles.
+func validateKeyPatterns(field string, patterns []string) error {
+	for i, p := range patterns {
+		if expr, ok := strings.CutPrefix(p, "regex:"); ok {
+			if _, err := regexp.Compile(expr); err != nil {
+				return fmt.Errorf("%s[%d]: invalid regular expression %q: %w", field, i, p, err)
+			}
+			continue
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("%s[%d]: invalid glob %q: %w", field, i, p, err)
+		}
+	}
 	return nil
 }
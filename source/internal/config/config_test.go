@@ -139,6 +139,8 @@ func TestLoadMinimalConfigAppliesDefaults(t *testing.T) {
 	assert.Equal(t, "/healthz", cfg.Health.LivenessPath)
 	assert.Equal(t, "/ready", cfg.Health.ReadinessPath)
 	assert.Equal(t, 8080, cfg.Health.Port)
+	assert.Equal(t, 5*time.Minute, cfg.Health.HeartbeatTimeout.Duration)
+	assert.Equal(t, 30*time.Second, cfg.Health.DatabasePingInterval.Duration)
 }
 
 func TestLoadMissingEndpointURL(t *testing.T) {
@@ -293,7 +295,898 @@ endpoint:
 	assert.Contains(t, err.Error(), "parsing config file")
 }
 
+func TestLoadPayloadFields(t *testing.T) {
+	content := `
+resources:
+  - apiVersion: v1
+    kind: Pod
+endpoint:
+  url: https://example.com/notify
+payload:
+  fields:
+    - name: model
+      jsonPath: .spec.model.name
+    - name: replicas
+      jsonPath: "{.spec.replicas}"
+`
+	path := writeTempConfig(t, content)
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	require.Len(t, cfg.Payload.Fields, 2)
+	assert.Equal(t, "model", cfg.Payload.Fields[0].Name)
+	assert.Equal(t, "{.spec.model.name}", cfg.Payload.Fields[0].Template())
+	assert.Equal(t, "{.spec.replicas}", cfg.Payload.Fields[1].Template())
+}
+
+func TestLoadInvalidPayloadFieldPath(t *testing.T) {
+	content := `
+resources:
+  - apiVersion: v1
+    kind: Pod
+endpoint:
+  url: https://example.com/notify
+payload:
+  fields:
+    - name: broken
+      jsonPath: "{.spec[}"
+`
+	path := writeTempConfig(t, content)
+	_, err := Load(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "payload.fields[0].jsonPath")
+}
+
+func TestLoadDuplicatePayloadFieldName(t *testing.T) {
+	content := `
+resources:
+  - apiVersion: v1
+    kind: Pod
+endpoint:
+  url: https://example.com/notify
+payload:
+  fields:
+    - name: replicas
+      jsonPath: .spec.replicas
+    - name: replicas
+      jsonPath: .status.replicas
+`
+	path := writeTempConfig(t, content)
+	_, err := Load(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "duplicated")
+}
+
+func TestLoadPayloadFilterAndRedact(t *testing.T) {
+	content := `
+resources:
+  - apiVersion: v1
+    kind: Pod
+endpoint:
+  url: https://example.com/notify
+payload:
+  labelFilter:
+    allow: ["app.kubernetes.io/*"]
+    deny: ["regex:^internal\\."]
+  annotationFilter:
+    deny: ["kubectl.kubernetes.io/*"]
+  redact:
+    - keys: ["example.com/email"]
+      action: sha256
+`
+	path := writeTempConfig(t, content)
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"app.kubernetes.io/*"}, cfg.Payload.LabelFilter.Allow)
+	assert.Equal(t, []string{`regex:^internal\.`}, cfg.Payload.LabelFilter.Deny)
+	assert.Equal(t, []string{"kubectl.kubernetes.io/*"}, cfg.Payload.AnnotationFilter.Deny)
+	require.Len(t, cfg.Payload.Redact, 1)
+	assert.Equal(t, "sha256", cfg.Payload.Redact[0].Action)
+}
+
+func TestLoadInvalidPayloadRedactAction(t *testing.T) {
+	content := `
+resources:
+  - apiVersion: v1
+    kind: Pod
+endpoint:
+  url: https://example.com/notify
+payload:
+  redact:
+    - keys: ["example.com/email"]
+      action: encrypt
+`
+	path := writeTempConfig(t, content)
+	_, err := Load(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "payload.redact[0].action")
+}
+
+func TestLoadInvalidPayloadFilterRegex(t *testing.T) {
+	content := `
+resources:
+  - apiVersion: v1
+    kind: Pod
+endpoint:
+  url: https://example.com/notify
+payload:
+  annotationFilter:
+    deny: ["regex:("]
+`
+	path := writeTempConfig(t, content)
+	_, err := Load(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "payload.annotationFilter.deny[0]")
+}
+
+func TestLoadCloudEventsDefaults(t *testing.T) {
+	content := `
+resources:
+  - apiVersion: v1
+    kind: Pod
+endpoint:
+  url: https://example.com/notify
+`
+	path := writeTempConfig(t, content)
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, CloudEventsModeStructured, cfg.CloudEvents.Mode)
+	assert.Equal(t, "/schemas/data.json", cfg.CloudEvents.Schema.Path)
+	assert.False(t, cfg.CloudEvents.Schema.Validate)
+}
+
+func TestLoadCloudEventsBinaryWithExtensions(t *testing.T) {
+	content := `
+resources:
+  - apiVersion: v1
+    kind: Pod
+endpoint:
+  url: https://example.com/notify
+cloudEvents:
+  mode: binary
+  dataSchema: https://example.com/schemas/data.json
+  extensions:
+    - name: cluster
+      value: prod-east
+    - name: partitionkey
+      template: "{{ .Namespace }}/{{ .Name }}"
+  schema:
+    validate: true
+`
+	path := writeTempConfig(t, content)
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, CloudEventsModeBinary, cfg.CloudEvents.Mode)
+	assert.Equal(t, "https://example.com/schemas/data.json", cfg.CloudEvents.DataSchema)
+	require.Len(t, cfg.CloudEvents.Extensions, 2)
+	assert.Equal(t, "prod-east", cfg.CloudEvents.Extensions[0].Value)
+	assert.Equal(t, "{{ .Namespace }}/{{ .Name }}", cfg.CloudEvents.Extensions[1].Template)
+	assert.True(t, cfg.CloudEvents.Schema.Validate)
+}
+
+func TestLoadInvalidCloudEventsExtensions(t *testing.T) {
+	tests := []struct {
+		name       string
+		extensions string
+		wantErr    string
+	}{
+		{"upper case name", `[{name: PartitionKey, value: x}]`, "lower-case"},
+		{"reserved name", `[{name: subject, value: x}]`, "reserved"},
+		{"duplicate", `[{name: a, value: x}, {name: a, value: y}]`, "duplicated"},
+		{"value and template", `[{name: a, value: x, template: y}]`, "exactly one"},
+		{"neither", `[{name: a}]`, "exactly one"},
+		{"bad template", `[{name: a, template: "{{ .UID "}]`, "template"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			content := `
+resources:
+  - apiVersion: v1
+    kind: Pod
+endpoint:
+  url: https://example.com/notify
+cloudEvents:
+  extensions: ` + tc.extensions + `
+`
+			path := writeTempConfig(t, content)
+			_, err := Load(path)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.wantErr)
+		})
+	}
+}
+
+func TestLoadInvalidCloudEventsMode(t *testing.T) {
+	content := `
+resources:
+  - apiVersion: v1
+    kind: Pod
+endpoint:
+  url: https://example.com/notify
+cloudEvents:
+  mode: batched
+`
+	path := writeTempConfig(t, content)
+	_, err := Load(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cloudEvents.mode")
+}
+
+func TestLoadEndpointBatch(t *testing.T) {
+	content := `
+resources:
+  - apiVersion: v1
+    kind: Pod
+endpoint:
+  url: https://example.com/notify
+  batch:
+    enabled: true
+    maxEvents: 50
+    partialFailure: perItem
+`
+	path := writeTempConfig(t, content)
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	assert.True(t, cfg.Endpoint.Batch.Enabled)
+	assert.Equal(t, 50, cfg.Endpoint.Batch.MaxEvents)
+	assert.Equal(t, 1<<20, cfg.Endpoint.Batch.MaxBytes)
+	assert.Equal(t, BatchPartialFailurePerItem, cfg.Endpoint.Batch.PartialFailure)
+}
+
+func TestLoadEndpointBatchInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		extra   string
+		wantErr string
+	}{
+		{"bad policy", "endpoint:\n  url: https://example.com\n  batch:\n    partialFailure: some\n", "endpoint.batch.partialFailure"},
+		{"negative max events", "endpoint:\n  url: https://example.com\n  batch:\n    maxEvents: -1\n", "endpoint.batch.maxEvents"},
+		{"binary mode", "endpoint:\n  url: https://example.com\n  batch:\n    enabled: true\ncloudEvents:\n  mode: binary\n", "binary"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			content := "resources:\n  - apiVersion: v1\n    kind: Pod\n" + tc.extra
+			path := writeTempConfig(t, content)
+			_, err := Load(path)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.wantErr)
+		})
+	}
+}
+
+func TestLoadKafkaSink(t *testing.T) {
+	t.Setenv("KAFKA_SASL_PASSWORD", "kafka-secret")
+	content := `
+resources:
+  - apiVersion: v1
+    kind: Pod
+sink:
+  type: kafka
+  kafka:
+    brokers: ["kafka-0:9092", "kafka-1:9092"]
+    topic: beacon-events
+    sasl:
+      mechanism: SCRAM-SHA-512
+      username: beacon
+`
+	path := writeTempConfig(t, content)
+	cfg, err := Load(path)
+	require.NoError(t, err, "endpoint.url is not required for the kafka sink")
+	assert.Equal(t, SinkTypeKafka, cfg.Sink.Type)
+	assert.Equal(t, []string{"kafka-0:9092", "kafka-1:9092"}, cfg.Sink.Kafka.Brokers)
+	assert.Equal(t, "beacon", cfg.Sink.Kafka.ClientID)
+	assert.Equal(t, KafkaKeyUID, cfg.Sink.Kafka.Key)
+	assert.Equal(t, KafkaAcksAll, cfg.Sink.Kafka.Acks)
+	assert.Equal(t, 30*time.Second, cfg.Sink.Kafka.ProduceTimeout.Duration)
+	assert.Equal(t, "kafka-secret", cfg.Sink.Kafka.SASL.Password)
+}
+
+func TestLoadSinkDefaultsToHTTP(t *testing.T) {
+	path := writeTempConfig(t, "resources:\n  - apiVersion: v1\n    kind: Pod\nendpoint:\n  url: https://example.com\n")
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, SinkTypeHTTP, cfg.Sink.Type)
+}
+
+func TestLoadKafkaSinkInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		kafka   string
+		wantErr string
+	}{
+		{"missing brokers", "    topic: t\n", "sink.kafka.brokers"},
+		{"missing topic", "    brokers: [b:9092]\n", "sink.kafka.topic"},
+		{"bad key", "    brokers: [b:9092]\n    topic: t\n    key: name\n", "sink.kafka.key"},
+		{"acks without idempotence disabled", "    brokers: [b:9092]\n    topic: t\n    acks: leader\n", "disableIdempotence"},
+		{"sasl without username", "    brokers: [b:9092]\n    topic: t\n    sasl:\n      mechanism: PLAIN\n", "sasl.username"},
+		{"cert without key", "    brokers: [b:9092]\n    topic: t\n    tls:\n      enabled: true\n      certFile: /c.pem\n", "keyFile"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			content := "resources:\n  - apiVersion: v1\n    kind: Pod\nsink:\n  type: kafka\n  kafka:\n" + tc.kafka
+			path := writeTempConfig(t, content)
+			_, err := Load(path)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.wantErr)
+		})
+	}
+}
+
+func TestLoadEndpointSigning(t *testing.T) {
+	t.Setenv("ENDPOINT_SIGNING_SECRETS", "whsec_MfKQ9r8GKYqrTwjUPD8ILPZIo2LaLaSw,whsec_c2Vjb25kLXNlY3JldC1mb3Itcm90YXRpb24=")
+	path := writeTempConfig(t, "resources:\n  - apiVersion: v1\n    kind: Pod\nendpoint:\n  url: https://example.com\n  signing:\n    enabled: true\n")
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	assert.True(t, cfg.Endpoint.Signing.Enabled)
+	assert.Len(t, cfg.Endpoint.Signing.Secrets, 2)
+}
+
+func TestLoadEndpointSigningInvalid(t *testing.T) {
+	content := "resources:\n  - apiVersion: v1\n    kind: Pod\nendpoint:\n  url: https://example.com\n  signing:\n    enabled: true\n"
+
+	_, err := Load(writeTempConfig(t, content))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "endpoint.signing requires")
+
+	t.Setenv("ENDPOINT_SIGNING_SECRETS", "whsec_c2hvcnQ=")
+	_, err = Load(writeTempConfig(t, content))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ENDPOINT_SIGNING_SECRETS entry 0")
+	assert.NotContains(t, err.Error(), "c2hvcnQ", "secret values must not be echoed")
+}
+
+func TestLoadEndpointOAuth2(t *testing.T) {
+	content := `
+resources:
+  - apiVersion: v1
+    kind: Pod
+endpoint:
+  url: https://example.com/notify
+  auth:
+    type: oauth2
+    oauth2:
+      tokenURL: https://auth.example.com/oauth2/token
+      clientID: beacon
+      clientSecretFile: /etc/beacon/oauth2/client-secret
+      scopes: [events:write]
+      audience: https://platform.example.com
+`
+	path := writeTempConfig(t, content)
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, AuthTypeOAuth2, cfg.Endpoint.Auth.Type)
+	assert.Equal(t, []string{"events:write"}, cfg.Endpoint.Auth.OAuth2.Scopes)
+	assert.Equal(t, 60*time.Second, cfg.Endpoint.Auth.OAuth2.RefreshBefore.Duration)
+}
+
+func TestLoadEndpointServiceAccountToken(t *testing.T) {
+	path := writeTempConfig(t, "resources:\n  - apiVersion: v1\n    kind: Pod\nendpoint:\n  url: https://example.com\n  auth:\n    type: serviceAccountToken\n")
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, AuthTypeServiceAccountToken, cfg.Endpoint.Auth.Type)
+	assert.Equal(t, "/var/run/secrets/beacon/token", cfg.Endpoint.Auth.ServiceAccountToken.Path)
+}
+
+func TestLoadEndpointAuthInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		auth    string
+		wantErr string
+	}{
+		{"unknown type", "    type: basic\n", "endpoint.auth.type"},
+		{"missing token URL", "    type: oauth2\n    oauth2:\n      clientID: c\n      clientSecretFile: /s\n", "tokenURL is required"},
+		{"relative token URL", "    type: oauth2\n    oauth2:\n      tokenURL: /token\n      clientID: c\n      clientSecretFile: /s\n", "absolute URL"},
+		{"missing client ID", "    type: oauth2\n    oauth2:\n      tokenURL: https://a/t\n      clientSecretFile: /s\n", "clientID"},
+		{"missing secret file", "    type: oauth2\n    oauth2:\n      tokenURL: https://a/t\n      clientID: c\n", "clientSecretFile"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			content := "resources:\n  - apiVersion: v1\n    kind: Pod\nendpoint:\n  url: https://example.com\n  auth:\n" + tc.auth
+			_, err := Load(writeTempConfig(t, content))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.wantErr)
+		})
+	}
+}
+
+func TestLoadEndpointRetryAfterAndRateLimit(t *testing.T) {
+	path := writeTempConfig(t, "resources:\n  - apiVersion: v1\n    kind: Pod\nendpoint:\n  url: https://example.com\n  rateLimit:\n    requestsPerSecond: 2.5\n")
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour, cfg.Endpoint.RetryAfter.MaxDelay.Duration)
+	assert.Equal(t, []int{429, 503}, cfg.Endpoint.RetryAfter.PauseStatuses)
+	assert.Equal(t, 2.5, cfg.Endpoint.RateLimit.RequestsPerSecond)
+	assert.Equal(t, 3, cfg.Endpoint.RateLimit.Burst)
+
+	path = writeTempConfig(t, "resources:\n  - apiVersion: v1\n    kind: Pod\nendpoint:\n  url: https://example.com\n  retryAfter:\n    pauseStatuses: []\n")
+	cfg, err = Load(path)
+	require.NoError(t, err)
+	assert.Empty(t, cfg.Endpoint.RetryAfter.PauseStatuses, "an explicit empty list disables endpoint pauses")
+	assert.Zero(t, cfg.Endpoint.RateLimit.Burst)
+}
+
+func TestLoadEndpointRetryAfterAndRateLimitInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		wantErr  string
+	}{
+		{"negative max delay", "  retryAfter:\n    maxDelay: -1s\n", "endpoint.retryAfter.maxDelay"},
+		{"success pause status", "  retryAfter:\n    pauseStatuses: [200]\n", "endpoint.retryAfter.pauseStatuses[0]"},
+		{"negative rate", "  rateLimit:\n    requestsPerSecond: -1\n", "endpoint.rateLimit.requestsPerSecond"},
+		{"negative burst", "  rateLimit:\n    requestsPerSecond: 1\n    burst: -1\n", "endpoint.rateLimit.burst"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			content := "resources:\n  - apiVersion: v1\n    kind: Pod\nendpoint:\n  url: https://example.com\n" + tc.endpoint
+			_, err := Load(writeTempConfig(t, content))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.wantErr)
+		})
+	}
+}
+
+func TestLoadEndpointCircuitBreaker(t *testing.T) {
+	path := writeTempConfig(t, "resources:\n  - apiVersion: v1\n    kind: Pod\nendpoint:\n  url: https://example.com\n  circuitBreaker:\n    enabled: true\n    failureRate: 0.5\n")
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	cb := cfg.Endpoint.CircuitBreaker
+	assert.True(t, cb.Enabled)
+	assert.Equal(t, 5, cb.ConsecutiveFailures)
+	assert.Equal(t, 0.5, cb.FailureRate)
+	assert.Equal(t, 20, cb.WindowSize)
+	assert.Equal(t, 30*time.Second, cb.OpenDuration.Duration)
+}
+
+func TestLoadEndpointCircuitBreakerInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		breaker string
+		wantErr string
+	}{
+		{"negative consecutive failures", "    consecutiveFailures: -1\n", "endpoint.circuitBreaker.consecutiveFailures"},
+		{"failure rate above one", "    failureRate: 1.5\n", "endpoint.circuitBreaker.failureRate"},
+		{"negative window", "    windowSize: -1\n", "endpoint.circuitBreaker.windowSize"},
+		{"negative open duration", "    openDuration: -5s\n", "endpoint.circuitBreaker.openDuration"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			content := "resources:\n  - apiVersion: v1\n    kind: Pod\nendpoint:\n  url: https://example.com\n  circuitBreaker:\n    enabled: true\n" + tc.breaker
+			_, err := Load(writeTempConfig(t, content))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.wantErr)
+		})
+	}
+}
+
+func TestLoadEndpointDiagnostics(t *testing.T) {
+	cfg, err := Load(writeTempConfig(t, "resources:\n  - apiVersion: v1\n    kind: Pod\nendpoint:\n  url: https://example.com\n"))
+	require.NoError(t, err)
+	d := cfg.Endpoint.Diagnostics
+	assert.Equal(t, 2048, d.MaxBodyBytes)
+	assert.Equal(t, []string{"Content-Type", "Retry-After", "X-Request-ID"}, d.Headers)
+	assert.Equal(t, 5, d.MaxAttempts)
+
+	tests := []struct {
+		name        string
+		diagnostics string
+		wantErr     string
+	}{
+		{"negative body size", "    maxBodyBytes: -1\n", "endpoint.diagnostics.maxBodyBytes"},
+		{"body size too large", "    maxBodyBytes: 1048576\n", "endpoint.diagnostics.maxBodyBytes"},
+		{"negative attempts", "    maxAttempts: -1\n", "endpoint.diagnostics.maxAttempts"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			content := "resources:\n  - apiVersion: v1\n    kind: Pod\nendpoint:\n  url: https://example.com\n  diagnostics:\n" + tc.diagnostics
+			_, err := Load(writeTempConfig(t, content))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.wantErr)
+		})
+	}
+}
+
+func TestLoadEndpointAck(t *testing.T) {
+	t.Setenv("ENDPOINT_ACK_TOKEN", "callback-secret")
+	cfg, err := Load(writeTempConfig(t, "resources:\n  - apiVersion: v1\n    kind: Pod\nendpoint:\n  url: https://example.com\n  ack:\n    enabled: true\n"))
+	require.NoError(t, err)
+	ack := cfg.Endpoint.Ack
+	assert.True(t, ack.Enabled)
+	assert.Equal(t, "/ack", ack.Path)
+	assert.Equal(t, 10*time.Minute, ack.Timeout.Duration)
+	assert.Equal(t, AckOnTimeoutRetry, ack.OnTimeout)
+	assert.Equal(t, "callback-secret", ack.Token)
+}
+
+func TestLoadEndpointAckInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   string
+		content string
+		wantErr string
+	}{
+		{"missing token", "", "endpoint:\n  url: https://example.com\n  ack:\n    enabled: true\n", "ENDPOINT_ACK_TOKEN"},
+		{"bad timeout action", "t", "endpoint:\n  url: https://example.com\n  ack:\n    enabled: true\n    onTimeout: drop\n", "endpoint.ack.onTimeout"},
+		{"relative path", "t", "endpoint:\n  url: https://example.com\n  ack:\n    enabled: true\n    path: ack\n", "endpoint.ack.path"},
+		{"kafka sink", "t", "sink:\n  type: kafka\n  kafka:\n    brokers: [localhost:9092]\n    topic: events\nendpoint:\n  ack:\n    enabled: true\n", "sink.type http"},
+		{"named endpoint", "t", "endpoints:\n  - name: billing\n    url: https://example.com\n    ack:\n      enabled: true\nroutes:\n  - endpoints: [billing]\n", "endpoints[0].ack"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("ENDPOINT_ACK_TOKEN", tc.token)
+			content := "resources:\n  - apiVersion: v1\n    kind: Pod\n" + tc.content
+			_, err := Load(writeTempConfig(t, content))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.wantErr)
+		})
+	}
+}
+
+func TestLoadWorkerOrderingKey(t *testing.T) {
+	cfg, err := Load(writeTempConfig(t, "resources:\n  - apiVersion: v1\n    kind: Pod\nendpoint:\n  url: https://example.com\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "uid", cfg.Worker.OrderingKey)
+
+	cfg, err = Load(writeTempConfig(t, "resources:\n  - apiVersion: v1\n    kind: Pod\nendpoint:\n  url: https://example.com\nworker:\n  orderingKey: name\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "name", cfg.Worker.OrderingKey)
+
+	_, err = Load(writeTempConfig(t, "resources:\n  - apiVersion: v1\n    kind: Pod\nendpoint:\n  url: https://example.com\nworker:\n  orderingKey: namespace\n"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "worker.orderingKey")
+}
+
+func TestLoadResourceCoalesce(t *testing.T) {
+	content := "resources:\n  - apiVersion: v1\n    kind: Pod\n    coalesce:\n      window: 30s\n  - apiVersion: batch/v1\n    kind: Job\nendpoint:\n  url: https://example.com\n"
+	cfg, err := Load(writeTempConfig(t, content))
+	require.NoError(t, err)
+
+	rule := cfg.CoalesceFor("Pod")
+	require.NotNil(t, rule)
+	assert.Equal(t, 30*time.Second, rule.Window.Duration)
+	assert.Equal(t, CoalesceModeEphemeral, rule.Mode)
+	assert.Nil(t, cfg.CoalesceFor("Job"))
+
+	_, err = Load(writeTempConfig(t, "resources:\n  - apiVersion: v1\n    kind: Pod\n    coalesce:\n      window: 30s\n      mode: drop\nendpoint:\n  url: https://example.com\n"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "resources[0].coalesce.mode")
+}
+
+func TestLoadEndpointsAndRoutes(t *testing.T) {
+	t.Setenv("ENDPOINT_SLA_TRACKER_AUTH_TOKEN", "sla-token")
+	content := `resources:
+  - apiVersion: v1
+    kind: Pod
+endpoints:
+  - name: billing
+    url: https://billing.example.com/events
+    retry:
+      maxAttempts: 3
+  - name: sla-tracker
+    url: https://sla.example.com/events
+routes:
+  - match:
+      resourceTypes: [LLMInferenceService]
+    endpoints: [billing]
+  - match:
+      annotationValues: [premium]
+      labels:
+        tier: gold
+    endpoints: [sla-tracker, billing]
+`
+	cfg, err := Load(writeTempConfig(t, content))
+	require.NoError(t, err, "endpoint.url is not required when routing")
+	assert.True(t, cfg.Routed())
+	require.Len(t, cfg.Endpoints, 2)
+	assert.Equal(t, 3, cfg.Endpoints[0].Retry.MaxAttempts)
+	assert.Equal(t, 30*time.Second, cfg.Endpoints[1].Timeout.Duration, "defaults apply to each endpoint")
+	assert.Equal(t, map[string]string{"tier": "gold"}, cfg.Routes[1].Match.Labels)
+
+	sla := cfg.ForEndpoint("sla-tracker")
+	require.NotNil(t, sla)
+	assert.Equal(t, "https://sla.example.com/events", sla.Endpoint.URL)
+	assert.Equal(t, "sla-token", sla.AuthToken)
+	assert.Nil(t, cfg.ForEndpoint("unknown"))
+}
+
+func TestLoadEndpointsAndRoutesInvalid(t *testing.T) {
+	const endpoints = "endpoints:\n  - name: billing\n    url: https://billing.example.com\n"
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"routes without endpoints", "endpoint:\n  url: https://example.com\nroutes:\n  - endpoints: [billing]\n", "routes require"},
+		{"no routes", endpoints, "routes must contain"},
+		{"unknown endpoint", endpoints + "routes:\n  - endpoints: [inventory]\n", `routes[0].endpoints[0] "inventory"`},
+		{"empty route", endpoints + "routes:\n  - match:\n      namespaces: [a]\n", "routes[0].endpoints is required"},
+		{"bad name", "endpoints:\n  - name: Billing\n    url: https://billing.example.com\nroutes:\n  - endpoints: [Billing]\n", "endpoints[0].name"},
+		{"duplicate name", endpoints + "  - name: billing\n    url: https://other.example.com\nroutes:\n  - endpoints: [billing]\n", "endpoints[1].name \"billing\" is duplicated"},
+		{"missing url", "endpoints:\n  - name: billing\nroutes:\n  - endpoints: [billing]\n", "endpoints[0].url is required"},
+		{"invalid endpoint setting", "endpoints:\n  - name: billing\n    url: https://billing.example.com\n    rateLimit:\n      requestsPerSecond: -1\nroutes:\n  - endpoints: [billing]\n", "endpoints[0].rateLimit.requestsPerSecond"},
+		{"kafka sink", "sink:\n  type: kafka\n  kafka:\n    brokers: [localhost:9092]\n    topic: events\n" + endpoints + "routes:\n  - endpoints: [billing]\n", "endpoints can only be used with sink.type http"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			content := "resources:\n  - apiVersion: v1\n    kind: Pod\n" + tc.content
+			_, err := Load(writeTempConfig(t, content))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.wantErr)
+		})
+	}
+}
+
 // writeTempConfig writes the given YAML content to a temporary file and returns its path.
+func TestLoadTracing(t *testing.T) {
+	cfg, err := Load(writeTempConfig(t, "resources:\n  - apiVersion: v1\n    kind: Pod\nendpoint:\n  url: https://example.com\ntracing:\n  enabled: true\n  endpoint: http://otel-collector:4318/v1/traces\n"))
+	require.NoError(t, err)
+	assert.True(t, cfg.Tracing.Enabled)
+	assert.Equal(t, "http://otel-collector:4318/v1/traces", cfg.Tracing.Endpoint)
+	assert.Equal(t, "beacon", cfg.Tracing.ServiceName)
+	assert.Equal(t, 1.0, cfg.Tracing.SampleRatio)
+}
+
+func TestLoadTracingInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"ratio above one", "tracing:\n  sampleRatio: 1.5\n", "tracing.sampleRatio"},
+		{"negative ratio", "tracing:\n  sampleRatio: -0.1\n", "tracing.sampleRatio"},
+		{"endpoint without scheme", "tracing:\n  endpoint: otel-collector:4318\n", "tracing.endpoint"},
+		{"traceparent extension", "cloudEvents:\n  extensions:\n    - name: traceparent\n      value: x\n", "traceparent"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			content := "resources:\n  - apiVersion: v1\n    kind: Pod\nendpoint:\n  url: https://example.com\n" + tc.content
+			_, err := Load(writeTempConfig(t, content))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.wantErr)
+		})
+	}
+}
+
+func TestLoadMetricsServer(t *testing.T) {
+	base := "resources:\n  - apiVersion: v1\n    kind: Pod\nendpoint:\n  url: https://example.com\n"
+
+	cfg, err := Load(writeTempConfig(t, base+"metrics:\n  enabled: false\n"))
+	require.NoError(t, err)
+	assert.False(t, cfg.Metrics.Enabled, "disabling metrics does not require a port")
+	assert.Equal(t, 8080, cfg.Metrics.Port)
+
+	t.Setenv("METRICS_AUTH_TOKEN", "s3cret")
+	cfg, err = Load(writeTempConfig(t, base+`metrics:
+  port: 9090
+  tls:
+    certFile: /certs/tls.crt
+    keyFile: /certs/tls.key
+  auth:
+    type: bearer
+  admin:
+    enabled: true
+health:
+  port: 8081
+`))
+	require.NoError(t, err)
+	assert.True(t, cfg.Metrics.Enabled)
+	assert.Equal(t, "/metrics", cfg.Metrics.Path)
+	assert.True(t, cfg.Metrics.TLS.Enabled())
+	assert.Equal(t, MetricsAuthBearer, cfg.Metrics.Auth.Type)
+	assert.Equal(t, "s3cret", cfg.Metrics.Auth.Token)
+	assert.True(t, cfg.Metrics.Admin.Enabled)
+	assert.Equal(t, 8081, cfg.Health.Port)
+}
+
+func TestLoadMetricsServerInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"cert without key", "metrics:\n  tls:\n    certFile: /certs/tls.crt\n", "metrics.tls.certFile and metrics.tls.keyFile"},
+		{"client CA without TLS", "metrics:\n  tls:\n    clientCAFile: /certs/ca.crt\n", "metrics.tls.clientCAFile requires"},
+		{"bearer without token", "metrics:\n  auth:\n    type: bearer\n", "metrics.auth.tokenFile or METRICS_AUTH_TOKEN"},
+		{"mtls without client CA", "metrics:\n  auth:\n    type: mtls\n", "metrics.tls.clientCAFile"},
+		{"unknown auth type", "metrics:\n  auth:\n    type: basic\n", "metrics.auth.type"},
+		{"admin without metrics", "metrics:\n  enabled: false\n  admin:\n    enabled: true\n", "metrics.admin.enabled requires metrics.enabled"},
+		{"admin without auth", "metrics:\n  admin:\n    enabled: true\n", "metrics.admin.enabled requires metrics.auth.type"},
+		{"TLS on the health port", "metrics:\n  tls:\n    certFile: /certs/tls.crt\n    keyFile: /certs/tls.key\n", "metrics.tls requires metrics.port to differ from health.port"},
+		{"relative path", "metrics:\n  path: metrics\n", "metrics.path"},
+		{"port out of range", "health:\n  port: 70000\n", "health.port"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			content := "resources:\n  - apiVersion: v1\n    kind: Pod\nendpoint:\n  url: https://example.com\n" + tc.content
+			_, err := Load(writeTempConfig(t, content))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.wantErr)
+		})
+	}
+}
+
+func TestLoadAudit(t *testing.T) {
+	base := "resources:\n  - apiVersion: v1\n    kind: Pod\nendpoint:\n  url: https://example.com\n"
+
+	cfg, err := Load(writeTempConfig(t, base))
+	require.NoError(t, err)
+	assert.False(t, cfg.Audit.Enabled)
+	assert.Equal(t, "/data/audit/audit.jsonl", cfg.Audit.Path)
+	assert.Equal(t, int64(100<<20), cfg.Audit.MaxBytes)
+	assert.Equal(t, 24*time.Hour, cfg.Audit.MaxAge.Duration)
+
+	cfg, err = Load(writeTempConfig(t, base+"audit:\n  enabled: true\n  path: /audit/beacon.jsonl\n  maxBytes: 1048576\n  maxAge: 1h\n  compress: true\n"))
+	require.NoError(t, err)
+	assert.True(t, cfg.Audit.Enabled)
+	assert.Equal(t, "/audit/beacon.jsonl", cfg.Audit.Path)
+	assert.Equal(t, int64(1<<20), cfg.Audit.MaxBytes)
+	assert.Equal(t, time.Hour, cfg.Audit.MaxAge.Duration)
+	assert.True(t, cfg.Audit.Compress)
+
+	_, err = Load(writeTempConfig(t, base+"audit:\n  maxBytes: -1\n"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "audit.maxBytes")
+}
+
+func TestLoadBackup(t *testing.T) {
+	base := "resources:\n  - apiVersion: v1\n    kind: Pod\nendpoint:\n  url: https://example.com\n"
+
+	cfg, err := Load(writeTempConfig(t, base))
+	require.NoError(t, err)
+	assert.False(t, cfg.Backup.Enabled)
+	assert.Equal(t, 6*time.Hour, cfg.Backup.Interval.Duration)
+	assert.Equal(t, "/data/backups", cfg.Backup.Dir)
+	assert.Equal(t, 7, cfg.Backup.Retain)
+	assert.Equal(t, "us-east-1", cfg.Backup.S3.Region)
+	assert.Equal(t, 5*time.Minute, cfg.Backup.S3.Timeout.Duration)
+
+	t.Setenv("BACKUP_S3_ACCESS_KEY_ID", "minioadmin")
+	t.Setenv("BACKUP_S3_SECRET_ACCESS_KEY", "minio-secret")
+	cfg, err = Load(writeTempConfig(t, base+`backup:
+  enabled: true
+  interval: 1h
+  retain: 3
+  s3:
+    enabled: true
+    endpoint: http://minio:9000
+    bucket: beacon-backups
+    prefix: prod/
+    pathStyle: true
+`))
+	require.NoError(t, err)
+	assert.True(t, cfg.Backup.Enabled)
+	assert.Equal(t, time.Hour, cfg.Backup.Interval.Duration)
+	assert.Equal(t, 3, cfg.Backup.Retain)
+	assert.True(t, cfg.Backup.S3.PathStyle)
+	assert.Equal(t, "minioadmin", cfg.Backup.S3.AccessKeyID)
+	assert.Equal(t, "minio-secret", cfg.Backup.S3.SecretAccessKey)
+}
+
+func TestLoadBackupInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"negative retain", "backup:\n  retain: -1\n", "backup.retain"},
+		{"endpoint without scheme", "backup:\n  s3:\n    enabled: true\n    endpoint: minio:9000\n    bucket: b\n", "backup.s3.endpoint"},
+		{"missing bucket", "backup:\n  s3:\n    enabled: true\n    endpoint: http://minio:9000\n", "backup.s3.bucket"},
+		{"missing credentials", "backup:\n  s3:\n    enabled: true\n    endpoint: http://minio:9000\n    bucket: b\n", "BACKUP_S3_ACCESS_KEY_ID"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			content := "resources:\n  - apiVersion: v1\n    kind: Pod\nendpoint:\n  url: https://example.com\n" + tc.content
+			_, err := Load(writeTempConfig(t, content))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.wantErr)
+		})
+	}
+}
+
+func TestLoadRetentionPolicies(t *testing.T) {
+	base := "resources:\n  - apiVersion: v1\n    kind: Pod\nendpoint:\n  url: https://example.com\n"
+
+	cfg, err := Load(writeTempConfig(t, base))
+	require.NoError(t, err)
+	assert.False(t, cfg.Retention.Archive)
+	assert.Zero(t, cfg.Retention.Failed.Period.Duration, "failed records are kept by default")
+	assert.Zero(t, cfg.StalePeriod(), "stale records are kept by default")
+	assert.Equal(t, 500, cfg.Retention.BatchSize)
+	assert.Equal(t, "/data/archive", cfg.Retention.ArchiveDir)
+
+	cfg, err = Load(writeTempConfig(t, base+`reconciliation:
+  enabled: true
+  interval: 10m
+retention:
+  cleanupInterval: 1h
+  retentionPeriod: 24h
+  archive: true
+  failed:
+    period: 168h
+    archive: true
+  stale:
+    intervals: 6
+  batchSize: 100
+  archiveDir: /archive
+`))
+	require.NoError(t, err)
+	assert.True(t, cfg.Retention.Archive)
+	assert.Equal(t, 168*time.Hour, cfg.Retention.Failed.Period.Duration)
+	assert.True(t, cfg.Retention.Failed.Archive)
+	assert.Equal(t, 6, cfg.Retention.Stale.Intervals)
+	assert.False(t, cfg.Retention.Stale.Archive)
+	assert.Equal(t, time.Hour, cfg.StalePeriod())
+	assert.Equal(t, 100, cfg.Retention.BatchSize)
+	assert.Equal(t, "/archive", cfg.Retention.ArchiveDir)
+}
+
+func TestLoadRetentionPoliciesInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"negative batch size", "retention:\n  batchSize: -1\n", "retention.batchSize"},
+		{"negative failed period", "retention:\n  failed:\n    period: -1h\n", "retention.failed.period"},
+		{"negative stale intervals", "retention:\n  stale:\n    intervals: -1\n", "retention.stale.intervals"},
+		{"stale without reconciliation", "reconciliation:\n  enabled: false\n  interval: 15m\nretention:\n  stale:\n    intervals: 4\n", "requires reconciliation.enabled"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			content := "resources:\n  - apiVersion: v1\n    kind: Pod\nendpoint:\n  url: https://example.com\n" + tc.content
+			_, err := Load(writeTempConfig(t, content))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.wantErr)
+		})
+	}
+}
+
+func TestLoadStoragePressure(t *testing.T) {
+	base := "resources:\n  - apiVersion: v1\n    kind: Pod\nendpoint:\n  url: https://example.com\n"
+
+	cfg, err := Load(writeTempConfig(t, base))
+	require.NoError(t, err)
+	assert.True(t, cfg.Storage.Pressure.Enabled)
+	assert.Equal(t, 12*time.Hour, cfg.Storage.Pressure.WarningRetention.Duration)
+	assert.Equal(t, time.Hour, cfg.Storage.Pressure.CriticalRetention.Duration)
+
+	cfg, err = Load(writeTempConfig(t, base+"retention:\n  cleanupInterval: 10m\n  retentionPeriod: 2h\n"))
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Minute, cfg.Storage.Pressure.WarningRetention.Duration)
+	assert.Equal(t, 30*time.Minute, cfg.Storage.Pressure.CriticalRetention.Duration, "capped at the warning retention")
+
+	cfg, err = Load(writeTempConfig(t, base+`storage:
+  pressure:
+    enabled: false
+    warningRetention: 6h
+    criticalRetention: 30m
+`))
+	require.NoError(t, err)
+	assert.False(t, cfg.Storage.Pressure.Enabled)
+	assert.Equal(t, 6*time.Hour, cfg.Storage.Pressure.WarningRetention.Duration)
+	assert.Equal(t, 30*time.Minute, cfg.Storage.Pressure.CriticalRetention.Duration)
+}
+
+func TestLoadStoragePressureInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"threshold above 100", "storage:\n  criticalThreshold: 120\n", "storage.criticalThreshold"},
+		{"warning above critical", "storage:\n  warningThreshold: 95\n", "storage.warningThreshold (95)"},
+		{"warning retention above retention period", "storage:\n  pressure:\n    warningRetention: 72h\n", "storage.pressure.warningRetention"},
+		{"critical retention above warning retention", "storage:\n  pressure:\n    criticalRetention: 24h\n", "storage.pressure.criticalRetention"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			content := "resources:\n  - apiVersion: v1\n    kind: Pod\nendpoint:\n  url: https://example.com\n" + tc.content
+			_, err := Load(writeTempConfig(t, content))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.wantErr)
+		})
+	}
+}
+
 func writeTempConfig(t *testing.T, content string) string {
 	t.Helper()
 	dir := t.TempDir()
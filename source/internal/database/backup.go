@@ -0,0 +1,146 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// BackupTo writes a consistent copy of the database to path with VACUUM
+// INTO. The copy is compacted and includes the schema version; writers wait
+// while it is taken.
+func (s *SQLiteDB) BackupTo(path string) error {
+	if _, err := s.q.Exec("VACUUM INTO ?", path); err != nil {
+		return fmt.Errorf("vacuum into %s: %w", path, err)
+	}
+	return nil
+}
+
+// VerifyFile opens the database file at path read-only, checks its integrity
+// and that it holds a beacon schema, and returns its schema version.
+func VerifyFile(path string) (int, error) {
+	if _, err := os.Stat(path); err != nil {
+		return 0, fmt.Errorf("reading database file: %w", err)
+	}
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return 0, fmt.Errorf("opening database file: %w", err)
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.QueryRow("PRAGMA integrity_check(1)").Scan(&result); err != nil {
+		return 0, fmt.Errorf("checking integrity: %w", err)
+	}
+	if result != "ok" {
+		return 0, fmt.Errorf("integrity check failed: %s", result)
+	}
+
+	var tables int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'managed_objects'").Scan(&tables); err != nil {
+		return 0, fmt.Errorf("reading schema: %w", err)
+	}
+	if tables == 0 {
+		return 0, errors.New("not a beacon database: managed_objects table not found")
+	}
+
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return 0, fmt.Errorf("reading schema version: %w", err)
+	}
+	return version, nil
+}
+
+// Restore replaces the database at dbPath with the backup at src. The backup
+// must pass VerifyFile and have a schema version no newer than SchemaVersion;
+// older versions are migrated when the database is next opened. The current
+// database, if any, is checkpointed and kept beside it, and its path is
+// returned. The service must not be running.
+func Restore(src, dbPath string) (string, error) {
+	version, err := VerifyFile(src)
+	if err != nil {
+		return "", fmt.Errorf("verifying backup: %w", err)
+	}
+	if version > SchemaVersion {
+		return "", fmt.Errorf("backup schema version %d is newer than the supported version %d", version, SchemaVersion)
+	}
+
+	// Stage the backup beside the database so that the swap is a rename.
+	staged := dbPath + ".restore"
+	if err := copyFile(src, staged); err != nil {
+		os.Remove(staged)
+		return "", fmt.Errorf("staging backup: %w", err)
+	}
+
+	var previous string
+	if _, err := os.Stat(dbPath); err == nil {
+		// Fold the write-ahead log into the database file so that the
+		// copy kept is complete on its own.
+		if err := checkpoint(dbPath); err != nil {
+			os.Remove(staged)
+			return "", err
+		}
+		previous = fmt.Sprintf("%s.pre-restore-%s", dbPath, time.Now().UTC().Format("20060102T150405Z"))
+		if err := os.Rename(dbPath, previous); err != nil {
+			os.Remove(staged)
+			return "", fmt.Errorf("keeping current database: %w", err)
+		}
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(dbPath + suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return previous, fmt.Errorf("removing %s: %w", dbPath+suffix, err)
+		}
+	}
+	if err := os.Rename(staged, dbPath); err != nil {
+		return previous, fmt.Errorf("replacing database: %w", err)
+	}
+	return previous, nil
+}
+
+// checkpoint copies the write-ahead log of the database at path into the
+// database file and truncates the log.
+func checkpoint(path string) error {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return fmt.Errorf("opening current database: %w", err)
+	}
+	defer db.Close()
+	var busy, logFrames, checkpointed int
+	if err := db.QueryRow("PRAGMA wal_checkpoint(TRUNCATE)").Scan(&busy, &logFrames, &checkpointed); err != nil {
+		return fmt.Errorf("checkpointing current database: %w", err)
+	}
+	if busy != 0 {
+		return errors.New("current database is in use; stop beacon before restoring")
+	}
+	return nil
+}
+
+// copyFile copies src to dst and syncs dst to disk.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0o750); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o640)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,118 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// newFileDB creates a SQLite database in a file for testing.
+func newFileDB(t *testing.T, path string) *SQLiteDB {
+	t.Helper()
+	db, err := NewSQLiteDB(path, zap.NewNop())
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestBackupToWritesVerifiableCopy(t *testing.T) {
+	dir := t.TempDir()
+	db := newFileDB(t, filepath.Join(dir, "events.db"))
+	require.NoError(t, db.InsertManagedObject(newTestObject("id-1", "uid-1")))
+
+	backup := filepath.Join(dir, "backup.db")
+	require.NoError(t, db.BackupTo(backup))
+
+	version, err := VerifyFile(backup)
+	require.NoError(t, err)
+	assert.Equal(t, SchemaVersion, version)
+
+	copied := newFileDB(t, backup)
+	got, err := copied.GetManagedObjectByID("id-1")
+	require.NoError(t, err)
+	assert.Equal(t, "uid-1", got.ResourceUID)
+
+	assert.Error(t, db.BackupTo(backup), "an existing file is not overwritten")
+}
+
+func TestVerifyFileRejectsInvalidFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	garbage := filepath.Join(dir, "garbage.db")
+	require.NoError(t, os.WriteFile(garbage, []byte("not a database"), 0o640))
+	_, err := VerifyFile(garbage)
+	assert.Error(t, err)
+
+	other := filepath.Join(dir, "other.db")
+	db := newFileDB(t, other)
+	_, err = db.db.Exec("DROP TABLE managed_objects")
+	require.NoError(t, err)
+	_, err = VerifyFile(other)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not a beacon database")
+
+	_, err = VerifyFile(filepath.Join(dir, "missing.db"))
+	assert.Error(t, err)
+}
+
+func TestNewSQLiteDBRejectsNewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.db")
+	db, err := NewSQLiteDB(path, zap.NewNop())
+	require.NoError(t, err)
+	_, err = db.db.Exec(fmt.Sprintf("PRAGMA user_version = %d", SchemaVersion+1))
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	_, err = NewSQLiteDB(path, zap.NewNop())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "newer than the supported version")
+}
+
+func TestRestoreReplacesDatabase(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "events.db")
+	backup := filepath.Join(dir, "backup.db")
+
+	db, err := NewSQLiteDB(dbPath, zap.NewNop())
+	require.NoError(t, err)
+	require.NoError(t, db.InsertManagedObject(newTestObject("id-1", "uid-1")))
+	require.NoError(t, db.BackupTo(backup))
+	require.NoError(t, db.InsertManagedObject(newTestObject("id-2", "uid-2")))
+	require.NoError(t, db.Close())
+
+	previous, err := Restore(backup, dbPath)
+	require.NoError(t, err)
+	assert.FileExists(t, previous)
+	assert.NoFileExists(t, dbPath+".restore")
+
+	restored := newFileDB(t, dbPath)
+	_, err = restored.GetManagedObjectByID("id-1")
+	assert.NoError(t, err)
+	_, err = restored.GetManagedObjectByID("id-2")
+	assert.Error(t, err, "records written after the backup are gone")
+
+	kept := newFileDB(t, previous)
+	_, err = kept.GetManagedObjectByID("id-2")
+	assert.NoError(t, err, "the replaced database is kept complete")
+}
+
+func TestRestoreRejectsNewerSchema(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "events.db")
+	backup := filepath.Join(dir, "backup.db")
+
+	db := newFileDB(t, backup)
+	_, err := db.db.Exec(fmt.Sprintf("PRAGMA user_version = %d", SchemaVersion+1))
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	_, err = Restore(backup, dbPath)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "newer than the supported version")
+	assert.NoFileExists(t, dbPath)
+}
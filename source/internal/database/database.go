@@ -18,57 +18,143 @@ type Database interface {
 	// Ping verifies the database connection is still alive.
 	Ping() error
 
-	// InsertManagedObject persists a new managed object record.
+	// WithTx runs fn in a transaction and commits it if fn returns nil, or
+	// rolls it back otherwise. fn must make all its calls through tx, which
+	// is valid only until fn returns. Calls to WithTx on tx nest.
+	WithTx(fn func(tx Database) error) error
+
+	// InsertManagedObject persists a new managed object record and assigns
+	// sequence numbers to its events.
 	InsertManagedObject(obj *models.ManagedObject) error
 
-	// GetManagedObjectByUID retrieves a managed object by its Kubernetes resource UID.
+	// GetManagedObjectByUID retrieves a managed object by its Kubernetes
+	// resource UID: the one in the "exists" state if the UID has several, or
+	// else the most recently created.
 	GetManagedObjectByUID(uid string) (*models.ManagedObject, error)
 
 	// GetManagedObjectByID retrieves a managed object by its internal record ID.
 	GetManagedObjectByID(id string) (*models.ManagedObject, error)
 
-	// UpdateClusterState sets the cluster state for a managed object identified by
-	// its resource UID and optionally records a deletion timestamp.
+	// UpdateClusterState moves the managed object identified by its resource
+	// UID to the "deleted" state, recording its deletion timestamp. Its
+	// deleted event is assigned a sequence number and, if it has per-endpoint
+	// deliveries, made due immediately. Any other change of cluster state, or
+	// deleting an object already deleted, is rejected with an error wrapping
+	// models.ErrInvalidTransition.
 	UpdateClusterState(uid string, state string, deletedAt *time.Time) error
 
-	// UpdateNotificationStatus marks a notification event (e.g. "created" or
-	// "deleted") as sent for the object identified by its internal ID.
+	// SetDeletedTraceParent records the trace context in which the deletion
+	// of the resource with the given UID was detected, for records that are
+	// not yet deleted. Call it before UpdateClusterState.
+	SetDeletedTraceParent(uid string, traceParent string) error
+
+	// UpdateNotificationStatus marks a pending notification event ("created"
+	// or "deleted") as sent for the object identified by its internal ID.
 	UpdateNotificationStatus(id string, eventType string, sentAt time.Time) error
 
+	// MarkCoalesced marks both events of a short-lived object as handled by
+	// coalescing, recording the decision (suppressed or ephemeral).
+	MarkCoalesced(id string, decision string, sentAt time.Time) error
+
 	// MarkNotificationFailed records a permanent notification failure along with
 	// the HTTP status code that caused it.
 	MarkNotificationFailed(id string, statusCode int) error
 
-	// IncrementNotificationAttempts bumps the attempt counter and records the
-	// current time as the last notification attempt.
-	IncrementNotificationAttempts(id string) error
+	// IncrementNotificationAttempts bumps the attempt counter, records the
+	// current time as the last notification attempt, and schedules the next
+	// attempt no earlier than nextAttemptAt.
+	IncrementNotificationAttempts(id string, nextAttemptAt time.Time) error
+
+	// The notification state changes below are guarded by the object's
+	// current state, as described by models.ManagedObject.CheckTransition.
+	// One that is not allowed changes nothing and returns an error wrapping
+	// models.ErrInvalidTransition; one of a missing object returns an error
+	// wrapping sql.ErrNoRows.
+
+	// MarkAwaitingAck records that the destination accepted eventType and
+	// will acknowledge it later, and defers the object's next attempt to
+	// deadline.
+	MarkAwaitingAck(id string, eventType string, deadline time.Time) error
+
+	// ClaimAwaitingAck clears the awaiting acknowledgement state of
+	// eventType and reports whether it was set.
+	ClaimAwaitingAck(id string, eventType string) (bool, error)
+
+	// GetEndpointDeliveries returns the per-endpoint delivery state of the
+	// events of the object identified by its internal ID.
+	GetEndpointDeliveries(objectID string) ([]*models.EndpointDelivery, error)
+
+	// SaveEndpointDelivery inserts or replaces the delivery state of one event
+	// to one endpoint.
+	SaveEndpointDelivery(d *models.EndpointDelivery) error
+
+	// RecordDeliveryAttempt stores a failed delivery attempt and deletes the
+	// oldest attempts of the same event and endpoint beyond the most recent
+	// keep.
+	RecordDeliveryAttempt(a *models.DeliveryAttempt, keep int) error
+
+	// GetDeliveryAttempts returns the recorded failed delivery attempts of a
+	// managed object, oldest first.
+	GetDeliveryAttempts(objectID string) ([]*models.DeliveryAttempt, error)
 
 	// UpdateLastReconciled sets the last_reconciled timestamp for the object
 	// identified by its internal ID.
 	UpdateLastReconciled(id string, reconciledAt time.Time) error
 
 	// GetPendingNotifications returns up to limit managed objects that still
-	// require a notification to be sent (either created or deleted).
-	GetPendingNotifications(limit int) ([]*models.ManagedObject, error)
+	// require a notification to be sent (either created or deleted) and whose
+	// next attempt is due. Objects are held back while an earlier object with
+	// the same ordering key (models.OrderingKeyUID or models.OrderingKeyName)
+	// is still pending.
+	GetPendingNotifications(limit int, orderingKey string) ([]*models.ManagedObject, error)
 
 	// GetAllActiveObjects returns all objects in the "exists" state for a given
 	// resource type.
 	GetAllActiveObjects(resourceType string) ([]*models.ManagedObject, error)
 
-	// GetCleanupEligible returns objects that have been deleted, successfully
-	// notified, and whose deletion timestamp is older than the retention period.
-	GetCleanupEligible(retentionPeriod time.Duration) ([]*models.ManagedObject, error)
+	// GetExpiredRecords returns up to limit objects that the retention policy
+	// (models.RetentionDelivered, RetentionFailed or RetentionStale) removes
+	// at cutoff, oldest first: delivered objects deleted before cutoff,
+	// failed objects last attempted before cutoff, and existing objects
+	// whose created event was delivered, last reconciled, or created if never
+	// reconciled, before cutoff, and whose resource type is not among the
+	// watched types. A negative limit returns them all.
+	GetExpiredRecords(policy string, cutoff time.Time, watched []string, limit int) ([]*models.ManagedObject, error)
+
+	// CountExpiredRecords returns the number of objects that GetExpiredRecords
+	// would return without a limit.
+	CountExpiredRecords(policy string, cutoff time.Time, watched []string) (int, error)
 
 	// CountByState returns the number of objects in the "exists" and "deleted"
 	// states respectively.
 	CountByState() (exists int, deleted int, err error)
 
+	// CountPendingNotifications returns the number of events still to be
+	// delivered, and of those the number due now, by resource type and event
+	// type.
+	CountPendingNotifications() ([]*models.PendingCount, error)
+
 	// DeleteRecord permanently removes a managed object record by its internal ID.
 	DeleteRecord(id string) error
 
 	// RunIncrementalVacuum triggers an incremental vacuum to reclaim unused pages.
 	RunIncrementalVacuum() error
 
+	// CompactDeliveredRecords drops the optional data kept for objects with
+	// no event left to deliver: their full metadata and the response bodies
+	// and headers of their delivery attempts. It works in small batches so
+	// that other writes are not held up, and returns the number of rows
+	// compacted.
+	CompactDeliveredRecords() (int64, error)
+
+	// CheckpointWAL copies the write-ahead log into the database and
+	// truncates it to zero bytes.
+	CheckpointWAL() error
+
 	// GetDatabaseSizeBytes returns the current on-disk size of the database in bytes.
 	GetDatabaseSizeBytes() (int64, error)
+
+	// BackupTo writes a consistent copy of the database to path, which must
+	// not exist, while the database remains in use.
+	BackupTo(path string) error
 }
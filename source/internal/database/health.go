@@ -0,0 +1,32 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/bryonbaker/beacon/internal/metrics"
+)
+
+// MonitorHealth pings db immediately and then every interval until ctx is
+// cancelled, recording the result as the health of the "database" component.
+func MonitorHealth(ctx context.Context, db Database, interval time.Duration, m *metrics.Metrics, logger *zap.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := db.Ping(); err != nil {
+			logger.Error("database ping failed", zap.Error(err))
+			m.RecordComponentHealth("database", false)
+		} else {
+			m.RecordComponentHealth("database", true)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
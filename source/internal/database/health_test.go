@@ -0,0 +1,41 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/bryonbaker/beacon/internal/metrics"
+)
+
+func TestMonitorHealthReportsPingResult(t *testing.T) {
+	m := metrics.NewMetrics(prometheus.NewRegistry())
+	health := metrics.NewHealthChecks()
+	m.SetHealthChecks(health)
+
+	db := new(MockDatabase)
+	db.On("Ping").Return(errors.New("disk I/O error")).Once()
+	db.On("Ping").Return(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		MonitorHealth(ctx, db, 10*time.Millisecond, m, zap.NewNop())
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool {
+		return health.All()["database"] == "ok"
+	}, time.Second, 5*time.Millisecond)
+	cancel()
+	<-done
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.ComponentUp.WithLabelValues("database")))
+	assert.GreaterOrEqual(t, len(db.Calls), 2, "the failed ping is retried on the next tick")
+}
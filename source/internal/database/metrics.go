@@ -0,0 +1,244 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/bryonbaker/beacon/internal/metrics"
+	"github.com/bryonbaker/beacon/internal/models"
+)
+
+// InstrumentedDB wraps a Database and records the duration of each call, and
+// the errors it returns, in the event_db_operation_* metrics. Operations are
+// labelled with the name of the Database method.
+type InstrumentedDB struct {
+	db      Database
+	metrics *metrics.Metrics
+}
+
+// Ensure InstrumentedDB satisfies the Database interface at compile time.
+var _ Database = (*InstrumentedDB)(nil)
+
+// NewInstrumentedDB creates an InstrumentedDB that delegates to db.
+func NewInstrumentedDB(db Database, m *metrics.Metrics) *InstrumentedDB {
+	return &InstrumentedDB{db: db, metrics: m}
+}
+
+// start begins timing operation. The returned function records the
+// operation's duration and error, and returns the error.
+func (i *InstrumentedDB) start(operation string) func(error) error {
+	begin := time.Now()
+	return func(err error) error {
+		i.metrics.RecordDBOperation(operation, time.Since(begin), errorType(err))
+		return err
+	}
+}
+
+// errorType classifies err for the error_type label, or returns "" when err
+// is nil or only reports a missing row.
+func errorType(err error) string {
+	if err == nil || errors.Is(err, sql.ErrNoRows) {
+		return ""
+	}
+	if errors.Is(err, models.ErrInvalidTransition) {
+		return "invalid_transition"
+	}
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return "other"
+	}
+	switch sqliteErr.Code {
+	case sqlite3.ErrBusy:
+		return "busy"
+	case sqlite3.ErrLocked:
+		return "locked"
+	case sqlite3.ErrConstraint:
+		return "constraint"
+	case sqlite3.ErrFull:
+		return "disk_full"
+	case sqlite3.ErrCorrupt, sqlite3.ErrNotADB:
+		return "corrupt"
+	case sqlite3.ErrIoErr:
+		return "io"
+	case sqlite3.ErrReadonly:
+		return "readonly"
+	default:
+		return "other"
+	}
+}
+
+// The Database methods below delegate to the wrapped Database, timing each
+// call.
+
+func (i *InstrumentedDB) Close() error {
+	return i.db.Close()
+}
+
+func (i *InstrumentedDB) Ping() error {
+	done := i.start("Ping")
+	return done(i.db.Ping())
+}
+
+// WithTx times the whole transaction, and each call within it separately.
+func (i *InstrumentedDB) WithTx(fn func(tx Database) error) error {
+	done := i.start("WithTx")
+	return done(i.db.WithTx(func(tx Database) error {
+		return fn(&InstrumentedDB{db: tx, metrics: i.metrics})
+	}))
+}
+
+func (i *InstrumentedDB) InsertManagedObject(obj *models.ManagedObject) error {
+	done := i.start("InsertManagedObject")
+	return done(i.db.InsertManagedObject(obj))
+}
+
+func (i *InstrumentedDB) GetManagedObjectByUID(uid string) (*models.ManagedObject, error) {
+	done := i.start("GetManagedObjectByUID")
+	obj, err := i.db.GetManagedObjectByUID(uid)
+	return obj, done(err)
+}
+
+func (i *InstrumentedDB) GetManagedObjectByID(id string) (*models.ManagedObject, error) {
+	done := i.start("GetManagedObjectByID")
+	obj, err := i.db.GetManagedObjectByID(id)
+	return obj, done(err)
+}
+
+func (i *InstrumentedDB) UpdateClusterState(uid string, state string, deletedAt *time.Time) error {
+	done := i.start("UpdateClusterState")
+	return done(i.db.UpdateClusterState(uid, state, deletedAt))
+}
+
+func (i *InstrumentedDB) SetDeletedTraceParent(uid string, traceParent string) error {
+	done := i.start("SetDeletedTraceParent")
+	return done(i.db.SetDeletedTraceParent(uid, traceParent))
+}
+
+func (i *InstrumentedDB) UpdateNotificationStatus(id string, eventType string, sentAt time.Time) error {
+	done := i.start("UpdateNotificationStatus")
+	return done(i.db.UpdateNotificationStatus(id, eventType, sentAt))
+}
+
+func (i *InstrumentedDB) MarkCoalesced(id string, decision string, sentAt time.Time) error {
+	done := i.start("MarkCoalesced")
+	return done(i.db.MarkCoalesced(id, decision, sentAt))
+}
+
+func (i *InstrumentedDB) MarkNotificationFailed(id string, statusCode int) error {
+	done := i.start("MarkNotificationFailed")
+	return done(i.db.MarkNotificationFailed(id, statusCode))
+}
+
+func (i *InstrumentedDB) IncrementNotificationAttempts(id string, nextAttemptAt time.Time) error {
+	done := i.start("IncrementNotificationAttempts")
+	return done(i.db.IncrementNotificationAttempts(id, nextAttemptAt))
+}
+
+func (i *InstrumentedDB) MarkAwaitingAck(id string, eventType string, deadline time.Time) error {
+	done := i.start("MarkAwaitingAck")
+	return done(i.db.MarkAwaitingAck(id, eventType, deadline))
+}
+
+func (i *InstrumentedDB) ClaimAwaitingAck(id string, eventType string) (bool, error) {
+	done := i.start("ClaimAwaitingAck")
+	claimed, err := i.db.ClaimAwaitingAck(id, eventType)
+	return claimed, done(err)
+}
+
+func (i *InstrumentedDB) GetEndpointDeliveries(objectID string) ([]*models.EndpointDelivery, error) {
+	done := i.start("GetEndpointDeliveries")
+	deliveries, err := i.db.GetEndpointDeliveries(objectID)
+	return deliveries, done(err)
+}
+
+func (i *InstrumentedDB) SaveEndpointDelivery(d *models.EndpointDelivery) error {
+	done := i.start("SaveEndpointDelivery")
+	return done(i.db.SaveEndpointDelivery(d))
+}
+
+func (i *InstrumentedDB) RecordDeliveryAttempt(a *models.DeliveryAttempt, keep int) error {
+	done := i.start("RecordDeliveryAttempt")
+	return done(i.db.RecordDeliveryAttempt(a, keep))
+}
+
+func (i *InstrumentedDB) GetDeliveryAttempts(objectID string) ([]*models.DeliveryAttempt, error) {
+	done := i.start("GetDeliveryAttempts")
+	attempts, err := i.db.GetDeliveryAttempts(objectID)
+	return attempts, done(err)
+}
+
+func (i *InstrumentedDB) UpdateLastReconciled(id string, reconciledAt time.Time) error {
+	done := i.start("UpdateLastReconciled")
+	return done(i.db.UpdateLastReconciled(id, reconciledAt))
+}
+
+func (i *InstrumentedDB) GetPendingNotifications(limit int, orderingKey string) ([]*models.ManagedObject, error) {
+	done := i.start("GetPendingNotifications")
+	objs, err := i.db.GetPendingNotifications(limit, orderingKey)
+	return objs, done(err)
+}
+
+func (i *InstrumentedDB) GetAllActiveObjects(resourceType string) ([]*models.ManagedObject, error) {
+	done := i.start("GetAllActiveObjects")
+	objs, err := i.db.GetAllActiveObjects(resourceType)
+	return objs, done(err)
+}
+
+func (i *InstrumentedDB) GetExpiredRecords(policy string, cutoff time.Time, watched []string, limit int) ([]*models.ManagedObject, error) {
+	done := i.start("GetExpiredRecords")
+	objs, err := i.db.GetExpiredRecords(policy, cutoff, watched, limit)
+	return objs, done(err)
+}
+
+func (i *InstrumentedDB) CountExpiredRecords(policy string, cutoff time.Time, watched []string) (int, error) {
+	done := i.start("CountExpiredRecords")
+	count, err := i.db.CountExpiredRecords(policy, cutoff, watched)
+	return count, done(err)
+}
+
+func (i *InstrumentedDB) CountByState() (int, int, error) {
+	done := i.start("CountByState")
+	exists, deleted, err := i.db.CountByState()
+	return exists, deleted, done(err)
+}
+
+func (i *InstrumentedDB) CountPendingNotifications() ([]*models.PendingCount, error) {
+	done := i.start("CountPendingNotifications")
+	counts, err := i.db.CountPendingNotifications()
+	return counts, done(err)
+}
+
+func (i *InstrumentedDB) DeleteRecord(id string) error {
+	done := i.start("DeleteRecord")
+	return done(i.db.DeleteRecord(id))
+}
+
+func (i *InstrumentedDB) RunIncrementalVacuum() error {
+	done := i.start("RunIncrementalVacuum")
+	return done(i.db.RunIncrementalVacuum())
+}
+
+func (i *InstrumentedDB) CompactDeliveredRecords() (int64, error) {
+	done := i.start("CompactDeliveredRecords")
+	n, err := i.db.CompactDeliveredRecords()
+	return n, done(err)
+}
+
+func (i *InstrumentedDB) CheckpointWAL() error {
+	done := i.start("CheckpointWAL")
+	return done(i.db.CheckpointWAL())
+}
+
+func (i *InstrumentedDB) GetDatabaseSizeBytes() (int64, error) {
+	done := i.start("GetDatabaseSizeBytes")
+	size, err := i.db.GetDatabaseSizeBytes()
+	return size, done(err)
+}
+
+func (i *InstrumentedDB) BackupTo(path string) error {
+	done := i.start("BackupTo")
+	return done(i.db.BackupTo(path))
+}
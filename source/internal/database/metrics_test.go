@@ -0,0 +1,42 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bryonbaker/beacon/internal/metrics"
+	"github.com/bryonbaker/beacon/internal/models"
+)
+
+func TestInstrumentedDBRecordsOperations(t *testing.T) {
+	m := metrics.NewMetrics(prometheus.NewRegistry())
+	db := NewInstrumentedDB(newTestDB(t), m)
+
+	require.NoError(t, db.InsertManagedObject(newTestObject("id-m1", "uid-m1")))
+	assert.Error(t, db.InsertManagedObject(newTestObject("id-m1", "uid-m1")))
+	_, err := db.GetManagedObjectByID("missing")
+	assert.Error(t, err)
+
+	assert.Equal(t, 2, testutil.CollectAndCount(m.DBOperationDuration), "one series per operation")
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.DBOperationErrors.WithLabelValues("InsertManagedObject", "constraint")))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.DBOperationErrors), "missing rows are not errors")
+}
+
+func TestInstrumentedDBRecordsTransactions(t *testing.T) {
+	m := metrics.NewMetrics(prometheus.NewRegistry())
+	db := NewInstrumentedDB(newTestDB(t), m)
+	require.NoError(t, db.InsertManagedObject(newTestObject("id-m1", "uid-m1")))
+
+	err := db.WithTx(func(tx Database) error {
+		return tx.UpdateNotificationStatus("id-m1", "deleted", time.Now())
+	})
+	assert.ErrorIs(t, err, models.ErrInvalidTransition)
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.DBOperationErrors.WithLabelValues("UpdateNotificationStatus", "invalid_transition")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.DBOperationErrors.WithLabelValues("WithTx", "invalid_transition")))
+}
@@ -0,0 +1,317 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+
+	"go.uber.org/zap"
+)
+
+// SchemaVersion is the version of the last migration, and so of the schema
+// that NewSQLiteDB creates. It is stored in the database header (PRAGMA
+// user_version) so that a database or backup written by a newer version of
+// Beacon is refused.
+const SchemaVersion = 2
+
+// Migration is a numbered change to the database schema.
+type Migration struct {
+	Version     int
+	Description string
+	up          func(tx *sql.Tx) error
+}
+
+// migrations lists the schema changes in order. To change the schema, append
+// a migration with the next version, raise SchemaVersion to match, and add a
+// fixture of the previous schema to testdata/schemas. Never change a
+// migration that has been released.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "create the schema, adding any tables and columns missing from an unversioned database",
+		up:          createBaseSchema,
+	},
+	{
+		Version:     2,
+		Description: "index failed and stale records for their retention policies",
+		up:          createRetentionIndexes,
+	},
+}
+
+// migrate applies the migrations in list that are newer than the database's
+// schema version. Each runs in a transaction that also records its version,
+// so a failed migration leaves the database at the version before it. A
+// database written by a newer schema is refused rather than downgraded.
+func (s *SQLiteDB) migrate(list []Migration) error {
+	version, err := schemaVersion(s.db)
+	if err != nil {
+		return err
+	}
+	pending, err := pendingMigrations(list, version)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range pending {
+		if err := s.applyMigration(m); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.Version, m.Description, err)
+		}
+		s.logger.Info("applied schema migration",
+			zap.Int("version", m.Version),
+			zap.String("description", m.Description),
+		)
+	}
+	return nil
+}
+
+// applyMigration runs m and records its version in one transaction.
+func (s *SQLiteDB) applyMigration(m Migration) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := m.up(tx); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", m.Version)); err != nil {
+		return fmt.Errorf("setting schema version: %w", err)
+	}
+	return tx.Commit()
+}
+
+// PendingMigrations opens the database file at path read-only and returns
+// its schema version and the migrations that NewSQLiteDB would apply to it.
+// A file that does not exist yet is at version 0.
+func PendingMigrations(path string) (int, []Migration, error) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return 0, migrations, nil
+	} else if err != nil {
+		return 0, nil, fmt.Errorf("reading database file: %w", err)
+	}
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return 0, nil, fmt.Errorf("opening database file: %w", err)
+	}
+	defer db.Close()
+
+	version, err := schemaVersion(db)
+	if err != nil {
+		return 0, nil, err
+	}
+	pending, err := pendingMigrations(migrations, version)
+	return version, pending, err
+}
+
+// pendingMigrations returns the migrations in list newer than version.
+func pendingMigrations(list []Migration, version int) ([]Migration, error) {
+	latest := list[len(list)-1].Version
+	if version > latest {
+		return nil, fmt.Errorf("database schema version %d is newer than the supported version %d", version, latest)
+	}
+	var pending []Migration
+	for _, m := range list {
+		if m.Version > version {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// schemaVersion reads the schema version from the database header.
+func schemaVersion(db *sql.DB) (int, error) {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return 0, fmt.Errorf("reading schema version: %w", err)
+	}
+	return version, nil
+}
+
+// createBaseSchema creates the managed_objects table, its supporting tables,
+// and all indexes. Databases created before the schema was versioned have
+// some of these already, so every statement tolerates existing objects and
+// columns added since the original table are added where missing.
+func createBaseSchema(tx *sql.Tx) error {
+	const createTable = `
+CREATE TABLE IF NOT EXISTS managed_objects (
+    id                           TEXT PRIMARY KEY,
+    resource_uid                 TEXT NOT NULL,
+    resource_type                TEXT NOT NULL,
+    resource_name                TEXT NOT NULL,
+    resource_namespace           TEXT NOT NULL DEFAULT '',
+    annotation_value             TEXT NOT NULL DEFAULT '',
+    cluster_state                TEXT NOT NULL DEFAULT 'exists',
+    detection_source             TEXT NOT NULL DEFAULT '',
+    created_at                   TEXT NOT NULL,
+    deleted_at                   TEXT,
+    last_reconciled              TEXT,
+    notified_created             INTEGER NOT NULL DEFAULT 0,
+    notified_deleted             INTEGER NOT NULL DEFAULT 0,
+    notification_failed          INTEGER NOT NULL DEFAULT 0,
+    notification_failed_code     INTEGER NOT NULL DEFAULT 0,
+    created_notification_sent_at TEXT,
+    deleted_notification_sent_at TEXT,
+    notification_attempts        INTEGER NOT NULL DEFAULT 0,
+    last_notification_attempt    TEXT,
+    labels                       TEXT NOT NULL DEFAULT '',
+    annotations                  TEXT NOT NULL DEFAULT '',
+    resource_version             TEXT NOT NULL DEFAULT '',
+    full_metadata                TEXT NOT NULL DEFAULT '',
+    fields                       TEXT NOT NULL DEFAULT '',
+    next_attempt_at              TEXT,
+    created_sequence             INTEGER NOT NULL DEFAULT 0,
+    deleted_sequence             INTEGER NOT NULL DEFAULT 0,
+    coalesced                    TEXT NOT NULL DEFAULT '',
+    awaiting_ack                 TEXT NOT NULL DEFAULT '',
+    created_trace_parent         TEXT NOT NULL DEFAULT '',
+    deleted_trace_parent         TEXT NOT NULL DEFAULT ''
+);`
+
+	// event_sequence holds the last sequence number assigned to an event.
+	const createSequence = `
+CREATE TABLE IF NOT EXISTS event_sequence (
+    id    INTEGER PRIMARY KEY CHECK (id = 1),
+    value INTEGER NOT NULL
+);
+INSERT OR IGNORE INTO event_sequence (id, value) VALUES (1, 0);`
+
+	// endpoint_deliveries holds the delivery state of each event to each
+	// named endpoint when events are routed to several endpoints.
+	const createDeliveries = `
+CREATE TABLE IF NOT EXISTS endpoint_deliveries (
+    object_id       TEXT NOT NULL REFERENCES managed_objects (id) ON DELETE CASCADE,
+    endpoint        TEXT NOT NULL,
+    event_type      TEXT NOT NULL,
+    status          TEXT NOT NULL DEFAULT 'pending',
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    last_attempt    TEXT,
+    next_attempt_at TEXT,
+    failed_code     INTEGER NOT NULL DEFAULT 0,
+    sent_at         TEXT,
+    PRIMARY KEY (object_id, endpoint, event_type)
+);`
+
+	// delivery_attempts keeps the most recent failed delivery attempts of
+	// each event, with the destination's response, for diagnosis.
+	const createAttempts = `
+CREATE TABLE IF NOT EXISTS delivery_attempts (
+    id               INTEGER PRIMARY KEY AUTOINCREMENT,
+    object_id        TEXT NOT NULL REFERENCES managed_objects (id) ON DELETE CASCADE,
+    endpoint         TEXT NOT NULL DEFAULT '',
+    event_type       TEXT NOT NULL,
+    attempted_at     TEXT NOT NULL,
+    status_code      INTEGER NOT NULL DEFAULT 0,
+    latency_ms       INTEGER NOT NULL DEFAULT 0,
+    error            TEXT NOT NULL DEFAULT '',
+    response_body    TEXT NOT NULL DEFAULT '',
+    response_headers TEXT NOT NULL DEFAULT ''
+);`
+
+	// Columns added to managed_objects after the original table, in the
+	// order they were introduced.
+	addColumns := []struct {
+		column string
+		ddl    string
+	}{
+		{"annotations", "ALTER TABLE managed_objects ADD COLUMN annotations TEXT NOT NULL DEFAULT ''"},
+		{"fields", "ALTER TABLE managed_objects ADD COLUMN fields TEXT NOT NULL DEFAULT ''"},
+		{"next_attempt_at", "ALTER TABLE managed_objects ADD COLUMN next_attempt_at TEXT"},
+		{"created_sequence", "ALTER TABLE managed_objects ADD COLUMN created_sequence INTEGER NOT NULL DEFAULT 0"},
+		{"deleted_sequence", "ALTER TABLE managed_objects ADD COLUMN deleted_sequence INTEGER NOT NULL DEFAULT 0"},
+		{"coalesced", "ALTER TABLE managed_objects ADD COLUMN coalesced TEXT NOT NULL DEFAULT ''"},
+		{"awaiting_ack", "ALTER TABLE managed_objects ADD COLUMN awaiting_ack TEXT NOT NULL DEFAULT ''"},
+		{"created_trace_parent", "ALTER TABLE managed_objects ADD COLUMN created_trace_parent TEXT NOT NULL DEFAULT ''"},
+		{"deleted_trace_parent", "ALTER TABLE managed_objects ADD COLUMN deleted_trace_parent TEXT NOT NULL DEFAULT ''"},
+	}
+
+	indexes := []string{
+		`CREATE INDEX IF NOT EXISTS idx_resource_uid ON managed_objects (resource_uid);`,
+		`CREATE INDEX IF NOT EXISTS idx_resource_type ON managed_objects (resource_type);`,
+		`CREATE INDEX IF NOT EXISTS idx_resource_namespace ON managed_objects (resource_namespace);`,
+		`CREATE INDEX IF NOT EXISTS idx_notification ON managed_objects (cluster_state, notified_created, notified_deleted);`,
+		`CREATE INDEX IF NOT EXISTS idx_reconciliation ON managed_objects (resource_type, last_reconciled);`,
+		`CREATE INDEX IF NOT EXISTS idx_cleanup ON managed_objects (deleted_at, notified_deleted, cluster_state);`,
+		`CREATE INDEX IF NOT EXISTS idx_resource_name ON managed_objects (resource_type, resource_namespace, resource_name);`,
+		`CREATE INDEX IF NOT EXISTS idx_attempts_object ON delivery_attempts (object_id, endpoint, event_type);`,
+	}
+
+	if _, err := tx.Exec(createTable); err != nil {
+		return fmt.Errorf("create table: %w", err)
+	}
+
+	columns, err := tableColumns(tx, "managed_objects")
+	if err != nil {
+		return err
+	}
+	for _, c := range addColumns {
+		if _, ok := columns[c.column]; ok {
+			continue
+		}
+		if _, err := tx.Exec(c.ddl); err != nil {
+			return fmt.Errorf("adding %s column: %w", c.column, err)
+		}
+	}
+
+	if _, err := tx.Exec(createSequence); err != nil {
+		return fmt.Errorf("create event_sequence table: %w", err)
+	}
+
+	if _, err := tx.Exec(createDeliveries); err != nil {
+		return fmt.Errorf("create endpoint_deliveries table: %w", err)
+	}
+
+	if _, err := tx.Exec(createAttempts); err != nil {
+		return fmt.Errorf("create delivery_attempts table: %w", err)
+	}
+
+	for _, idx := range indexes {
+		if _, err := tx.Exec(idx); err != nil {
+			return fmt.Errorf("create index: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// createRetentionIndexes indexes the columns that the failed and stale
+// retention policies select records by. Delivered records use idx_cleanup.
+func createRetentionIndexes(tx *sql.Tx) error {
+	indexes := []string{
+		`CREATE INDEX idx_retention_failed ON managed_objects (notification_failed, last_notification_attempt);`,
+		`CREATE INDEX idx_retention_stale ON managed_objects (cluster_state, last_reconciled);`,
+	}
+	for _, idx := range indexes {
+		if _, err := tx.Exec(idx); err != nil {
+			return fmt.Errorf("create index: %w", err)
+		}
+	}
+	return nil
+}
+
+// tableColumns returns the set of column names defined on the given table.
+func tableColumns(tx *sql.Tx, table string) (map[string]struct{}, error) {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return nil, fmt.Errorf("reading table info: %w", err)
+	}
+	defer rows.Close()
+
+	columns := make(map[string]struct{})
+	for rows.Next() {
+		var cid int
+		var name, colType string
+		var notNull int
+		var dfltValue sql.NullString
+		var pk int
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return nil, fmt.Errorf("scanning table info: %w", err)
+		}
+		columns[name] = struct{}{}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating table info: %w", err)
+	}
+	return columns, nil
+}
@@ -0,0 +1,199 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestMigrationsAreNumberedInOrder(t *testing.T) {
+	require.NotEmpty(t, migrations)
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.Version, "migration %d", i)
+		assert.NotEmpty(t, m.Description)
+	}
+	assert.Equal(t, SchemaVersion, migrations[len(migrations)-1].Version)
+}
+
+// versions returns the versions of the migrations in list.
+func versions(list []Migration) []int {
+	var v []int
+	for _, m := range list {
+		v = append(v, m.Version)
+	}
+	return v
+}
+
+// describeSchema returns a description of every table's columns and every
+// index, independent of the order in which columns were added.
+func describeSchema(t *testing.T, db *sql.DB) map[string][]string {
+	t.Helper()
+	schema := make(map[string][]string)
+
+	rows, err := db.Query("SELECT type, name, tbl_name FROM sqlite_master WHERE name NOT LIKE 'sqlite_%'")
+	require.NoError(t, err)
+	var tables []string
+	for rows.Next() {
+		var kind, name, table string
+		require.NoError(t, rows.Scan(&kind, &name, &table))
+		if kind == "table" {
+			tables = append(tables, name)
+		} else {
+			schema["indexes"] = append(schema["indexes"], kind+" "+name+" on "+table)
+		}
+	}
+	require.NoError(t, rows.Err())
+	rows.Close()
+
+	for _, table := range tables {
+		rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+		require.NoError(t, err)
+		for rows.Next() {
+			var cid, notNull, pk int
+			var name, colType string
+			var dflt sql.NullString
+			require.NoError(t, rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk))
+			schema[table] = append(schema[table], fmt.Sprintf("%s %s notnull=%d default=%s pk=%d", name, colType, notNull, dflt.String, pk))
+		}
+		require.NoError(t, rows.Err())
+		rows.Close()
+	}
+
+	for _, v := range schema {
+		sort.Strings(v)
+	}
+	return schema
+}
+
+func TestMigrateUpgradesHistoricalSchemas(t *testing.T) {
+	fresh := newFileDB(t, filepath.Join(t.TempDir(), "fresh.db"))
+	want := describeSchema(t, fresh.db)
+
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "schemas", "*.sql"))
+	require.NoError(t, err)
+	require.NotEmpty(t, fixtures)
+
+	for _, fixture := range fixtures {
+		t.Run(strings.TrimSuffix(filepath.Base(fixture), ".sql"), func(t *testing.T) {
+			ddl, err := os.ReadFile(fixture)
+			require.NoError(t, err)
+
+			// Build the old database with a row in the columns every
+			// schema has had. Fixtures of versioned schemas set their
+			// version.
+			path := filepath.Join(t.TempDir(), "events.db")
+			old, err := sql.Open("sqlite3", path)
+			require.NoError(t, err)
+			_, err = old.Exec(string(ddl))
+			require.NoError(t, err)
+			_, err = old.Exec(`INSERT INTO managed_objects
+				(id, resource_uid, resource_type, resource_name, resource_namespace, cluster_state, created_at, deleted_at, notified_created)
+				VALUES ('id-1', 'uid-1', 'Pod', 'web', 'default', 'deleted', ?, ?, 1)`,
+				"2025-06-01T10:00:00Z", "2025-06-02T10:00:00Z")
+			require.NoError(t, err)
+			require.NoError(t, old.Close())
+
+			version, pending, err := PendingMigrations(path)
+			require.NoError(t, err)
+			assert.Equal(t, versions(migrations[version:]), versions(pending))
+
+			db := newFileDB(t, path)
+			assert.Equal(t, want, describeSchema(t, db.db))
+			version, pending, err = PendingMigrations(path)
+			require.NoError(t, err)
+			assert.Equal(t, SchemaVersion, version)
+			assert.Empty(t, pending)
+
+			got, err := db.GetManagedObjectByID("id-1")
+			require.NoError(t, err)
+			assert.Equal(t, "uid-1", got.ResourceUID)
+			assert.Equal(t, "deleted", got.ClusterState)
+			assert.True(t, got.NotifiedCreated)
+			assert.False(t, got.NotifiedDeleted)
+			assert.Empty(t, got.Annotations)
+
+			// The upgraded database takes new events.
+			require.NoError(t, db.InsertManagedObject(newTestObject("id-2", "uid-2")))
+			pendingObjects, err := db.GetPendingNotifications(10, "")
+			require.NoError(t, err)
+			assert.Len(t, pendingObjects, 2)
+		})
+	}
+}
+
+func TestMigrateAppliesEachMigrationInATransaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.db")
+	db := newFileDB(t, path)
+	list := append(append([]Migration{}, migrations...),
+		Migration{
+			Version:     SchemaVersion + 1,
+			Description: "add widgets",
+			up: func(tx *sql.Tx) error {
+				_, err := tx.Exec("CREATE TABLE widgets (id TEXT PRIMARY KEY)")
+				return err
+			},
+		},
+		Migration{
+			Version:     SchemaVersion + 2,
+			Description: "add gadgets",
+			up: func(tx *sql.Tx) error {
+				if _, err := tx.Exec("CREATE TABLE gadgets (id TEXT PRIMARY KEY)"); err != nil {
+					return err
+				}
+				return errors.New("boom")
+			},
+		},
+	)
+
+	err := db.migrate(list)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), fmt.Sprintf("migration %d (add gadgets): boom", SchemaVersion+2))
+
+	version, err := schemaVersion(db.db)
+	require.NoError(t, err)
+	assert.Equal(t, SchemaVersion+1, version, "the failed migration is not recorded")
+	schema := describeSchema(t, db.db)
+	assert.Contains(t, schema, "widgets")
+	assert.NotContains(t, schema, "gadgets", "the failed migration is rolled back")
+
+	// The database is now newer than this version of Beacon supports.
+	_, _, err = PendingMigrations(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "newer than the supported version")
+}
+
+func TestPendingMigrationsOfMissingDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.db")
+	version, pending, err := PendingMigrations(path)
+	require.NoError(t, err)
+	assert.Equal(t, 0, version)
+	assert.Equal(t, versions(migrations), versions(pending))
+	assert.NoFileExists(t, path, "a dry run does not create the database")
+}
+
+func TestNewSQLiteDBReopensCurrentSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.db")
+	db, err := NewSQLiteDB(path, zap.NewNop())
+	require.NoError(t, err)
+	obj := newTestObject("id-1", "uid-1")
+	obj.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	require.NoError(t, db.InsertManagedObject(obj))
+	require.NoError(t, db.Close())
+
+	reopened := newFileDB(t, path)
+	version, err := schemaVersion(reopened.db)
+	require.NoError(t, err)
+	assert.Equal(t, SchemaVersion, version)
+	_, err = reopened.GetManagedObjectByID("id-1")
+	assert.NoError(t, err)
+}
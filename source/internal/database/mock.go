@@ -27,6 +27,12 @@ func (m *MockDatabase) Ping() error {
 	return args.Error(0)
 }
 
+// WithTx runs fn with m itself as the transaction, so that the calls within
+// it are matched against m's expectations. It is not recorded as a call.
+func (m *MockDatabase) WithTx(fn func(tx Database) error) error {
+	return fn(m)
+}
+
 // InsertManagedObject mocks the InsertManagedObject method.
 func (m *MockDatabase) InsertManagedObject(obj *models.ManagedObject) error {
 	args := m.Called(obj)
@@ -57,12 +63,24 @@ func (m *MockDatabase) UpdateClusterState(uid string, state string, deletedAt *t
 	return args.Error(0)
 }
 
+// SetDeletedTraceParent mocks the SetDeletedTraceParent method.
+func (m *MockDatabase) SetDeletedTraceParent(uid string, traceParent string) error {
+	args := m.Called(uid, traceParent)
+	return args.Error(0)
+}
+
 // UpdateNotificationStatus mocks the UpdateNotificationStatus method.
 func (m *MockDatabase) UpdateNotificationStatus(id string, eventType string, sentAt time.Time) error {
 	args := m.Called(id, eventType, sentAt)
 	return args.Error(0)
 }
 
+// MarkCoalesced mocks the MarkCoalesced method.
+func (m *MockDatabase) MarkCoalesced(id string, decision string, sentAt time.Time) error {
+	args := m.Called(id, decision, sentAt)
+	return args.Error(0)
+}
+
 // MarkNotificationFailed mocks the MarkNotificationFailed method.
 func (m *MockDatabase) MarkNotificationFailed(id string, statusCode int) error {
 	args := m.Called(id, statusCode)
@@ -70,11 +88,53 @@ func (m *MockDatabase) MarkNotificationFailed(id string, statusCode int) error {
 }
 
 // IncrementNotificationAttempts mocks the IncrementNotificationAttempts method.
-func (m *MockDatabase) IncrementNotificationAttempts(id string) error {
-	args := m.Called(id)
+func (m *MockDatabase) IncrementNotificationAttempts(id string, nextAttemptAt time.Time) error {
+	args := m.Called(id, nextAttemptAt)
+	return args.Error(0)
+}
+
+// MarkAwaitingAck mocks the MarkAwaitingAck method.
+func (m *MockDatabase) MarkAwaitingAck(id string, eventType string, deadline time.Time) error {
+	args := m.Called(id, eventType, deadline)
+	return args.Error(0)
+}
+
+// ClaimAwaitingAck mocks the ClaimAwaitingAck method.
+func (m *MockDatabase) ClaimAwaitingAck(id string, eventType string) (bool, error) {
+	args := m.Called(id, eventType)
+	return args.Bool(0), args.Error(1)
+}
+
+// GetEndpointDeliveries mocks the GetEndpointDeliveries method.
+func (m *MockDatabase) GetEndpointDeliveries(objectID string) ([]*models.EndpointDelivery, error) {
+	args := m.Called(objectID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.EndpointDelivery), args.Error(1)
+}
+
+// SaveEndpointDelivery mocks the SaveEndpointDelivery method.
+func (m *MockDatabase) SaveEndpointDelivery(d *models.EndpointDelivery) error {
+	args := m.Called(d)
+	return args.Error(0)
+}
+
+// RecordDeliveryAttempt mocks the RecordDeliveryAttempt method.
+func (m *MockDatabase) RecordDeliveryAttempt(a *models.DeliveryAttempt, keep int) error {
+	args := m.Called(a, keep)
 	return args.Error(0)
 }
 
+// GetDeliveryAttempts mocks the GetDeliveryAttempts method.
+func (m *MockDatabase) GetDeliveryAttempts(objectID string) ([]*models.DeliveryAttempt, error) {
+	args := m.Called(objectID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.DeliveryAttempt), args.Error(1)
+}
+
 // UpdateLastReconciled mocks the UpdateLastReconciled method.
 func (m *MockDatabase) UpdateLastReconciled(id string, reconciledAt time.Time) error {
 	args := m.Called(id, reconciledAt)
@@ -82,8 +142,8 @@ func (m *MockDatabase) UpdateLastReconciled(id string, reconciledAt time.Time) e
 }
 
 // GetPendingNotifications mocks the GetPendingNotifications method.
-func (m *MockDatabase) GetPendingNotifications(limit int) ([]*models.ManagedObject, error) {
-	args := m.Called(limit)
+func (m *MockDatabase) GetPendingNotifications(limit int, orderingKey string) ([]*models.ManagedObject, error) {
+	args := m.Called(limit, orderingKey)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
@@ -99,21 +159,36 @@ func (m *MockDatabase) GetAllActiveObjects(resourceType string) ([]*models.Manag
 	return args.Get(0).([]*models.ManagedObject), args.Error(1)
 }
 
-// GetCleanupEligible mocks the GetCleanupEligible method.
-func (m *MockDatabase) GetCleanupEligible(retentionPeriod time.Duration) ([]*models.ManagedObject, error) {
-	args := m.Called(retentionPeriod)
+// GetExpiredRecords mocks the GetExpiredRecords method.
+func (m *MockDatabase) GetExpiredRecords(policy string, cutoff time.Time, watched []string, limit int) ([]*models.ManagedObject, error) {
+	args := m.Called(policy, cutoff, watched, limit)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).([]*models.ManagedObject), args.Error(1)
 }
 
+// CountExpiredRecords mocks the CountExpiredRecords method.
+func (m *MockDatabase) CountExpiredRecords(policy string, cutoff time.Time, watched []string) (int, error) {
+	args := m.Called(policy, cutoff, watched)
+	return args.Int(0), args.Error(1)
+}
+
 // CountByState mocks the CountByState method.
 func (m *MockDatabase) CountByState() (int, int, error) {
 	args := m.Called()
 	return args.Int(0), args.Int(1), args.Error(2)
 }
 
+// CountPendingNotifications mocks the CountPendingNotifications method.
+func (m *MockDatabase) CountPendingNotifications() ([]*models.PendingCount, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.PendingCount), args.Error(1)
+}
+
 // DeleteRecord mocks the DeleteRecord method.
 func (m *MockDatabase) DeleteRecord(id string) error {
 	args := m.Called(id)
@@ -131,3 +206,21 @@ func (m *MockDatabase) GetDatabaseSizeBytes() (int64, error) {
 	args := m.Called()
 	return args.Get(0).(int64), args.Error(1)
 }
+
+// CompactDeliveredRecords mocks the CompactDeliveredRecords method.
+func (m *MockDatabase) CompactDeliveredRecords() (int64, error) {
+	args := m.Called()
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// CheckpointWAL mocks the CheckpointWAL method.
+func (m *MockDatabase) CheckpointWAL() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+// BackupTo mocks the BackupTo method.
+func (m *MockDatabase) BackupTo(path string) error {
+	args := m.Called(path)
+	return args.Error(0)
+}
@@ -2,6 +2,8 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -13,15 +15,25 @@ import (
 // SQLiteDB implements the Database interface using SQLite with the go-sqlite3 driver.
 type SQLiteDB struct {
 	db     *sql.DB
+	q      querier // db, or tx for the Database passed to a WithTx function
+	tx     *sql.Tx
 	logger *zap.Logger
 }
 
+// querier is implemented by *sql.DB and *sql.Tx, so that the same queries
+// run inside and outside a transaction.
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
 // Ensure SQLiteDB satisfies the Database interface at compile time.
 var _ Database = (*SQLiteDB)(nil)
 
 // NewSQLiteDB opens (or creates) a SQLite database at dbPath, applies PRAGMAs for
 // WAL mode, incremental auto-vacuum, foreign keys, and a busy timeout, then
-// creates the managed_objects table and its indexes if they do not already exist.
+// applies any schema migrations the database has not had yet.
 func NewSQLiteDB(dbPath string, logger *zap.Logger) (*SQLiteDB, error) {
 	db, err := sql.Open("sqlite3", dbPath)
 	if err != nil {
@@ -34,6 +46,7 @@ func NewSQLiteDB(dbPath string, logger *zap.Logger) (*SQLiteDB, error) {
 
 	s := &SQLiteDB{
 		db:     db,
+		q:      db,
 		logger: logger,
 	}
 
@@ -42,12 +55,7 @@ func NewSQLiteDB(dbPath string, logger *zap.Logger) (*SQLiteDB, error) {
 		return nil, fmt.Errorf("failed to apply pragmas: %w", err)
 	}
 
-	if err := s.createSchema(); err != nil {
-		db.Close()
-		return nil, fmt.Errorf("failed to create schema: %w", err)
-	}
-
-	if err := s.migrateSchema(); err != nil {
+	if err := s.migrate(migrations); err != nil {
 		db.Close()
 		return nil, fmt.Errorf("failed to migrate schema: %w", err)
 	}
@@ -65,124 +73,119 @@ func (s *SQLiteDB) applyPragmas() error {
 		"PRAGMA busy_timeout=5000",
 	}
 	for _, p := range pragmas {
-		if _, err := s.db.Exec(p); err != nil {
+		if _, err := s.q.Exec(p); err != nil {
 			return fmt.Errorf("pragma %q: %w", p, err)
 		}
 	}
 	return nil
 }
 
-// createSchema creates the managed_objects table and all supporting indexes.
-func (s *SQLiteDB) createSchema() error {
-	const createTable = `
-CREATE TABLE IF NOT EXISTS managed_objects (
-    id                           TEXT PRIMARY KEY,
-    resource_uid                 TEXT NOT NULL,
-    resource_type                TEXT NOT NULL,
-    resource_name                TEXT NOT NULL,
-    resource_namespace           TEXT NOT NULL DEFAULT '',
-    annotation_value             TEXT NOT NULL DEFAULT '',
-    cluster_state                TEXT NOT NULL DEFAULT 'exists',
-    detection_source             TEXT NOT NULL DEFAULT '',
-    created_at                   TEXT NOT NULL,
-    deleted_at                   TEXT,
-    last_reconciled              TEXT,
-    notified_created             INTEGER NOT NULL DEFAULT 0,
-    notified_deleted             INTEGER NOT NULL DEFAULT 0,
-    notification_failed          INTEGER NOT NULL DEFAULT 0,
-    notification_failed_code     INTEGER NOT NULL DEFAULT 0,
-    created_notification_sent_at TEXT,
-    deleted_notification_sent_at TEXT,
-    notification_attempts        INTEGER NOT NULL DEFAULT 0,
-    last_notification_attempt    TEXT,
-    labels                       TEXT NOT NULL DEFAULT '',
-    annotations                  TEXT NOT NULL DEFAULT '',
-    resource_version             TEXT NOT NULL DEFAULT '',
-    full_metadata                TEXT NOT NULL DEFAULT ''
-);`
-
-	indexes := []string{
-		`CREATE INDEX IF NOT EXISTS idx_resource_uid ON managed_objects (resource_uid);`,
-		`CREATE INDEX IF NOT EXISTS idx_resource_type ON managed_objects (resource_type);`,
-		`CREATE INDEX IF NOT EXISTS idx_resource_namespace ON managed_objects (resource_namespace);`,
-		`CREATE INDEX IF NOT EXISTS idx_notification ON managed_objects (cluster_state, notified_created, notified_deleted);`,
-		`CREATE INDEX IF NOT EXISTS idx_reconciliation ON managed_objects (resource_type, last_reconciled);`,
-		`CREATE INDEX IF NOT EXISTS idx_cleanup ON managed_objects (deleted_at, notified_deleted, cluster_state);`,
-	}
-
-	if _, err := s.db.Exec(createTable); err != nil {
-		return fmt.Errorf("create table: %w", err)
-	}
-
-	for _, idx := range indexes {
-		if _, err := s.db.Exec(idx); err != nil {
-			return fmt.Errorf("create index: %w", err)
-		}
+// Close closes the underlying database connection.
+func (s *SQLiteDB) Close() error {
+	if s.tx != nil {
+		return errors.New("close called within a transaction")
 	}
-
-	return nil
+	return s.db.Close()
 }
 
-// migrateSchema applies incremental schema migrations for existing databases.
-func (s *SQLiteDB) migrateSchema() error {
-	// Check whether the annotations column already exists.
-	rows, err := s.db.Query("PRAGMA table_info(managed_objects)")
-	if err != nil {
-		return fmt.Errorf("reading table info: %w", err)
+// Ping verifies the database connection is alive.
+func (s *SQLiteDB) Ping() error {
+	if s.tx != nil {
+		_, err := s.tx.Exec("SELECT 1")
+		return err
 	}
-	defer rows.Close()
+	return s.db.Ping()
+}
 
-	hasAnnotations := false
-	for rows.Next() {
-		var cid int
-		var name, colType string
-		var notNull int
-		var dfltValue sql.NullString
-		var pk int
-		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
-			return fmt.Errorf("scanning table info: %w", err)
+// WithTx runs fn in a transaction, passing it a Database whose calls are
+// part of the transaction. The transaction commits if fn returns nil and
+// rolls back otherwise. Calling WithTx on the Database passed to fn runs fn
+// in a savepoint of the same transaction. The database has a single
+// connection, so fn must make its calls through tx rather than s.
+func (s *SQLiteDB) WithTx(fn func(tx Database) error) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		return fn(s.bound(tx))
+	})
+}
+
+// inTx runs fn in a new transaction, or in a savepoint of the transaction s
+// is bound to, so that its changes are applied all or nothing either way.
+func (s *SQLiteDB) inTx(fn func(tx *sql.Tx) error) error {
+	if s.tx != nil {
+		if _, err := s.tx.Exec("SAVEPOINT nested"); err != nil {
+			return fmt.Errorf("begin savepoint: %w", err)
 		}
-		if name == "annotations" {
-			hasAnnotations = true
-			break
+		if err := fn(s.tx); err != nil {
+			if _, rbErr := s.tx.Exec("ROLLBACK TO nested"); rbErr != nil {
+				return errors.Join(err, fmt.Errorf("roll back savepoint: %w", rbErr))
+			}
+			s.tx.Exec("RELEASE nested")
+			return err
 		}
-	}
-	if err := rows.Err(); err != nil {
-		return fmt.Errorf("iterating table info: %w", err)
-	}
-
-	if !hasAnnotations {
-		if _, err := s.db.Exec("ALTER TABLE managed_objects ADD COLUMN annotations TEXT NOT NULL DEFAULT ''"); err != nil {
-			return fmt.Errorf("adding annotations column: %w", err)
+		if _, err := s.tx.Exec("RELEASE nested"); err != nil {
+			return fmt.Errorf("release savepoint: %w", err)
 		}
-		s.logger.Info("migrated schema: added annotations column")
+		return nil
 	}
 
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
 	return nil
 }
 
-// Close closes the underlying database connection.
-func (s *SQLiteDB) Close() error {
-	return s.db.Close()
+// bound returns a copy of s whose queries run in tx.
+func (s *SQLiteDB) bound(tx *sql.Tx) *SQLiteDB {
+	return &SQLiteDB{db: s.db, q: tx, tx: tx, logger: s.logger}
 }
 
-// Ping verifies the database connection is alive.
-func (s *SQLiteDB) Ping() error {
-	return s.db.Ping()
+// InsertManagedObject inserts a new managed object record into the database
+// and assigns sequence numbers to its created event and, for an object that
+// is already deleted, its deleted event. The assigned numbers are set on obj.
+func (s *SQLiteDB) InsertManagedObject(obj *models.ManagedObject) error {
+	var createdSeq, deletedSeq int64
+	err := s.inTx(func(tx *sql.Tx) error {
+		var err error
+		if createdSeq, err = nextSequence(tx); err != nil {
+			return err
+		}
+		if obj.ClusterState == models.ClusterStateDeleted {
+			if deletedSeq, err = nextSequence(tx); err != nil {
+				return err
+			}
+		}
+		return insertManagedObject(tx, obj, createdSeq, deletedSeq)
+	})
+	if err != nil {
+		return fmt.Errorf("insert managed object: %w", err)
+	}
+	obj.CreatedSequence = createdSeq
+	obj.DeletedSequence = deletedSeq
+	return nil
 }
 
-// InsertManagedObject inserts a new managed object record into the database.
-func (s *SQLiteDB) InsertManagedObject(obj *models.ManagedObject) error {
+// insertManagedObject inserts obj with the given event sequence numbers.
+func insertManagedObject(tx *sql.Tx, obj *models.ManagedObject, createdSeq, deletedSeq int64) error {
 	const query = `
 INSERT INTO managed_objects (
     id, resource_uid, resource_type, resource_name, resource_namespace,
     annotation_value, cluster_state, detection_source, created_at, deleted_at,
     last_reconciled, notified_created, notified_deleted, notification_failed,
     notification_failed_code, created_notification_sent_at, deleted_notification_sent_at,
-    notification_attempts, last_notification_attempt, labels, annotations, resource_version, full_metadata
-) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+    notification_attempts, last_notification_attempt, labels, annotations, resource_version, full_metadata, fields,
+    next_attempt_at, created_sequence, deleted_sequence, coalesced, awaiting_ack,
+    created_trace_parent, deleted_trace_parent
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
-	_, err := s.db.Exec(query,
+	_, err := tx.Exec(query,
 		obj.ID,
 		obj.ResourceUID,
 		obj.ResourceType,
@@ -206,24 +209,36 @@ INSERT INTO managed_objects (
 		obj.Annotations,
 		obj.ResourceVersion,
 		obj.FullMetadata,
+		obj.Fields,
+		formatNullableTime(utcTime(obj.NextAttemptAt)),
+		createdSeq,
+		deletedSeq,
+		obj.Coalesced,
+		obj.AwaitingAck,
+		obj.CreatedTraceParent,
+		obj.DeletedTraceParent,
 	)
-	if err != nil {
-		return fmt.Errorf("insert managed object: %w", err)
-	}
-	return nil
+	return err
 }
 
-// GetManagedObjectByUID retrieves a managed object by its Kubernetes resource UID.
+// GetManagedObjectByUID retrieves a managed object by its Kubernetes resource
+// UID. A resource whose annotation was removed and added again has several
+// records; the one in the "exists" state is returned if there is one, or
+// else the most recently created.
 func (s *SQLiteDB) GetManagedObjectByUID(uid string) (*models.ManagedObject, error) {
 	const query = `SELECT
     id, resource_uid, resource_type, resource_name, resource_namespace,
     annotation_value, cluster_state, detection_source, created_at, deleted_at,
     last_reconciled, notified_created, notified_deleted, notification_failed,
     notification_failed_code, created_notification_sent_at, deleted_notification_sent_at,
-    notification_attempts, last_notification_attempt, labels, annotations, resource_version, full_metadata
-FROM managed_objects WHERE resource_uid = ?`
-
-	return s.scanManagedObject(s.db.QueryRow(query, uid))
+    notification_attempts, last_notification_attempt, labels, annotations, resource_version, full_metadata, fields,
+    next_attempt_at, created_sequence, deleted_sequence, coalesced, awaiting_ack,
+    created_trace_parent, deleted_trace_parent
+FROM managed_objects WHERE resource_uid = ?
+ORDER BY cluster_state = 'exists' DESC, created_at DESC, rowid DESC
+LIMIT 1`
+
+	return s.scanManagedObject(s.q.QueryRow(query, uid))
 }
 
 // GetManagedObjectByID retrieves a managed object by its internal record ID.
@@ -233,69 +248,385 @@ func (s *SQLiteDB) GetManagedObjectByID(id string) (*models.ManagedObject, error
     annotation_value, cluster_state, detection_source, created_at, deleted_at,
     last_reconciled, notified_created, notified_deleted, notification_failed,
     notification_failed_code, created_notification_sent_at, deleted_notification_sent_at,
-    notification_attempts, last_notification_attempt, labels, annotations, resource_version, full_metadata
+    notification_attempts, last_notification_attempt, labels, annotations, resource_version, full_metadata, fields,
+    next_attempt_at, created_sequence, deleted_sequence, coalesced, awaiting_ack,
+    created_trace_parent, deleted_trace_parent
 FROM managed_objects WHERE id = ?`
 
-	return s.scanManagedObject(s.db.QueryRow(query, id))
+	return s.scanManagedObject(s.q.QueryRow(query, id))
 }
 
-// UpdateClusterState sets the cluster state and optional deletion timestamp for
-// the managed object identified by the given resource UID.
+// UpdateClusterState moves the managed object identified by the given
+// resource UID to the "deleted" state, the only change of cluster state
+// allowed, and records its deletion timestamp. Its deleted event is assigned
+// a sequence number. An object with per-endpoint deliveries becomes due at
+// once, since its deleted event is new to every endpoint; each endpoint's
+// own retry schedule still applies. An object that is already deleted is left
+// unchanged and a models.ErrInvalidTransition error returned.
 func (s *SQLiteDB) UpdateClusterState(uid string, state string, deletedAt *time.Time) error {
-	const query = `UPDATE managed_objects SET cluster_state = ?, deleted_at = ? WHERE resource_uid = ?`
-	_, err := s.db.Exec(query, state, formatNullableTime(deletedAt), uid)
+	if state != models.ClusterStateDeleted {
+		return fmt.Errorf("update cluster state: %w: cluster state cannot change to %q", models.ErrInvalidTransition, state)
+	}
+
+	err := s.inTx(func(tx *sql.Tx) error {
+		const query = `UPDATE managed_objects SET cluster_state = ?, deleted_at = ? WHERE resource_uid = ? AND cluster_state = ?`
+		res, err := tx.Exec(query, state, formatNullableTime(deletedAt), uid, models.ClusterStateExists)
+		if err != nil {
+			return err
+		}
+		if err := checkTransition(res, models.TransitionDelete, "", func() (*models.ManagedObject, error) {
+			return s.bound(tx).GetManagedObjectByUID(uid)
+		}); err != nil {
+			return err
+		}
+
+		seq, err := nextSequence(tx)
+		if err != nil {
+			return err
+		}
+		const assign = `UPDATE managed_objects SET deleted_sequence = ? WHERE resource_uid = ? AND deleted_sequence = 0`
+		if _, err := tx.Exec(assign, seq, uid); err != nil {
+			return err
+		}
+
+		const due = `UPDATE managed_objects SET next_attempt_at = NULL
+WHERE resource_uid = ? AND EXISTS (SELECT 1 FROM endpoint_deliveries d WHERE d.object_id = managed_objects.id)`
+		_, err = tx.Exec(due, uid)
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("update cluster state: %w", err)
 	}
 	return nil
 }
 
+// SetDeletedTraceParent records the W3C traceparent of the span that
+// detected the deletion of the resource with the given UID on its records
+// that are not yet deleted. It is called before UpdateClusterState so that
+// the deleted event is never pending without its trace context.
+func (s *SQLiteDB) SetDeletedTraceParent(uid string, traceParent string) error {
+	const query = `UPDATE managed_objects SET deleted_trace_parent = ? WHERE resource_uid = ? AND cluster_state = ?`
+	if _, err := s.q.Exec(query, traceParent, uid, models.ClusterStateExists); err != nil {
+		return fmt.Errorf("set deleted trace parent: %w", err)
+	}
+	return nil
+}
+
+// Guards of the notification state transitions, matching
+// ManagedObject.CheckTransition. Each update applies only to a row in a state
+// from which its transition is allowed.
+const (
+	guardNotFailed      = `notification_failed = 0`
+	guardCreatedPending = guardNotFailed + ` AND notified_created = 0`
+	guardDeletedPending = guardNotFailed + ` AND cluster_state = 'deleted' AND notified_created = 1 AND notified_deleted = 0`
+	guardAnyPending     = guardNotFailed + ` AND (notified_created = 0 OR (cluster_state = 'deleted' AND notified_deleted = 0))`
+	guardCoalescible    = guardNotFailed + ` AND cluster_state = 'deleted' AND notified_created = 0 AND notified_deleted = 0`
+)
+
+// eventGuard returns the guard under which eventType is pending, or "" for an
+// unknown event type.
+func eventGuard(eventType string) string {
+	switch eventType {
+	case "created":
+		return guardCreatedPending
+	case "deleted":
+		return guardDeletedPending
+	case models.EventEphemeral:
+		return guardCoalescible
+	default:
+		return ""
+	}
+}
+
 // UpdateNotificationStatus marks a notification event as sent. eventType must be
-// either "created" or "deleted".
+// either "created" or "deleted", and the event must be pending.
 func (s *SQLiteDB) UpdateNotificationStatus(id string, eventType string, sentAt time.Time) error {
 	var query string
 	switch eventType {
 	case "created":
-		query = `UPDATE managed_objects SET notified_created = 1, created_notification_sent_at = ? WHERE id = ?`
+		query = `UPDATE managed_objects SET notified_created = 1, created_notification_sent_at = ?, awaiting_ack = '' WHERE id = ? AND ` + guardCreatedPending
 	case "deleted":
-		query = `UPDATE managed_objects SET notified_deleted = 1, deleted_notification_sent_at = ? WHERE id = ?`
+		query = `UPDATE managed_objects SET notified_deleted = 1, deleted_notification_sent_at = ?, awaiting_ack = '' WHERE id = ? AND ` + guardDeletedPending
 	default:
 		return fmt.Errorf("unknown event type: %s", eventType)
 	}
-	_, err := s.db.Exec(query, sentAt.Format(time.RFC3339), id)
-	if err != nil {
+	if err := s.transition(models.TransitionSend, eventType, id, query, sentAt.Format(time.RFC3339), id); err != nil {
 		return fmt.Errorf("update notification status: %w", err)
 	}
 	return nil
 }
 
+// MarkCoalesced records that the created and deleted events of a short-lived
+// object were coalesced. Both events are marked sent at sentAt, and decision
+// (models.CoalescedSuppressed or models.CoalescedEphemeral) records whether
+// an ephemeral event replaced them. Neither event may have been sent.
+func (s *SQLiteDB) MarkCoalesced(id string, decision string, sentAt time.Time) error {
+	const query = `UPDATE managed_objects SET notified_created = 1, notified_deleted = 1,
+    created_notification_sent_at = ?, deleted_notification_sent_at = ?, coalesced = ?, awaiting_ack = '' WHERE id = ? AND ` + guardCoalescible
+	ts := sentAt.Format(time.RFC3339)
+	if err := s.transition(models.TransitionCoalesce, "", id, query, ts, ts, decision, id); err != nil {
+		return fmt.Errorf("mark coalesced: %w", err)
+	}
+	return nil
+}
+
 // MarkNotificationFailed records a permanent notification failure with the
-// HTTP status code that caused it.
+// HTTP status code that caused it, at the time of the last notification
+// attempt. An object fails only once.
 func (s *SQLiteDB) MarkNotificationFailed(id string, statusCode int) error {
-	const query = `UPDATE managed_objects SET notification_failed = 1, notification_failed_code = ? WHERE id = ?`
-	_, err := s.db.Exec(query, statusCode, id)
-	if err != nil {
+	const query = `UPDATE managed_objects SET notification_failed = 1, notification_failed_code = ?, last_notification_attempt = ?,
+    awaiting_ack = '' WHERE id = ? AND ` + guardNotFailed
+	now := time.Now().Format(time.RFC3339)
+	if err := s.transition(models.TransitionFail, "", id, query, statusCode, now, id); err != nil {
 		return fmt.Errorf("mark notification failed: %w", err)
 	}
 	return nil
 }
 
-// IncrementNotificationAttempts bumps the attempt counter and records the
-// current time as the last notification attempt.
-func (s *SQLiteDB) IncrementNotificationAttempts(id string) error {
-	const query = `UPDATE managed_objects SET notification_attempts = notification_attempts + 1, last_notification_attempt = ? WHERE id = ?`
+// IncrementNotificationAttempts bumps the attempt counter, records the
+// current time as the last notification attempt, and schedules the next
+// attempt of an object with a pending event. Times are stored in UTC so
+// next_attempt_at compares correctly as text.
+func (s *SQLiteDB) IncrementNotificationAttempts(id string, nextAttemptAt time.Time) error {
+	const query = `UPDATE managed_objects SET notification_attempts = notification_attempts + 1, last_notification_attempt = ?, next_attempt_at = ?,
+    awaiting_ack = '' WHERE id = ? AND ` + guardAnyPending
 	now := time.Now().Format(time.RFC3339)
-	_, err := s.db.Exec(query, now, id)
-	if err != nil {
+	if err := s.transition(models.TransitionRetry, "", id, query, now, nextAttemptAt.UTC().Format(time.RFC3339), id); err != nil {
 		return fmt.Errorf("increment notification attempts: %w", err)
 	}
 	return nil
 }
 
+// MarkAwaitingAck records that the destination accepted eventType for
+// processing and will acknowledge it later. The object is not pending again
+// until deadline, when the acknowledgement times out. The event must be
+// pending and no other event awaiting acknowledgement.
+func (s *SQLiteDB) MarkAwaitingAck(id string, eventType string, deadline time.Time) error {
+	guard := eventGuard(eventType)
+	if guard == "" {
+		return fmt.Errorf("unknown event type: %s", eventType)
+	}
+	query := `UPDATE managed_objects SET awaiting_ack = ?, last_notification_attempt = ?, next_attempt_at = ? WHERE id = ? AND awaiting_ack = '' AND ` + guard
+	now := time.Now().Format(time.RFC3339)
+	if err := s.transition(models.TransitionAwaitAck, eventType, id, query, eventType, now, deadline.UTC().Format(time.RFC3339), id); err != nil {
+		return fmt.Errorf("mark awaiting ack: %w", err)
+	}
+	return nil
+}
+
+// transition runs query, an update of the object with the given ID guarded
+// by its current state, in a transaction with checkTransition.
+func (s *SQLiteDB) transition(transition, eventType, id, query string, args ...any) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(query, args...)
+		if err != nil {
+			return err
+		}
+		return checkTransition(res, transition, eventType, func() (*models.ManagedObject, error) {
+			return s.bound(tx).GetManagedObjectByID(id)
+		})
+	})
+}
+
+// checkTransition returns nil if the guarded update with result res changed a
+// row. Otherwise it loads the object with load and returns the error that
+// CheckTransition gives for its state, or one wrapping sql.ErrNoRows if there
+// is no such object.
+func checkTransition(res sql.Result, transition, eventType string, load func() (*models.ManagedObject, error)) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	obj, err := load()
+	if err != nil {
+		return err
+	}
+	if err := obj.CheckTransition(transition, eventType); err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %s of object %s", models.ErrInvalidTransition, transition, obj.ID)
+}
+
+// ClaimAwaitingAck clears the awaiting acknowledgement state of eventType and
+// reports whether it was set. Only one caller claims a given wait, so an
+// acknowledgement and its timeout are never both applied.
+func (s *SQLiteDB) ClaimAwaitingAck(id string, eventType string) (bool, error) {
+	const query = `UPDATE managed_objects SET awaiting_ack = '' WHERE id = ? AND awaiting_ack = ?`
+	res, err := s.q.Exec(query, id, eventType)
+	if err != nil {
+		return false, fmt.Errorf("claim awaiting ack: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("claim awaiting ack: %w", err)
+	}
+	return n > 0, nil
+}
+
+// GetEndpointDeliveries returns the per-endpoint delivery state of the events
+// of the object with the given internal ID.
+func (s *SQLiteDB) GetEndpointDeliveries(objectID string) ([]*models.EndpointDelivery, error) {
+	const query = `SELECT
+    object_id, endpoint, event_type, status, attempts, last_attempt, next_attempt_at, failed_code, sent_at
+FROM endpoint_deliveries WHERE object_id = ?`
+
+	rows, err := s.q.Query(query, objectID)
+	if err != nil {
+		return nil, fmt.Errorf("get endpoint deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var results []*models.EndpointDelivery
+	for rows.Next() {
+		var d models.EndpointDelivery
+		var lastAttempt, nextAttempt, sentAt sql.NullString
+		if err := rows.Scan(&d.ObjectID, &d.Endpoint, &d.EventType, &d.Status, &d.Attempts,
+			&lastAttempt, &nextAttempt, &d.FailedCode, &sentAt); err != nil {
+			return nil, fmt.Errorf("scan endpoint delivery: %w", err)
+		}
+		if d.LastAttempt, err = parseNullableTime(lastAttempt); err != nil {
+			return nil, fmt.Errorf("parse last_attempt: %w", err)
+		}
+		if d.NextAttemptAt, err = parseNullableTime(nextAttempt); err != nil {
+			return nil, fmt.Errorf("parse next_attempt_at: %w", err)
+		}
+		if d.SentAt, err = parseNullableTime(sentAt); err != nil {
+			return nil, fmt.Errorf("parse sent_at: %w", err)
+		}
+		results = append(results, &d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration: %w", err)
+	}
+	return results, nil
+}
+
+// SaveEndpointDelivery inserts the delivery state of one event to one
+// endpoint, replacing any existing state for the same event and endpoint.
+func (s *SQLiteDB) SaveEndpointDelivery(d *models.EndpointDelivery) error {
+	const query = `
+INSERT INTO endpoint_deliveries (
+    object_id, endpoint, event_type, status, attempts, last_attempt, next_attempt_at, failed_code, sent_at
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (object_id, endpoint, event_type) DO UPDATE SET
+    status = excluded.status,
+    attempts = excluded.attempts,
+    last_attempt = excluded.last_attempt,
+    next_attempt_at = excluded.next_attempt_at,
+    failed_code = excluded.failed_code,
+    sent_at = excluded.sent_at`
+
+	_, err := s.q.Exec(query,
+		d.ObjectID,
+		d.Endpoint,
+		d.EventType,
+		d.Status,
+		d.Attempts,
+		formatNullableTime(utcTime(d.LastAttempt)),
+		formatNullableTime(utcTime(d.NextAttemptAt)),
+		d.FailedCode,
+		formatNullableTime(utcTime(d.SentAt)),
+	)
+	if err != nil {
+		return fmt.Errorf("save endpoint delivery: %w", err)
+	}
+	return nil
+}
+
+// RecordDeliveryAttempt stores a failed delivery attempt and deletes the
+// oldest attempts of the same event and endpoint beyond the most recent keep.
+func (s *SQLiteDB) RecordDeliveryAttempt(a *models.DeliveryAttempt, keep int) error {
+	headers := ""
+	if len(a.ResponseHeaders) > 0 {
+		b, err := json.Marshal(a.ResponseHeaders)
+		if err != nil {
+			return fmt.Errorf("marshal response headers: %w", err)
+		}
+		headers = string(b)
+	}
+
+	return s.inTx(func(tx *sql.Tx) error {
+		const insert = `
+INSERT INTO delivery_attempts (
+    object_id, endpoint, event_type, attempted_at, status_code, latency_ms, error, response_body, response_headers
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		if _, err := tx.Exec(insert,
+			a.ObjectID,
+			a.Endpoint,
+			a.EventType,
+			a.AttemptedAt.UTC().Format(time.RFC3339Nano),
+			a.StatusCode,
+			a.Latency.Milliseconds(),
+			a.Error,
+			a.ResponseBody,
+			headers,
+		); err != nil {
+			return fmt.Errorf("insert delivery attempt: %w", err)
+		}
+
+		const prune = `
+DELETE FROM delivery_attempts
+WHERE object_id = ? AND endpoint = ? AND event_type = ? AND id NOT IN (
+    SELECT id FROM delivery_attempts
+    WHERE object_id = ? AND endpoint = ? AND event_type = ?
+    ORDER BY id DESC LIMIT ?
+)`
+		if _, err := tx.Exec(prune,
+			a.ObjectID, a.Endpoint, a.EventType,
+			a.ObjectID, a.Endpoint, a.EventType, keep,
+		); err != nil {
+			return fmt.Errorf("prune delivery attempts: %w", err)
+		}
+		return nil
+	})
+}
+
+// GetDeliveryAttempts returns the recorded failed delivery attempts of the
+// object identified by its internal ID, oldest first.
+func (s *SQLiteDB) GetDeliveryAttempts(objectID string) ([]*models.DeliveryAttempt, error) {
+	const query = `SELECT
+    id, object_id, endpoint, event_type, attempted_at, status_code, latency_ms, error, response_body, response_headers
+FROM delivery_attempts WHERE object_id = ? ORDER BY id`
+
+	rows, err := s.q.Query(query, objectID)
+	if err != nil {
+		return nil, fmt.Errorf("get delivery attempts: %w", err)
+	}
+	defer rows.Close()
+
+	var results []*models.DeliveryAttempt
+	for rows.Next() {
+		var a models.DeliveryAttempt
+		var attemptedAt, headers string
+		var latencyMS int64
+		if err := rows.Scan(&a.ID, &a.ObjectID, &a.Endpoint, &a.EventType, &attemptedAt,
+			&a.StatusCode, &latencyMS, &a.Error, &a.ResponseBody, &headers); err != nil {
+			return nil, fmt.Errorf("scan delivery attempt: %w", err)
+		}
+		if a.AttemptedAt, err = time.Parse(time.RFC3339Nano, attemptedAt); err != nil {
+			return nil, fmt.Errorf("parse attempted_at: %w", err)
+		}
+		a.Latency = time.Duration(latencyMS) * time.Millisecond
+		if headers != "" {
+			if err := json.Unmarshal([]byte(headers), &a.ResponseHeaders); err != nil {
+				return nil, fmt.Errorf("parse response_headers: %w", err)
+			}
+		}
+		results = append(results, &a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration: %w", err)
+	}
+	return results, nil
+}
+
 // UpdateLastReconciled sets the last_reconciled timestamp.
 func (s *SQLiteDB) UpdateLastReconciled(id string, reconciledAt time.Time) error {
 	const query = `UPDATE managed_objects SET last_reconciled = ? WHERE id = ?`
-	_, err := s.db.Exec(query, reconciledAt.Format(time.RFC3339), id)
+	_, err := s.q.Exec(query, reconciledAt.Format(time.RFC3339), id)
 	if err != nil {
 		return fmt.Errorf("update last reconciled: %w", err)
 	}
@@ -307,21 +638,44 @@ func (s *SQLiteDB) UpdateLastReconciled(id string, reconciledAt time.Time) error
 //   - It has not been notified of creation, OR
 //   - It is in the "deleted" state and has not been notified of deletion
 //
-// Objects whose notifications have permanently failed are excluded.
-func (s *SQLiteDB) GetPendingNotifications(limit int) ([]*models.ManagedObject, error) {
-	const query = `SELECT
+// Objects whose notifications have permanently failed, and objects whose next
+// retry is scheduled in the future, are excluded. So is any object that
+// shares its ordering key (see models.OrderingKeyUID and
+// models.OrderingKeyName) with an earlier object that is still pending, so
+// that the events for a key are delivered in the order they occurred.
+func (s *SQLiteDB) GetPendingNotifications(limit int, orderingKey string) ([]*models.ManagedObject, error) {
+	sameKey := `earlier.resource_uid = m.resource_uid`
+	if orderingKey == models.OrderingKeyName {
+		sameKey = `earlier.resource_type = m.resource_type
+      AND earlier.resource_namespace = m.resource_namespace
+      AND earlier.resource_name = m.resource_name`
+	}
+
+	query := `SELECT
     id, resource_uid, resource_type, resource_name, resource_namespace,
     annotation_value, cluster_state, detection_source, created_at, deleted_at,
     last_reconciled, notified_created, notified_deleted, notification_failed,
     notification_failed_code, created_notification_sent_at, deleted_notification_sent_at,
-    notification_attempts, last_notification_attempt, labels, annotations, resource_version, full_metadata
-FROM managed_objects
+    notification_attempts, last_notification_attempt, labels, annotations, resource_version, full_metadata, fields,
+    next_attempt_at, created_sequence, deleted_sequence, coalesced, awaiting_ack,
+    created_trace_parent, deleted_trace_parent
+FROM managed_objects m
 WHERE (notified_created = 0 OR (cluster_state = 'deleted' AND notified_deleted = 0))
   AND notification_failed = 0
-ORDER BY created_at ASC
+  AND (next_attempt_at IS NULL OR next_attempt_at <= ?)
+  AND NOT EXISTS (
+    SELECT 1 FROM managed_objects earlier
+    WHERE ` + sameKey + `
+      AND earlier.id != m.id
+      AND (earlier.created_at < m.created_at
+           OR (earlier.created_at = m.created_at AND earlier.created_sequence < m.created_sequence))
+      AND (earlier.notified_created = 0 OR (earlier.cluster_state = 'deleted' AND earlier.notified_deleted = 0))
+      AND earlier.notification_failed = 0
+  )
+ORDER BY created_at ASC, created_sequence ASC
 LIMIT ?`
 
-	return s.queryManagedObjects(query, limit)
+	return s.queryManagedObjects(query, time.Now().UTC().Format(time.RFC3339), limit)
 }
 
 // GetAllActiveObjects returns all objects in the "exists" state for the given
@@ -332,37 +686,101 @@ func (s *SQLiteDB) GetAllActiveObjects(resourceType string) ([]*models.ManagedOb
     annotation_value, cluster_state, detection_source, created_at, deleted_at,
     last_reconciled, notified_created, notified_deleted, notification_failed,
     notification_failed_code, created_notification_sent_at, deleted_notification_sent_at,
-    notification_attempts, last_notification_attempt, labels, annotations, resource_version, full_metadata
+    notification_attempts, last_notification_attempt, labels, annotations, resource_version, full_metadata, fields,
+    next_attempt_at, created_sequence, deleted_sequence, coalesced, awaiting_ack,
+    created_trace_parent, deleted_trace_parent
 FROM managed_objects
 WHERE cluster_state = 'exists' AND resource_type = ?`
 
 	return s.queryManagedObjects(query, resourceType)
 }
 
-// GetCleanupEligible returns objects that are deleted, have had their deletion
-// notification sent successfully, and whose deleted_at timestamp is older than
-// the retention period.
-func (s *SQLiteDB) GetCleanupEligible(retentionPeriod time.Duration) ([]*models.ManagedObject, error) {
-	cutoff := time.Now().Add(-retentionPeriod).Format(time.RFC3339)
-	const query = `SELECT
+// expiredCondition selects and orders the records a retention policy removes.
+type expiredCondition struct{ where, order string }
+
+// expiredConditions holds, for each retention policy, the condition on a
+// managed_objects row that the policy removes at the cutoff ?1, and the
+// order in which it removes them. The stale condition also takes the JSON
+// array of watched resource types as ?2.
+var expiredConditions = map[string]expiredCondition{
+	models.RetentionDelivered: {
+		where: `cluster_state = 'deleted' AND notified_deleted = 1 AND notification_failed = 0 AND deleted_at < ?1`,
+		order: `deleted_at`,
+	},
+	models.RetentionFailed: {
+		where: `notification_failed = 1 AND COALESCE(last_notification_attempt, created_at) < ?1`,
+		order: `COALESCE(last_notification_attempt, created_at)`,
+	},
+	models.RetentionStale: {
+		where: `cluster_state = 'exists' AND notified_created = 1 AND notification_failed = 0
+  AND (last_reconciled < ?1 OR (last_reconciled IS NULL AND created_at < ?1))
+  AND resource_type NOT IN (SELECT value FROM json_each(?2))`,
+		order: `COALESCE(last_reconciled, created_at)`,
+	},
+}
+
+// GetExpiredRecords returns up to limit objects that the retention policy
+// removes at cutoff, oldest first. A negative limit returns them all.
+func (s *SQLiteDB) GetExpiredRecords(policy string, cutoff time.Time, watched []string, limit int) ([]*models.ManagedObject, error) {
+	cond, args, err := expiredQuery(policy, cutoff, watched)
+	if err != nil {
+		return nil, err
+	}
+	query := `SELECT
     id, resource_uid, resource_type, resource_name, resource_namespace,
     annotation_value, cluster_state, detection_source, created_at, deleted_at,
     last_reconciled, notified_created, notified_deleted, notification_failed,
     notification_failed_code, created_notification_sent_at, deleted_notification_sent_at,
-    notification_attempts, last_notification_attempt, labels, annotations, resource_version, full_metadata
+    notification_attempts, last_notification_attempt, labels, annotations, resource_version, full_metadata, fields,
+    next_attempt_at, created_sequence, deleted_sequence, coalesced, awaiting_ack,
+    created_trace_parent, deleted_trace_parent
 FROM managed_objects
-WHERE cluster_state = 'deleted'
-  AND notified_deleted = 1
-  AND notification_failed = 0
-  AND deleted_at < ?`
+WHERE ` + cond.where + `
+ORDER BY ` + cond.order + `
+LIMIT ?`
+
+	return s.queryManagedObjects(query, append(args, limit)...)
+}
+
+// CountExpiredRecords returns the number of objects that the retention
+// policy removes at cutoff.
+func (s *SQLiteDB) CountExpiredRecords(policy string, cutoff time.Time, watched []string) (int, error) {
+	cond, args, err := expiredQuery(policy, cutoff, watched)
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	if err := s.q.QueryRow(`SELECT COUNT(*) FROM managed_objects WHERE `+cond.where, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("count expired %s records: %w", policy, err)
+	}
+	return count, nil
+}
 
-	return s.queryManagedObjects(query, cutoff)
+// expiredQuery returns the condition of the retention policy and the
+// arguments it takes at cutoff.
+func expiredQuery(policy string, cutoff time.Time, watched []string) (expiredCondition, []interface{}, error) {
+	cond, ok := expiredConditions[policy]
+	if !ok {
+		return cond, nil, fmt.Errorf("unknown retention policy: %s", policy)
+	}
+	args := []interface{}{cutoff.Format(time.RFC3339)}
+	if policy == models.RetentionStale {
+		if watched == nil {
+			watched = []string{}
+		}
+		kinds, err := json.Marshal(watched)
+		if err != nil {
+			return cond, nil, fmt.Errorf("marshal watched resource types: %w", err)
+		}
+		args = append(args, string(kinds))
+	}
+	return cond, args, nil
 }
 
 // CountByState returns the count of objects in the "exists" and "deleted" states.
 func (s *SQLiteDB) CountByState() (exists int, deleted int, err error) {
 	const query = `SELECT cluster_state, COUNT(*) FROM managed_objects GROUP BY cluster_state`
-	rows, err := s.db.Query(query)
+	rows, err := s.q.Query(query)
 	if err != nil {
 		return 0, 0, fmt.Errorf("count by state: %w", err)
 	}
@@ -387,10 +805,44 @@ func (s *SQLiteDB) CountByState() (exists int, deleted int, err error) {
 	return exists, deleted, nil
 }
 
+// CountPendingNotifications returns the number of events still to be
+// delivered by resource type and event type. An object counts once, for the
+// event it sends next.
+func (s *SQLiteDB) CountPendingNotifications() ([]*models.PendingCount, error) {
+	const query = `SELECT resource_type,
+    CASE WHEN notified_created = 0 THEN 'created' ELSE 'deleted' END AS event_type,
+    COUNT(*),
+    SUM(CASE WHEN next_attempt_at IS NULL OR next_attempt_at <= ? THEN 1 ELSE 0 END)
+FROM managed_objects
+WHERE (notified_created = 0 OR (cluster_state = 'deleted' AND notified_deleted = 0))
+  AND notification_failed = 0
+GROUP BY resource_type, event_type
+ORDER BY resource_type, event_type`
+
+	rows, err := s.q.Query(query, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, fmt.Errorf("count pending notifications: %w", err)
+	}
+	defer rows.Close()
+
+	var counts []*models.PendingCount
+	for rows.Next() {
+		c := &models.PendingCount{}
+		if err := rows.Scan(&c.ResourceType, &c.EventType, &c.Pending, &c.Due); err != nil {
+			return nil, fmt.Errorf("scan pending count: %w", err)
+		}
+		counts = append(counts, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration: %w", err)
+	}
+	return counts, nil
+}
+
 // DeleteRecord permanently removes a managed object record by its internal ID.
 func (s *SQLiteDB) DeleteRecord(id string) error {
 	const query = `DELETE FROM managed_objects WHERE id = ?`
-	_, err := s.db.Exec(query, id)
+	_, err := s.q.Exec(query, id)
 	if err != nil {
 		return fmt.Errorf("delete record: %w", err)
 	}
@@ -399,23 +851,84 @@ func (s *SQLiteDB) DeleteRecord(id string) error {
 
 // RunIncrementalVacuum triggers an incremental vacuum to reclaim unused pages.
 func (s *SQLiteDB) RunIncrementalVacuum() error {
-	_, err := s.db.Exec("PRAGMA incremental_vacuum")
+	_, err := s.q.Exec("PRAGMA incremental_vacuum")
 	if err != nil {
 		return fmt.Errorf("incremental vacuum: %w", err)
 	}
 	return nil
 }
 
+// compactBatchSize is the number of rows CompactDeliveredRecords updates per
+// statement. Each batch commits on its own, so events inserted meanwhile wait
+// for one batch at most.
+const compactBatchSize = 500
+
+// delivered matches the managed_objects rows, aliased o, with no event left
+// to deliver.
+const delivered = `o.notified_created = 1 AND (o.cluster_state = 'exists' OR o.notified_deleted = 1)`
+
+// CompactDeliveredRecords clears the full metadata of delivered objects and
+// the response bodies and headers recorded for their delivery attempts.
+func (s *SQLiteDB) CompactDeliveredRecords() (int64, error) {
+	queries := []struct {
+		name  string
+		query string
+	}{
+		{"full metadata", `UPDATE managed_objects SET full_metadata = ''
+WHERE id IN (
+    SELECT o.id FROM managed_objects o
+    WHERE o.full_metadata != '' AND ` + delivered + `
+    LIMIT ?)`},
+		{"delivery attempt responses", `UPDATE delivery_attempts SET response_body = '', response_headers = ''
+WHERE id IN (
+    SELECT a.id FROM delivery_attempts a JOIN managed_objects o ON o.id = a.object_id
+    WHERE (a.response_body != '' OR a.response_headers != '') AND ` + delivered + `
+    LIMIT ?)`},
+	}
+
+	var total int64
+	for _, q := range queries {
+		for {
+			res, err := s.q.Exec(q.query, compactBatchSize)
+			if err != nil {
+				return total, fmt.Errorf("compact %s: %w", q.name, err)
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return total, fmt.Errorf("compact %s: %w", q.name, err)
+			}
+			total += n
+			if n < compactBatchSize {
+				break
+			}
+		}
+	}
+	return total, nil
+}
+
+// CheckpointWAL runs a truncating checkpoint of the write-ahead log. It fails
+// if a reader or writer kept the checkpoint from completing.
+func (s *SQLiteDB) CheckpointWAL() error {
+	var busy, logFrames, checkpointed int
+	if err := s.q.QueryRow("PRAGMA wal_checkpoint(TRUNCATE)").Scan(&busy, &logFrames, &checkpointed); err != nil {
+		return fmt.Errorf("wal checkpoint: %w", err)
+	}
+	if busy != 0 {
+		return fmt.Errorf("wal checkpoint: blocked after copying %d of %d frames", checkpointed, logFrames)
+	}
+	return nil
+}
+
 // GetDatabaseSizeBytes returns the current size of the database in bytes,
 // computed as page_count * page_size.
 func (s *SQLiteDB) GetDatabaseSizeBytes() (int64, error) {
 	var pageCount int64
-	if err := s.db.QueryRow("PRAGMA page_count").Scan(&pageCount); err != nil {
+	if err := s.q.QueryRow("PRAGMA page_count").Scan(&pageCount); err != nil {
 		return 0, fmt.Errorf("page_count: %w", err)
 	}
 
 	var pageSize int64
-	if err := s.db.QueryRow("PRAGMA page_size").Scan(&pageSize); err != nil {
+	if err := s.q.QueryRow("PRAGMA page_size").Scan(&pageSize); err != nil {
 		return 0, fmt.Errorf("page_size: %w", err)
 	}
 
@@ -430,7 +943,7 @@ func (s *SQLiteDB) GetDatabaseSizeBytes() (int64, error) {
 func (s *SQLiteDB) scanManagedObject(row *sql.Row) (*models.ManagedObject, error) {
 	var obj models.ManagedObject
 	var createdAt string
-	var deletedAt, lastReconciled, createdSentAt, deletedSentAt, lastAttempt sql.NullString
+	var deletedAt, lastReconciled, createdSentAt, deletedSentAt, lastAttempt, nextAttempt sql.NullString
 	var notifiedCreated, notifiedDeleted, notificationFailed int
 
 	err := row.Scan(
@@ -457,6 +970,14 @@ func (s *SQLiteDB) scanManagedObject(row *sql.Row) (*models.ManagedObject, error
 		&obj.Annotations,
 		&obj.ResourceVersion,
 		&obj.FullMetadata,
+		&obj.Fields,
+		&nextAttempt,
+		&obj.CreatedSequence,
+		&obj.DeletedSequence,
+		&obj.Coalesced,
+		&obj.AwaitingAck,
+		&obj.CreatedTraceParent,
+		&obj.DeletedTraceParent,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("scan managed object: %w", err)
@@ -496,12 +1017,17 @@ func (s *SQLiteDB) scanManagedObject(row *sql.Row) (*models.ManagedObject, error
 		return nil, fmt.Errorf("parse last_notification_attempt: %w", err)
 	}
 
+	obj.NextAttemptAt, err = parseNullableTime(nextAttempt)
+	if err != nil {
+		return nil, fmt.Errorf("parse next_attempt_at: %w", err)
+	}
+
 	return &obj, nil
 }
 
 // queryManagedObjects executes a query that returns multiple managed object rows.
 func (s *SQLiteDB) queryManagedObjects(query string, args ...interface{}) ([]*models.ManagedObject, error) {
-	rows, err := s.db.Query(query, args...)
+	rows, err := s.q.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("query managed objects: %w", err)
 	}
@@ -511,7 +1037,7 @@ func (s *SQLiteDB) queryManagedObjects(query string, args ...interface{}) ([]*mo
 	for rows.Next() {
 		var obj models.ManagedObject
 		var createdAt string
-		var deletedAt, lastReconciled, createdSentAt, deletedSentAt, lastAttempt sql.NullString
+		var deletedAt, lastReconciled, createdSentAt, deletedSentAt, lastAttempt, nextAttempt sql.NullString
 		var notifiedCreated, notifiedDeleted, notificationFailed int
 
 		err := rows.Scan(
@@ -538,6 +1064,14 @@ func (s *SQLiteDB) queryManagedObjects(query string, args ...interface{}) ([]*mo
 			&obj.Annotations,
 			&obj.ResourceVersion,
 			&obj.FullMetadata,
+			&obj.Fields,
+			&nextAttempt,
+			&obj.CreatedSequence,
+			&obj.DeletedSequence,
+			&obj.Coalesced,
+			&obj.AwaitingAck,
+			&obj.CreatedTraceParent,
+			&obj.DeletedTraceParent,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("scan row: %w", err)
@@ -577,6 +1111,11 @@ func (s *SQLiteDB) queryManagedObjects(query string, args ...interface{}) ([]*mo
 			return nil, fmt.Errorf("parse last_notification_attempt: %w", err)
 		}
 
+		obj.NextAttemptAt, err = parseNullableTime(nextAttempt)
+		if err != nil {
+			return nil, fmt.Errorf("parse next_attempt_at: %w", err)
+		}
+
 		results = append(results, &obj)
 	}
 	if err := rows.Err(); err != nil {
@@ -586,6 +1125,17 @@ func (s *SQLiteDB) queryManagedObjects(query string, args ...interface{}) ([]*mo
 	return results, nil
 }
 
+// nextSequence increments the event sequence counter within tx and returns
+// the new value.
+func nextSequence(tx *sql.Tx) (int64, error) {
+	var seq int64
+	const query = `UPDATE event_sequence SET value = value + 1 WHERE id = 1 RETURNING value`
+	if err := tx.QueryRow(query).Scan(&seq); err != nil {
+		return 0, fmt.Errorf("assigning event sequence: %w", err)
+	}
+	return seq, nil
+}
+
 // formatNullableTime converts a *time.Time to a sql.NullString in RFC3339 format.
 func formatNullableTime(t *time.Time) sql.NullString {
 	if t == nil {
@@ -594,6 +1144,16 @@ func formatNullableTime(t *time.Time) sql.NullString {
 	return sql.NullString{String: t.Format(time.RFC3339), Valid: true}
 }
 
+// utcTime returns t in UTC, for columns that are compared as text against
+// the current UTC time.
+func utcTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
 // parseNullableTime converts a sql.NullString in RFC3339 format to a *time.Time.
 func parseNullableTime(ns sql.NullString) (*time.Time, error) {
 	if !ns.Valid || ns.String == "" {
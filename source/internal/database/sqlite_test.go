@@ -1,6 +1,12 @@
 package database
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
@@ -106,6 +112,18 @@ func TestInsertAndGetEmptyAnnotations(t *testing.T) {
 // State updates
 // --------------------------------------------------------------------------
 
+func TestInsertAndGetFieldsRoundTrip(t *testing.T) {
+	db := newTestDB(t)
+	obj := newTestObject("id-fields", "uid-fields")
+	obj.Fields = `{"model":"llama","replicas":3}`
+
+	require.NoError(t, db.InsertManagedObject(obj))
+
+	got, err := db.GetManagedObjectByUID("uid-fields")
+	require.NoError(t, err)
+	assert.Equal(t, obj.Fields, got.Fields)
+}
+
 func TestUpdateClusterState(t *testing.T) {
 	db := newTestDB(t)
 	obj := newTestObject("id-3", "uid-3")
@@ -122,6 +140,26 @@ func TestUpdateClusterState(t *testing.T) {
 	assert.True(t, now.Equal(*got.DeletedAt), "deleted_at mismatch")
 }
 
+func TestTraceParentsRoundTrip(t *testing.T) {
+	db := newTestDB(t)
+	obj := newTestObject("id-tp", "uid-tp")
+	obj.CreatedTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	require.NoError(t, db.InsertManagedObject(obj))
+
+	const deleted = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	require.NoError(t, db.SetDeletedTraceParent("uid-tp", deleted))
+	now := time.Now()
+	require.NoError(t, db.UpdateClusterState("uid-tp", models.ClusterStateDeleted, &now))
+
+	// A deleted object keeps the trace context of its deletion.
+	require.NoError(t, db.SetDeletedTraceParent("uid-tp", "00-ffffffffffffffffffffffffffffffff-ffffffffffffffff-01"))
+
+	got, err := db.GetManagedObjectByUID("uid-tp")
+	require.NoError(t, err)
+	assert.Equal(t, obj.CreatedTraceParent, got.CreatedTraceParent)
+	assert.Equal(t, deleted, got.DeletedTraceParent)
+}
+
 func TestUpdateNotificationStatusCreated(t *testing.T) {
 	db := newTestDB(t)
 	obj := newTestObject("id-4", "uid-4")
@@ -142,6 +180,9 @@ func TestUpdateNotificationStatusDeleted(t *testing.T) {
 	db := newTestDB(t)
 	obj := newTestObject("id-5", "uid-5")
 	require.NoError(t, db.InsertManagedObject(obj))
+	now := time.Now()
+	require.NoError(t, db.UpdateNotificationStatus("id-5", "created", now))
+	require.NoError(t, db.UpdateClusterState("uid-5", models.ClusterStateDeleted, &now))
 
 	sentAt := time.Now().Truncate(time.Second)
 	err := db.UpdateNotificationStatus("id-5", "deleted", sentAt)
@@ -192,7 +233,7 @@ func TestGetPendingNotifications(t *testing.T) {
 	require.NoError(t, db.InsertManagedObject(obj4))
 	require.NoError(t, db.MarkNotificationFailed("id-p4", 500))
 
-	pending, err := db.GetPendingNotifications(10)
+	pending, err := db.GetPendingNotifications(10, models.OrderingKeyUID)
 	require.NoError(t, err)
 
 	ids := make([]string, len(pending))
@@ -213,7 +254,7 @@ func TestGetPendingNotificationsLimit(t *testing.T) {
 		require.NoError(t, db.InsertManagedObject(obj))
 	}
 
-	pending, err := db.GetPendingNotifications(3)
+	pending, err := db.GetPendingNotifications(3, models.OrderingKeyUID)
 	require.NoError(t, err)
 	assert.Len(t, pending, 3)
 }
@@ -222,13 +263,14 @@ func TestGetPendingNotificationsLimit(t *testing.T) {
 // Cleanup eligibility
 // --------------------------------------------------------------------------
 
-func TestGetCleanupEligible(t *testing.T) {
+func TestGetExpiredRecords_Delivered(t *testing.T) {
 	db := newTestDB(t)
 
 	// Eligible: deleted > 1 hour ago, deletion notified, not failed
 	obj1 := newTestObject("id-c1", "uid-c1")
 	require.NoError(t, db.InsertManagedObject(obj1))
 	past := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, db.UpdateNotificationStatus("id-c1", "created", time.Now()))
 	require.NoError(t, db.UpdateClusterState("uid-c1", models.ClusterStateDeleted, &past))
 	require.NoError(t, db.UpdateNotificationStatus("id-c1", "deleted", time.Now()))
 
@@ -236,6 +278,7 @@ func TestGetCleanupEligible(t *testing.T) {
 	obj2 := newTestObject("id-c2", "uid-c2")
 	require.NoError(t, db.InsertManagedObject(obj2))
 	recent := time.Now()
+	require.NoError(t, db.UpdateNotificationStatus("id-c2", "created", time.Now()))
 	require.NoError(t, db.UpdateClusterState("uid-c2", models.ClusterStateDeleted, &recent))
 	require.NoError(t, db.UpdateNotificationStatus("id-c2", "deleted", time.Now()))
 
@@ -246,11 +289,12 @@ func TestGetCleanupEligible(t *testing.T) {
 	// NOT eligible: notification failed
 	obj4 := newTestObject("id-c4", "uid-c4")
 	require.NoError(t, db.InsertManagedObject(obj4))
+	require.NoError(t, db.UpdateNotificationStatus("id-c4", "created", time.Now()))
 	require.NoError(t, db.UpdateClusterState("uid-c4", models.ClusterStateDeleted, &past))
 	require.NoError(t, db.UpdateNotificationStatus("id-c4", "deleted", time.Now()))
 	require.NoError(t, db.MarkNotificationFailed("id-c4", 403))
 
-	eligible, err := db.GetCleanupEligible(1 * time.Hour)
+	eligible, err := db.GetExpiredRecords(models.RetentionDelivered, time.Now().Add(-time.Hour), nil, -1)
 	require.NoError(t, err)
 
 	ids := make([]string, len(eligible))
@@ -263,6 +307,76 @@ func TestGetCleanupEligible(t *testing.T) {
 	assert.NotContains(t, ids, "id-c4")
 }
 
+func TestGetExpiredRecords(t *testing.T) {
+	db := newTestDB(t)
+	now := time.Now()
+	old := now.Add(-3 * time.Hour)
+	older := now.Add(-4 * time.Hour)
+
+	// Delivered: deleted with both events sent, the older deletion first.
+	for id, deletedAt := range map[string]time.Time{"delivered-old": old, "delivered-older": older, "delivered-new": now} {
+		require.NoError(t, db.InsertManagedObject(newTestObject(id, "uid-"+id)))
+		require.NoError(t, db.UpdateNotificationStatus(id, "created", now))
+		require.NoError(t, db.UpdateClusterState("uid-"+id, models.ClusterStateDeleted, &deletedAt))
+		require.NoError(t, db.UpdateNotificationStatus(id, "deleted", now))
+	}
+
+	// Failed: the failure counts from the last attempt.
+	require.NoError(t, db.InsertManagedObject(newTestObject("failed", "uid-failed")))
+	require.NoError(t, db.MarkNotificationFailed("failed", 403))
+
+	// Stale: existing objects of unwatched types whose created event was
+	// delivered, reconciled, or created, before the cutoff.
+	reconciledOld := newTestObject("reconciled-old", "uid-reconciled-old")
+	reconciledNew := newTestObject("reconciled-new", "uid-reconciled-new")
+	reconciledNew.CreatedAt = old
+	neverReconciled := newTestObject("never-reconciled", "uid-never-reconciled")
+	neverReconciled.CreatedAt = older
+	undelivered := newTestObject("undelivered", "uid-undelivered")
+	undelivered.CreatedAt = older
+	watched := newTestObject("watched", "uid-watched")
+	watched.ResourceType = "Pod"
+	watched.CreatedAt = older
+	for _, obj := range []*models.ManagedObject{reconciledOld, reconciledNew, neverReconciled, undelivered, watched} {
+		require.NoError(t, db.InsertManagedObject(obj))
+	}
+	for _, id := range []string{"reconciled-old", "reconciled-new", "never-reconciled", "watched"} {
+		require.NoError(t, db.UpdateNotificationStatus(id, "created", now))
+	}
+	require.NoError(t, db.UpdateLastReconciled("reconciled-old", old))
+	require.NoError(t, db.UpdateLastReconciled("reconciled-new", now))
+
+	ids := func(policy string, cutoff time.Time, limit int) []string {
+		objs, err := db.GetExpiredRecords(policy, cutoff, []string{"Pod"}, limit)
+		require.NoError(t, err)
+		count, err := db.CountExpiredRecords(policy, cutoff, []string{"Pod"})
+		require.NoError(t, err)
+		if limit < 0 {
+			assert.Equal(t, count, len(objs), "count of %s records", policy)
+		}
+		var ids []string
+		for _, obj := range objs {
+			ids = append(ids, obj.ID)
+		}
+		return ids
+	}
+	hourAgo := now.Add(-time.Hour)
+	assert.Equal(t, []string{"delivered-older", "delivered-old"}, ids(models.RetentionDelivered, hourAgo, -1))
+	assert.Equal(t, []string{"delivered-older"}, ids(models.RetentionDelivered, hourAgo, 1))
+	assert.Empty(t, ids(models.RetentionFailed, hourAgo, -1), "failed just now")
+	assert.Equal(t, []string{"failed"}, ids(models.RetentionFailed, now.Add(time.Minute), -1))
+	assert.Equal(t, []string{"never-reconciled", "reconciled-old"}, ids(models.RetentionStale, hourAgo, -1))
+
+	objs, err := db.GetExpiredRecords(models.RetentionStale, hourAgo, nil, -1)
+	require.NoError(t, err)
+	assert.Len(t, objs, 3, "records of any type expire when no type is watched")
+
+	_, err = db.GetExpiredRecords("pending", now, nil, 10)
+	assert.ErrorContains(t, err, "unknown retention policy")
+	_, err = db.CountExpiredRecords("pending", now, nil)
+	assert.ErrorContains(t, err, "unknown retention policy")
+}
+
 // --------------------------------------------------------------------------
 // Mark notification failed
 // --------------------------------------------------------------------------
@@ -278,6 +392,7 @@ func TestMarkNotificationFailed(t *testing.T) {
 	require.NoError(t, err)
 	assert.True(t, got.NotificationFailed)
 	assert.Equal(t, 502, got.NotificationFailedCode)
+	assert.NotNil(t, got.LastNotificationAttempt, "the failure is the last attempt")
 }
 
 // --------------------------------------------------------------------------
@@ -289,14 +404,268 @@ func TestIncrementNotificationAttempts(t *testing.T) {
 	obj := newTestObject("id-a1", "uid-a1")
 	require.NoError(t, db.InsertManagedObject(obj))
 
-	require.NoError(t, db.IncrementNotificationAttempts("id-a1"))
-	require.NoError(t, db.IncrementNotificationAttempts("id-a1"))
-	require.NoError(t, db.IncrementNotificationAttempts("id-a1"))
+	next := time.Now().Add(-time.Second)
+	require.NoError(t, db.IncrementNotificationAttempts("id-a1", next))
+	require.NoError(t, db.IncrementNotificationAttempts("id-a1", next))
+	require.NoError(t, db.IncrementNotificationAttempts("id-a1", next))
 
 	got, err := db.GetManagedObjectByID("id-a1")
 	require.NoError(t, err)
 	assert.Equal(t, 3, got.NotificationAttempts)
 	assert.NotNil(t, got.LastNotificationAttempt)
+	require.NotNil(t, got.NextAttemptAt)
+	assert.Equal(t, next.Unix(), got.NextAttemptAt.Unix())
+}
+
+func TestGetPendingNotificationsSkipsScheduledRetries(t *testing.T) {
+	db := newTestDB(t)
+	require.NoError(t, db.InsertManagedObject(newTestObject("id-due", "uid-due")))
+	require.NoError(t, db.InsertManagedObject(newTestObject("id-later", "uid-later")))
+
+	require.NoError(t, db.IncrementNotificationAttempts("id-due", time.Now().Add(-time.Minute)))
+	require.NoError(t, db.IncrementNotificationAttempts("id-later", time.Now().Add(time.Hour)))
+
+	pending, err := db.GetPendingNotifications(10, models.OrderingKeyUID)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, "id-due", pending[0].ID)
+}
+
+// --------------------------------------------------------------------------
+// Event ordering
+// --------------------------------------------------------------------------
+
+func TestEventSequencesAreAssignedInOrder(t *testing.T) {
+	db := newTestDB(t)
+	first := newTestObject("id-s1", "uid-s1")
+	second := newTestObject("id-s2", "uid-s2")
+	require.NoError(t, db.InsertManagedObject(first))
+	require.NoError(t, db.InsertManagedObject(second))
+
+	now := time.Now()
+	require.NoError(t, db.UpdateClusterState("uid-s1", models.ClusterStateDeleted, &now))
+	err := db.UpdateClusterState("uid-s1", models.ClusterStateDeleted, &now)
+	assert.ErrorIs(t, err, models.ErrInvalidTransition, "an object is deleted only once")
+
+	got1, err := db.GetManagedObjectByID("id-s1")
+	require.NoError(t, err)
+	got2, err := db.GetManagedObjectByID("id-s2")
+	require.NoError(t, err)
+
+	assert.Equal(t, first.CreatedSequence, got1.CreatedSequence)
+	assert.Greater(t, got2.CreatedSequence, got1.CreatedSequence)
+	assert.Greater(t, got1.DeletedSequence, got2.CreatedSequence, "the deletion happened after the second creation")
+	assert.Equal(t, got1.DeletedSequence, got2.CreatedSequence+1, "a repeated deletion does not consume a sequence number")
+	assert.Zero(t, got2.DeletedSequence)
+}
+
+func TestInsertDeletedObjectAssignsBothSequences(t *testing.T) {
+	db := newTestDB(t)
+	obj := newTestObject("id-sd", "uid-sd")
+	obj.ClusterState = models.ClusterStateDeleted
+	require.NoError(t, db.InsertManagedObject(obj))
+
+	assert.Positive(t, obj.CreatedSequence)
+	assert.Equal(t, obj.CreatedSequence+1, obj.DeletedSequence)
+}
+
+func TestGetPendingNotificationsOrdersByName(t *testing.T) {
+	db := newTestDB(t)
+	old := newTestObject("id-old", "uid-old")
+	old.CreatedAt = time.Now().Add(-time.Hour).Truncate(time.Second)
+	old.NotifiedCreated = true
+	require.NoError(t, db.InsertManagedObject(old))
+	now := time.Now()
+	require.NoError(t, db.UpdateClusterState("uid-old", models.ClusterStateDeleted, &now))
+
+	// The resource was recreated with the same name and a new UID.
+	recreated := newTestObject("id-new", "uid-new")
+	require.NoError(t, db.InsertManagedObject(recreated))
+
+	other := newTestObject("id-other", "uid-other")
+	other.ResourceName = "other-app"
+	require.NoError(t, db.InsertManagedObject(other))
+
+	// The old object's deletion is being retried.
+	require.NoError(t, db.IncrementNotificationAttempts("id-old", time.Now().Add(time.Hour)))
+
+	pending, err := db.GetPendingNotifications(10, models.OrderingKeyName)
+	require.NoError(t, err)
+	require.Len(t, pending, 1, "the recreated object waits for the old object's deletion")
+	assert.Equal(t, "id-other", pending[0].ID)
+
+	pending, err = db.GetPendingNotifications(10, models.OrderingKeyUID)
+	require.NoError(t, err)
+	assert.Len(t, pending, 2, "UIDs differ, so the recreated object is not held back")
+
+	require.NoError(t, db.UpdateNotificationStatus("id-old", "deleted", time.Now()))
+	pending, err = db.GetPendingNotifications(10, models.OrderingKeyName)
+	require.NoError(t, err)
+	assert.Len(t, pending, 2)
+}
+
+func TestGetPendingNotificationsIgnoresFailedEarlierEvents(t *testing.T) {
+	db := newTestDB(t)
+	old := newTestObject("id-old", "uid-old")
+	old.CreatedAt = time.Now().Add(-time.Hour).Truncate(time.Second)
+	require.NoError(t, db.InsertManagedObject(old))
+	require.NoError(t, db.InsertManagedObject(newTestObject("id-new", "uid-new")))
+	require.NoError(t, db.MarkNotificationFailed("id-old", 400))
+
+	pending, err := db.GetPendingNotifications(10, models.OrderingKeyName)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, "id-new", pending[0].ID)
+}
+
+func TestMarkCoalesced(t *testing.T) {
+	db := newTestDB(t)
+	require.NoError(t, db.InsertManagedObject(newTestObject("id-c1", "uid-c1")))
+	now := time.Now()
+	require.NoError(t, db.UpdateClusterState("uid-c1", models.ClusterStateDeleted, &now))
+
+	require.NoError(t, db.MarkCoalesced("id-c1", models.CoalescedEphemeral, now))
+
+	got, err := db.GetManagedObjectByID("id-c1")
+	require.NoError(t, err)
+	assert.True(t, got.NotifiedCreated)
+	assert.True(t, got.NotifiedDeleted)
+	assert.Equal(t, models.CoalescedEphemeral, got.Coalesced)
+
+	pending, err := db.GetPendingNotifications(10, models.OrderingKeyUID)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestSaveAndGetEndpointDeliveries(t *testing.T) {
+	db := newTestDB(t)
+	require.NoError(t, db.InsertManagedObject(newTestObject("id-r1", "uid-r1")))
+
+	next := time.Now().Add(time.Minute).Truncate(time.Second)
+	d := &models.EndpointDelivery{
+		ObjectID:      "id-r1",
+		Endpoint:      "billing",
+		EventType:     "created",
+		Status:        models.NotificationPending,
+		Attempts:      1,
+		NextAttemptAt: &next,
+	}
+	require.NoError(t, db.SaveEndpointDelivery(d))
+
+	sentAt := time.Now().Truncate(time.Second)
+	d.Status, d.Attempts, d.NextAttemptAt, d.SentAt = models.NotificationSent, 2, nil, &sentAt
+	require.NoError(t, db.SaveEndpointDelivery(d))
+	require.NoError(t, db.SaveEndpointDelivery(&models.EndpointDelivery{
+		ObjectID: "id-r1", Endpoint: "inventory", EventType: "created", Status: models.NotificationFailed, FailedCode: 400,
+	}))
+
+	got, err := db.GetEndpointDeliveries("id-r1")
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	byEndpoint := map[string]*models.EndpointDelivery{got[0].Endpoint: got[0], got[1].Endpoint: got[1]}
+	assert.Equal(t, models.NotificationSent, byEndpoint["billing"].Status)
+	assert.Equal(t, 2, byEndpoint["billing"].Attempts)
+	assert.Nil(t, byEndpoint["billing"].NextAttemptAt)
+	require.NotNil(t, byEndpoint["billing"].SentAt)
+	assert.True(t, sentAt.Equal(*byEndpoint["billing"].SentAt))
+	assert.Equal(t, 400, byEndpoint["inventory"].FailedCode)
+
+	require.NoError(t, db.DeleteRecord("id-r1"))
+	got, err = db.GetEndpointDeliveries("id-r1")
+	require.NoError(t, err)
+	assert.Empty(t, got, "deliveries are deleted with their object")
+}
+
+func TestMarkAndClaimAwaitingAck(t *testing.T) {
+	db := newTestDB(t)
+	require.NoError(t, db.InsertManagedObject(newTestObject("id-k1", "uid-k1")))
+
+	require.NoError(t, db.MarkAwaitingAck("id-k1", "created", time.Now().Add(time.Hour)))
+	got, err := db.GetManagedObjectByID("id-k1")
+	require.NoError(t, err)
+	assert.Equal(t, "created", got.AwaitingAck)
+	require.NotNil(t, got.LastNotificationAttempt)
+	pending, err := db.GetPendingNotifications(10, models.OrderingKeyUID)
+	require.NoError(t, err)
+	assert.Empty(t, pending, "an event awaiting acknowledgement is not pending before its deadline")
+
+	claimed, err := db.ClaimAwaitingAck("id-k1", "deleted")
+	require.NoError(t, err)
+	assert.False(t, claimed)
+	claimed, err = db.ClaimAwaitingAck("id-k1", "created")
+	require.NoError(t, err)
+	assert.True(t, claimed)
+	claimed, err = db.ClaimAwaitingAck("id-k1", "created")
+	require.NoError(t, err)
+	assert.False(t, claimed, "a wait is claimed only once")
+
+	require.NoError(t, db.MarkAwaitingAck("id-k1", "created", time.Now().Add(time.Hour)))
+	require.NoError(t, db.UpdateNotificationStatus("id-k1", "created", time.Now()))
+	got, err = db.GetManagedObjectByID("id-k1")
+	require.NoError(t, err)
+	assert.Empty(t, got.AwaitingAck, "recording the outcome ends the wait")
+}
+
+func TestRecordAndGetDeliveryAttempts(t *testing.T) {
+	db := newTestDB(t)
+	require.NoError(t, db.InsertManagedObject(newTestObject("id-a1", "uid-a1")))
+
+	for i, code := range []int{503, 502, 422} {
+		require.NoError(t, db.RecordDeliveryAttempt(&models.DeliveryAttempt{
+			ObjectID:        "id-a1",
+			EventType:       "created",
+			AttemptedAt:     time.Now().Add(time.Duration(i) * time.Second),
+			StatusCode:      code,
+			Latency:         250 * time.Millisecond,
+			Error:           "destination returned status",
+			ResponseBody:    `{"error":"invalid resource"}`,
+			ResponseHeaders: map[string]string{"Content-Type": "application/json"},
+		}, 2))
+	}
+	require.NoError(t, db.RecordDeliveryAttempt(&models.DeliveryAttempt{
+		ObjectID: "id-a1", Endpoint: "billing", EventType: "created", AttemptedAt: time.Now(), Error: "timeout",
+	}, 2))
+
+	got, err := db.GetDeliveryAttempts("id-a1")
+	require.NoError(t, err)
+	require.Len(t, got, 3, "only the two most recent attempts per event and endpoint are kept")
+	assert.Equal(t, 502, got[0].StatusCode)
+	assert.Equal(t, 422, got[1].StatusCode)
+	assert.Equal(t, 250*time.Millisecond, got[1].Latency)
+	assert.Equal(t, `{"error":"invalid resource"}`, got[1].ResponseBody)
+	assert.Equal(t, map[string]string{"Content-Type": "application/json"}, got[1].ResponseHeaders)
+	assert.Equal(t, "billing", got[2].Endpoint)
+	assert.Nil(t, got[2].ResponseHeaders)
+
+	require.NoError(t, db.DeleteRecord("id-a1"))
+	got, err = db.GetDeliveryAttempts("id-a1")
+	require.NoError(t, err)
+	assert.Empty(t, got, "attempts are deleted with their object")
+}
+
+func TestUpdateClusterStateMakesRoutedObjectDue(t *testing.T) {
+	db := newTestDB(t)
+	routed := newTestObject("id-r2", "uid-r2")
+	later := time.Now().Add(time.Hour)
+	routed.NextAttemptAt = &later
+	require.NoError(t, db.InsertManagedObject(routed))
+	require.NoError(t, db.SaveEndpointDelivery(&models.EndpointDelivery{
+		ObjectID: "id-r2", Endpoint: "billing", EventType: "created", Status: models.NotificationPending, NextAttemptAt: &later,
+	}))
+	held := newTestObject("id-r3", "uid-r3")
+	held.NextAttemptAt = &later
+	require.NoError(t, db.InsertManagedObject(held))
+
+	now := time.Now()
+	require.NoError(t, db.UpdateClusterState("uid-r2", models.ClusterStateDeleted, &now))
+	require.NoError(t, db.UpdateClusterState("uid-r3", models.ClusterStateDeleted, &now))
+
+	got, err := db.GetManagedObjectByID("id-r2")
+	require.NoError(t, err)
+	assert.Nil(t, got.NextAttemptAt)
+	got, err = db.GetManagedObjectByID("id-r3")
+	require.NoError(t, err)
+	assert.NotNil(t, got.NextAttemptAt, "objects without endpoint deliveries keep their schedule")
 }
 
 // --------------------------------------------------------------------------
@@ -467,3 +836,421 @@ func TestRunIncrementalVacuum(t *testing.T) {
 	db := newTestDB(t)
 	assert.NoError(t, db.RunIncrementalVacuum())
 }
+
+// --------------------------------------------------------------------------
+// Storage pressure
+// --------------------------------------------------------------------------
+
+func TestCompactDeliveredRecords(t *testing.T) {
+	db := newTestDB(t)
+	now := time.Now()
+	for _, id := range []string{"pending", "delivered", "deleting", "deleted"} {
+		obj := newTestObject("id-"+id, "uid-"+id)
+		obj.FullMetadata = `{"name":"my-app"}`
+		require.NoError(t, db.InsertManagedObject(obj))
+		require.NoError(t, db.RecordDeliveryAttempt(&models.DeliveryAttempt{
+			ObjectID: obj.ID, EventType: "created", AttemptedAt: now, StatusCode: 503,
+			Error: "destination returned status", ResponseBody: "unavailable",
+			ResponseHeaders: map[string]string{"Retry-After": "5"},
+		}, 5))
+		if id != "pending" {
+			require.NoError(t, db.UpdateNotificationStatus(obj.ID, "created", now))
+		}
+		if id == "deleting" || id == "deleted" {
+			require.NoError(t, db.UpdateClusterState(obj.ResourceUID, models.ClusterStateDeleted, &now))
+		}
+	}
+	require.NoError(t, db.UpdateNotificationStatus("id-deleted", "deleted", now))
+
+	n, err := db.CompactDeliveredRecords()
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), n, "the metadata and attempt of the two delivered objects")
+
+	for id, compacted := range map[string]bool{"pending": false, "delivered": true, "deleting": false, "deleted": true} {
+		obj, err := db.GetManagedObjectByID("id-" + id)
+		require.NoError(t, err)
+		attempts, err := db.GetDeliveryAttempts("id-" + id)
+		require.NoError(t, err)
+		require.Len(t, attempts, 1)
+		assert.Equal(t, 503, attempts[0].StatusCode, "the attempt itself is kept")
+		if compacted {
+			assert.Empty(t, obj.FullMetadata, id)
+			assert.Empty(t, attempts[0].ResponseBody, id)
+			assert.Empty(t, attempts[0].ResponseHeaders, id)
+		} else {
+			assert.NotEmpty(t, obj.FullMetadata, id)
+			assert.Equal(t, "unavailable", attempts[0].ResponseBody, id)
+		}
+	}
+
+	n, err = db.CompactDeliveredRecords()
+	require.NoError(t, err)
+	assert.Zero(t, n, "compacted rows are not updated again")
+}
+
+func TestCompactDeliveredRecordsInBatches(t *testing.T) {
+	db := newTestDB(t)
+	for i := 0; i < compactBatchSize+1; i++ {
+		obj := newTestObject(fmt.Sprintf("id-%d", i), fmt.Sprintf("uid-%d", i))
+		obj.FullMetadata = `{"name":"my-app"}`
+		require.NoError(t, db.InsertManagedObject(obj))
+		require.NoError(t, db.UpdateNotificationStatus(obj.ID, "created", time.Now()))
+	}
+
+	n, err := db.CompactDeliveredRecords()
+	require.NoError(t, err)
+	assert.Equal(t, int64(compactBatchSize+1), n)
+}
+
+func TestCheckpointWAL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.db")
+	db, err := NewSQLiteDB(path, zap.NewNop())
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	require.NoError(t, db.InsertManagedObject(newTestObject("id-w1", "uid-w1")))
+
+	require.NoError(t, db.CheckpointWAL())
+
+	info, err := os.Stat(path + "-wal")
+	require.NoError(t, err)
+	assert.Zero(t, info.Size(), "the log is truncated")
+}
+
+func TestCountPendingNotifications(t *testing.T) {
+	db := newTestDB(t)
+	require.NoError(t, db.InsertManagedObject(newTestObject("id-c1", "uid-c1")))
+	require.NoError(t, db.InsertManagedObject(newTestObject("id-c2", "uid-c2")))
+	require.NoError(t, db.InsertManagedObject(newTestObject("id-c3", "uid-c3")))
+	require.NoError(t, db.IncrementNotificationAttempts("id-c2", time.Now().Add(time.Hour)))
+
+	// A deleted object whose creation was delivered counts for its deletion.
+	deletedAt := time.Now()
+	require.NoError(t, db.UpdateNotificationStatus("id-c3", "created", deletedAt))
+	require.NoError(t, db.UpdateClusterState("uid-c3", models.ClusterStateDeleted, &deletedAt))
+
+	counts, err := db.CountPendingNotifications()
+	require.NoError(t, err)
+	require.Len(t, counts, 2)
+	assert.Equal(t, &models.PendingCount{ResourceType: "Deployment", EventType: "created", Pending: 2, Due: 1}, counts[0])
+	assert.Equal(t, &models.PendingCount{ResourceType: "Deployment", EventType: "deleted", Pending: 1, Due: 1}, counts[1])
+}
+
+// --------------------------------------------------------------------------
+// Transactions
+// --------------------------------------------------------------------------
+
+func TestWithTxCommits(t *testing.T) {
+	db := newTestDB(t)
+	err := db.WithTx(func(tx Database) error {
+		if err := tx.InsertManagedObject(newTestObject("id-t1", "uid-t1")); err != nil {
+			return err
+		}
+		return tx.UpdateNotificationStatus("id-t1", "created", time.Now())
+	})
+	require.NoError(t, err)
+
+	got, err := db.GetManagedObjectByID("id-t1")
+	require.NoError(t, err)
+	assert.True(t, got.NotifiedCreated)
+}
+
+func TestWithTxRollsBackOnError(t *testing.T) {
+	db := newTestDB(t)
+	require.NoError(t, db.InsertManagedObject(newTestObject("id-t1", "uid-t1")))
+
+	boom := errors.New("boom")
+	err := db.WithTx(func(tx Database) error {
+		now := time.Now()
+		require.NoError(t, tx.UpdateClusterState("uid-t1", models.ClusterStateDeleted, &now))
+		require.NoError(t, tx.InsertManagedObject(newTestObject("id-t2", "uid-t2")))
+		return boom
+	})
+	assert.ErrorIs(t, err, boom)
+
+	got, err := db.GetManagedObjectByID("id-t1")
+	require.NoError(t, err)
+	assert.Equal(t, models.ClusterStateExists, got.ClusterState)
+	assert.Zero(t, got.DeletedSequence)
+	_, err = db.GetManagedObjectByID("id-t2")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	// The sequence numbers taken by the rolled back changes are reused.
+	require.NoError(t, db.InsertManagedObject(newTestObject("id-t3", "uid-t3")))
+	got3, err := db.GetManagedObjectByID("id-t3")
+	require.NoError(t, err)
+	assert.Equal(t, got.CreatedSequence+1, got3.CreatedSequence)
+}
+
+func TestWithTxNestsInSavepoints(t *testing.T) {
+	db := newTestDB(t)
+	err := db.WithTx(func(tx Database) error {
+		require.NoError(t, tx.InsertManagedObject(newTestObject("id-t1", "uid-t1")))
+		inner := tx.WithTx(func(tx Database) error {
+			require.NoError(t, tx.UpdateNotificationStatus("id-t1", "created", time.Now()))
+			return errors.New("boom")
+		})
+		assert.Error(t, inner)
+
+		// A failed guarded update inside the transaction leaves it usable.
+		err := tx.UpdateNotificationStatus("id-t1", "deleted", time.Now())
+		assert.ErrorIs(t, err, models.ErrInvalidTransition)
+		return tx.IncrementNotificationAttempts("id-t1", time.Now())
+	})
+	require.NoError(t, err)
+
+	got, err := db.GetManagedObjectByID("id-t1")
+	require.NoError(t, err)
+	assert.False(t, got.NotifiedCreated, "the inner transaction was rolled back")
+	assert.Equal(t, 1, got.NotificationAttempts)
+}
+
+func TestCloseWithinTxFails(t *testing.T) {
+	db := newTestDB(t)
+	err := db.WithTx(func(tx Database) error {
+		assert.NoError(t, tx.Ping())
+		return tx.Close()
+	})
+	assert.Error(t, err)
+	assert.NoError(t, db.Ping())
+}
+
+func TestUpdateClusterStateRejectsInvalidTransitions(t *testing.T) {
+	db := newTestDB(t)
+	require.NoError(t, db.InsertManagedObject(newTestObject("id-t1", "uid-t1")))
+
+	err := db.UpdateClusterState("uid-t1", models.ClusterStateExists, nil)
+	assert.ErrorIs(t, err, models.ErrInvalidTransition, "a cluster state only moves to deleted")
+
+	now := time.Now()
+	err = db.UpdateClusterState("uid-missing", models.ClusterStateDeleted, &now)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	require.NoError(t, db.UpdateClusterState("uid-t1", models.ClusterStateDeleted, &now))
+	later := now.Add(time.Hour)
+	err = db.UpdateClusterState("uid-t1", models.ClusterStateDeleted, &later)
+	assert.ErrorIs(t, err, models.ErrInvalidTransition)
+
+	got, err := db.GetManagedObjectByID("id-t1")
+	require.NoError(t, err)
+	require.NotNil(t, got.DeletedAt)
+	assert.Equal(t, now.Unix(), got.DeletedAt.Unix(), "the first deletion is kept")
+}
+
+func TestGuardedUpdatesOfMissingObject(t *testing.T) {
+	db := newTestDB(t)
+	assert.ErrorIs(t, db.UpdateNotificationStatus("id-missing", "created", time.Now()), sql.ErrNoRows)
+	assert.ErrorIs(t, db.MarkNotificationFailed("id-missing", 500), sql.ErrNoRows)
+	assert.ErrorIs(t, db.IncrementNotificationAttempts("id-missing", time.Now()), sql.ErrNoRows)
+}
+
+// transitionReinsert records a resource whose record is deleted again, as the
+// watcher does when the annotation of the resource is added back.
+const transitionReinsert = "reinsert"
+
+// stateStep is one step of a random sequence of state transitions.
+type stateStep struct {
+	object     int    // the resource, whose records share its UID
+	record     int    // which of its records a notification transition applies to
+	transition string // a models.Transition*, "claim" for ClaimAwaitingAck, or transitionReinsert
+	eventType  string
+}
+
+// randomStep returns a random transition of one of n resources.
+func randomStep(rng *rand.Rand, n int) stateStep {
+	transitions := []string{
+		models.TransitionDelete, models.TransitionSend, models.TransitionAwaitAck,
+		models.TransitionRetry, models.TransitionFail, models.TransitionCoalesce, "claim",
+		transitionReinsert,
+	}
+	eventTypes := []string{"created", "deleted", models.EventEphemeral}
+	return stateStep{
+		object:     rng.Intn(n),
+		record:     rng.Intn(3),
+		transition: transitions[rng.Intn(len(transitions))],
+		eventType:  eventTypes[rng.Intn(len(eventTypes))],
+	}
+}
+
+// apply makes step through db, with the models.ManagedObject obj as the
+// model of the stored object.
+func (step stateStep) apply(db Database, obj *models.ManagedObject) error {
+	now := time.Now()
+	switch step.transition {
+	case models.TransitionDelete:
+		return db.UpdateClusterState(obj.ResourceUID, models.ClusterStateDeleted, &now)
+	case models.TransitionSend:
+		return db.UpdateNotificationStatus(obj.ID, step.eventType, now)
+	case models.TransitionAwaitAck:
+		return db.MarkAwaitingAck(obj.ID, step.eventType, now)
+	case models.TransitionRetry:
+		return db.IncrementNotificationAttempts(obj.ID, now)
+	case models.TransitionFail:
+		return db.MarkNotificationFailed(obj.ID, 500)
+	case models.TransitionCoalesce:
+		return db.MarkCoalesced(obj.ID, models.CoalescedSuppressed, now)
+	default:
+		_, err := db.ClaimAwaitingAck(obj.ID, step.eventType)
+		return err
+	}
+}
+
+// model applies step to obj, the model of a stored object, as the database
+// should, and reports whether it is allowed.
+func (step stateStep) model(obj *models.ManagedObject) bool {
+	if step.transition == "claim" {
+		if obj.AwaitingAck == step.eventType {
+			obj.AwaitingAck = ""
+		}
+		return true
+	}
+	if step.transition == models.TransitionSend && step.eventType == models.EventEphemeral {
+		// Ephemeral events are recorded by coalescing rather than sent.
+		return false
+	}
+	if obj.CheckTransition(step.transition, step.eventType) != nil {
+		return false
+	}
+	switch step.transition {
+	case models.TransitionDelete:
+		obj.ClusterState = models.ClusterStateDeleted
+	case models.TransitionSend:
+		if step.eventType == "created" {
+			obj.NotifiedCreated = true
+		} else {
+			obj.NotifiedDeleted = true
+		}
+		obj.AwaitingAck = ""
+	case models.TransitionAwaitAck:
+		obj.AwaitingAck = step.eventType
+	case models.TransitionRetry:
+		obj.NotificationAttempts++
+		obj.AwaitingAck = ""
+	case models.TransitionFail:
+		obj.NotificationFailed = true
+		obj.AwaitingAck = ""
+	case models.TransitionCoalesce:
+		obj.NotifiedCreated, obj.NotifiedDeleted = true, true
+		obj.AwaitingAck = ""
+	}
+	return true
+}
+
+// stateOf returns the fields of obj that the state machine governs.
+func stateOf(obj *models.ManagedObject) models.ManagedObject {
+	return models.ManagedObject{
+		ID:                   obj.ID,
+		ClusterState:         obj.ClusterState,
+		NotifiedCreated:      obj.NotifiedCreated,
+		NotifiedDeleted:      obj.NotifiedDeleted,
+		NotificationFailed:   obj.NotificationFailed,
+		NotificationAttempts: obj.NotificationAttempts,
+		AwaitingAck:          obj.AwaitingAck,
+	}
+}
+
+// TestRandomTransitionsFollowTheStateMachine applies random sequences of
+// transitions, some of them in transactions that are rolled back, to the
+// database and to a model of its objects. A resource gets a new record each
+// time it is recorded again, and its deletion applies to the newest. The
+// database must allow exactly the transitions that the model allows and end
+// in the model's state.
+func TestRandomTransitionsFollowTheStateMachine(t *testing.T) {
+	const (
+		sequences = 200
+		steps     = 40
+		objects   = 3
+	)
+	for seed := int64(1); seed <= sequences; seed++ {
+		rng := rand.New(rand.NewSource(seed))
+		db := newTestDB(t)
+
+		// model holds the records of each resource, oldest first.
+		model := make([][]*models.ManagedObject, objects)
+		for i := range model {
+			obj := newTestObject(fmt.Sprintf("id-%d-0", i), fmt.Sprintf("uid-%d", i))
+			require.NoError(t, db.InsertManagedObject(obj))
+			model[i] = []*models.ManagedObject{obj}
+		}
+
+		var history []stateStep
+		check := func(tx Database, step stateStep, model [][]*models.ManagedObject) {
+			history = append(history, step)
+			records := model[step.object]
+			newest := records[len(records)-1]
+			if step.transition == transitionReinsert {
+				// Only a resource whose record is deleted is recorded again.
+				if newest.ClusterState == models.ClusterStateDeleted {
+					obj := newTestObject(fmt.Sprintf("id-%d-%d", step.object, len(records)), newest.ResourceUID)
+					require.NoError(t, tx.InsertManagedObject(obj), "seed %d: %+v", seed, history)
+					model[step.object] = append(records, obj)
+				}
+				return
+			}
+			obj := records[step.record%len(records)]
+			if step.transition == models.TransitionDelete {
+				obj = newest
+			}
+			allowed := step.model(obj)
+			err := step.apply(tx, obj)
+			if allowed {
+				require.NoError(t, err, "seed %d: %+v", seed, history)
+			} else {
+				require.Error(t, err, "seed %d: %+v", seed, history)
+				if step.transition != models.TransitionSend || step.eventType != models.EventEphemeral {
+					require.ErrorIs(t, err, models.ErrInvalidTransition, "seed %d: %+v", seed, history)
+				}
+			}
+		}
+
+		for i := 0; i < steps; i++ {
+			if rng.Intn(5) > 0 {
+				check(db, randomStep(rng, objects), model)
+				continue
+			}
+
+			// Apply a few steps in a transaction to a copy of the model,
+			// keeping the copy only if the transaction commits.
+			scratch := make([][]*models.ManagedObject, objects)
+			for j, records := range model {
+				for _, obj := range records {
+					c := *obj
+					scratch[j] = append(scratch[j], &c)
+				}
+			}
+			commit := rng.Intn(2) == 0
+			err := db.WithTx(func(tx Database) error {
+				for j := rng.Intn(4); j >= 0; j-- {
+					check(tx, randomStep(rng, objects), scratch)
+				}
+				if !commit {
+					return errors.New("rolled back")
+				}
+				return nil
+			})
+			if commit {
+				require.NoError(t, err)
+				model = scratch
+			} else {
+				require.Error(t, err)
+			}
+		}
+
+		for _, records := range model {
+			for _, want := range records {
+				got, err := db.GetManagedObjectByID(want.ID)
+				require.NoError(t, err)
+				require.Equal(t, stateOf(want), stateOf(got), "seed %d: %+v", seed, history)
+				if got.NotifiedDeleted {
+					assert.True(t, got.NotifiedCreated, "seed %d: the deleted event is sent after the created event", seed)
+					assert.Equal(t, models.ClusterStateDeleted, got.ClusterState, "seed %d", seed)
+					assert.NotZero(t, got.DeletedSequence, "seed %d", seed)
+				}
+			}
+
+			newest := records[len(records)-1]
+			got, err := db.GetManagedObjectByUID(newest.ResourceUID)
+			require.NoError(t, err)
+			assert.Equal(t, newest.ID, got.ID, "seed %d: the UID resolves to its newest record", seed)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+-- The schema after the fields column was added.
+
+CREATE TABLE IF NOT EXISTS managed_objects (
+    id                           TEXT PRIMARY KEY,
+    resource_uid                 TEXT NOT NULL,
+    resource_type                TEXT NOT NULL,
+    resource_name                TEXT NOT NULL,
+    resource_namespace           TEXT NOT NULL DEFAULT '',
+    annotation_value             TEXT NOT NULL DEFAULT '',
+    cluster_state                TEXT NOT NULL DEFAULT 'exists',
+    detection_source             TEXT NOT NULL DEFAULT '',
+    created_at                   TEXT NOT NULL,
+    deleted_at                   TEXT,
+    last_reconciled              TEXT,
+    notified_created             INTEGER NOT NULL DEFAULT 0,
+    notified_deleted             INTEGER NOT NULL DEFAULT 0,
+    notification_failed          INTEGER NOT NULL DEFAULT 0,
+    notification_failed_code     INTEGER NOT NULL DEFAULT 0,
+    created_notification_sent_at TEXT,
+    deleted_notification_sent_at TEXT,
+    notification_attempts        INTEGER NOT NULL DEFAULT 0,
+    last_notification_attempt    TEXT,
+    labels                       TEXT NOT NULL DEFAULT '',
+    annotations                  TEXT NOT NULL DEFAULT '',
+    resource_version             TEXT NOT NULL DEFAULT '',
+    full_metadata                TEXT NOT NULL DEFAULT '',
+    fields                       TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_resource_uid ON managed_objects (resource_uid);
+CREATE INDEX IF NOT EXISTS idx_resource_type ON managed_objects (resource_type);
+CREATE INDEX IF NOT EXISTS idx_resource_namespace ON managed_objects (resource_namespace);
+CREATE INDEX IF NOT EXISTS idx_notification ON managed_objects (cluster_state, notified_created, notified_deleted);
+CREATE INDEX IF NOT EXISTS idx_reconciliation ON managed_objects (resource_type, last_reconciled);
+CREATE INDEX IF NOT EXISTS idx_cleanup ON managed_objects (deleted_at, notified_deleted, cluster_state);
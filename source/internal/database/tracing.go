@@ -0,0 +1,260 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/bryonbaker/beacon/internal/models"
+	"github.com/bryonbaker/beacon/internal/tracing"
+)
+
+// TracedDB wraps a Database and records each call as an OpenTelemetry span.
+// The Database interface carries no context, so spans are parented on the
+// context bound with WithContext; calls without a span in their context are
+// not traced, so periodic housekeeping does not start a trace per query.
+type TracedDB struct {
+	db     Database
+	tracer trace.Tracer
+	ctx    context.Context
+}
+
+// Ensure TracedDB satisfies the Database interface at compile time.
+var _ Database = (*TracedDB)(nil)
+
+// NewTracedDB creates a TracedDB that delegates to db.
+func NewTracedDB(db Database) *TracedDB {
+	return &TracedDB{
+		db:     db,
+		tracer: tracing.Tracer("database"),
+		ctx:    context.Background(),
+	}
+}
+
+// WithContext returns a copy of t whose calls are children of the span in
+// ctx.
+func (t *TracedDB) WithContext(ctx context.Context) Database {
+	c := *t
+	c.ctx = ctx
+	return &c
+}
+
+// WithContext returns db bound to ctx when db records spans, so that its
+// calls are children of the span in ctx, and db itself otherwise.
+func WithContext(ctx context.Context, db Database) Database {
+	if t, ok := db.(interface {
+		WithContext(context.Context) Database
+	}); ok {
+		return t.WithContext(ctx)
+	}
+	return db
+}
+
+// start begins the span for operation, or returns a no-op span when the bound
+// context has no span.
+func (t *TracedDB) start(operation string) trace.Span {
+	if !trace.SpanContextFromContext(t.ctx).IsValid() {
+		return trace.SpanFromContext(context.Background())
+	}
+	_, span := t.tracer.Start(t.ctx, "database."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "sqlite"),
+			attribute.String("db.operation.name", operation),
+		),
+	)
+	return span
+}
+
+// end ends span, recording err unless it only reports a missing row.
+func end(span trace.Span, err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		tracing.End(span, nil)
+	} else {
+		tracing.End(span, err)
+	}
+	return err
+}
+
+// The Database methods below delegate to the wrapped Database, each within
+// its own span.
+
+func (t *TracedDB) Close() error {
+	return t.db.Close()
+}
+
+func (t *TracedDB) Ping() error {
+	span := t.start("Ping")
+	return end(span, t.db.Ping())
+}
+
+// WithTx records the transaction as a span with the calls within it as its
+// children.
+func (t *TracedDB) WithTx(fn func(tx Database) error) error {
+	span := t.start("WithTx")
+	return end(span, t.db.WithTx(func(tx Database) error {
+		c := *t
+		c.db = tx
+		c.ctx = trace.ContextWithSpan(t.ctx, span)
+		return fn(&c)
+	}))
+}
+
+func (t *TracedDB) InsertManagedObject(obj *models.ManagedObject) error {
+	span := t.start("InsertManagedObject")
+	return end(span, t.db.InsertManagedObject(obj))
+}
+
+func (t *TracedDB) GetManagedObjectByUID(uid string) (*models.ManagedObject, error) {
+	span := t.start("GetManagedObjectByUID")
+	obj, err := t.db.GetManagedObjectByUID(uid)
+	return obj, end(span, err)
+}
+
+func (t *TracedDB) GetManagedObjectByID(id string) (*models.ManagedObject, error) {
+	span := t.start("GetManagedObjectByID")
+	obj, err := t.db.GetManagedObjectByID(id)
+	return obj, end(span, err)
+}
+
+func (t *TracedDB) UpdateClusterState(uid string, state string, deletedAt *time.Time) error {
+	span := t.start("UpdateClusterState")
+	return end(span, t.db.UpdateClusterState(uid, state, deletedAt))
+}
+
+func (t *TracedDB) SetDeletedTraceParent(uid string, traceParent string) error {
+	span := t.start("SetDeletedTraceParent")
+	return end(span, t.db.SetDeletedTraceParent(uid, traceParent))
+}
+
+func (t *TracedDB) UpdateNotificationStatus(id string, eventType string, sentAt time.Time) error {
+	span := t.start("UpdateNotificationStatus")
+	return end(span, t.db.UpdateNotificationStatus(id, eventType, sentAt))
+}
+
+func (t *TracedDB) MarkCoalesced(id string, decision string, sentAt time.Time) error {
+	span := t.start("MarkCoalesced")
+	return end(span, t.db.MarkCoalesced(id, decision, sentAt))
+}
+
+func (t *TracedDB) MarkNotificationFailed(id string, statusCode int) error {
+	span := t.start("MarkNotificationFailed")
+	return end(span, t.db.MarkNotificationFailed(id, statusCode))
+}
+
+func (t *TracedDB) IncrementNotificationAttempts(id string, nextAttemptAt time.Time) error {
+	span := t.start("IncrementNotificationAttempts")
+	return end(span, t.db.IncrementNotificationAttempts(id, nextAttemptAt))
+}
+
+func (t *TracedDB) MarkAwaitingAck(id string, eventType string, deadline time.Time) error {
+	span := t.start("MarkAwaitingAck")
+	return end(span, t.db.MarkAwaitingAck(id, eventType, deadline))
+}
+
+func (t *TracedDB) ClaimAwaitingAck(id string, eventType string) (bool, error) {
+	span := t.start("ClaimAwaitingAck")
+	claimed, err := t.db.ClaimAwaitingAck(id, eventType)
+	return claimed, end(span, err)
+}
+
+func (t *TracedDB) GetEndpointDeliveries(objectID string) ([]*models.EndpointDelivery, error) {
+	span := t.start("GetEndpointDeliveries")
+	deliveries, err := t.db.GetEndpointDeliveries(objectID)
+	return deliveries, end(span, err)
+}
+
+func (t *TracedDB) SaveEndpointDelivery(d *models.EndpointDelivery) error {
+	span := t.start("SaveEndpointDelivery")
+	return end(span, t.db.SaveEndpointDelivery(d))
+}
+
+func (t *TracedDB) RecordDeliveryAttempt(a *models.DeliveryAttempt, keep int) error {
+	span := t.start("RecordDeliveryAttempt")
+	return end(span, t.db.RecordDeliveryAttempt(a, keep))
+}
+
+func (t *TracedDB) GetDeliveryAttempts(objectID string) ([]*models.DeliveryAttempt, error) {
+	span := t.start("GetDeliveryAttempts")
+	attempts, err := t.db.GetDeliveryAttempts(objectID)
+	return attempts, end(span, err)
+}
+
+func (t *TracedDB) UpdateLastReconciled(id string, reconciledAt time.Time) error {
+	span := t.start("UpdateLastReconciled")
+	return end(span, t.db.UpdateLastReconciled(id, reconciledAt))
+}
+
+func (t *TracedDB) GetPendingNotifications(limit int, orderingKey string) ([]*models.ManagedObject, error) {
+	span := t.start("GetPendingNotifications")
+	objs, err := t.db.GetPendingNotifications(limit, orderingKey)
+	span.SetAttributes(attribute.Int("db.response.returned_rows", len(objs)))
+	return objs, end(span, err)
+}
+
+func (t *TracedDB) GetAllActiveObjects(resourceType string) ([]*models.ManagedObject, error) {
+	span := t.start("GetAllActiveObjects")
+	objs, err := t.db.GetAllActiveObjects(resourceType)
+	span.SetAttributes(attribute.Int("db.response.returned_rows", len(objs)))
+	return objs, end(span, err)
+}
+
+func (t *TracedDB) GetExpiredRecords(policy string, cutoff time.Time, watched []string, limit int) ([]*models.ManagedObject, error) {
+	span := t.start("GetExpiredRecords")
+	objs, err := t.db.GetExpiredRecords(policy, cutoff, watched, limit)
+	return objs, end(span, err)
+}
+
+func (t *TracedDB) CountExpiredRecords(policy string, cutoff time.Time, watched []string) (int, error) {
+	span := t.start("CountExpiredRecords")
+	count, err := t.db.CountExpiredRecords(policy, cutoff, watched)
+	return count, end(span, err)
+}
+
+func (t *TracedDB) CountByState() (int, int, error) {
+	span := t.start("CountByState")
+	exists, deleted, err := t.db.CountByState()
+	return exists, deleted, end(span, err)
+}
+
+func (t *TracedDB) CountPendingNotifications() ([]*models.PendingCount, error) {
+	span := t.start("CountPendingNotifications")
+	counts, err := t.db.CountPendingNotifications()
+	return counts, end(span, err)
+}
+
+func (t *TracedDB) DeleteRecord(id string) error {
+	span := t.start("DeleteRecord")
+	return end(span, t.db.DeleteRecord(id))
+}
+
+func (t *TracedDB) RunIncrementalVacuum() error {
+	span := t.start("RunIncrementalVacuum")
+	return end(span, t.db.RunIncrementalVacuum())
+}
+
+func (t *TracedDB) CompactDeliveredRecords() (int64, error) {
+	span := t.start("CompactDeliveredRecords")
+	n, err := t.db.CompactDeliveredRecords()
+	return n, end(span, err)
+}
+
+func (t *TracedDB) CheckpointWAL() error {
+	span := t.start("CheckpointWAL")
+	return end(span, t.db.CheckpointWAL())
+}
+
+func (t *TracedDB) GetDatabaseSizeBytes() (int64, error) {
+	span := t.start("GetDatabaseSizeBytes")
+	size, err := t.db.GetDatabaseSizeBytes()
+	return size, end(span, err)
+}
+
+func (t *TracedDB) BackupTo(path string) error {
+	span := t.start("BackupTo")
+	return end(span, t.db.BackupTo(path))
+}
@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/bryonbaker/beacon/internal/config"
+)
+
+// authenticate returns middleware that only passes on requests authenticated
+// as auth requires, answering the others with 401 Unauthorized.
+func authenticate(auth config.MetricsAuthConfig, logger *zap.Logger) func(http.Handler) http.Handler {
+	var allowed func(r *http.Request) bool
+	switch auth.Type {
+	case config.MetricsAuthBearer:
+		allowed = func(r *http.Request) bool {
+			return validBearerToken(r, auth, logger)
+		}
+	case config.MetricsAuthMTLS:
+		allowed = func(r *http.Request) bool {
+			return r.TLS != nil && len(r.TLS.VerifiedChains) > 0
+		}
+	default:
+		return func(next http.Handler) http.Handler { return next }
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !allowed(r) {
+				if auth.Type == config.MetricsAuthBearer {
+					w.Header().Set("WWW-Authenticate", `Bearer realm="beacon"`)
+				}
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// validBearerToken reports whether r carries the token in auth.TokenFile or
+// the static auth.Token. The file is read on every request so that the
+// token can be rotated without a restart.
+func validBearerToken(r *http.Request, auth config.MetricsAuthConfig, logger *zap.Logger) bool {
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || got == "" {
+		return false
+	}
+
+	tokens := []string{auth.Token}
+	if auth.TokenFile != "" {
+		data, err := os.ReadFile(auth.TokenFile)
+		if err != nil {
+			logger.Error("failed to read metrics auth token file",
+				zap.String("path", auth.TokenFile),
+				zap.Error(err),
+			)
+		} else {
+			tokens = append(tokens, strings.TrimSpace(string(data)))
+		}
+	}
+	for _, want := range tokens {
+		if want != "" && subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1 {
+			return true
+		}
+	}
+	return false
+}
@@ -5,8 +5,11 @@ package metrics
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/bryonbaker/beacon/internal/models"
 )
 
 // Metrics holds every Prometheus collector used by beacon.
@@ -61,6 +64,9 @@ type Metrics struct {
 	// NotificationNonRetriableFailures counts non-retriable notification failures.
 	NotificationNonRetriableFailures *prometheus.CounterVec
 
+	// NotificationsCoalescedTotal counts short-lived resources whose events were coalesced.
+	NotificationsCoalescedTotal *prometheus.CounterVec
+
 	// ---------------------------------------------------------------
 	// Endpoint Health
 	// ---------------------------------------------------------------
@@ -74,6 +80,18 @@ type Metrics struct {
 	// EndpointLastSuccess records the Unix timestamp of the last successful call.
 	EndpointLastSuccess prometheus.Gauge
 
+	// RoutedEndpointUp indicates whether each named endpoint is reachable (1 = up).
+	RoutedEndpointUp *prometheus.GaugeVec
+
+	// RoutedDeliveriesTotal counts delivery outcomes per named endpoint.
+	RoutedDeliveriesTotal *prometheus.CounterVec
+
+	// AckCallbacksTotal counts acknowledgement callbacks by result.
+	AckCallbacksTotal *prometheus.CounterVec
+
+	// AckTimeoutsTotal counts events whose acknowledgement did not arrive in time.
+	AckTimeoutsTotal *prometheus.CounterVec
+
 	// ---------------------------------------------------------------
 	// Reconciliation
 	// ---------------------------------------------------------------
@@ -109,6 +127,26 @@ type Metrics struct {
 	// CleanupOldestRecordAge tracks the age (in seconds) of the oldest eligible record.
 	CleanupOldestRecordAge prometheus.Gauge
 
+	// CleanupPolicyRecords counts the records each retention policy archived
+	// and deleted.
+	CleanupPolicyRecords *prometheus.CounterVec
+
+	// ---------------------------------------------------------------
+	// Backup
+	// ---------------------------------------------------------------
+
+	// BackupRunsTotal counts backup runs by status.
+	BackupRunsTotal *prometheus.CounterVec
+
+	// BackupDuration observes how long each backup run takes.
+	BackupDuration prometheus.Histogram
+
+	// BackupSizeBytes tracks the size of the latest backup.
+	BackupSizeBytes prometheus.Gauge
+
+	// BackupLastSuccess records the Unix timestamp of the latest successful backup.
+	BackupLastSuccess prometheus.Gauge
+
 	// ---------------------------------------------------------------
 	// Database
 	// ---------------------------------------------------------------
@@ -150,6 +188,10 @@ type Metrics struct {
 	// StoragePressure indicates storage pressure by severity level.
 	StoragePressure *prometheus.GaugeVec
 
+	// StoragePressureActions counts the actions taken to relieve storage
+	// pressure by action and status.
+	StoragePressureActions *prometheus.CounterVec
+
 	// ---------------------------------------------------------------
 	// Component Health
 	// ---------------------------------------------------------------
@@ -175,6 +217,10 @@ type Metrics struct {
 
 	// WorkerBatchSize observes the batch sizes processed by workers.
 	WorkerBatchSize *prometheus.HistogramVec
+
+	// health receives the component health recorded through these metrics,
+	// when set.
+	health *HealthChecks
 }
 
 // NewMetrics creates and registers all Prometheus metrics with the supplied
@@ -279,6 +325,12 @@ func NewMetrics(registerer prometheus.Registerer) *Metrics {
 	}, []string{"resource_type", "event_type", "status_code"})
 	registerer.MustRegister(m.NotificationNonRetriableFailures)
 
+	m.NotificationsCoalescedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "event_notifications_coalesced_total",
+		Help: "Short-lived resources whose created and deleted events were coalesced, by decision (suppressed or ephemeral).",
+	}, []string{"resource_type", "decision"})
+	registerer.MustRegister(m.NotificationsCoalescedTotal)
+
 	// -------------------------------------------------------------------
 	// Endpoint Health Metrics
 	// -------------------------------------------------------------------
@@ -301,6 +353,30 @@ func NewMetrics(registerer prometheus.Registerer) *Metrics {
 	})
 	registerer.MustRegister(m.EndpointLastSuccess)
 
+	m.RoutedEndpointUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "event_routed_endpoint_up",
+		Help: "Whether each named endpoint is reachable (1 = up, 0 = down).",
+	}, []string{"endpoint"})
+	registerer.MustRegister(m.RoutedEndpointUp)
+
+	m.RoutedDeliveriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "event_routed_deliveries_total",
+		Help: "Deliveries to named endpoints by outcome (sent, retry, or failed).",
+	}, []string{"endpoint", "event_type", "result"})
+	registerer.MustRegister(m.RoutedDeliveriesTotal)
+
+	m.AckCallbacksTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "event_ack_callbacks_total",
+		Help: "Acknowledgement callbacks by result (delivered, rejected, or invalid).",
+	}, []string{"result"})
+	registerer.MustRegister(m.AckCallbacksTotal)
+
+	m.AckTimeoutsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "event_ack_timeouts_total",
+		Help: "Events whose acknowledgement timed out, by the action taken (retry or fail).",
+	}, []string{"event_type", "action"})
+	registerer.MustRegister(m.AckTimeoutsTotal)
+
 	// -------------------------------------------------------------------
 	// Reconciliation Metrics
 	// -------------------------------------------------------------------
@@ -365,6 +441,41 @@ func NewMetrics(registerer prometheus.Registerer) *Metrics {
 	})
 	registerer.MustRegister(m.CleanupOldestRecordAge)
 
+	m.CleanupPolicyRecords = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "event_cleanup_policy_records_total",
+		Help: "Total records archived or deleted by retention policy and action.",
+	}, []string{"policy", "action"})
+	registerer.MustRegister(m.CleanupPolicyRecords)
+
+	// -------------------------------------------------------------------
+	// Backup Metrics
+	// -------------------------------------------------------------------
+
+	m.BackupRunsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "event_backup_runs_total",
+		Help: "Total database backup runs by status.",
+	}, []string{"status"})
+	registerer.MustRegister(m.BackupRunsTotal)
+
+	m.BackupDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "event_backup_duration_seconds",
+		Help:    "Duration of each database backup run, including the upload.",
+		Buckets: []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300},
+	})
+	registerer.MustRegister(m.BackupDuration)
+
+	m.BackupSizeBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "event_backup_size_bytes",
+		Help: "Size of the latest database backup in bytes.",
+	})
+	registerer.MustRegister(m.BackupSizeBytes)
+
+	m.BackupLastSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "event_backup_last_success_timestamp",
+		Help: "Unix timestamp of the latest successful database backup.",
+	})
+	registerer.MustRegister(m.BackupLastSuccess)
+
 	// -------------------------------------------------------------------
 	// Database Metrics
 	// -------------------------------------------------------------------
@@ -440,6 +551,12 @@ func NewMetrics(registerer prometheus.Registerer) *Metrics {
 	}, []string{"severity"})
 	registerer.MustRegister(m.StoragePressure)
 
+	m.StoragePressureActions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "event_storage_pressure_actions_total",
+		Help: "Total actions taken to relieve storage pressure by action and status.",
+	}, []string{"action", "status"})
+	registerer.MustRegister(m.StoragePressureActions)
+
 	// -------------------------------------------------------------------
 	// Component Health Metrics
 	// -------------------------------------------------------------------
@@ -490,10 +607,30 @@ func NewMetrics(registerer prometheus.Registerer) *Metrics {
 }
 
 // RecordResourceEvent increments the EventsTotal counter for the given
-// resource type and event type. The namespace and detection_source labels
-// default to "all" and "watch" respectively when not further specified.
+// resource type and event type and records the time of the event. The
+// namespace and detection_source labels default to "all" and "watch"
+// respectively when not further specified.
 func (m *Metrics) RecordResourceEvent(resourceType, eventType string) {
 	m.EventsTotal.WithLabelValues(resourceType, eventType, "all", "watch").Inc()
+	m.LastEventTimestamp.WithLabelValues(resourceType).SetToCurrentTime()
+}
+
+// RecordConnectionStatus records whether the watches of a resource type are
+// connected.
+func (m *Metrics) RecordConnectionStatus(resourceType string, connected bool) {
+	m.ConnectionStatus.WithLabelValues(resourceType).Set(boolToFloat(connected))
+}
+
+// RecordReconnect counts a failed watch of a resource type that the informer
+// will re-establish.
+func (m *Metrics) RecordReconnect(resourceType, reason string) {
+	m.ReconnectsTotal.WithLabelValues(resourceType, reason).Inc()
+}
+
+// RecordMissedEvent counts an event the watch missed and reconciliation
+// recovered, by reason (missed_creation or missed_deletion).
+func (m *Metrics) RecordMissedEvent(resourceType, reason string) {
+	m.EventsMissedTotal.WithLabelValues(resourceType, reason).Inc()
 }
 
 // RecordAnnotationMutation increments the AnnotationMutationsTotal counter
@@ -520,13 +657,184 @@ func (m *Metrics) RecordNotificationFailed(eventType string, statusCode int) {
 	m.NotificationNonRetriableFailures.WithLabelValues("", eventType, fmt.Sprintf("%d", statusCode)).Inc()
 }
 
+// RecordNotificationDuration observes how long one delivery attempt took, by
+// its outcome (success, accepted, retry, or failed).
+func (m *Metrics) RecordNotificationDuration(resourceType, eventType, status string, d time.Duration) {
+	m.NotificationDuration.WithLabelValues(resourceType, eventType, status).Observe(d.Seconds())
+}
+
+// RecordNotificationDelivered observes the latency between the detection of
+// an event and its delivery, and the number of attempts the delivery took.
+func (m *Metrics) RecordNotificationDelivered(resourceType, eventType string, latency time.Duration, attempts int) {
+	m.NotificationLatency.WithLabelValues(resourceType, eventType).Observe(latency.Seconds())
+	m.NotificationAttemptsTotal.WithLabelValues(resourceType, eventType).Observe(float64(attempts))
+}
+
+// RecordRetryBackoff observes the delay before the given retry attempt.
+func (m *Metrics) RecordRetryBackoff(attempt int, backoff time.Duration) {
+	m.NotificationRetryBackoff.WithLabelValues(fmt.Sprintf("%d", attempt)).Observe(backoff.Seconds())
+}
+
+// RecordPending replaces the pending notification gauges with counts, and
+// sets the notifier's queue size to the number of events that are due.
+func (m *Metrics) RecordPending(counts []*models.PendingCount) {
+	m.NotificationsPendingTotal.Reset()
+	due := 0
+	for _, c := range counts {
+		m.NotificationsPendingTotal.WithLabelValues(c.ResourceType, c.EventType).Set(float64(c.Pending))
+		due += c.Due
+	}
+	m.WorkerQueueSize.WithLabelValues("notifier").Set(float64(due))
+}
+
+// RecordWorkerCycle observes the number of items a worker processed in one
+// cycle and how long the cycle took.
+func (m *Metrics) RecordWorkerCycle(worker string, items int, d time.Duration) {
+	m.WorkerBatchSize.WithLabelValues(worker).Observe(float64(items))
+	m.WorkerProcessingDuration.WithLabelValues(worker).Observe(d.Seconds())
+}
+
+// RecordDBOperation observes the duration of a database operation and counts
+// it as an error of errorType when errorType is not empty.
+func (m *Metrics) RecordDBOperation(operation string, d time.Duration, errorType string) {
+	m.DBOperationDuration.WithLabelValues(operation).Observe(d.Seconds())
+	if errorType != "" {
+		m.DBOperationErrors.WithLabelValues(operation, errorType).Inc()
+	}
+}
+
+// RecordDBRows records the number of managed object rows in each cluster
+// state.
+func (m *Metrics) RecordDBRows(exists, deleted int) {
+	m.DBRowsTotal.WithLabelValues("managed_objects", "exists").Set(float64(exists))
+	m.DBRowsTotal.WithLabelValues("managed_objects", "deleted").Set(float64(deleted))
+}
+
+// RecordBackup is a convenience method used by the backup component to
+// record the outcome of a run. size is the size of the backup written, or 0
+// if none was.
+func (m *Metrics) RecordBackup(status string, d time.Duration, size int64) {
+	m.BackupRunsTotal.WithLabelValues(status).Inc()
+	m.BackupDuration.Observe(d.Seconds())
+	if size > 0 {
+		m.BackupSizeBytes.Set(float64(size))
+	}
+	if status == "success" {
+		m.BackupLastSuccess.SetToCurrentTime()
+	}
+}
+
+// SetHealthChecks makes the component health recorded through these metrics
+// also update h, which backs the health probes. It must be called before the
+// components start.
+func (m *Metrics) SetHealthChecks(h *HealthChecks) {
+	m.health = h
+}
+
+// RecordComponentHealth records whether a component is healthy and, if it
+// is, the time of its latest success. Either way it counts as a heartbeat of
+// the component.
+func (m *Metrics) RecordComponentHealth(component string, up bool) {
+	m.ComponentUp.WithLabelValues(component).Set(boolToFloat(up))
+	if up {
+		m.ComponentLastSuccess.WithLabelValues(component).SetToCurrentTime()
+	}
+	if m.health != nil {
+		status := "ok"
+		if !up {
+			status = "failing"
+		}
+		m.health.Update(component, status)
+		m.health.Heartbeat(component)
+	}
+}
+
+// RecordComponentDegraded records that a component works but cannot keep
+// beacon ready, for the given reason. The component reports as down and its
+// health status as "degraded: <reason>", which fails readiness. It counts as
+// a success and a heartbeat of the component.
+func (m *Metrics) RecordComponentDegraded(component, reason string) {
+	m.ComponentUp.WithLabelValues(component).Set(0)
+	m.ComponentLastSuccess.WithLabelValues(component).SetToCurrentTime()
+	if m.health != nil {
+		m.health.Update(component, "degraded: "+reason)
+		m.health.Heartbeat(component)
+	}
+}
+
+// RecordStoragePressureAction is a convenience method used by the storage
+// monitor for each action taken to relieve storage pressure.
+func (m *Metrics) RecordStoragePressureAction(action string, err error) {
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	m.StoragePressureActions.WithLabelValues(action, status).Inc()
+}
+
+// RecordHeartbeat records that a component's loop completed a cycle without
+// checking its health, e.g. because the cycle had nothing to do.
+func (m *Metrics) RecordHeartbeat(component string) {
+	if m.health != nil {
+		m.health.Heartbeat(component)
+	}
+}
+
+// RecordNotificationCoalesced is a convenience method used by the notifier
+// when the events of a short-lived resource are coalesced.
+func (m *Metrics) RecordNotificationCoalesced(resourceType, decision string) {
+	m.NotificationsCoalescedTotal.WithLabelValues(resourceType, decision).Inc()
+}
+
 // RecordEndpointHealth records the latest health state of the notification
-// endpoint.
-func (m *Metrics) RecordEndpointHealth(healthy bool) {
-	if healthy {
+// endpoint and the number of consecutive failed requests.
+func (m *Metrics) RecordEndpointHealth(up bool, consecutiveFailures int) {
+	if up {
 		m.EndpointUp.Set(1)
-		m.EndpointConsecutiveFailures.Set(0)
 	} else {
 		m.EndpointUp.Set(0)
 	}
+	m.EndpointConsecutiveFailures.Set(float64(consecutiveFailures))
+}
+
+// RecordEndpointSuccess records the time of the latest event the
+// notification endpoint accepted.
+func (m *Metrics) RecordEndpointSuccess() {
+	m.EndpointLastSuccess.SetToCurrentTime()
+}
+
+// RecordRoutedDelivery is a convenience method used by the notifier to count
+// the outcome of a delivery to a named endpoint.
+func (m *Metrics) RecordRoutedDelivery(endpoint, eventType, result string) {
+	m.RoutedDeliveriesTotal.WithLabelValues(endpoint, eventType, result).Inc()
+}
+
+// RecordRoutedEndpointHealth records the latest health state of a named
+// endpoint.
+func (m *Metrics) RecordRoutedEndpointHealth(endpoint string, up bool) {
+	if up {
+		m.RoutedEndpointUp.WithLabelValues(endpoint).Set(1)
+	} else {
+		m.RoutedEndpointUp.WithLabelValues(endpoint).Set(0)
+	}
+}
+
+// RecordAckCallback is a convenience method used by the acknowledgement
+// callback handler to count callbacks by result.
+func (m *Metrics) RecordAckCallback(result string) {
+	m.AckCallbacksTotal.WithLabelValues(result).Inc()
+}
+
+// RecordAckTimeout is a convenience method used by the notifier to count
+// acknowledgement timeouts.
+func (m *Metrics) RecordAckTimeout(eventType, action string) {
+	m.AckTimeoutsTotal.WithLabelValues(eventType, action).Inc()
+}
+
+// boolToFloat returns 1 for true and 0 for false.
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
 }
@@ -2,10 +2,14 @@ package metrics
 
 import (
 	"testing"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/bryonbaker/beacon/internal/models"
 )
 
 // TestNewMetricsDoesNotPanic verifies that creating metrics against a fresh
@@ -115,3 +119,64 @@ func TestDuplicateRegistrationPanics(t *testing.T) {
 		_ = NewMetrics(reg)
 	})
 }
+
+// TestRecordPendingReplacesCounts verifies that pending counts replace the
+// previous ones and that the notifier's queue size is the number of due events.
+func TestRecordPendingReplacesCounts(t *testing.T) {
+	m := NewMetrics(prometheus.NewRegistry())
+
+	m.RecordPending([]*models.PendingCount{
+		{ResourceType: "Pod", EventType: "created", Pending: 4, Due: 3},
+		{ResourceType: "Pod", EventType: "deleted", Pending: 2, Due: 1},
+	})
+	assert.Equal(t, float64(4), testutil.ToFloat64(m.NotificationsPendingTotal.WithLabelValues("Pod", "created")))
+	assert.Equal(t, float64(4), testutil.ToFloat64(m.WorkerQueueSize.WithLabelValues("notifier")))
+
+	m.RecordPending([]*models.PendingCount{
+		{ResourceType: "Pod", EventType: "deleted", Pending: 1, Due: 0},
+	})
+	assert.Equal(t, 1, testutil.CollectAndCount(m.NotificationsPendingTotal), "drained series are removed")
+	assert.Equal(t, float64(0), testutil.ToFloat64(m.WorkerQueueSize.WithLabelValues("notifier")))
+}
+
+// TestRecordDBOperation verifies that every operation is timed and only
+// failed operations are counted as errors.
+func TestRecordDBOperation(t *testing.T) {
+	m := NewMetrics(prometheus.NewRegistry())
+
+	m.RecordDBOperation("InsertManagedObject", time.Millisecond, "")
+	m.RecordDBOperation("InsertManagedObject", time.Millisecond, "constraint")
+
+	assert.Equal(t, 1, testutil.CollectAndCount(m.DBOperationDuration))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.DBOperationErrors.WithLabelValues("InsertManagedObject", "constraint")))
+}
+
+// TestRecordBackup verifies that a failed run keeps the size and time of the
+// last successful backup.
+func TestRecordBackup(t *testing.T) {
+	m := NewMetrics(prometheus.NewRegistry())
+
+	m.RecordBackup("success", time.Second, 4096)
+	assert.Equal(t, float64(4096), testutil.ToFloat64(m.BackupSizeBytes))
+	last := testutil.ToFloat64(m.BackupLastSuccess)
+	assert.Greater(t, last, float64(0))
+
+	m.RecordBackup("error", time.Second, 0)
+	assert.Equal(t, float64(4096), testutil.ToFloat64(m.BackupSizeBytes))
+	assert.Equal(t, last, testutil.ToFloat64(m.BackupLastSuccess))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.BackupRunsTotal.WithLabelValues("error")))
+}
+
+// TestRecordComponentHealth verifies that only healthy reports update the
+// time of the last success.
+func TestRecordComponentHealth(t *testing.T) {
+	m := NewMetrics(prometheus.NewRegistry())
+
+	m.RecordComponentHealth("cleaner", false)
+	assert.Equal(t, float64(0), testutil.ToFloat64(m.ComponentUp.WithLabelValues("cleaner")))
+	assert.Equal(t, float64(0), testutil.ToFloat64(m.ComponentLastSuccess.WithLabelValues("cleaner")))
+
+	m.RecordComponentHealth("cleaner", true)
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.ComponentUp.WithLabelValues("cleaner")))
+	assert.Greater(t, testutil.ToFloat64(m.ComponentLastSuccess.WithLabelValues("cleaner")), float64(0))
+}
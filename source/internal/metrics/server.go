@@ -2,26 +2,46 @@ package metrics
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/http/pprof"
+	"os"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+
+	"github.com/bryonbaker/beacon/internal/config"
 )
 
 // HealthChecks tracks per-component health status in a thread-safe manner.
+// It also tracks the heartbeats of periodic loops, so that a loop that has
+// stopped can be told apart from one that is merely idle.
 type HealthChecks struct {
-	mu     sync.RWMutex
-	checks map[string]string
+	mu         sync.RWMutex
+	checks     map[string]string
+	heartbeats map[string]*heartbeat
+}
+
+// heartbeat is the latest cycle of a periodic loop and how long the loop may
+// go without completing another.
+type heartbeat struct {
+	timeout time.Duration
+	last    time.Time
 }
 
 // NewHealthChecks creates an empty HealthChecks instance.
 func NewHealthChecks() *HealthChecks {
 	return &HealthChecks{
-		checks: make(map[string]string),
+		checks:     make(map[string]string),
+		heartbeats: make(map[string]*heartbeat),
 	}
 }
 
@@ -55,67 +75,229 @@ func (h *HealthChecks) AllOK() bool {
 	return true
 }
 
+// ExpectHeartbeat registers component as a periodic loop that must report a
+// heartbeat at least every timeout, starting now.
+func (h *HealthChecks) ExpectHeartbeat(component string, timeout time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.heartbeats[component] = &heartbeat{timeout: timeout, last: time.Now()}
+}
+
+// Heartbeat records that component completed a cycle. It has no effect on
+// components that are not expected to report heartbeats.
+func (h *HealthChecks) Heartbeat(component string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if hb, ok := h.heartbeats[component]; ok {
+		hb.last = time.Now()
+	}
+}
+
+// Stale returns, in name order, the components whose latest heartbeat is
+// older than their timeout at now.
+func (h *HealthChecks) Stale(now time.Time) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var stale []string
+	for component, hb := range h.heartbeats {
+		if now.Sub(hb.last) > hb.timeout {
+			stale = append(stale, component)
+		}
+	}
+	sort.Strings(stale)
+	return stale
+}
+
 // Server exposes Prometheus metrics and health/readiness probes over HTTP.
+// The probes, and handlers registered with Handle, are served on the health
+// listener. Metrics and the admin routes are served on a listener of their
+// own when metrics.port differs from health.port, and on the health listener
+// otherwise.
 type Server struct {
-	httpServer   *http.Server
+	listeners    []*http.Server
+	healthMux    *http.ServeMux
+	metricsMux   *http.ServeMux
+	protect      func(http.Handler) http.Handler
+	admin        bool
 	registry     *prometheus.Registry
 	healthChecks *HealthChecks
+	logger       *zap.Logger
 
-	mu    sync.RWMutex
-	ready bool
+	mu      sync.RWMutex
+	ready   bool
+	details map[string]string
 }
 
-// NewServer creates a new metrics/health HTTP server.
-//
-// Parameters:
-//   - port: TCP port to listen on
-//   - metricsPath: URL path for Prometheus metrics (e.g. "/metrics")
-//   - healthPath: URL path for the liveness probe (e.g. "/healthz")
-//   - readyPath: URL path for the readiness probe (e.g. "/ready")
-//   - registry: Prometheus registry to expose (may be nil for default)
-func NewServer(port int, metricsPath string, healthPath string, readyPath string, registry *prometheus.Registry) *Server {
+// NewServer creates the metrics and health HTTP server described by
+// cfg.Metrics and cfg.Health, exposing registry (the default registry when
+// nil). It returns an error if the TLS certificates cannot be loaded.
+func NewServer(cfg *config.Config, registry *prometheus.Registry, logger *zap.Logger) (*Server, error) {
 	s := &Server{
+		healthMux:    http.NewServeMux(),
 		registry:     registry,
 		healthChecks: NewHealthChecks(),
+		logger:       logger,
 		ready:        false,
+		details:      make(map[string]string),
 	}
 
-	mux := http.NewServeMux()
+	// Liveness probe -- returns 200 while the periodic loops are running.
+	s.healthMux.HandleFunc(cfg.Health.LivenessPath, s.handleHealth)
+
+	// Readiness probe -- returns 200 only when all components are healthy.
+	s.healthMux.HandleFunc(cfg.Health.ReadinessPath, s.handleReady)
+
+	health := newHTTPServer(cfg.Health.Port, s.healthMux)
+	s.listeners = append(s.listeners, health)
+	if !cfg.Metrics.Enabled {
+		return s, nil
+	}
+
+	tlsConfig, err := newTLSConfig(cfg.Metrics.TLS)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Metrics.Port == cfg.Health.Port {
+		// The probes must stay on plain HTTP; config validation rejects TLS
+		// on a shared listener.
+		if tlsConfig != nil {
+			return nil, fmt.Errorf("metrics TLS requires a metrics port other than the health port %d", cfg.Health.Port)
+		}
+		s.metricsMux = s.healthMux
+	} else {
+		s.metricsMux = http.NewServeMux()
+		metricsServer := newHTTPServer(cfg.Metrics.Port, s.metricsMux)
+		metricsServer.TLSConfig = tlsConfig
+		s.listeners = append(s.listeners, metricsServer)
+	}
+	s.protect = authenticate(cfg.Metrics.Auth, logger)
 
 	// Prometheus metrics handler.
 	if registry != nil {
-		mux.Handle(metricsPath, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+		s.metricsMux.Handle(cfg.Metrics.Path, s.protect(promhttp.HandlerFor(registry, promhttp.HandlerOpts{})))
 	} else {
-		mux.Handle(metricsPath, promhttp.Handler())
+		s.metricsMux.Handle(cfg.Metrics.Path, s.protect(promhttp.Handler()))
+	}
+
+	if cfg.Metrics.Admin.Enabled {
+		s.admin = true
+		s.HandleAdmin("/debug/pprof/", http.HandlerFunc(pprof.Index))
+		s.HandleAdmin("/debug/pprof/cmdline", http.HandlerFunc(pprof.Cmdline))
+		s.HandleAdmin("/debug/pprof/profile", http.HandlerFunc(pprof.Profile))
+		s.HandleAdmin("/debug/pprof/symbol", http.HandlerFunc(pprof.Symbol))
+		s.HandleAdmin("/debug/pprof/trace", http.HandlerFunc(pprof.Trace))
 	}
 
-	// Liveness probe -- always returns 200 if the process is running.
-	mux.HandleFunc(healthPath, s.handleHealth)
+	return s, nil
+}
 
-	// Readiness probe -- returns 200 only when all components are healthy.
-	mux.HandleFunc(readyPath, s.handleReady)
+// newHTTPServer returns an http.Server for handler on port.
+func newHTTPServer(port int, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+}
 
-	s.httpServer = &http.Server{
-		Addr:    fmt.Sprintf(":%d", port),
-		Handler: mux,
+// newTLSConfig loads the certificates of cfg. It returns nil when cfg does
+// not enable TLS.
+func newTLSConfig(cfg config.ServerTLSConfig) (*tls.Config, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading metrics TLS certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading metrics client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("metrics client CA file %s contains no certificates", cfg.ClientCAFile)
+		}
+		// Probes on a shared listener present no certificate, so one is
+		// only verified here and required by the routes that need it.
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
 	}
+	return tlsConfig, nil
+}
 
-	return s
+// Handle registers an additional handler on the health listener, e.g. for
+// documents that are published alongside the probes. It must be called
+// before Start.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.healthMux.Handle(pattern, handler)
+}
+
+// HandleAdmin registers an admin handler next to the metrics, behind the
+// same protection. It has no effect unless metrics.admin.enabled is set. It
+// must be called before Start.
+func (s *Server) HandleAdmin(pattern string, handler http.Handler) {
+	if !s.admin {
+		return
+	}
+	s.metricsMux.Handle(pattern, s.protect(handler))
 }
 
-// Start begins serving HTTP requests. It blocks until the server is stopped
-// or encounters a fatal error. ErrServerClosed is not returned.
+// Start begins serving HTTP requests on every listener. It blocks until the
+// server is stopped or a listener encounters a fatal error, in which case
+// the other listeners are closed. ErrServerClosed is not returned.
 func (s *Server) Start() error {
-	err := s.httpServer.ListenAndServe()
-	if err != nil && err != http.ErrServerClosed {
-		return err
+	errs := make(chan error, len(s.listeners))
+	for _, srv := range s.listeners {
+		go func(srv *http.Server) {
+			s.logger.Info("http server listening",
+				zap.String("addr", srv.Addr),
+				zap.Bool("tls", srv.TLSConfig != nil),
+			)
+			var err error
+			if srv.TLSConfig != nil {
+				err = srv.ListenAndServeTLS("", "")
+			} else {
+				err = srv.ListenAndServe()
+			}
+			if err == http.ErrServerClosed {
+				err = nil
+			}
+			errs <- err
+		}(srv)
 	}
-	return nil
+
+	var firstErr error
+	for range s.listeners {
+		if err := <-errs; err != nil && firstErr == nil {
+			firstErr = err
+			for _, srv := range s.listeners {
+				_ = srv.Close()
+			}
+		}
+	}
+	return firstErr
 }
 
-// Shutdown gracefully shuts down the HTTP server using the provided context.
+// Shutdown gracefully shuts down every listener using the provided context.
 func (s *Server) Shutdown(ctx context.Context) error {
-	return s.httpServer.Shutdown(ctx)
+	var errs []error
+	for _, srv := range s.listeners {
+		if err := srv.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// HealthChecks returns the component health checks behind the probes.
+func (s *Server) HealthChecks() *HealthChecks {
+	return s.healthChecks
 }
 
 // UpdateHealthCheck updates the status of the named component.
@@ -130,6 +312,25 @@ func (s *Server) SetReady(ready bool) {
 	s.ready = ready
 }
 
+// SetDetail records informational state for the named component. Details
+// are included in the readiness response but do not affect readiness.
+func (s *Server) SetDetail(component string, detail string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.details[component] = detail
+}
+
+// readinessDetails returns a snapshot of the informational details.
+func (s *Server) readinessDetails() map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make(map[string]string, len(s.details))
+	for k, v := range s.details {
+		out[k] = v
+	}
+	return out
+}
+
 // isReady returns the current readiness state.
 func (s *Server) isReady() bool {
 	s.mu.RLock()
@@ -137,16 +338,31 @@ func (s *Server) isReady() bool {
 	return s.ready
 }
 
-// handleHealth is the liveness handler. It always returns HTTP 200 to indicate
-// that the process is alive.
+// handleHealth is the liveness handler. It returns HTTP 200 while every
+// periodic loop keeps reporting heartbeats, otherwise HTTP 503 with the loops
+// that have stopped.
 func (s *Server) handleHealth(w http.ResponseWriter, _ *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
 
-	resp := map[string]string{
-		"status":    "ok",
-		"timestamp": time.Now().UTC().Format(time.RFC3339),
+	now := time.Now()
+	stale := s.healthChecks.Stale(now)
+
+	status := "ok"
+	code := http.StatusOK
+	if len(stale) > 0 {
+		status = "unavailable"
+		code = http.StatusServiceUnavailable
+	}
+
+	resp := map[string]interface{}{
+		"status":    status,
+		"timestamp": now.UTC().Format(time.RFC3339),
 	}
+	if len(stale) > 0 {
+		resp["stale"] = stale
+	}
+
+	w.WriteHeader(code)
 	_ = json.NewEncoder(w).Encode(resp)
 }
 
@@ -170,6 +386,9 @@ func (s *Server) handleReady(w http.ResponseWriter, _ *http.Request) {
 		"timestamp": time.Now().UTC().Format(time.RFC3339),
 		"checks":    checks,
 	}
+	if details := s.readinessDetails(); len(details) > 0 {
+		resp["details"] = details
+	}
 
 	w.WriteHeader(code)
 	_ = json.NewEncoder(w).Encode(resp)
@@ -1,35 +1,69 @@
 package metrics
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/bryonbaker/beacon/internal/config"
 )
 
-// helper builds a Server wired to an httptest recorder. It returns the
-// underlying http.Handler so callers can issue requests without starting
-// a real listener.
-func newTestServer(t *testing.T) *Server {
+// testServerConfig returns the default configuration of the metrics and
+// health server, which shares one listener.
+func testServerConfig() *config.Config {
+	return &config.Config{
+		Metrics: config.MetricsConfig{
+			Enabled: true,
+			Port:    8080,
+			Path:    "/metrics",
+			Auth:    config.MetricsAuthConfig{Type: config.MetricsAuthNone},
+		},
+		Health: config.HealthConfig{LivenessPath: "/healthz", ReadinessPath: "/ready", Port: 8080},
+	}
+}
+
+// newTestServerWithConfig builds a Server for cfg. Callers issue requests to
+// its muxes without starting a real listener.
+func newTestServerWithConfig(t *testing.T, cfg *config.Config) *Server {
 	t.Helper()
 	reg := prometheus.NewRegistry()
 	_ = NewMetrics(reg)
-	srv := NewServer(0, "/metrics", "/healthz", "/ready", reg)
+	srv, err := NewServer(cfg, reg, zap.NewNop())
+	require.NoError(t, err)
 	return srv
 }
 
-// TestLivenessReturns200 verifies that the liveness endpoint always returns
-// HTTP 200 with a JSON body containing status "ok".
+// newTestServer builds a Server with the default configuration.
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	return newTestServerWithConfig(t, testServerConfig())
+}
+
+// TestLivenessReturns200 verifies that the liveness endpoint returns HTTP 200
+// with a JSON body containing status "ok" when no loop has stopped.
 func TestLivenessReturns200(t *testing.T) {
 	srv := newTestServer(t)
 
 	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
 	rec := httptest.NewRecorder()
-	srv.httpServer.Handler.ServeHTTP(rec, req)
+	srv.healthMux.ServeHTTP(rec, req)
 
 	assert.Equal(t, http.StatusOK, rec.Code)
 
@@ -43,6 +77,25 @@ func TestLivenessReturns200(t *testing.T) {
 // TestReadinessReturns200WhenHealthy verifies that the readiness endpoint
 // returns HTTP 200 when the server is marked ready and all component checks
 // report "ok".
+// TestLivenessReturns503WhenHeartbeatStale verifies that the liveness
+// endpoint fails and names the loops that stopped reporting heartbeats.
+func TestLivenessReturns503WhenHeartbeatStale(t *testing.T) {
+	srv := newTestServer(t)
+	srv.HealthChecks().ExpectHeartbeat("notifier", time.Hour)
+	srv.HealthChecks().ExpectHeartbeat("reconciler", -time.Second)
+
+	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	rec := httptest.NewRecorder()
+	srv.healthMux.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, "unavailable", body["status"])
+	assert.Equal(t, []interface{}{"reconciler"}, body["stale"])
+}
+
 func TestReadinessReturns200WhenHealthy(t *testing.T) {
 	srv := newTestServer(t)
 
@@ -54,7 +107,7 @@ func TestReadinessReturns200WhenHealthy(t *testing.T) {
 
 	req := httptest.NewRequest(http.MethodGet, "/ready", nil)
 	rec := httptest.NewRecorder()
-	srv.httpServer.Handler.ServeHTTP(rec, req)
+	srv.healthMux.ServeHTTP(rec, req)
 
 	assert.Equal(t, http.StatusOK, rec.Code)
 
@@ -71,6 +124,26 @@ func TestReadinessReturns200WhenHealthy(t *testing.T) {
 	assert.Equal(t, "ok", checks["database"])
 }
 
+// TestReadinessIncludesDetails verifies that details are reported in the
+// readiness response without affecting the status.
+func TestReadinessIncludesDetails(t *testing.T) {
+	srv := newTestServer(t)
+	srv.SetReady(true)
+	srv.SetDetail("endpointCircuit", "open")
+
+	req := httptest.NewRequest(http.MethodGet, "/ready", nil)
+	rec := httptest.NewRecorder()
+	srv.healthMux.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	details, ok := body["details"].(map[string]interface{})
+	require.True(t, ok, "expected details to be a map")
+	assert.Equal(t, "open", details["endpointCircuit"])
+}
+
 // TestReadinessReturns503WhenNotReady verifies that the readiness endpoint
 // returns HTTP 503 when the server has not been marked ready.
 func TestReadinessReturns503WhenNotReady(t *testing.T) {
@@ -79,7 +152,7 @@ func TestReadinessReturns503WhenNotReady(t *testing.T) {
 	// Server not marked ready (default is false).
 	req := httptest.NewRequest(http.MethodGet, "/ready", nil)
 	rec := httptest.NewRecorder()
-	srv.httpServer.Handler.ServeHTTP(rec, req)
+	srv.healthMux.ServeHTTP(rec, req)
 
 	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
 
@@ -100,7 +173,7 @@ func TestReadinessReturns503WhenComponentUnhealthy(t *testing.T) {
 
 	req := httptest.NewRequest(http.MethodGet, "/ready", nil)
 	rec := httptest.NewRecorder()
-	srv.httpServer.Handler.ServeHTTP(rec, req)
+	srv.healthMux.ServeHTTP(rec, req)
 
 	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
 
@@ -120,7 +193,7 @@ func TestMetricsEndpointReturns200(t *testing.T) {
 
 	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
 	rec := httptest.NewRecorder()
-	srv.httpServer.Handler.ServeHTTP(rec, req)
+	srv.healthMux.ServeHTTP(rec, req)
 
 	assert.Equal(t, http.StatusOK, rec.Code)
 	// Prometheus text format contains at least one HELP line for our metrics.
@@ -128,6 +201,22 @@ func TestMetricsEndpointReturns200(t *testing.T) {
 }
 
 // TestSetReadyToggle verifies that SetReady toggles the readiness state.
+// TestHandleRegistersAdditionalPath verifies that handlers added with Handle
+// are served alongside the built-in endpoints.
+func TestHandleRegistersAdditionalPath(t *testing.T) {
+	srv := newTestServer(t)
+	srv.Handle("/schemas/data.json", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/schemas/data.json", nil)
+	rec := httptest.NewRecorder()
+	srv.healthMux.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "{}", rec.Body.String())
+}
+
 func TestSetReadyToggle(t *testing.T) {
 	srv := newTestServer(t)
 
@@ -163,3 +252,231 @@ func TestHealthChecksAllOKEmptyIsTrue(t *testing.T) {
 	hc := NewHealthChecks()
 	assert.True(t, hc.AllOK())
 }
+
+// TestHealthChecksHeartbeat verifies that a heartbeat keeps a loop live for
+// its timeout and that components without a timeout are ignored.
+func TestHealthChecksHeartbeat(t *testing.T) {
+	hc := NewHealthChecks()
+	hc.ExpectHeartbeat("notifier", time.Minute)
+	hc.Heartbeat("cleaner")
+
+	now := time.Now()
+	assert.Empty(t, hc.Stale(now))
+	assert.Equal(t, []string{"notifier"}, hc.Stale(now.Add(2*time.Minute)))
+
+	hc.Heartbeat("notifier")
+	assert.Empty(t, hc.Stale(time.Now().Add(30*time.Second)))
+}
+
+// TestRecordComponentHealthUpdatesHealthChecks verifies that component health
+// recorded as metrics also updates the probes.
+func TestRecordComponentHealthUpdatesHealthChecks(t *testing.T) {
+	m := NewMetrics(prometheus.NewRegistry())
+	hc := NewHealthChecks()
+	m.SetHealthChecks(hc)
+	hc.ExpectHeartbeat("reconciler", time.Minute)
+
+	m.RecordComponentHealth("reconciler", false)
+	assert.Equal(t, "failing", hc.All()["reconciler"])
+	assert.False(t, hc.AllOK())
+
+	m.RecordComponentHealth("reconciler", true)
+	assert.Equal(t, "ok", hc.All()["reconciler"])
+	assert.Empty(t, hc.Stale(time.Now().Add(30*time.Second)))
+}
+
+func TestRecordComponentDegradedFailsReadiness(t *testing.T) {
+	m := NewMetrics(prometheus.NewRegistry())
+	hc := NewHealthChecks()
+	m.SetHealthChecks(hc)
+	hc.ExpectHeartbeat("storage", time.Minute)
+
+	m.RecordComponentDegraded("storage", "volume usage is critical")
+	assert.Equal(t, "degraded: volume usage is critical", hc.All()["storage"])
+	assert.False(t, hc.AllOK())
+	assert.Empty(t, hc.Stale(time.Now().Add(30*time.Second)))
+
+	m.RecordComponentHealth("storage", true)
+	assert.True(t, hc.AllOK())
+}
+
+// serve issues a GET for path to handler and returns the response recorder.
+func serve(handler http.Handler, path string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// TestSeparateMetricsListener verifies that metrics move to a listener of
+// their own when the ports differ.
+func TestSeparateMetricsListener(t *testing.T) {
+	cfg := testServerConfig()
+	cfg.Metrics.Port = 9090
+	srv := newTestServerWithConfig(t, cfg)
+
+	require.Len(t, srv.listeners, 2)
+	assert.Equal(t, ":8080", srv.listeners[0].Addr)
+	assert.Equal(t, ":9090", srv.listeners[1].Addr)
+	assert.Equal(t, http.StatusNotFound, serve(srv.healthMux, "/metrics", nil).Code)
+	assert.Equal(t, http.StatusOK, serve(srv.metricsMux, "/metrics", nil).Code)
+	assert.Equal(t, http.StatusNotFound, serve(srv.metricsMux, "/healthz", nil).Code)
+}
+
+// TestHandleServedOnHealthListener verifies that handlers added with Handle,
+// such as the acknowledgement callback, answer on the health listener and
+// not on a separate metrics listener.
+func TestHandleServedOnHealthListener(t *testing.T) {
+	cfg := testServerConfig()
+	cfg.Metrics.Port = 9090
+	srv := newTestServerWithConfig(t, cfg)
+	srv.Handle("/ack", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	require.Len(t, srv.listeners, 2)
+	assert.Equal(t, http.StatusNoContent, serve(srv.listeners[0].Handler, "/ack", nil).Code)
+	assert.Equal(t, http.StatusNotFound, serve(srv.listeners[1].Handler, "/ack", nil).Code)
+}
+
+// TestMetricsDisabled verifies that disabled metrics are not served at all.
+func TestMetricsDisabled(t *testing.T) {
+	cfg := testServerConfig()
+	cfg.Metrics.Enabled = false
+	cfg.Metrics.Port = 9090
+	srv := newTestServerWithConfig(t, cfg)
+
+	require.Len(t, srv.listeners, 1)
+	assert.Equal(t, http.StatusNotFound, serve(srv.healthMux, "/metrics", nil).Code)
+	assert.Equal(t, http.StatusOK, serve(srv.healthMux, "/healthz", nil).Code)
+}
+
+// TestMetricsBearerAuth verifies that the metrics require the token from the
+// token file, re-read on every request, while the probes stay open.
+func TestMetricsBearerAuth(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("s3cret\n"), 0o600))
+	cfg := testServerConfig()
+	cfg.Metrics.Auth = config.MetricsAuthConfig{Type: config.MetricsAuthBearer, TokenFile: tokenFile}
+	srv := newTestServerWithConfig(t, cfg)
+
+	rec := serve(srv.healthMux, "/metrics", nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, `Bearer realm="beacon"`, rec.Header().Get("WWW-Authenticate"))
+	assert.Equal(t, http.StatusUnauthorized, serve(srv.healthMux, "/metrics", http.Header{"Authorization": {"Bearer wrong"}}).Code)
+	assert.Equal(t, http.StatusOK, serve(srv.healthMux, "/metrics", http.Header{"Authorization": {"Bearer s3cret"}}).Code)
+	assert.Equal(t, http.StatusOK, serve(srv.healthMux, "/healthz", nil).Code)
+
+	require.NoError(t, os.WriteFile(tokenFile, []byte("rotated"), 0o600))
+	assert.Equal(t, http.StatusUnauthorized, serve(srv.healthMux, "/metrics", http.Header{"Authorization": {"Bearer s3cret"}}).Code)
+	assert.Equal(t, http.StatusOK, serve(srv.healthMux, "/metrics", http.Header{"Authorization": {"Bearer rotated"}}).Code)
+}
+
+// TestMetricsMTLSAuth verifies that the metrics require a verified client
+// certificate.
+func TestMetricsMTLSAuth(t *testing.T) {
+	protect := authenticate(config.MetricsAuthConfig{Type: config.MetricsAuthMTLS}, zap.NewNop())
+	handler := protect(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	req.TLS = &tls.ConnectionState{}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code, "an unverified connection is rejected")
+
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{}}}}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+// TestNewTLSConfig verifies that the certificate and client CA are loaded
+// and that client certificates are verified without being required.
+func TestNewTLSConfig(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t)
+
+	tlsConfig, err := newTLSConfig(config.ServerTLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: certFile})
+	require.NoError(t, err)
+	assert.Len(t, tlsConfig.Certificates, 1)
+	assert.NotNil(t, tlsConfig.ClientCAs)
+	assert.Equal(t, tls.VerifyClientCertIfGiven, tlsConfig.ClientAuth)
+
+	tlsConfig, err = newTLSConfig(config.ServerTLSConfig{})
+	require.NoError(t, err)
+	assert.Nil(t, tlsConfig)
+
+	_, err = newTLSConfig(config.ServerTLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: keyFile})
+	assert.ErrorContains(t, err, "contains no certificates")
+
+	_, err = NewServer(func() *config.Config {
+		cfg := testServerConfig()
+		cfg.Metrics.TLS = config.ServerTLSConfig{CertFile: "/missing.crt", KeyFile: "/missing.key"}
+		return cfg
+	}(), nil, zap.NewNop())
+	assert.ErrorContains(t, err, "loading metrics TLS certificate")
+
+	// The probes on the health listener are never served over TLS.
+	_, err = NewServer(func() *config.Config {
+		cfg := testServerConfig()
+		cfg.Metrics.TLS = config.ServerTLSConfig{CertFile: certFile, KeyFile: keyFile}
+		return cfg
+	}(), nil, zap.NewNop())
+	assert.ErrorContains(t, err, "metrics TLS requires a metrics port other than the health port")
+}
+
+// TestAdminRoutes verifies that pprof and admin routes are only served when
+// enabled, behind the metrics protection.
+func TestAdminRoutes(t *testing.T) {
+	srv := newTestServer(t)
+	srv.HandleAdmin("/admin/loglevel", http.NotFoundHandler())
+	assert.Equal(t, http.StatusNotFound, serve(srv.healthMux, "/debug/pprof/", nil).Code)
+
+	cfg := testServerConfig()
+	cfg.Metrics.Port = 9090
+	cfg.Metrics.Admin.Enabled = true
+	cfg.Metrics.Auth = config.MetricsAuthConfig{Type: config.MetricsAuthBearer, Token: "s3cret"}
+	srv = newTestServerWithConfig(t, cfg)
+	level := zap.NewAtomicLevel()
+	srv.HandleAdmin("/admin/loglevel", level)
+	auth := http.Header{"Authorization": {"Bearer s3cret"}}
+
+	assert.Equal(t, http.StatusUnauthorized, serve(srv.metricsMux, "/debug/pprof/", nil).Code)
+	assert.Equal(t, http.StatusOK, serve(srv.metricsMux, "/debug/pprof/", auth).Code)
+	assert.Equal(t, http.StatusOK, serve(srv.metricsMux, "/admin/loglevel", auth).Code)
+	assert.Equal(t, http.StatusNotFound, serve(srv.healthMux, "/admin/loglevel", auth).Code)
+}
+
+// writeTestCertificate writes a self-signed certificate and its key to PEM
+// files and returns their paths.
+func writeTestCertificate(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "beacon"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "tls.crt")
+	keyFile = filepath.Join(dir, "tls.key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
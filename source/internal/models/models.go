@@ -2,6 +2,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 )
 
@@ -18,6 +19,26 @@ const (
 	DetectionSourceReconciliation = "reconciliation"
 )
 
+// Ordering key constants. Events that share an ordering key are delivered in
+// the order they occurred.
+const (
+	OrderingKeyUID  = "uid"  // Events for the same resource UID
+	OrderingKeyName = "name" // Events for the same type, namespace, and name, across recreations
+)
+
+// Coalescing decisions recorded for short-lived objects.
+const (
+	CoalescedSuppressed = "suppressed" // No events were sent
+	CoalescedEphemeral  = "ephemeral"  // A single ephemeral event was sent
+)
+
+// Retention policies, named for the state of the records they remove.
+const (
+	RetentionDelivered = "delivered" // Deleted, with every event delivered
+	RetentionFailed    = "failed"    // Delivery failed permanently
+	RetentionStale     = "stale"     // Exists, but no longer reconciled
+)
+
 // Notification status constants
 const (
 	NotificationPending = "pending"
@@ -47,10 +68,51 @@ type ManagedObject struct {
 	DeletedNotificationSentAt *time.Time `json:"deleted_notification_sent_at,omitempty"`
 	NotificationAttempts      int        `json:"notification_attempts"`
 	LastNotificationAttempt   *time.Time `json:"last_notification_attempt,omitempty"`
+	NextAttemptAt             *time.Time `json:"next_attempt_at,omitempty"`
+	CreatedSequence           int64      `json:"created_sequence,omitempty"`
+	DeletedSequence           int64      `json:"deleted_sequence,omitempty"`
+	Coalesced                 string     `json:"coalesced,omitempty"`
+	AwaitingAck               string     `json:"awaiting_ack,omitempty"`
+	CreatedTraceParent        string     `json:"created_trace_parent,omitempty"`
+	DeletedTraceParent        string     `json:"deleted_trace_parent,omitempty"`
 	Labels                    string     `json:"labels,omitempty"`
 	Annotations               string     `json:"annotations,omitempty"`
 	ResourceVersion           string     `json:"resource_version,omitempty"`
 	FullMetadata              string     `json:"full_metadata,omitempty"`
+	Fields                    string     `json:"fields,omitempty"`
+}
+
+// EndpointDelivery is the delivery state of one event of a managed object to
+// one named endpoint. It mirrors the endpoint_deliveries database table and is
+// only used when events are routed to several endpoints. Status is one of the
+// Notification* constants.
+type EndpointDelivery struct {
+	ObjectID      string     `json:"object_id"`
+	Endpoint      string     `json:"endpoint"`
+	EventType     string     `json:"event_type"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	LastAttempt   *time.Time `json:"last_attempt,omitempty"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	FailedCode    int        `json:"failed_status_code,omitempty"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+}
+
+// DeliveryAttempt records a failed attempt to deliver an event, with what the
+// destination said about it. It mirrors the delivery_attempts database table.
+// Endpoint is "" for the single endpoint. StatusCode is 0 when no response was
+// received, and ResponseBody is truncated to the configured maximum.
+type DeliveryAttempt struct {
+	ID              int64             `json:"id"`
+	ObjectID        string            `json:"object_id"`
+	Endpoint        string            `json:"endpoint,omitempty"`
+	EventType       string            `json:"event_type"`
+	AttemptedAt     time.Time         `json:"attempted_at"`
+	StatusCode      int               `json:"status_code,omitempty"`
+	Latency         time.Duration     `json:"latency"`
+	Error           string            `json:"error"`
+	ResponseBody    string            `json:"response_body,omitempty"`
+	ResponseHeaders map[string]string `json:"response_headers,omitempty"`
 }
 
 // IsPendingCreationNotification returns true if a creation notification has not been sent
@@ -83,23 +145,72 @@ func (m *ManagedObject) IsEligibleForCleanup(retentionPeriod time.Duration) bool
 	return time.Since(*m.DeletedAt) > retentionPeriod
 }
 
-// CloudEvent is a CloudEvents v1.0 structured-content-mode envelope
-// sent to the notification endpoint.
+// PendingCount is the number of outstanding events of one resource type and
+// event type, and how many of them are due for delivery now. Events are due
+// unless a retry, hold, or acknowledgement wait defers them.
+type PendingCount struct {
+	ResourceType string
+	EventType    string
+	Pending      int
+	Due          int
+}
+
+// CloudEvent is a CloudEvents v1.0 envelope sent to the notification
+// endpoint. Its JSON encoding is the structured-content-mode representation,
+// with extension attributes flattened alongside the core attributes.
 type CloudEvent struct {
-	SpecVersion     string           `json:"specversion"`
-	ID              string           `json:"id"`
-	Source          string           `json:"source"`
-	Type            string           `json:"type"`
-	Subject         string           `json:"subject,omitempty"`
-	Time            string           `json:"time"`
-	DataContentType string           `json:"datacontenttype"`
-	Data            CloudEventData   `json:"data"`
+	SpecVersion     string            `json:"specversion"`
+	ID              string            `json:"id"`
+	Source          string            `json:"source"`
+	Type            string            `json:"type"`
+	Subject         string            `json:"subject,omitempty"`
+	Time            string            `json:"time"`
+	DataContentType string            `json:"datacontenttype"`
+	DataSchema      string            `json:"dataschema,omitempty"`
+	Extensions      map[string]string `json:"-"`
+	Data            CloudEventData    `json:"data"`
+}
+
+// MarshalJSON encodes the envelope in structured content mode. Extension
+// attributes never replace a core attribute of the same name.
+func (ce CloudEvent) MarshalJSON() ([]byte, error) {
+	type envelope CloudEvent
+	base, err := json.Marshal(envelope(ce))
+	if err != nil || len(ce.Extensions) == 0 {
+		return base, err
+	}
+
+	var attrs map[string]json.RawMessage
+	if err := json.Unmarshal(base, &attrs); err != nil {
+		return nil, err
+	}
+	for name, value := range ce.Extensions {
+		if _, exists := attrs[name]; exists {
+			continue
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		attrs[name] = encoded
+	}
+	return json.Marshal(attrs)
 }
 
 // CloudEventData is the business payload within a CloudEvent.
 type CloudEventData struct {
-	Resource NotificationResource `json:"resource"`
-	Metadata NotificationMetadata `json:"metadata"`
+	Resource NotificationResource   `json:"resource"`
+	Metadata NotificationMetadata   `json:"metadata"`
+	Fields   map[string]interface{} `json:"fields,omitempty"`
+	Lifespan *Lifespan              `json:"lifespan,omitempty"`
+}
+
+// Lifespan describes how long a short-lived resource existed. It is only set
+// on ephemeral events.
+type Lifespan struct {
+	CreatedAt string  `json:"createdAt"`
+	DeletedAt string  `json:"deletedAt"`
+	Seconds   float64 `json:"seconds"`
 }
 
 // NotificationResource describes the Kubernetes resource in a notification payload.
@@ -129,4 +240,5 @@ type ReadinessResponse struct {
 	Status    string            `json:"status"`
 	Timestamp string            `json:"timestamp"`
 	Checks    map[string]string `json:"checks"`
+	Details   map[string]string `json:"details,omitempty"`
 }
@@ -1,10 +1,12 @@
 package models
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestIsPendingCreationNotification(t *testing.T) {
@@ -180,3 +182,25 @@ func TestConstants(t *testing.T) {
 	assert.Equal(t, "mutation", DetectionSourceMutation)
 	assert.Equal(t, "reconciliation", DetectionSourceReconciliation)
 }
+
+func TestCloudEventMarshalJSON_FlattensExtensions(t *testing.T) {
+	ce := CloudEvent{
+		SpecVersion:     "1.0",
+		ID:              "id-1",
+		Source:          "/beacon/default/Pod",
+		Type:            "net.bakerapps.beacon.resource.created",
+		Time:            "2025-01-01T00:00:00Z",
+		DataContentType: "application/json",
+		Extensions:      map[string]string{"partitionkey": "default/web", "id": "ignored"},
+	}
+
+	raw, err := json.Marshal(ce)
+	require.NoError(t, err)
+
+	var attrs map[string]interface{}
+	require.NoError(t, json.Unmarshal(raw, &attrs))
+	assert.Equal(t, "default/web", attrs["partitionkey"])
+	assert.Equal(t, "id-1", attrs["id"], "extensions must not override core attributes")
+	assert.NotContains(t, attrs, "Extensions")
+	assert.NotContains(t, attrs, "dataschema")
+}
@@ -0,0 +1,123 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidTransition reports a state change that is not allowed from a
+// managed object's current state.
+var ErrInvalidTransition = errors.New("invalid state transition")
+
+// NotificationAwaitingAck is the notification state of an event that the
+// destination accepted and will acknowledge later.
+const NotificationAwaitingAck = "awaiting_ack"
+
+// EventEphemeral is the event sent in place of the created and deleted events
+// of a short-lived object.
+const EventEphemeral = "ephemeral"
+
+// Transitions of a managed object's state machine.
+//
+// The cluster state moves once, from exists to deleted. Each of the created
+// and deleted events is pending until it is sent, possibly after awaiting an
+// acknowledgement; the deleted event is pending only once the object is
+// deleted, and is sent only after the created event. Coalescing sends both
+// events of a deleted object at once. Once the object's notifications have
+// failed, none of its events change again.
+const (
+	TransitionDelete   = "delete"    // the resource was deleted from the cluster
+	TransitionSend     = "send"      // an event was delivered
+	TransitionAwaitAck = "await_ack" // an event was accepted and awaits acknowledgement
+	TransitionRetry    = "retry"     // an attempt failed and another is scheduled
+	TransitionFail     = "fail"      // the object's notifications failed permanently
+	TransitionCoalesce = "coalesce"  // both events were replaced by coalescing
+)
+
+// EventState returns the notification state of eventType ("created" or
+// "deleted"): NotificationSent, NotificationFailed, NotificationAwaitingAck or
+// NotificationPending, or "" for the deleted event of an object that still
+// exists.
+func (m *ManagedObject) EventState(eventType string) string {
+	sent := m.NotifiedCreated
+	if eventType == "deleted" {
+		if m.ClusterState != ClusterStateDeleted {
+			return ""
+		}
+		sent = m.NotifiedDeleted
+	}
+	switch {
+	case sent:
+		return NotificationSent
+	case m.NotificationFailed:
+		return NotificationFailed
+	case m.AwaitingAck == eventType:
+		return NotificationAwaitingAck
+	default:
+		return NotificationPending
+	}
+}
+
+// CheckTransition returns an error wrapping ErrInvalidTransition if
+// transition is not allowed from m's current state. eventType names the event
+// of a send or await_ack transition and is ignored by the others; an
+// acknowledgement can also be awaited for EventEphemeral.
+func (m *ManagedObject) CheckTransition(transition, eventType string) error {
+	invalid := func(reason string) error {
+		name := transition
+		if transition == TransitionSend || transition == TransitionAwaitAck {
+			name += " " + eventType
+		}
+		return fmt.Errorf("%w: %s of object %s: %s", ErrInvalidTransition, name, m.ID, reason)
+	}
+
+	switch transition {
+	case TransitionDelete:
+		if m.ClusterState != ClusterStateExists {
+			return invalid("the object is already deleted")
+		}
+		return nil
+	case TransitionFail:
+		if m.NotificationFailed {
+			return invalid("its notifications have already failed")
+		}
+		return nil
+	case TransitionRetry, TransitionCoalesce, TransitionSend, TransitionAwaitAck:
+	default:
+		return invalid("unknown transition")
+	}
+
+	if m.NotificationFailed {
+		return invalid("its notifications have failed")
+	}
+	if transition == TransitionAwaitAck && m.AwaitingAck != "" {
+		return invalid("an event is already awaiting acknowledgement")
+	}
+	if transition == TransitionCoalesce || (transition == TransitionAwaitAck && eventType == EventEphemeral) {
+		switch {
+		case m.ClusterState != ClusterStateDeleted:
+			return invalid("the object is not deleted")
+		case m.NotifiedCreated || m.NotifiedDeleted:
+			return invalid("an event has already been sent")
+		}
+		return nil
+	}
+	if transition == TransitionRetry {
+		if !m.IsPendingCreationNotification() && !m.IsPendingDeletionNotification() {
+			return invalid("no event is pending")
+		}
+		return nil
+	}
+
+	switch state := m.EventState(eventType); {
+	case eventType != "created" && eventType != "deleted":
+		return invalid("unknown event type")
+	case state == "":
+		return invalid("the object is not deleted")
+	case state == NotificationSent:
+		return invalid("the event has already been sent")
+	case eventType == "deleted" && !m.NotifiedCreated:
+		return invalid("the created event has not been sent")
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventState(t *testing.T) {
+	obj := ManagedObject{ClusterState: ClusterStateExists}
+	assert.Equal(t, NotificationPending, obj.EventState("created"))
+	assert.Equal(t, "", obj.EventState("deleted"), "an object that exists has no deleted event")
+
+	obj.AwaitingAck = "created"
+	assert.Equal(t, NotificationAwaitingAck, obj.EventState("created"))
+
+	obj.AwaitingAck = ""
+	obj.NotifiedCreated = true
+	obj.ClusterState = ClusterStateDeleted
+	assert.Equal(t, NotificationSent, obj.EventState("created"))
+	assert.Equal(t, NotificationPending, obj.EventState("deleted"))
+
+	obj.NotificationFailed = true
+	assert.Equal(t, NotificationSent, obj.EventState("created"))
+	assert.Equal(t, NotificationFailed, obj.EventState("deleted"))
+}
+
+func TestCheckTransition(t *testing.T) {
+	exists := ManagedObject{ID: "id-1", ClusterState: ClusterStateExists}
+	created := ManagedObject{ID: "id-1", ClusterState: ClusterStateExists, NotifiedCreated: true}
+	deleted := ManagedObject{ID: "id-1", ClusterState: ClusterStateDeleted}
+	deletedCreated := ManagedObject{ID: "id-1", ClusterState: ClusterStateDeleted, NotifiedCreated: true}
+	done := ManagedObject{ID: "id-1", ClusterState: ClusterStateDeleted, NotifiedCreated: true, NotifiedDeleted: true}
+	failed := ManagedObject{ID: "id-1", ClusterState: ClusterStateDeleted, NotificationFailed: true}
+	awaiting := ManagedObject{ID: "id-1", ClusterState: ClusterStateExists, AwaitingAck: "created"}
+
+	tests := []struct {
+		name       string
+		obj        ManagedObject
+		transition string
+		eventType  string
+		allowed    bool
+	}{
+		{"delete an existing object", exists, TransitionDelete, "", true},
+		{"delete a deleted object", deleted, TransitionDelete, "", false},
+		{"send the created event", exists, TransitionSend, "created", true},
+		{"send the created event twice", created, TransitionSend, "created", false},
+		{"send the created event after failing", failed, TransitionSend, "created", false},
+		{"send the created event awaiting acknowledgement", awaiting, TransitionSend, "created", true},
+		{"send the deleted event of an existing object", created, TransitionSend, "deleted", false},
+		{"send the deleted event before the created event", deleted, TransitionSend, "deleted", false},
+		{"send the deleted event", deletedCreated, TransitionSend, "deleted", true},
+		{"send the deleted event twice", done, TransitionSend, "deleted", false},
+		{"send an unknown event", exists, TransitionSend, "updated", false},
+		{"await the created event", exists, TransitionAwaitAck, "created", true},
+		{"await a second event", awaiting, TransitionAwaitAck, "created", false},
+		{"await a sent event", created, TransitionAwaitAck, "created", false},
+		{"await the ephemeral event", deleted, TransitionAwaitAck, EventEphemeral, true},
+		{"await the ephemeral event of an existing object", exists, TransitionAwaitAck, EventEphemeral, false},
+		{"await the ephemeral event after the created event", deletedCreated, TransitionAwaitAck, EventEphemeral, false},
+		{"retry a pending event", exists, TransitionRetry, "", true},
+		{"retry the deleted event", deletedCreated, TransitionRetry, "", true},
+		{"retry with nothing pending", created, TransitionRetry, "", false},
+		{"retry after failing", failed, TransitionRetry, "", false},
+		{"fail", done, TransitionFail, "", true},
+		{"fail twice", failed, TransitionFail, "", false},
+		{"coalesce a deleted object", deleted, TransitionCoalesce, "", true},
+		{"coalesce an existing object", exists, TransitionCoalesce, "", false},
+		{"coalesce after the created event", deletedCreated, TransitionCoalesce, "", false},
+		{"coalesce after failing", failed, TransitionCoalesce, "", false},
+		{"unknown transition", exists, "resurrect", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.obj.CheckTransition(tt.transition, tt.eventType)
+			if tt.allowed {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrInvalidTransition)
+				assert.Contains(t, err.Error(), "of object id-1")
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package notifier
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/bryonbaker/beacon/internal/config"
+	"github.com/bryonbaker/beacon/internal/database"
+	"github.com/bryonbaker/beacon/internal/models"
+)
+
+// Results of an acknowledgement callback.
+const (
+	ackDelivered = "delivered"
+	ackRejected  = "rejected"
+	ackInvalid   = "invalid"
+)
+
+// maxAckCallbackBytes bounds the size of an acknowledgement callback body.
+const maxAckCallbackBytes = 64 << 10
+
+// errAckTimeout is recorded as the error of an attempt whose acknowledgement
+// did not arrive in time.
+var errAckTimeout = errors.New("acknowledgement timed out")
+
+// ackCallback is the body of an acknowledgement callback.
+type ackCallback struct {
+	ID     string `json:"id"`     // CloudEvent id
+	Type   string `json:"type"`   // CloudEvent type; optional
+	Status string `json:"status"` // delivered or rejected
+	Reason string `json:"reason"` // why the event was rejected; optional
+}
+
+// handleAccepted records that the destination accepted eventType and defers
+// the object until the acknowledgement is due.
+func (n *Notifier) handleAccepted(ctx context.Context, obj *models.ManagedObject, eventType string) {
+	deadline := time.Now().Add(n.cfg.Endpoint.Ack.Timeout.Duration)
+	if err := database.WithContext(ctx, n.db).MarkAwaitingAck(obj.ID, eventType, deadline); err != nil {
+		n.logger.Error("failed to record awaited acknowledgement",
+			zap.String("object_id", obj.ID),
+			zap.Error(err),
+		)
+		return
+	}
+	n.auditTransition(obj, eventType, stateAwaitingAck, nil, nil)
+	n.logger.Info("notification accepted, awaiting acknowledgement",
+		zap.String("object_id", obj.ID),
+		zap.String("event_type", eventType),
+		zap.Time("ack_deadline", deadline),
+	)
+}
+
+// ackTimedOut handles an object whose event is still awaiting
+// acknowledgement. Such an object is only pending again once the
+// acknowledgement has timed out; the event is then sent again or, with
+// endpoint.ack.onTimeout set to fail, marked as failed. It reports whether
+// the object should be processed as usual.
+func (n *Notifier) ackTimedOut(ctx context.Context, obj *models.ManagedObject) bool {
+	eventType := obj.AwaitingAck
+	if eventType == "" {
+		return true
+	}
+	// Claim the acknowledgement and, when timeouts fail the notification,
+	// mark it failed in one transaction, so that a failure leaves the event
+	// awaiting acknowledgement for the next pass.
+	fail := n.cfg.Endpoint.Ack.OnTimeout == config.AckOnTimeoutFail
+	var claimed bool
+	err := database.WithContext(ctx, n.db).WithTx(func(tx database.Database) error {
+		var err error
+		claimed, err = tx.ClaimAwaitingAck(obj.ID, eventType)
+		if err != nil || !claimed || !fail {
+			return err
+		}
+		return tx.MarkNotificationFailed(obj.ID, 0)
+	})
+	if err != nil {
+		n.logger.Error("failed to record acknowledgement timeout",
+			zap.String("object_id", obj.ID),
+			zap.Error(err),
+		)
+		return false
+	}
+	if !claimed {
+		// The acknowledgement arrived after the object was fetched.
+		return false
+	}
+
+	n.recordAttempt(ctx, obj, eventType, errAckTimeout, n.cfg.Endpoint.Ack.Timeout.Duration)
+	if fail {
+		n.logger.Error("acknowledgement timed out, notification failed",
+			zap.String("object_id", obj.ID),
+			zap.String("event_type", eventType),
+		)
+		n.auditTransition(obj, eventType, models.NotificationFailed, nil, errAckTimeout)
+		n.metrics.RecordAckTimeout(eventType, config.AckOnTimeoutFail)
+		n.metrics.RecordNotificationFailed(eventType, 0)
+		return false
+	}
+
+	n.logger.Warn("acknowledgement timed out, sending notification again",
+		zap.String("object_id", obj.ID),
+		zap.String("event_type", eventType),
+	)
+	n.metrics.RecordAckTimeout(eventType, config.AckOnTimeoutRetry)
+	return true
+}
+
+// AckHandler returns the HTTP handler for acknowledgement callbacks. A
+// receiver that answered an event with 202 Accepted posts a JSON body with
+// the event's id, optionally its type, a status of "delivered" or
+// "rejected", and optionally a reason. Callbacks must carry the
+// ENDPOINT_ACK_TOKEN as a bearer token.
+func (n *Notifier) AckHandler() http.Handler {
+	return http.HandlerFunc(n.handleAck)
+}
+
+func (n *Notifier) handleAck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAckResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !n.ackAuthorized(r) {
+		n.metrics.RecordAckCallback(ackInvalid)
+		writeAckResponse(w, http.StatusUnauthorized, "invalid or missing bearer token")
+		return
+	}
+
+	var cb ackCallback
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxAckCallbackBytes)).Decode(&cb); err != nil {
+		n.metrics.RecordAckCallback(ackInvalid)
+		writeAckResponse(w, http.StatusBadRequest, fmt.Sprintf("invalid JSON: %v", err))
+		return
+	}
+	if cb.ID == "" || (cb.Status != ackDelivered && cb.Status != ackRejected) {
+		n.metrics.RecordAckCallback(ackInvalid)
+		writeAckResponse(w, http.StatusBadRequest, `id and a status of "delivered" or "rejected" are required`)
+		return
+	}
+
+	objectID, idType := parseEventID(cb.ID)
+	obj, err := n.db.GetManagedObjectByID(objectID)
+	if errors.Is(err, sql.ErrNoRows) {
+		n.metrics.RecordAckCallback(ackInvalid)
+		writeAckResponse(w, http.StatusNotFound, "unknown event")
+		return
+	}
+	if err != nil {
+		n.logger.Error("failed to look up acknowledged event", zap.String("object_id", objectID), zap.Error(err))
+		writeAckResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	eventType := obj.AwaitingAck
+	if eventType == "" || (idType != "" && idType != eventType) ||
+		(cb.Type != "" && cb.Type != fmt.Sprintf("%s.%s", n.cfg.CloudEvents.TypePrefix, eventType)) {
+		n.metrics.RecordAckCallback(ackInvalid)
+		writeAckResponse(w, http.StatusConflict, "event is not awaiting acknowledgement")
+		return
+	}
+	// Claim the acknowledgement and record its outcome in one transaction,
+	// so that a failure leaves the event awaiting acknowledgement.
+	var claimed bool
+	err = database.WithContext(r.Context(), n.db).WithTx(func(tx database.Database) error {
+		var err error
+		claimed, err = tx.ClaimAwaitingAck(obj.ID, eventType)
+		if err != nil || !claimed {
+			return err
+		}
+		return recordAck(tx, obj, eventType, cb.Status, time.Now().UTC())
+	})
+	if errors.Is(err, models.ErrInvalidTransition) {
+		claimed = false
+	} else if err != nil {
+		n.logger.Error("failed to record acknowledgement",
+			zap.String("object_id", obj.ID),
+			zap.String("status", cb.Status),
+			zap.Error(err),
+		)
+		writeAckResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if !claimed {
+		n.metrics.RecordAckCallback(ackInvalid)
+		writeAckResponse(w, http.StatusConflict, "event is not awaiting acknowledgement")
+		return
+	}
+
+	if cb.Status == ackDelivered {
+		n.ackDelivered(obj, eventType)
+	} else {
+		n.ackRejected(r.Context(), obj, eventType, cb.Reason)
+	}
+	n.metrics.RecordAckCallback(cb.Status)
+	writeAckResponse(w, http.StatusOK, "")
+}
+
+// recordAck stores, through tx, the outcome of the acknowledgement of
+// eventType with the given status.
+func recordAck(tx database.Database, obj *models.ManagedObject, eventType, status string, at time.Time) error {
+	switch {
+	case status == ackRejected:
+		return tx.MarkNotificationFailed(obj.ID, 0)
+	case eventType == eventTypeEphemeral:
+		return tx.MarkCoalesced(obj.ID, models.CoalescedEphemeral, at)
+	default:
+		return tx.UpdateNotificationStatus(obj.ID, eventType, at)
+	}
+}
+
+// ackDelivered reports eventType as delivered after the receiver confirmed
+// it and recordAck stored it.
+func (n *Notifier) ackDelivered(obj *models.ManagedObject, eventType string) {
+	if eventType == eventTypeEphemeral {
+		n.auditTransition(obj, "", "coalesced_"+models.CoalescedEphemeral, nil, nil)
+		n.reportCoalesced(obj, models.CoalescedEphemeral)
+		return
+	}
+	n.auditTransition(obj, eventType, models.NotificationSent, nil, nil)
+	n.logger.Info("notification acknowledged",
+		zap.String("object_id", obj.ID),
+		zap.String("event_type", eventType),
+	)
+	n.recordDelivered(obj, eventType)
+}
+
+// ackRejected reports eventType as failed after the receiver rejected it and
+// recordAck stored it.
+func (n *Notifier) ackRejected(ctx context.Context, obj *models.ManagedObject, eventType, reason string) {
+	rejection := fmt.Errorf("rejected by receiver: %s", reason)
+	n.auditTransition(obj, eventType, models.NotificationFailed, nil, rejection)
+	n.logger.Error("receiver rejected notification",
+		zap.String("object_id", obj.ID),
+		zap.String("event_type", eventType),
+		zap.String("reason", reason),
+	)
+	n.recordAttempt(ctx, obj, eventType, rejection, 0)
+	n.metrics.RecordNotificationFailed(eventType, 0)
+}
+
+// ackAuthorized reports whether r carries the acknowledgement token.
+func (n *Notifier) ackAuthorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	want := n.cfg.Endpoint.Ack.Token
+	return ok && want != "" && subtle.ConstantTimeCompare([]byte(token), []byte(want)) == 1
+}
+
+// writeAckResponse writes a JSON response to an acknowledgement callback.
+func writeAckResponse(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	resp := map[string]string{"status": "ok"}
+	if code != http.StatusOK {
+		resp = map[string]string{"error": message}
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
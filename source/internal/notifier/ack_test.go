@@ -0,0 +1,192 @@
+package notifier
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/bryonbaker/beacon/internal/config"
+	"github.com/bryonbaker/beacon/internal/database"
+	"github.com/bryonbaker/beacon/internal/metrics"
+	"github.com/bryonbaker/beacon/internal/models"
+)
+
+// ackConfig returns a config with acknowledgement mode enabled.
+func ackConfig(onTimeout string) *config.Config {
+	cfg := testConfig()
+	cfg.Endpoint.Ack = config.AckConfig{
+		Enabled:   true,
+		Path:      "/ack",
+		Timeout:   config.Duration{Duration: 10 * time.Minute},
+		OnTimeout: onTimeout,
+		Token:     "ack-token",
+	}
+	cfg.Endpoint.Diagnostics.MaxAttempts = 5
+	return cfg
+}
+
+// newAckTest creates a Notifier over an in-memory database that delivers to
+// a fake sink answering 202 Accepted.
+func newAckTest(t *testing.T, cfg *config.Config) (*Notifier, *database.SQLiteDB, *fakeSink) {
+	t.Helper()
+	db, err := database.NewSQLiteDB(":memory:", zap.NewNop())
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	sink := &fakeSink{err: ErrAwaitingAck}
+	m := metrics.NewMetrics(prometheus.NewRegistry())
+	return NewNotifierWithSink(db, sink, cfg, m, zap.NewNop()), db, sink
+}
+
+// postAck sends an acknowledgement callback to n and returns the response.
+func postAck(n *Notifier, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/ack", strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	n.AckHandler().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAck_AcceptedThenDelivered(t *testing.T) {
+	n, db, sink := newAckTest(t, ackConfig(config.AckOnTimeoutRetry))
+	obj := testObject()
+	require.NoError(t, db.InsertManagedObject(obj))
+
+	n.poll(context.Background())
+
+	got, err := db.GetManagedObjectByID(obj.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "created", got.AwaitingAck)
+	assert.False(t, got.NotifiedCreated)
+	pending, err := db.GetPendingNotifications(10, models.OrderingKeyUID)
+	require.NoError(t, err)
+	assert.Empty(t, pending, "the event is not re-sent while awaiting acknowledgement")
+
+	rec := postAck(n, "ack-token", `{"id":"`+obj.ID+`:created","type":"net.bakerapps.beacon.resource.created","status":"delivered"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	got, err = db.GetManagedObjectByID(obj.ID)
+	require.NoError(t, err)
+	assert.True(t, got.NotifiedCreated)
+	assert.Empty(t, got.AwaitingAck)
+	assert.Len(t, sink.types(), 1)
+	assert.Equal(t, 1.0, testutil.ToFloat64(n.metrics.AckCallbacksTotal.WithLabelValues("delivered")))
+
+	rec = postAck(n, "ack-token", `{"id":"`+obj.ID+`","status":"delivered"}`)
+	assert.Equal(t, http.StatusConflict, rec.Code, "a second acknowledgement is refused")
+}
+
+func TestAck_Rejected(t *testing.T) {
+	n, db, _ := newAckTest(t, ackConfig(config.AckOnTimeoutRetry))
+	obj := testObject()
+	require.NoError(t, db.InsertManagedObject(obj))
+	n.poll(context.Background())
+
+	// Callbacks may name the object alone, as for events sent by earlier
+	// versions.
+	rec := postAck(n, "ack-token", `{"id":"`+obj.ID+`","status":"rejected","reason":"quota exceeded"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	got, err := db.GetManagedObjectByID(obj.ID)
+	require.NoError(t, err)
+	assert.True(t, got.NotificationFailed)
+	attempts, err := db.GetDeliveryAttempts(obj.ID)
+	require.NoError(t, err)
+	require.Len(t, attempts, 1)
+	assert.Equal(t, "rejected by receiver: quota exceeded", attempts[0].Error)
+}
+
+func TestAck_InvalidCallbacks(t *testing.T) {
+	n, db, _ := newAckTest(t, ackConfig(config.AckOnTimeoutRetry))
+	obj := testObject()
+	require.NoError(t, db.InsertManagedObject(obj))
+	n.poll(context.Background())
+
+	valid := `{"id":"` + obj.ID + `","status":"delivered"}`
+	assert.Equal(t, http.StatusUnauthorized, postAck(n, "", valid).Code)
+	assert.Equal(t, http.StatusUnauthorized, postAck(n, "wrong", valid).Code)
+	assert.Equal(t, http.StatusBadRequest, postAck(n, "ack-token", `{"id":"`+obj.ID+`","status":"done"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, postAck(n, "ack-token", `not json`).Code)
+	assert.Equal(t, http.StatusNotFound, postAck(n, "ack-token", `{"id":"unknown","status":"delivered"}`).Code)
+	assert.Equal(t, http.StatusConflict,
+		postAck(n, "ack-token", `{"id":"`+obj.ID+`","type":"net.bakerapps.beacon.resource.deleted","status":"delivered"}`).Code)
+	assert.Equal(t, http.StatusConflict, postAck(n, "ack-token", `{"id":"`+obj.ID+`:deleted","status":"delivered"}`).Code)
+
+	got, err := db.GetManagedObjectByID(obj.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "created", got.AwaitingAck, "invalid callbacks leave the event awaiting")
+	assert.Equal(t, 7.0, testutil.ToFloat64(n.metrics.AckCallbacksTotal.WithLabelValues("invalid")))
+}
+
+func TestAck_TimeoutRetries(t *testing.T) {
+	n, db, sink := newAckTest(t, ackConfig(config.AckOnTimeoutRetry))
+	obj := testObject()
+	require.NoError(t, db.InsertManagedObject(obj))
+	require.NoError(t, db.MarkAwaitingAck(obj.ID, "created", time.Now().Add(-time.Second)))
+	sink.err = nil
+
+	n.poll(context.Background())
+
+	assert.Len(t, sink.types(), 1, "the event is sent again")
+	got, err := db.GetManagedObjectByID(obj.ID)
+	require.NoError(t, err)
+	assert.True(t, got.NotifiedCreated)
+	attempts, err := db.GetDeliveryAttempts(obj.ID)
+	require.NoError(t, err)
+	require.Len(t, attempts, 1)
+	assert.Equal(t, errAckTimeout.Error(), attempts[0].Error)
+	assert.Equal(t, 1.0, testutil.ToFloat64(n.metrics.AckTimeoutsTotal.WithLabelValues("created", "retry")))
+}
+
+func TestAck_TimeoutFails(t *testing.T) {
+	n, db, sink := newAckTest(t, ackConfig(config.AckOnTimeoutFail))
+	obj := testObject()
+	require.NoError(t, db.InsertManagedObject(obj))
+	require.NoError(t, db.MarkAwaitingAck(obj.ID, "created", time.Now().Add(-time.Second)))
+
+	n.poll(context.Background())
+
+	assert.Empty(t, sink.types())
+	got, err := db.GetManagedObjectByID(obj.ID)
+	require.NoError(t, err)
+	assert.True(t, got.NotificationFailed)
+	assert.Empty(t, got.AwaitingAck)
+}
+
+func TestHTTPSink_AcceptedInAckMode(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		enabled bool
+		want    error
+	}{
+		{"ack mode", true, ErrAwaitingAck},
+		{"default", false, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := ackConfig(config.AckOnTimeoutRetry)
+			cfg.Endpoint.Ack.Enabled = tc.enabled
+			client := new(MockHTTPClient)
+			client.On("Do", mock.Anything).Return(&http.Response{
+				StatusCode: http.StatusAccepted,
+				Body:       io.NopCloser(strings.NewReader("")),
+			}, nil)
+			sink := NewHTTPSink(client, cfg, zap.NewNop())
+
+			err := sink.Send(context.Background(), buildCloudEvent(testObject(), "created", cfg))
+			assert.Equal(t, tc.want, err)
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/bryonbaker/beacon/internal/database"
+	"github.com/bryonbaker/beacon/internal/models"
+)
+
+// recordAttempt stores a failed delivery attempt of eventType with the
+// destination's response, so the reason for the failure can be read back
+// later. Only the most recent endpoint.diagnostics.maxAttempts attempts of
+// each event are kept. Successful and accepted attempts are not recorded.
+func (n *Notifier) recordAttempt(ctx context.Context, obj *models.ManagedObject, eventType string, err error, latency time.Duration) {
+	keep := n.cfg.Endpoint.Diagnostics.MaxAttempts
+	if err == nil || errors.Is(err, ErrAwaitingAck) || keep < 1 {
+		return
+	}
+
+	a := &models.DeliveryAttempt{
+		ObjectID:    obj.ID,
+		Endpoint:    n.name,
+		EventType:   eventType,
+		AttemptedAt: time.Now().UTC(),
+		Latency:     latency,
+		Error:       err.Error(),
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		a.StatusCode = statusErr.StatusCode
+		a.ResponseBody = statusErr.Body
+		a.ResponseHeaders = statusErr.Headers
+	}
+	if dbErr := database.WithContext(ctx, n.db).RecordDeliveryAttempt(a, keep); dbErr != nil {
+		n.logger.Error("failed to record delivery attempt",
+			zap.String("object_id", obj.ID),
+			zap.Error(dbErr),
+		)
+	}
+}
+
+// responseFields returns log fields describing the response captured on
+// statusErr, if any.
+func responseFields(statusErr *StatusError) []zap.Field {
+	var fields []zap.Field
+	if statusErr.Body != "" {
+		fields = append(fields, zap.String("response_body", statusErr.Body))
+	}
+	if len(statusErr.Headers) > 0 {
+		fields = append(fields, zap.Any("response_headers", statusErr.Headers))
+	}
+	return fields
+}
@@ -0,0 +1,141 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/bryonbaker/beacon/internal/audit"
+	"github.com/bryonbaker/beacon/internal/config"
+	"github.com/bryonbaker/beacon/internal/models"
+)
+
+// stateAwaitingAck is the audited state of an event the destination accepted
+// and will acknowledge later.
+const stateAwaitingAck = models.NotificationAwaitingAck
+
+// SetAuditLog records every delivery attempt and state transition in log.
+// When routing, it applies to each named endpoint. It must be called before
+// Start.
+func (n *Notifier) SetAuditLog(log *audit.Log) {
+	for _, ep := range n.endpoints {
+		ep.SetAuditLog(log)
+	}
+	n.audit = log
+	n.store = auditedStore{deliveryStore: n.store, n: n}
+}
+
+// auditedStore records the transitions made through a deliveryStore in the
+// audit log once they are stored.
+type auditedStore struct {
+	deliveryStore
+	n *Notifier
+}
+
+func (s auditedStore) sent(ctx context.Context, obj *models.ManagedObject, eventType string, at time.Time) error {
+	if err := s.deliveryStore.sent(ctx, obj, eventType, at); err != nil {
+		return err
+	}
+	s.n.auditTransition(obj, eventType, models.NotificationSent, nil, nil)
+	return nil
+}
+
+func (s auditedStore) failed(ctx context.Context, obj *models.ManagedObject, eventType string, statusCode int) error {
+	if err := s.deliveryStore.failed(ctx, obj, eventType, statusCode); err != nil {
+		return err
+	}
+	s.n.auditTransition(obj, eventType, models.NotificationFailed, nil, nil)
+	return nil
+}
+
+func (s auditedStore) retry(ctx context.Context, obj *models.ManagedObject, eventType string, next time.Time) error {
+	if err := s.deliveryStore.retry(ctx, obj, eventType, next); err != nil {
+		return err
+	}
+	s.n.auditTransition(obj, eventType, models.NotificationPending, &next, nil)
+	return nil
+}
+
+func (s auditedStore) coalesced(ctx context.Context, obj *models.ManagedObject, decision string, at time.Time) error {
+	if err := s.deliveryStore.coalesced(ctx, obj, decision, at); err != nil {
+		return err
+	}
+	s.n.auditTransition(obj, "", "coalesced_"+decision, nil, nil)
+	return nil
+}
+
+// auditAttempt records in the audit log that ce was handed to the sink, and
+// the outcome.
+func (n *Notifier) auditAttempt(obj *models.ManagedObject, eventType string, ce *models.CloudEvent, err error, latency time.Duration) {
+	if n.audit == nil {
+		return
+	}
+	e := n.auditEntry(audit.KindAttempt, obj, eventType)
+	e.EventID = ce.ID
+	e.Attempt = obj.NotificationAttempts + 1
+	e.Result = resultStatus(err)
+	e.LatencyMS = latency.Milliseconds()
+	if event, marshalErr := json.Marshal(ce); marshalErr == nil {
+		e.Event = event
+	}
+	if err != nil && !errors.Is(err, ErrAwaitingAck) {
+		e.Error = err.Error()
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		e.StatusCode = statusErr.StatusCode
+		e.ResponseBody = statusErr.Body
+		e.ResponseHeaders = statusErr.Headers
+	}
+	n.writeAudit(e)
+}
+
+// auditTransition records in the audit log that eventType of obj entered
+// state. next is when a retry is due, and err why the state was entered when
+// there was no attempt to explain it.
+func (n *Notifier) auditTransition(obj *models.ManagedObject, eventType, state string, next *time.Time, err error) {
+	if n.audit == nil {
+		return
+	}
+	e := n.auditEntry(audit.KindTransition, obj, eventType)
+	e.State = state
+	e.NextAttemptAt = next
+	if err != nil {
+		e.Error = err.Error()
+	}
+	n.writeAudit(e)
+}
+
+// auditEntry returns an audit entry describing obj and its destination.
+func (n *Notifier) auditEntry(kind string, obj *models.ManagedObject, eventType string) *audit.Entry {
+	e := &audit.Entry{
+		Kind:         kind,
+		ObjectID:     obj.ID,
+		ResourceUID:  obj.ResourceUID,
+		ResourceType: obj.ResourceType,
+		Namespace:    obj.ResourceNamespace,
+		Name:         obj.ResourceName,
+		EventType:    eventType,
+		Endpoint:     n.name,
+		Destination:  n.cfg.Endpoint.URL,
+	}
+	if n.cfg.Sink.Type == config.SinkTypeKafka {
+		e.Destination = "kafka:" + n.cfg.Sink.Kafka.Topic
+	}
+	return e
+}
+
+// writeAudit appends e to the audit log. A failure is logged; delivery
+// continues.
+func (n *Notifier) writeAudit(e *audit.Entry) {
+	if err := n.audit.Record(e); err != nil {
+		n.logger.Error("failed to write audit log entry",
+			zap.String("object_id", e.ObjectID),
+			zap.String("kind", e.Kind),
+			zap.Error(err),
+		)
+	}
+}
@@ -0,0 +1,121 @@
+package notifier
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/bryonbaker/beacon/internal/audit"
+	"github.com/bryonbaker/beacon/internal/config"
+	"github.com/bryonbaker/beacon/internal/database"
+	"github.com/bryonbaker/beacon/internal/metrics"
+	"github.com/bryonbaker/beacon/internal/models"
+)
+
+// readAudit returns the entries of the audit log at path.
+func readAudit(t *testing.T, path string) []audit.Entry {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var entries []audit.Entry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e audit.Entry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+		entries = append(entries, e)
+	}
+	require.NoError(t, scanner.Err())
+	return entries
+}
+
+func TestAuditLog_RecordsAttemptsAndTransitions(t *testing.T) {
+	db, err := database.NewSQLiteDB(":memory:", zap.NewNop())
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	auditCfg := config.AuditConfig{
+		Path:     filepath.Join(t.TempDir(), "audit.jsonl"),
+		MaxBytes: 1 << 20,
+		MaxAge:   config.Duration{Duration: time.Hour},
+	}
+	log, err := audit.Open(auditCfg, zap.NewNop())
+	require.NoError(t, err)
+	t.Cleanup(func() { log.Close() })
+
+	sink := &fakeSink{err: &StatusError{StatusCode: 503, Body: "maintenance"}}
+	cfg := testConfig()
+	n := NewNotifierWithSink(db, sink, cfg, metrics.NewMetrics(prometheus.NewRegistry()), zap.NewNop())
+	n.SetAuditLog(log)
+
+	obj := testObject()
+	require.NoError(t, db.InsertManagedObject(obj))
+	n.poll(context.Background())
+
+	// The retry is not yet due; deliver it directly.
+	sink.err = nil
+	got, err := db.GetManagedObjectByID(obj.ID)
+	require.NoError(t, err)
+	n.processNotification(context.Background(), got)
+
+	entries := readAudit(t, auditCfg.Path)
+	require.Len(t, entries, 4)
+
+	failedAttempt := entries[0]
+	assert.Equal(t, audit.KindAttempt, failedAttempt.Kind)
+	assert.Equal(t, obj.ID, failedAttempt.ObjectID)
+	assert.Equal(t, "created", failedAttempt.EventType)
+	assert.Equal(t, cfg.Endpoint.URL, failedAttempt.Destination)
+	assert.Equal(t, 1, failedAttempt.Attempt)
+	assert.Equal(t, "retry", failedAttempt.Result)
+	assert.Equal(t, 503, failedAttempt.StatusCode)
+	assert.Equal(t, "maintenance", failedAttempt.ResponseBody)
+	assert.Equal(t, sink.events[0].ID, failedAttempt.EventID)
+	assert.Contains(t, string(failedAttempt.Event), `"id":"`+sink.events[0].ID+`"`)
+
+	assert.Equal(t, audit.KindTransition, entries[1].Kind)
+	assert.Equal(t, models.NotificationPending, entries[1].State)
+	assert.NotNil(t, entries[1].NextAttemptAt)
+
+	assert.Equal(t, 2, entries[2].Attempt)
+	assert.Equal(t, "success", entries[2].Result)
+	assert.Empty(t, entries[2].Error)
+
+	assert.Equal(t, models.NotificationSent, entries[3].State)
+
+	result, err := audit.Verify(auditCfg.Path)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), result.Entries)
+}
+
+func TestAuditLog_RecordsAcknowledgement(t *testing.T) {
+	n, db, _ := newAckTest(t, ackConfig(config.AckOnTimeoutRetry))
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	log, err := audit.Open(config.AuditConfig{Path: path, MaxBytes: 1 << 20, MaxAge: config.Duration{Duration: time.Hour}}, zap.NewNop())
+	require.NoError(t, err)
+	t.Cleanup(func() { log.Close() })
+	n.SetAuditLog(log)
+
+	obj := testObject()
+	require.NoError(t, db.InsertManagedObject(obj))
+	n.poll(context.Background())
+	rec := postAck(n, "ack-token", `{"id":"`+obj.ID+`","status":"rejected","reason":"unknown tenant"}`)
+	require.Equal(t, 200, rec.Code)
+
+	entries := readAudit(t, path)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "accepted", entries[0].Result)
+	assert.Equal(t, stateAwaitingAck, entries[1].State)
+	assert.Equal(t, models.NotificationFailed, entries[2].State)
+	assert.Equal(t, "rejected by receiver: unknown tenant", entries[2].Error)
+}
@@ -0,0 +1,297 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/bryonbaker/beacon/internal/config"
+	"github.com/bryonbaker/beacon/internal/models"
+	"github.com/bryonbaker/beacon/internal/tracing"
+)
+
+// batchContentType is the CloudEvents JSON batch format media type.
+const batchContentType = "application/cloudevents-batch+json; charset=UTF-8"
+
+// maxBatchResultsBytes bounds how much of a batch response body is read when
+// looking for per-item results.
+const maxBatchResultsBytes = 1 << 20
+
+// batching reports whether each poll cycle's events are handed to the sink
+// together. HTTP batching is opt-in; the Kafka sink always produces a cycle's
+// records together.
+func (n *Notifier) batching() bool {
+	return n.cfg.Endpoint.Batch.Enabled || n.cfg.Sink.Type == config.SinkTypeKafka
+}
+
+// processBatch builds the events for the pending objects, delivers them with
+// a single SendBatch call, and records the outcome of each. The batch is
+// traced in one span linked to the traces in which its events were detected;
+// each event carries the trace context of its own detection.
+func (n *Notifier) processBatch(ctx context.Context, pending []*models.ManagedObject) {
+	if len(pending) == 0 {
+		return
+	}
+	var links []trace.Link
+	for _, obj := range pending {
+		if sc := tracing.SpanContext(traceParentOf(obj, eventTypeFor(obj))); sc.IsValid() {
+			links = append(links, trace.Link{SpanContext: sc})
+		}
+	}
+	ctx, span := n.tracer.Start(ctx, "notifier.processBatch",
+		trace.WithSpanKind(trace.SpanKindProducer), trace.WithLinks(links...))
+	defer span.End()
+
+	var objs []*models.ManagedObject
+	var eventTypes []string
+	var events []*models.CloudEvent
+	for _, obj := range pending {
+		if !n.ackTimedOut(ctx, obj) {
+			continue
+		}
+		eventType := n.nextEvent(ctx, obj)
+		if eventType == "" {
+			continue
+		}
+		ce := n.cloudEvent(obj, eventType)
+		setTraceParent(ce, traceParentOf(obj, eventType))
+		if !n.validatePayload(ctx, obj, eventType, ce) {
+			continue
+		}
+		objs = append(objs, obj)
+		eventTypes = append(eventTypes, eventType)
+		events = append(events, ce)
+	}
+	span.SetAttributes(attribute.Int("beacon.batch.size", len(events)))
+	if len(events) == 0 {
+		return
+	}
+
+	if !n.breaker.allow() {
+		return
+	}
+	start := time.Now()
+	results := n.sink.SendBatch(ctx, events)
+	latency := time.Since(start)
+	n.recordEndpointResult(batchFailed(results))
+	failed := 0
+	for i, obj := range objs {
+		if results[i] != nil && !errors.Is(results[i], ErrAwaitingAck) {
+			failed++
+		}
+		n.metrics.RecordNotificationDuration(obj.ResourceType, eventTypes[i], resultStatus(results[i]), latency)
+		n.recordAttempt(ctx, obj, eventTypes[i], results[i], latency)
+		n.auditAttempt(obj, eventTypes[i], events[i], results[i], latency)
+		n.handleResult(ctx, obj, eventTypes[i], results[i])
+	}
+	span.SetAttributes(attribute.Int("beacon.batch.failed", failed))
+	if failed > 0 {
+		span.SetStatus(codes.Error, fmt.Sprintf("%d of %d events failed", failed, len(events)))
+	}
+}
+
+// batchFailed reports whether a SendBatch call counts as a failed request
+// for the circuit breaker: every event failed because the endpoint was
+// unavailable.
+func batchFailed(results []error) bool {
+	for _, err := range results {
+		if !isEndpointFailure(err) {
+			return false
+		}
+	}
+	return len(results) > 0
+}
+
+// batchItem is one encoded event awaiting batched delivery.
+type batchItem struct {
+	index int    // position in the SendBatch input
+	id    string // CloudEvent id
+	event []byte // structured-mode encoding
+}
+
+// batchResults is the response body an endpoint may return to report the
+// outcome of each event in a batch under the perItem policy:
+//
+//	{"results": [{"id": "<event id>", "status": 200}, ...]}
+//
+// Events that are not listed take the status of the response itself.
+type batchResults struct {
+	Results []struct {
+		ID     string `json:"id"`
+		Status int    `json:"status"`
+	} `json:"results"`
+}
+
+// SendBatch delivers events using the CloudEvents JSON batch format, in as
+// few requests as the configured event and byte limits allow.
+func (s *HTTPSink) SendBatch(ctx context.Context, events []*models.CloudEvent) []error {
+	results := make([]error, len(events))
+	items := make([]batchItem, 0, len(events))
+	for i, ce := range events {
+		event, err := json.Marshal(ce)
+		if err != nil {
+			results[i] = &PermanentError{Err: err}
+			continue
+		}
+		items = append(items, batchItem{index: i, id: ce.ID, event: event})
+	}
+
+	batchCfg := s.cfg.Endpoint.Batch
+	for _, batch := range splitBatches(items, batchCfg.MaxEvents, batchCfg.MaxBytes) {
+		if err := ctx.Err(); err != nil {
+			for _, item := range batch {
+				results[item.index] = err
+			}
+			continue
+		}
+		for i, err := range s.sendBatch(ctx, batch) {
+			results[batch[i].index] = err
+		}
+	}
+	return results
+}
+
+// splitBatches groups items in order so that no batch exceeds maxEvents
+// events or maxBytes of encoded JSON array. An event that is larger than
+// maxBytes on its own is sent as a batch of one.
+func splitBatches(items []batchItem, maxEvents, maxBytes int) [][]batchItem {
+	var batches [][]batchItem
+	var current []batchItem
+	size := 2 // enclosing brackets
+	for _, item := range items {
+		added := len(item.event)
+		if len(current) > 0 {
+			added++ // separating comma
+		}
+		if len(current) > 0 && (len(current) >= maxEvents || size+added > maxBytes) {
+			batches = append(batches, current)
+			current, size = nil, 2
+			added = len(item.event)
+		}
+		current = append(current, item)
+		size += added
+	}
+	if len(current) > 0 {
+		batches = append(batches, current)
+	}
+	return batches
+}
+
+// encodeBatch joins the encoded events into a JSON array.
+func encodeBatch(batch []batchItem) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, item := range batch {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(item.event)
+	}
+	buf.WriteByte(']')
+	return buf.Bytes()
+}
+
+// batchID returns the message id of a batch. A batch has no single event id,
+// so it is a digest of the ids of its events: a retried batch of the same
+// events is the same message.
+func batchID(batch []batchItem) string {
+	h := sha256.New()
+	for _, item := range batch {
+		h.Write([]byte(item.id))
+		h.Write([]byte{0})
+	}
+	return "batch_" + hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// sendBatch delivers one batch request and returns the result for each item.
+func (s *HTTPSink) sendBatch(ctx context.Context, batch []batchItem) []error {
+	req, err := s.newRequest(encodeBatch(batch), batchContentType, nil)
+	if err != nil {
+		return repeatError(len(batch), &PermanentError{Err: err})
+	}
+	tracing.Inject(ctx, req.Header)
+
+	sendCtx, cancel := context.WithTimeout(ctx, s.cfg.Endpoint.Timeout.Duration)
+	defer cancel()
+
+	resp, err := s.do(sendCtx, req, batchID(batch))
+	if err != nil {
+		return repeatError(len(batch), err)
+	}
+	defer resp.Body.Close()
+
+	s.logger.Debug("batch notification response",
+		zap.Int("batch_size", len(batch)),
+		zap.Int("status_code", resp.StatusCode),
+	)
+
+	var statuses map[string]int
+	success := resp.StatusCode >= 200 && resp.StatusCode < 300
+	if success && s.cfg.Endpoint.Batch.PartialFailure == config.BatchPartialFailurePerItem {
+		statuses = s.readBatchResults(resp.Body)
+	}
+
+	// The response body, if not consumed for per-item results, explains a
+	// failure that applies to every event.
+	var response StatusError
+	if !success {
+		s.captureResponse(&response, resp)
+	}
+
+	retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	results := make([]error, len(batch))
+	for i, item := range batch {
+		status, ok := statuses[item.id]
+		if !ok {
+			status = resp.StatusCode
+		}
+		if s.awaitsAck(status) {
+			results[i] = ErrAwaitingAck
+			continue
+		}
+		if status < 200 || status >= 300 {
+			// Retry-After describes the response, so it only applies to
+			// events that take the response status.
+			statusErr := &StatusError{StatusCode: status}
+			if !ok {
+				statusErr.RetryAfter = retryAfter
+				statusErr.Body, statusErr.Headers = response.Body, response.Headers
+			}
+			results[i] = statusErr
+		}
+	}
+	return results
+}
+
+// readBatchResults parses per-item results from a batch response body. A body
+// that is empty or not in the results format yields no per-item statuses, so
+// every event takes the response status.
+func (s *HTTPSink) readBatchResults(body io.Reader) map[string]int {
+	var results batchResults
+	if err := json.NewDecoder(io.LimitReader(body, maxBatchResultsBytes)).Decode(&results); err != nil {
+		if err != io.EOF {
+			s.logger.Warn("failed to parse batch results, applying response status to all events", zap.Error(err))
+		}
+		return nil
+	}
+
+	statuses := make(map[string]int, len(results.Results))
+	for _, r := range results.Results {
+		if r.ID == "" || r.Status < 100 || r.Status > 599 {
+			continue
+		}
+		statuses[r.ID] = r.Status
+	}
+	return statuses
+}
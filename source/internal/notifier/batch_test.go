@@ -0,0 +1,217 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bryonbaker/beacon/internal/config"
+	"github.com/bryonbaker/beacon/internal/database"
+	"github.com/bryonbaker/beacon/internal/models"
+)
+
+// batchTestConfig returns a config with batch mode enabled.
+func batchTestConfig(policy string) *config.Config {
+	cfg := testConfig()
+	cfg.Endpoint.Batch = config.BatchConfig{
+		Enabled:        true,
+		MaxEvents:      100,
+		MaxBytes:       1 << 20,
+		PartialFailure: policy,
+	}
+	return cfg
+}
+
+// batchObjects returns n pending objects with distinct IDs.
+func batchObjects(ids ...string) []*models.ManagedObject {
+	objs := make([]*models.ManagedObject, 0, len(ids))
+	for _, id := range ids {
+		obj := testObject()
+		obj.ID = id
+		objs = append(objs, obj)
+	}
+	return objs
+}
+
+func response(status int, body string) *http.Response {
+	return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(body))}
+}
+
+func TestSplitBatches_MaxEvents(t *testing.T) {
+	items := make([]batchItem, 5)
+	for i := range items {
+		items[i] = batchItem{event: []byte(`{}`)}
+	}
+	batches := splitBatches(items, 2, 1<<20)
+	require.Len(t, batches, 3)
+	assert.Len(t, batches[0], 2)
+	assert.Len(t, batches[2], 1)
+}
+
+func TestSplitBatches_MaxBytes(t *testing.T) {
+	event := []byte(`{"id":"0123456789"}`) // 19 bytes
+	items := []batchItem{{event: event}, {event: event}, {event: event}}
+
+	// Two events encode to 2 + 19 + 1 + 19 = 41 bytes.
+	batches := splitBatches(items, 100, 41)
+	require.Len(t, batches, 2)
+	assert.Len(t, batches[0], 2)
+	assert.Len(t, batches[1], 1)
+
+	// An oversized event is still sent on its own.
+	batches = splitBatches(items, 100, 10)
+	assert.Len(t, batches, 3)
+}
+
+func TestProcessBatch_AllOrNothingSuccess(t *testing.T) {
+	cfg := batchTestConfig(config.BatchPartialFailureAllOrNothing)
+	mockDB := new(database.MockDatabase)
+	mockClient := new(MockHTTPClient)
+	n, _ := newTestNotifier(cfg, mockDB, mockClient)
+
+	var body []byte
+	mockClient.On("Do", mock.Anything).Run(func(args mock.Arguments) {
+		req := args.Get(0).(*http.Request)
+		assert.Equal(t, batchContentType, req.Header.Get("Content-Type"))
+		body, _ = io.ReadAll(req.Body)
+	}).Return(response(http.StatusOK, ""), nil).Once()
+	for _, id := range []string{"a", "b", "c"} {
+		mockDB.On("UpdateNotificationStatus", id, "created", mock.AnythingOfType("time.Time")).Return(nil)
+	}
+
+	n.processBatch(context.Background(), batchObjects("a", "b", "c"))
+
+	var events []map[string]interface{}
+	require.NoError(t, json.Unmarshal(body, &events))
+	require.Len(t, events, 3)
+	assert.Equal(t, "a:created", events[0]["id"])
+	assert.Equal(t, "1.0", events[0]["specversion"])
+	mockDB.AssertExpectations(t)
+	mockClient.AssertExpectations(t)
+}
+
+func TestProcessBatch_AllOrNothingIgnoresItemResults(t *testing.T) {
+	cfg := batchTestConfig(config.BatchPartialFailureAllOrNothing)
+	mockDB := new(database.MockDatabase)
+	mockClient := new(MockHTTPClient)
+	n, _ := newTestNotifier(cfg, mockDB, mockClient)
+
+	mockClient.On("Do", mock.Anything).
+		Return(response(http.StatusOK, `{"results":[{"id":"a:created","status":500}]}`), nil)
+	mockDB.On("UpdateNotificationStatus", "a", "created", mock.AnythingOfType("time.Time")).Return(nil)
+	mockDB.On("UpdateNotificationStatus", "b", "created", mock.AnythingOfType("time.Time")).Return(nil)
+
+	n.processBatch(context.Background(), batchObjects("a", "b"))
+
+	mockDB.AssertExpectations(t)
+	mockDB.AssertNotCalled(t, "IncrementNotificationAttempts", mock.Anything, mock.Anything)
+}
+
+func TestProcessBatch_PerItemResults(t *testing.T) {
+	cfg := batchTestConfig(config.BatchPartialFailurePerItem)
+	mockDB := new(database.MockDatabase)
+	mockClient := new(MockHTTPClient)
+	n, _ := newTestNotifier(cfg, mockDB, mockClient)
+
+	mockClient.On("Do", mock.Anything).Return(response(http.StatusMultiStatus,
+		`{"results":[{"id":"a:created","status":202},{"id":"b:created","status":503},{"id":"c:created","status":422}]}`), nil)
+	mockDB.On("UpdateNotificationStatus", "a", "created", mock.AnythingOfType("time.Time")).Return(nil)
+	mockDB.On("IncrementNotificationAttempts", "b", mock.AnythingOfType("time.Time")).Return(nil)
+	mockDB.On("MarkNotificationFailed", "c", 422).Return(nil)
+	// "d" is not listed and takes the response status.
+	mockDB.On("UpdateNotificationStatus", "d", "created", mock.AnythingOfType("time.Time")).Return(nil)
+
+	n.processBatch(context.Background(), batchObjects("a", "b", "c", "d"))
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestProcessBatch_PerItemUnparseableBodyAppliesResponseStatus(t *testing.T) {
+	cfg := batchTestConfig(config.BatchPartialFailurePerItem)
+	mockDB := new(database.MockDatabase)
+	mockClient := new(MockHTTPClient)
+	n, _ := newTestNotifier(cfg, mockDB, mockClient)
+
+	mockClient.On("Do", mock.Anything).Return(response(http.StatusOK, "accepted"), nil)
+	mockDB.On("UpdateNotificationStatus", "a", "created", mock.AnythingOfType("time.Time")).Return(nil)
+
+	n.processBatch(context.Background(), batchObjects("a"))
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestProcessBatch_ErrorStatusAppliesToAll(t *testing.T) {
+	cfg := batchTestConfig(config.BatchPartialFailurePerItem)
+	mockDB := new(database.MockDatabase)
+	mockClient := new(MockHTTPClient)
+	n, _ := newTestNotifier(cfg, mockDB, mockClient)
+
+	mockClient.On("Do", mock.Anything).
+		Return(response(http.StatusServiceUnavailable, `{"results":[{"id":"a:created","status":200}]}`), nil)
+	mockDB.On("IncrementNotificationAttempts", "a", mock.AnythingOfType("time.Time")).Return(nil)
+	mockDB.On("IncrementNotificationAttempts", "b", mock.AnythingOfType("time.Time")).Return(nil)
+
+	n.processBatch(context.Background(), batchObjects("a", "b"))
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestProcessBatch_NetworkErrorIncrementsAll(t *testing.T) {
+	cfg := batchTestConfig(config.BatchPartialFailureAllOrNothing)
+	mockDB := new(database.MockDatabase)
+	mockClient := new(MockHTTPClient)
+	n, _ := newTestNotifier(cfg, mockDB, mockClient)
+
+	mockClient.On("Do", mock.Anything).Return(nil, errors.New("connection refused"))
+	mockDB.On("IncrementNotificationAttempts", "a", mock.AnythingOfType("time.Time")).Return(nil)
+	mockDB.On("IncrementNotificationAttempts", "b", mock.AnythingOfType("time.Time")).Return(nil)
+
+	n.processBatch(context.Background(), batchObjects("a", "b"))
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestProcessBatch_SplitsIntoMultipleRequests(t *testing.T) {
+	cfg := batchTestConfig(config.BatchPartialFailureAllOrNothing)
+	cfg.Endpoint.Batch.MaxEvents = 2
+	mockDB := new(database.MockDatabase)
+	mockClient := new(MockHTTPClient)
+	n, _ := newTestNotifier(cfg, mockDB, mockClient)
+
+	mockClient.On("Do", mock.Anything).Return(response(http.StatusOK, ""), nil).Once()
+	mockClient.On("Do", mock.Anything).Return(response(http.StatusOK, ""), nil).Once()
+	mockDB.On("UpdateNotificationStatus", mock.Anything, "created", mock.AnythingOfType("time.Time")).Return(nil)
+
+	n.processBatch(context.Background(), batchObjects("a", "b", "c"))
+
+	mockClient.AssertNumberOfCalls(t, "Do", 2)
+	mockDB.AssertNumberOfCalls(t, "UpdateNotificationStatus", 3)
+}
+
+func TestSendBatch_FailedResponseCapturedForEachEvent(t *testing.T) {
+	cfg := batchTestConfig(config.BatchPartialFailurePerItem)
+	cfg.Endpoint.Diagnostics.MaxBodyBytes = 1024
+	mockDB := new(database.MockDatabase)
+	mockClient := new(MockHTTPClient)
+	n, _ := newTestNotifier(cfg, mockDB, mockClient)
+
+	mockClient.On("Do", mock.Anything).Return(response(http.StatusBadRequest, "batch too large"), nil)
+
+	events := []*models.CloudEvent{n.cloudEvent(batchObjects("a")[0], "created"), n.cloudEvent(batchObjects("b")[0], "created")}
+	results := httpSink(n).SendBatch(context.Background(), events)
+
+	require.Len(t, results, 2)
+	for _, err := range results {
+		var statusErr *StatusError
+		require.True(t, errors.As(err, &statusErr))
+		assert.Equal(t, "batch too large", statusErr.Body)
+	}
+}
@@ -0,0 +1,229 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/bryonbaker/beacon/internal/config"
+)
+
+// circuitState is the state of the endpoint circuit breaker.
+type circuitState int
+
+const (
+	// circuitClosed lets every delivery through.
+	circuitClosed circuitState = iota
+	// circuitOpen blocks all deliveries until the open duration has passed.
+	circuitOpen
+	// circuitHalfOpen lets a single probe delivery through.
+	circuitHalfOpen
+)
+
+// String returns the state name reported in logs and readiness details.
+func (s circuitState) String() string {
+	switch s {
+	case circuitOpen:
+		return "open"
+	case circuitHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreaker tracks endpoint failures and, when enabled, stops
+// deliveries while the endpoint is failing. It counts consecutive failures
+// even when disabled so they can be reported.
+type circuitBreaker struct {
+	cfg      config.CircuitBreakerConfig
+	now      func() time.Time
+	onChange func(from, to circuitState)
+
+	mu          sync.Mutex
+	state       circuitState
+	openedAt    time.Time
+	probing     bool
+	consecutive int
+
+	// window is a ring of the most recent outcomes; true is a failure.
+	window   []bool
+	next     int
+	filled   int
+	failures int
+}
+
+// newCircuitBreaker creates a closed circuitBreaker. onChange, if not nil,
+// is called with the breaker's lock held whenever the state changes.
+func newCircuitBreaker(cfg config.CircuitBreakerConfig, onChange func(from, to circuitState)) *circuitBreaker {
+	size := cfg.WindowSize
+	if size < 1 {
+		size = 1
+	}
+	return &circuitBreaker{
+		cfg:      cfg,
+		now:      time.Now,
+		onChange: onChange,
+		window:   make([]bool, size),
+	}
+}
+
+// currentState returns the breaker state, moving an open breaker to
+// half-open once the open duration has passed.
+func (b *circuitBreaker) currentState() circuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.checkOpenExpired()
+	return b.state
+}
+
+// openUntil returns when an open breaker will allow a probe, or the zero time
+// if it is not open.
+func (b *circuitBreaker) openUntil() time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.checkOpenExpired()
+	if b.state != circuitOpen {
+		return time.Time{}
+	}
+	return b.openedAt.Add(b.cfg.OpenDuration.Duration)
+}
+
+// allow reports whether a delivery may be sent now. In the half-open state
+// only one probe is allowed until its outcome is recorded.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.checkOpenExpired()
+
+	switch b.state {
+	case circuitOpen:
+		return false
+	case circuitHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// release gives back a probe allowed in the half-open state that was not
+// sent, e.g. because the event was suppressed or failed validation, so that
+// a later delivery can probe the endpoint instead.
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// record updates the breaker with the outcome of one delivery request.
+func (b *circuitBreaker) record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if failed {
+		b.consecutive++
+	} else {
+		b.consecutive = 0
+	}
+	if !b.cfg.Enabled {
+		return
+	}
+
+	if b.state == circuitHalfOpen {
+		b.probing = false
+		if failed {
+			b.open()
+		} else {
+			b.resetWindow()
+			b.transition(circuitClosed)
+		}
+		return
+	}
+	if b.state != circuitClosed {
+		return
+	}
+
+	if b.filled == len(b.window) && b.window[b.next] {
+		b.failures--
+	}
+	b.window[b.next] = failed
+	b.next = (b.next + 1) % len(b.window)
+	if b.filled < len(b.window) {
+		b.filled++
+	}
+	if failed {
+		b.failures++
+	}
+
+	if failed && b.tripped() {
+		b.open()
+	}
+}
+
+// consecutiveFailures returns the number of failed requests since the last
+// success.
+func (b *circuitBreaker) consecutiveFailures() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.consecutive
+}
+
+// tripped reports whether the recorded failures exceed either threshold.
+func (b *circuitBreaker) tripped() bool {
+	if b.cfg.ConsecutiveFailures > 0 && b.consecutive >= b.cfg.ConsecutiveFailures {
+		return true
+	}
+	return b.cfg.FailureRate > 0 && b.filled == len(b.window) &&
+		float64(b.failures)/float64(b.filled) >= b.cfg.FailureRate
+}
+
+// open moves the breaker to the open state and restarts the open timer.
+func (b *circuitBreaker) open() {
+	b.openedAt = b.now()
+	b.transition(circuitOpen)
+}
+
+// checkOpenExpired moves an open breaker to half-open once the open
+// duration has passed.
+func (b *circuitBreaker) checkOpenExpired() {
+	if b.state == circuitOpen && !b.now().Before(b.openedAt.Add(b.cfg.OpenDuration.Duration)) {
+		b.transition(circuitHalfOpen)
+	}
+}
+
+// resetWindow discards the recorded outcomes.
+func (b *circuitBreaker) resetWindow() {
+	for i := range b.window {
+		b.window[i] = false
+	}
+	b.next, b.filled, b.failures = 0, 0, 0
+}
+
+// transition changes the state and notifies the observer.
+func (b *circuitBreaker) transition(to circuitState) {
+	from := b.state
+	b.state = to
+	if from != to && b.onChange != nil {
+		b.onChange(from, to)
+	}
+}
+
+// isEndpointFailure reports whether a delivery result means the endpoint is
+// unavailable: a transport error or a retriable status. Events the endpoint
+// rejected, and deliveries interrupted by shutdown, do not count.
+func isEndpointFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, ErrAwaitingAck) {
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return isRetriable(statusErr.StatusCode)
+	}
+	var permErr *PermanentError
+	return !errors.As(err, &permErr)
+}
@@ -0,0 +1,277 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/bryonbaker/beacon/internal/config"
+	"github.com/bryonbaker/beacon/internal/database"
+	"github.com/bryonbaker/beacon/internal/models"
+)
+
+// testBreakerConfig returns an enabled breaker configuration.
+func testBreakerConfig() config.CircuitBreakerConfig {
+	return config.CircuitBreakerConfig{
+		Enabled:             true,
+		ConsecutiveFailures: 3,
+		WindowSize:          10,
+		OpenDuration:        config.Duration{Duration: 30 * time.Second},
+	}
+}
+
+// fakeClock is a settable time source.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func TestCircuitBreaker_OpensAfterConsecutiveFailures(t *testing.T) {
+	var changes []string
+	b := newCircuitBreaker(testBreakerConfig(), func(_, to circuitState) { changes = append(changes, to.String()) })
+
+	b.record(true)
+	b.record(true)
+	assert.True(t, b.allow())
+	b.record(true)
+
+	assert.Equal(t, circuitOpen, b.currentState())
+	assert.False(t, b.allow())
+	assert.Equal(t, 3, b.consecutiveFailures())
+	assert.Equal(t, []string{"open"}, changes)
+}
+
+func TestCircuitBreaker_SuccessResetsConsecutiveFailures(t *testing.T) {
+	b := newCircuitBreaker(testBreakerConfig(), nil)
+
+	for i := 0; i < 5; i++ {
+		b.record(true)
+		b.record(true)
+		b.record(false)
+	}
+
+	assert.Equal(t, circuitClosed, b.currentState())
+	assert.Zero(t, b.consecutiveFailures())
+}
+
+func TestCircuitBreaker_OpensOnFailureRate(t *testing.T) {
+	cfg := testBreakerConfig()
+	cfg.ConsecutiveFailures = 0
+	cfg.FailureRate = 0.5
+	cfg.WindowSize = 4
+	b := newCircuitBreaker(cfg, nil)
+
+	b.record(true)
+	b.record(false)
+	b.record(true)
+	assert.Equal(t, circuitClosed, b.currentState(), "the rate is not evaluated until the window is full")
+	b.record(false)
+	assert.Equal(t, circuitClosed, b.currentState(), "the breaker only trips on a failure")
+	b.record(true)
+
+	assert.Equal(t, circuitOpen, b.currentState())
+}
+
+func TestCircuitBreaker_HalfOpenAllowsSingleProbe(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	var changes []string
+	b := newCircuitBreaker(testBreakerConfig(), func(_, to circuitState) { changes = append(changes, to.String()) })
+	b.now = clock.now
+
+	for i := 0; i < 3; i++ {
+		b.record(true)
+	}
+	clock.t = clock.t.Add(29 * time.Second)
+	assert.False(t, b.allow())
+
+	clock.t = clock.t.Add(time.Second)
+	assert.Equal(t, circuitHalfOpen, b.currentState())
+	assert.True(t, b.allow(), "one probe is allowed")
+	assert.False(t, b.allow(), "only one probe is allowed")
+
+	b.record(false)
+	assert.Equal(t, circuitClosed, b.currentState())
+	assert.True(t, b.allow())
+	assert.Equal(t, []string{"open", "half-open", "closed"}, changes)
+}
+
+func TestCircuitBreaker_ReleasedProbeAllowsAnother(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	b := newCircuitBreaker(testBreakerConfig(), nil)
+	b.now = clock.now
+
+	for i := 0; i < 3; i++ {
+		b.record(true)
+	}
+	clock.t = clock.t.Add(30 * time.Second)
+	assert.True(t, b.allow())
+	b.release()
+
+	assert.Equal(t, circuitHalfOpen, b.currentState())
+	assert.True(t, b.allow(), "a released probe can be made again")
+}
+
+func TestCircuitBreaker_FailedProbeReopens(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	b := newCircuitBreaker(testBreakerConfig(), nil)
+	b.now = clock.now
+
+	for i := 0; i < 3; i++ {
+		b.record(true)
+	}
+	clock.t = clock.t.Add(30 * time.Second)
+	assert.True(t, b.allow())
+	b.record(true)
+
+	assert.Equal(t, circuitOpen, b.currentState())
+	clock.t = clock.t.Add(29 * time.Second)
+	assert.False(t, b.allow(), "the open timer restarts after a failed probe")
+}
+
+func TestCircuitBreaker_DisabledNeverOpens(t *testing.T) {
+	cfg := testBreakerConfig()
+	cfg.Enabled = false
+	b := newCircuitBreaker(cfg, nil)
+
+	for i := 0; i < 10; i++ {
+		b.record(true)
+	}
+
+	assert.True(t, b.allow())
+	assert.Equal(t, 10, b.consecutiveFailures())
+}
+
+func TestIsEndpointFailure(t *testing.T) {
+	assert.False(t, isEndpointFailure(nil))
+	assert.True(t, isEndpointFailure(errors.New("connection refused")))
+	assert.True(t, isEndpointFailure(&StatusError{StatusCode: http.StatusServiceUnavailable}))
+	assert.False(t, isEndpointFailure(&StatusError{StatusCode: http.StatusBadRequest}))
+	assert.False(t, isEndpointFailure(&PermanentError{Err: errors.New("too large")}))
+	assert.False(t, isEndpointFailure(context.Canceled))
+}
+
+func TestPoll_CircuitOpenSkipsDelivery(t *testing.T) {
+	cfg := testConfig()
+	cfg.Endpoint.CircuitBreaker = testBreakerConfig()
+	mockDB := new(database.MockDatabase)
+	n, _ := newTestNotifier(cfg, mockDB, new(MockHTTPClient))
+
+	var states []string
+	n.OnCircuitStateChange(func(_, state string) { states = append(states, state) })
+	for i := 0; i < 3; i++ {
+		n.recordEndpointResult(true)
+	}
+	mockDB.On("CountPendingNotifications").Return(nil, nil)
+
+	n.poll(context.Background())
+
+	mockDB.AssertNotCalled(t, "GetPendingNotifications", mock.Anything, mock.Anything)
+	assert.Equal(t, []string{"closed", "open"}, states)
+	assert.Equal(t, 0.0, testutil.ToFloat64(n.metrics.EndpointUp))
+	assert.Equal(t, 3.0, testutil.ToFloat64(n.metrics.EndpointConsecutiveFailures))
+}
+
+func TestPoll_CircuitHalfOpenSendsOneProbe(t *testing.T) {
+	cfg := testConfig()
+	cfg.Endpoint.CircuitBreaker = testBreakerConfig()
+	cfg.Endpoint.Batch.Enabled = true
+	mockDB := new(database.MockDatabase)
+	mockClient := new(MockHTTPClient)
+	n, _ := newTestNotifier(cfg, mockDB, mockClient)
+
+	clock := &fakeClock{t: time.Now()}
+	n.breaker.now = clock.now
+	for i := 0; i < 3; i++ {
+		n.recordEndpointResult(true)
+	}
+	clock.t = clock.t.Add(30 * time.Second)
+
+	obj := testObject()
+	mockDB.On("CountPendingNotifications").Return(nil, nil)
+	mockDB.On("GetPendingNotifications", 1, mock.Anything).Return([]*models.ManagedObject{obj}, nil)
+	mockDB.On("UpdateNotificationStatus", obj.ID, "created", mock.AnythingOfType("time.Time")).Return(nil)
+	mockClient.On("Do", mock.Anything).Return(&http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil)
+
+	n.poll(context.Background())
+
+	mockDB.AssertExpectations(t)
+	mockClient.AssertNumberOfCalls(t, "Do", 1)
+	assert.Equal(t, circuitClosed, n.breaker.currentState())
+	assert.Equal(t, 1.0, testutil.ToFloat64(n.metrics.EndpointUp))
+	assert.Equal(t, 0.0, testutil.ToFloat64(n.metrics.EndpointConsecutiveFailures))
+}
+
+func TestPoll_CircuitHalfOpenProbeNotSent(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   func() *config.Config
+		obj   func() *models.ManagedObject
+		setup func(*database.MockDatabase, *models.ManagedObject)
+	}{
+		{
+			name: "schema violation",
+			cfg: func() *config.Config {
+				cfg := testConfig()
+				cfg.CloudEvents.Schema.Validate = true
+				return cfg
+			},
+			obj: func() *models.ManagedObject {
+				obj := testObject()
+				obj.ResourceUID = ""
+				return obj
+			},
+			setup: func(mockDB *database.MockDatabase, obj *models.ManagedObject) {
+				mockDB.On("MarkNotificationFailed", obj.ID, 0).Return(nil)
+			},
+		},
+		{
+			name: "suppressed",
+			cfg:  func() *config.Config { return coalescingConfig(config.CoalesceModeSuppress) },
+			obj:  func() *models.ManagedObject { return shortLivedObject(5 * time.Second) },
+			setup: func(mockDB *database.MockDatabase, obj *models.ManagedObject) {
+				mockDB.On("MarkCoalesced", obj.ID, models.CoalescedSuppressed, mock.AnythingOfType("time.Time")).Return(nil)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg()
+			cfg.Endpoint.CircuitBreaker = testBreakerConfig()
+			mockDB := new(database.MockDatabase)
+			mockClient := new(MockHTTPClient)
+			n, _ := newTestNotifier(cfg, mockDB, mockClient)
+
+			clock := &fakeClock{t: time.Now()}
+			n.breaker.now = clock.now
+			for i := 0; i < 3; i++ {
+				n.recordEndpointResult(true)
+			}
+			clock.t = clock.t.Add(30 * time.Second)
+
+			skipped := tt.obj()
+			next := testObject()
+			next.ID = "next"
+			mockDB.On("CountPendingNotifications").Return(nil, nil)
+			mockDB.On("GetPendingNotifications", 1, mock.Anything).Return([]*models.ManagedObject{skipped}, nil).Once()
+			mockDB.On("GetPendingNotifications", 1, mock.Anything).Return([]*models.ManagedObject{next}, nil).Once()
+			tt.setup(mockDB, skipped)
+			mockDB.On("UpdateNotificationStatus", next.ID, "created", mock.AnythingOfType("time.Time")).Return(nil)
+			mockClient.On("Do", mock.Anything).Return(&http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil)
+
+			n.poll(context.Background())
+			assert.Equal(t, circuitHalfOpen, n.breaker.currentState())
+			mockClient.AssertNotCalled(t, "Do", mock.Anything)
+
+			n.poll(context.Background())
+
+			mockDB.AssertExpectations(t)
+			mockClient.AssertNumberOfCalls(t, "Do", 1)
+			assert.Equal(t, circuitClosed, n.breaker.currentState(), "the next event probes the endpoint")
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package notifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+
+	"github.com/bryonbaker/beacon/internal/config"
+	"github.com/bryonbaker/beacon/internal/models"
+	"github.com/bryonbaker/beacon/internal/tracing"
+)
+
+// extensionData is the value templated extension attributes are evaluated
+// against, e.g. `{{ .Namespace }}/{{ .Name }}`.
+type extensionData struct {
+	UID             string
+	Type            string
+	Name            string
+	Namespace       string
+	AnnotationValue string
+	EventType       string
+	Labels          map[string]string
+	Annotations     map[string]string
+}
+
+// extension is a compiled cloudEvents.extensions entry.
+type extension struct {
+	name  string
+	value string
+	tmpl  *template.Template
+}
+
+// compileExtensions parses the templated extension attributes.
+func compileExtensions(cfgs []config.ExtensionConfig) ([]extension, error) {
+	exts := make([]extension, 0, len(cfgs))
+	for _, c := range cfgs {
+		ext := extension{name: c.Name, value: c.Value}
+		if c.Template != "" {
+			tmpl, err := template.New(c.Name).Option("missingkey=error").Parse(c.Template)
+			if err != nil {
+				return nil, fmt.Errorf("parsing template for extension %q: %w", c.Name, err)
+			}
+			ext.tmpl = tmpl
+		}
+		exts = append(exts, ext)
+	}
+	return exts, nil
+}
+
+// applyExtensions sets the configured extension attributes on ce. A template
+// that fails or renders an empty string leaves its attribute unset, since
+// CloudEvents attributes may not be empty.
+func (n *Notifier) applyExtensions(ce *models.CloudEvent, obj *models.ManagedObject, eventType string) error {
+	if len(n.extensions) == 0 {
+		return nil
+	}
+
+	data := extensionData{
+		UID:             obj.ResourceUID,
+		Type:            obj.ResourceType,
+		Name:            obj.ResourceName,
+		Namespace:       obj.ResourceNamespace,
+		AnnotationValue: obj.AnnotationValue,
+		EventType:       eventType,
+		Labels:          ce.Data.Metadata.Labels,
+		Annotations:     ce.Data.Metadata.Annotations,
+	}
+
+	var errs []string
+	ce.Extensions = make(map[string]string, len(n.extensions))
+	for _, ext := range n.extensions {
+		value := ext.value
+		if ext.tmpl != nil {
+			var buf bytes.Buffer
+			if err := ext.tmpl.Execute(&buf, data); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", ext.name, err))
+				continue
+			}
+			value = buf.String()
+		}
+		if value != "" {
+			ce.Extensions[ext.name] = value
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("evaluating extension attributes: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// sequenceWidth is the number of digits sequence values are zero-padded to,
+// enough for any int64, so that they order correctly as strings.
+const sequenceWidth = 19
+
+// setSequence sets the sequence extension attribute to the sequence number
+// assigned to the event when it was recorded; an ephemeral event takes the
+// sequence of the deletion it replaces. The CloudEvents sequence
+// extension compares values as strings, so the number is zero-padded.
+// Events recorded before sequences were introduced have none.
+func setSequence(ce *models.CloudEvent, obj *models.ManagedObject, eventType string) {
+	seq := obj.CreatedSequence
+	if eventType == "deleted" || eventType == eventTypeEphemeral {
+		seq = obj.DeletedSequence
+	}
+	if seq <= 0 {
+		return
+	}
+	if ce.Extensions == nil {
+		ce.Extensions = make(map[string]string, 1)
+	}
+	ce.Extensions["sequence"] = fmt.Sprintf("%0*d", sequenceWidth, seq)
+}
+
+// setTraceParent sets the traceparent extension attribute of the CloudEvents
+// distributed tracing extension, so that receivers can continue the trace of
+// the event. Nothing is set when the event is not traced.
+func setTraceParent(ce *models.CloudEvent, traceParent string) {
+	if traceParent == "" {
+		return
+	}
+	if ce.Extensions == nil {
+		ce.Extensions = make(map[string]string, 1)
+	}
+	ce.Extensions[tracing.TraceParentKey] = traceParent
+}
+
+// encodeEvent returns the request body and content type for ce in the
+// configured content mode, setting ce-* headers on h in binary mode.
+func encodeEvent(ce *models.CloudEvent, mode string, h http.Header) ([]byte, string, error) {
+	if mode != config.CloudEventsModeBinary {
+		body, err := json.Marshal(ce)
+		if err != nil {
+			return nil, "", fmt.Errorf("marshalling CloudEvent: %w", err)
+		}
+		return body, "application/cloudevents+json; charset=UTF-8", nil
+	}
+
+	body, err := json.Marshal(ce.Data)
+	if err != nil {
+		return nil, "", fmt.Errorf("marshalling CloudEvent data: %w", err)
+	}
+
+	for name, value := range binaryAttributes(ce) {
+		h.Set("ce-"+name, encodeHeaderValue(value))
+	}
+	return body, ce.DataContentType, nil
+}
+
+// eventID returns the CloudEvent id of obj's eventType event. It is the same
+// for every attempt to deliver the event and differs between the events of
+// one object, so receivers can deduplicate on it.
+func eventID(objectID, eventType string) string {
+	return objectID + ":" + eventType
+}
+
+// parseEventID returns the object and event type that an event id refers
+// to. An id without an event type, as sent by earlier versions, refers to
+// the object alone.
+func parseEventID(id string) (objectID, eventType string) {
+	i := strings.LastIndex(id, ":")
+	if i < 0 {
+		return id, ""
+	}
+	return id[:i], id[i+1:]
+}
+
+// binaryAttributes returns the non-empty context attributes of ce, including
+// extensions, keyed by attribute name. In binary content mode they are carried
+// as protocol headers rather than in the body. datacontenttype is excluded
+// because bindings map it to their native content-type header.
+func binaryAttributes(ce *models.CloudEvent) map[string]string {
+	attrs := make(map[string]string, 7+len(ce.Extensions))
+	for name, value := range ce.Extensions {
+		attrs[name] = value
+	}
+	for name, value := range map[string]string{
+		"specversion": ce.SpecVersion,
+		"id":          ce.ID,
+		"source":      ce.Source,
+		"type":        ce.Type,
+		"subject":     ce.Subject,
+		"time":        ce.Time,
+		"dataschema":  ce.DataSchema,
+	} {
+		attrs[name] = value
+	}
+	for name, value := range attrs {
+		if value == "" {
+			delete(attrs, name)
+		}
+	}
+	return attrs
+}
+
+// encodeHeaderValue percent-encodes the characters the CloudEvents HTTP
+// binding requires to be escaped in ce-* header values: '%', '"', and
+// anything outside printable ASCII.
+func encodeHeaderValue(v string) string {
+	var b strings.Builder
+	for i := 0; i < len(v); i++ {
+		c := v[i]
+		if c < 0x20 || c > 0x7e || c == '%' || c == '"' {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
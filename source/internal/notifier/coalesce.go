@@ -0,0 +1,84 @@
+package notifier
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/bryonbaker/beacon/internal/config"
+	"github.com/bryonbaker/beacon/internal/models"
+)
+
+// eventTypeEphemeral is the event sent in place of the created and deleted
+// events of a short-lived resource.
+const eventTypeEphemeral = models.EventEphemeral
+
+// nextEvent returns the event that is due for obj, or "" when nothing is to
+// be sent. A resource that was deleted within its type's coalescing window
+// before its created event was delivered gets a single ephemeral event, or
+// none at all when its events are suppressed.
+func (n *Notifier) nextEvent(ctx context.Context, obj *models.ManagedObject) string {
+	switch n.coalesceMode(obj) {
+	case config.CoalesceModeSuppress:
+		n.markCoalesced(ctx, obj, models.CoalescedSuppressed)
+		return ""
+	case config.CoalesceModeEphemeral:
+		return eventTypeEphemeral
+	}
+	return eventTypeFor(obj)
+}
+
+// coalesceMode returns the coalescing mode that applies to obj's pending
+// events, or "" if they are not coalesced.
+func (n *Notifier) coalesceMode(obj *models.ManagedObject) string {
+	if eventTypeFor(obj) != "created" || obj.ClusterState != models.ClusterStateDeleted || obj.DeletedAt == nil {
+		return ""
+	}
+	if obj.AwaitingAck == "created" {
+		// The receiver already has the created event.
+		return ""
+	}
+	rule := n.cfg.CoalesceFor(obj.ResourceType)
+	if rule == nil || obj.DeletedAt.Sub(obj.CreatedAt) > rule.Window.Duration {
+		return ""
+	}
+	return rule.Mode
+}
+
+// markCoalesced records that obj's created and deleted events were replaced
+// by decision.
+func (n *Notifier) markCoalesced(ctx context.Context, obj *models.ManagedObject, decision string) {
+	if err := n.store.coalesced(ctx, obj, decision, time.Now().UTC()); err != nil {
+		n.logger.Error("failed to mark notification as coalesced",
+			zap.String("object_id", obj.ID),
+			zap.Error(err),
+		)
+		return
+	}
+	n.reportCoalesced(obj, decision)
+}
+
+// reportCoalesced logs and counts the coalescing of obj's events.
+func (n *Notifier) reportCoalesced(obj *models.ManagedObject, decision string) {
+	n.logger.Info("coalesced events of short-lived resource",
+		zap.String("object_id", obj.ID),
+		zap.String("resource_type", obj.ResourceType),
+		zap.String("resource_name", obj.ResourceName),
+		zap.String("decision", decision),
+		zap.Duration("lifespan", obj.DeletedAt.Sub(obj.CreatedAt)),
+	)
+	n.metrics.RecordNotificationCoalesced(obj.ResourceType, decision)
+}
+
+// lifespanOf returns how long obj existed.
+func lifespanOf(obj *models.ManagedObject) *models.Lifespan {
+	if obj.DeletedAt == nil {
+		return nil
+	}
+	return &models.Lifespan{
+		CreatedAt: obj.CreatedAt.UTC().Format(time.RFC3339),
+		DeletedAt: obj.DeletedAt.UTC().Format(time.RFC3339),
+		Seconds:   obj.DeletedAt.Sub(obj.CreatedAt).Seconds(),
+	}
+}
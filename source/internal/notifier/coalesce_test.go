@@ -0,0 +1,101 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bryonbaker/beacon/internal/config"
+	"github.com/bryonbaker/beacon/internal/database"
+	"github.com/bryonbaker/beacon/internal/models"
+)
+
+// shortLivedObject returns an object of type ConfigMap that was deleted
+// lifespan after it was created, before its created event was delivered.
+func shortLivedObject(lifespan time.Duration) *models.ManagedObject {
+	obj := testObject()
+	obj.CreatedAt = time.Now().Add(-time.Minute).Truncate(time.Second)
+	deletedAt := obj.CreatedAt.Add(lifespan)
+	obj.ClusterState = models.ClusterStateDeleted
+	obj.DeletedAt = &deletedAt
+	obj.DeletedSequence = 7
+	return obj
+}
+
+// coalescingConfig returns a test config that coalesces ConfigMap events
+// within a 30s window using mode.
+func coalescingConfig(mode string) *config.Config {
+	cfg := testConfig()
+	cfg.Resources = []config.ResourceConfig{{
+		APIVersion: "v1",
+		Kind:       "ConfigMap",
+		Coalesce:   config.CoalesceConfig{Window: config.Duration{Duration: 30 * time.Second}, Mode: mode},
+	}}
+	return cfg
+}
+
+func TestProcessNotification_CoalesceSuppress(t *testing.T) {
+	cfg := coalescingConfig(config.CoalesceModeSuppress)
+	mockDB := new(database.MockDatabase)
+	mockClient := new(MockHTTPClient)
+	n, _ := newTestNotifier(cfg, mockDB, mockClient)
+
+	obj := shortLivedObject(5 * time.Second)
+	mockDB.On("MarkCoalesced", obj.ID, models.CoalescedSuppressed, mock.AnythingOfType("time.Time")).Return(nil)
+
+	n.processNotification(context.Background(), obj)
+
+	mockDB.AssertExpectations(t)
+	mockClient.AssertNotCalled(t, "Do", mock.Anything)
+	assert.Equal(t, 1.0, testutil.ToFloat64(n.metrics.NotificationsCoalescedTotal.WithLabelValues("ConfigMap", "suppressed")))
+}
+
+func TestProcessNotification_CoalesceEphemeral(t *testing.T) {
+	cfg := coalescingConfig(config.CoalesceModeEphemeral)
+	mockDB := new(database.MockDatabase)
+	mockClient := new(MockHTTPClient)
+	n, _ := newTestNotifier(cfg, mockDB, mockClient)
+
+	obj := shortLivedObject(5 * time.Second)
+	var sent map[string]interface{}
+	mockClient.On("Do", mock.Anything).Run(func(args mock.Arguments) {
+		body, _ := io.ReadAll(args.Get(0).(*http.Request).Body)
+		_ = json.Unmarshal(body, &sent)
+	}).Return(&http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil)
+	mockDB.On("MarkCoalesced", obj.ID, models.CoalescedEphemeral, mock.AnythingOfType("time.Time")).Return(nil)
+
+	n.processNotification(context.Background(), obj)
+
+	mockDB.AssertExpectations(t)
+	mockDB.AssertNotCalled(t, "UpdateNotificationStatus", mock.Anything, mock.Anything, mock.Anything)
+	require.NotNil(t, sent)
+	assert.Equal(t, "net.bakerapps.beacon.resource.ephemeral", sent["type"])
+	assert.Equal(t, "0000000000000000007", sent["sequence"])
+	lifespan := sent["data"].(map[string]interface{})["lifespan"].(map[string]interface{})
+	assert.Equal(t, 5.0, lifespan["seconds"])
+	assert.Equal(t, 1.0, testutil.ToFloat64(n.metrics.NotificationsCoalescedTotal.WithLabelValues("ConfigMap", "ephemeral")))
+}
+
+func TestNextEvent_NotCoalesced(t *testing.T) {
+	cfg := coalescingConfig(config.CoalesceModeSuppress)
+	n, _ := newTestNotifier(cfg, new(database.MockDatabase), new(MockHTTPClient))
+
+	assert.Equal(t, "created", n.nextEvent(context.Background(), shortLivedObject(time.Minute)), "deleted after the window")
+	assert.Equal(t, "created", n.nextEvent(context.Background(), testObject()), "not deleted")
+
+	delivered := shortLivedObject(time.Second)
+	delivered.NotifiedCreated = true
+	assert.Equal(t, "deleted", n.nextEvent(context.Background(), delivered), "created event already delivered")
+
+	other := shortLivedObject(time.Second)
+	other.ResourceType = "Pod"
+	assert.Equal(t, "created", n.nextEvent(context.Background(), other), "type without coalescing")
+}
@@ -0,0 +1,287 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+
+	"github.com/bryonbaker/beacon/internal/config"
+	"github.com/bryonbaker/beacon/internal/models"
+	"github.com/bryonbaker/beacon/internal/tracing"
+)
+
+// HTTPClient is the interface used to send HTTP requests. *http.Client satisfies
+// this interface, and it can be replaced with a mock in tests.
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// HTTPSink delivers CloudEvents to the configured HTTP endpoint using the
+// CloudEvents HTTP protocol binding.
+type HTTPSink struct {
+	client  HTTPClient
+	signer  *requestSigner // nil when signing is disabled
+	tokens  tokenSource    // nil for static bearer authentication
+	limiter *rate.Limiter  // nil when rate limiting is disabled
+	cfg     *config.Config
+	logger  *zap.Logger
+}
+
+// Ensure HTTPSink satisfies the Sink interface at compile time.
+var _ Sink = (*HTTPSink)(nil)
+
+// NewHTTPSink creates an HTTPSink that sends requests with client.
+func NewHTTPSink(client HTTPClient, cfg *config.Config, logger *zap.Logger) *HTTPSink {
+	s := &HTTPSink{
+		client: client,
+		cfg:    cfg,
+		logger: logger,
+	}
+	if rl := cfg.Endpoint.RateLimit; rl.RequestsPerSecond > 0 {
+		s.limiter = rate.NewLimiter(rate.Limit(rl.RequestsPerSecond), rl.Burst)
+	}
+	switch cfg.Endpoint.Auth.Type {
+	case config.AuthTypeOAuth2:
+		s.tokens = newOAuth2TokenSource(&cfg.Endpoint.Auth.OAuth2, logger)
+	case config.AuthTypeServiceAccountToken:
+		s.tokens = newServiceAccountTokenSource(cfg.Endpoint.Auth.ServiceAccountToken.Path, logger)
+	}
+	if cfg.Endpoint.Signing.Enabled {
+		s.signer = newRequestSigner(&cfg.Endpoint.Signing, logger)
+		// Load the secrets now so misconfiguration is reported at startup.
+		// Requests are not sent unsigned; they fail and are retried until
+		// the secrets can be loaded.
+		if _, err := s.signer.current(); err != nil {
+			logger.Error("failed to load signing secrets", zap.Error(err))
+		}
+	}
+	return s
+}
+
+// Send delivers one event in the configured content mode.
+func (s *HTTPSink) Send(ctx context.Context, ce *models.CloudEvent) error {
+	req, err := s.buildRequest(ce)
+	if err != nil {
+		return &PermanentError{Err: err}
+	}
+	tracing.Inject(ctx, req.Header)
+
+	// Send the request with the configured timeout.
+	sendCtx, cancel := context.WithTimeout(ctx, s.cfg.Endpoint.Timeout.Duration)
+	defer cancel()
+
+	resp, err := s.do(sendCtx, req, ce.ID)
+	if resp != nil && resp.Body != nil {
+		defer resp.Body.Close()
+	}
+	if err == nil && s.awaitsAck(resp.StatusCode) {
+		return ErrAwaitingAck
+	}
+	err = responseError(resp, err)
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		s.captureResponse(statusErr, resp)
+	}
+	return err
+}
+
+// awaitsAck reports whether a response with statusCode accepts an event that
+// the receiver will acknowledge later.
+func (s *HTTPSink) awaitsAck(statusCode int) bool {
+	return s.cfg.Endpoint.Ack.Enabled && statusCode == http.StatusAccepted
+}
+
+// captureResponse records the start of resp's body and the configured
+// response headers on statusErr, bounded by the diagnostics settings.
+func (s *HTTPSink) captureResponse(statusErr *StatusError, resp *http.Response) {
+	diag := s.cfg.Endpoint.Diagnostics
+	if resp.Body != nil && diag.MaxBodyBytes > 0 {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, int64(diag.MaxBodyBytes)))
+		if err != nil {
+			s.logger.Debug("failed to read endpoint response body", zap.Error(err))
+		}
+		statusErr.Body = strings.ToValidUTF8(string(body), "")
+	}
+	for _, name := range diag.Headers {
+		if v := resp.Header.Get(name); v != "" {
+			if statusErr.Headers == nil {
+				statusErr.Headers = make(map[string]string)
+			}
+			statusErr.Headers[http.CanonicalHeaderKey(name)] = v
+		}
+	}
+}
+
+// do sends req as the message msgID. With OAuth2 or ServiceAccount token
+// authentication it attaches the current token, and a 401 response discards
+// the token and retries the request once with a freshly obtained one.
+func (s *HTTPSink) do(ctx context.Context, req *http.Request, msgID string) (*http.Response, error) {
+	if s.tokens == nil {
+		return s.send(req.WithContext(ctx), msgID)
+	}
+
+	token, err := s.tokens.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.send(withBearer(ctx, req, token), msgID)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	if resp.Body != nil {
+		resp.Body.Close()
+	}
+
+	s.logger.Info("endpoint rejected access token, refreshing and retrying")
+	s.tokens.Invalidate(token)
+	token, err = s.tokens.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.send(withBearer(ctx, req, token), msgID)
+}
+
+// send waits for the rate limiter, if configured, then signs req as the
+// message msgID and sends it. Signing last keeps the signed timestamp within
+// the receiver's tolerance however long the limiter held the request.
+func (s *HTTPSink) send(req *http.Request, msgID string) (*http.Response, error) {
+	if s.limiter != nil {
+		if err := s.limiter.Wait(req.Context()); err != nil {
+			return nil, fmt.Errorf("waiting for rate limiter: %w", err)
+		}
+	}
+	if err := s.sign(req, msgID); err != nil {
+		return nil, err
+	}
+	return s.client.Do(req)
+}
+
+// withBearer returns a copy of req bound to ctx with a fresh body and the
+// bearer token set in the Authorization header.
+func withBearer(ctx context.Context, req *http.Request, token string) *http.Request {
+	r := req.Clone(ctx)
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			r.Body = body
+		}
+	}
+	r.Header.Set("Authorization", "Bearer "+token)
+	return r
+}
+
+// Close is a no-op; the HTTP client's connections are owned by the caller.
+func (s *HTTPSink) Close() error {
+	return nil
+}
+
+// sign adds signature headers to req when signing is enabled. Signing errors
+// are retriable: the secrets may become available before the next attempt.
+func (s *HTTPSink) sign(req *http.Request, msgID string) error {
+	if s.signer == nil {
+		return nil
+	}
+	return s.signer.sign(req, msgID)
+}
+
+// responseError converts the result of an HTTP request into a Sink result:
+// nil for a 2xx response, a *StatusError for any other response, and the
+// transport error when no response was received.
+func responseError(resp *http.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	return &StatusError{
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+// parseRetryAfter parses a Retry-After header value, given either as delay
+// seconds or as an HTTP-date, into a delay from now. It returns zero when the
+// header is absent, malformed, or in the past.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs <= 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// buildRequest constructs the HTTP POST request for a CloudEvents envelope in
+// the configured content mode.
+func (s *HTTPSink) buildRequest(ce *models.CloudEvent) (*http.Request, error) {
+	ceHeaders := make(http.Header)
+	body, contentType, err := encodeEvent(ce, s.cfg.CloudEvents.Mode, ceHeaders)
+	if err != nil {
+		return nil, err
+	}
+	return s.newRequest(body, contentType, ceHeaders)
+}
+
+// newRequest creates the POST request carrying body and sets the standard,
+// authentication, and custom headers. contentType and ceHeaders are applied
+// last so configured headers cannot override them.
+func (s *HTTPSink) newRequest(body []byte, contentType string, ceHeaders http.Header) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodPost, s.cfg.Endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("creating HTTP request: %w", err)
+	}
+
+	// Standard headers.
+	req.Header.Set("User-Agent", fmt.Sprintf("beacon/%s", s.cfg.App.Version))
+	req.Header.Set("X-Request-ID", newUUID())
+
+	// Static bearer token authentication. Tokens from a tokenSource are
+	// attached when the request is sent.
+	if s.tokens == nil && s.cfg.AuthToken != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", s.cfg.AuthToken))
+	}
+
+	// Custom headers from configuration.
+	for k, v := range s.cfg.Endpoint.Headers {
+		req.Header.Set(k, v)
+	}
+
+	// CloudEvents content type and ce-* attributes — set after custom headers
+	// to prevent accidental override.
+	for k, v := range ceHeaders {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	return req, nil
+}
+
+// newUUID generates a version-4 UUID string without requiring an external
+// dependency.
+func newUUID() string {
+	var uuid [16]byte
+	_, _ = rand.Read(uuid[:])
+	// Set version 4 and variant bits per RFC 4122.
+	uuid[6] = (uuid[6] & 0x0f) | 0x40
+	uuid[8] = (uuid[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%08x-%04x-%04x-%04x-%012x",
+		uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:16])
+}
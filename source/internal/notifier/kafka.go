@@ -0,0 +1,222 @@
+package notifier
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+	"go.uber.org/zap"
+
+	"github.com/bryonbaker/beacon/internal/config"
+	"github.com/bryonbaker/beacon/internal/models"
+)
+
+// kafkaProducer is the subset of *kgo.Client used by KafkaSink.
+type kafkaProducer interface {
+	ProduceSync(ctx context.Context, rs ...*kgo.Record) kgo.ProduceResults
+	Close()
+}
+
+// KafkaSink delivers CloudEvents to a Kafka topic using the CloudEvents Kafka
+// protocol binding. In structured mode the record value is the JSON envelope;
+// in binary mode it is the data payload and the attributes are carried in
+// ce_* record headers.
+type KafkaSink struct {
+	producer kafkaProducer
+	cfg      *config.Config
+	logger   *zap.Logger
+}
+
+// Ensure KafkaSink satisfies the Sink interface at compile time.
+var _ Sink = (*KafkaSink)(nil)
+
+// NewKafkaSink creates a KafkaSink connected to the brokers in
+// cfg.Sink.Kafka. Connections are established lazily on first produce.
+func NewKafkaSink(cfg *config.Config, logger *zap.Logger) (*KafkaSink, error) {
+	opts, err := kafkaOptions(&cfg.Sink.Kafka)
+	if err != nil {
+		return nil, err
+	}
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating kafka client: %w", err)
+	}
+	return &KafkaSink{producer: client, cfg: cfg, logger: logger}, nil
+}
+
+// kafkaOptions translates the sink configuration into client options.
+func kafkaOptions(k *config.KafkaConfig) ([]kgo.Opt, error) {
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(k.Brokers...),
+		kgo.ClientID(k.ClientID),
+		kgo.DefaultProduceTopic(k.Topic),
+		kgo.RecordDeliveryTimeout(k.ProduceTimeout.Duration),
+		// Records for the same key must stay in order, so the default
+		// sticky-key partitioner is kept and retries are left to the client.
+	}
+
+	switch k.Acks {
+	case config.KafkaAcksLeader:
+		opts = append(opts, kgo.RequiredAcks(kgo.LeaderAck()))
+	case config.KafkaAcksNone:
+		opts = append(opts, kgo.RequiredAcks(kgo.NoAck()))
+	default:
+		opts = append(opts, kgo.RequiredAcks(kgo.AllISRAcks()))
+	}
+	if k.DisableIdempotence {
+		opts = append(opts, kgo.DisableIdempotentWrite())
+	}
+
+	switch k.SASL.Mechanism {
+	case "PLAIN":
+		opts = append(opts, kgo.SASL(plain.Auth{User: k.SASL.Username, Pass: k.SASL.Password}.AsMechanism()))
+	case "SCRAM-SHA-256":
+		opts = append(opts, kgo.SASL(scram.Auth{User: k.SASL.Username, Pass: k.SASL.Password}.AsSha256Mechanism()))
+	case "SCRAM-SHA-512":
+		opts = append(opts, kgo.SASL(scram.Auth{User: k.SASL.Username, Pass: k.SASL.Password}.AsSha512Mechanism()))
+	}
+
+	if k.TLS.Enabled {
+		tlsCfg, err := kafkaTLSConfig(&k.TLS)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, kgo.DialTLSConfig(tlsCfg))
+	}
+
+	return opts, nil
+}
+
+// kafkaTLSConfig builds the TLS configuration for broker connections.
+func kafkaTLSConfig(t *config.KafkaTLSConfig) (*tls.Config, error) {
+	tlsCfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: t.InsecureSkipVerify, // nolint: gosec // opt-in for development clusters.
+	}
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading kafka CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in kafka CA file %q", t.CAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading kafka client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	return tlsCfg, nil
+}
+
+// Send produces one event and waits for it to be acknowledged.
+func (s *KafkaSink) Send(ctx context.Context, ce *models.CloudEvent) error {
+	return s.SendBatch(ctx, []*models.CloudEvent{ce})[0]
+}
+
+// SendBatch produces all events concurrently and waits for every
+// acknowledgement. Records with the same key are written to the same
+// partition in order.
+func (s *KafkaSink) SendBatch(ctx context.Context, events []*models.CloudEvent) []error {
+	results := make([]error, len(events))
+	records := make([]*kgo.Record, 0, len(events))
+	index := make(map[*kgo.Record]int, len(events))
+	for i, ce := range events {
+		rec, err := s.record(ce)
+		if err != nil {
+			results[i] = &PermanentError{Err: err}
+			continue
+		}
+		records = append(records, rec)
+		index[rec] = i
+	}
+	if len(records) == 0 {
+		return results
+	}
+
+	for _, r := range s.producer.ProduceSync(ctx, records...) {
+		results[index[r.Record]] = classifyKafkaError(r.Err)
+	}
+	return results
+}
+
+// Close closes the broker connections. SendBatch waits for every record it
+// produces, so there is nothing left to flush.
+func (s *KafkaSink) Close() error {
+	s.producer.Close()
+	return nil
+}
+
+// record encodes ce as a Kafka record in the configured content mode.
+func (s *KafkaSink) record(ce *models.CloudEvent) (*kgo.Record, error) {
+	rec := &kgo.Record{Key: s.key(ce)}
+
+	if s.cfg.CloudEvents.Mode == config.CloudEventsModeBinary {
+		value, err := json.Marshal(ce.Data)
+		if err != nil {
+			return nil, fmt.Errorf("marshalling CloudEvent data: %w", err)
+		}
+		rec.Value = value
+		rec.Headers = append(rec.Headers, kgo.RecordHeader{Key: "content-type", Value: []byte(ce.DataContentType)})
+		for name, value := range binaryAttributes(ce) {
+			rec.Headers = append(rec.Headers, kgo.RecordHeader{Key: "ce_" + name, Value: []byte(value)})
+		}
+		return rec, nil
+	}
+
+	value, err := json.Marshal(ce)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling CloudEvent: %w", err)
+	}
+	rec.Value = value
+	rec.Headers = append(rec.Headers, kgo.RecordHeader{Key: "content-type", Value: []byte("application/cloudevents+json; charset=UTF-8")})
+	return rec, nil
+}
+
+// key returns the record key for ce. Keying by resource keeps every event for
+// one resource on one partition, and therefore in order.
+func (s *KafkaSink) key(ce *models.CloudEvent) []byte {
+	var key string
+	switch s.cfg.Sink.Kafka.Key {
+	case config.KafkaKeyNone:
+		return nil
+	case config.KafkaKeyNamespacedName:
+		key = ce.Data.Resource.Namespace + "/" + ce.Data.Resource.Name
+	case config.KafkaKeyPartitionKey:
+		key = ce.Extensions["partitionkey"]
+	default:
+		key = ce.Data.Resource.UID
+	}
+	if key == "" {
+		return nil
+	}
+	return []byte(key)
+}
+
+// classifyKafkaError maps a produce error to a Sink result. Records the broker
+// rejects outright are permanent failures; everything else, including
+// timeouts and unavailable brokers, is retried.
+func classifyKafkaError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, kerr.MessageTooLarge) ||
+		errors.Is(err, kerr.RecordListTooLarge) ||
+		errors.Is(err, kerr.InvalidRecord) {
+		return &PermanentError{Err: err}
+	}
+	return err
+}
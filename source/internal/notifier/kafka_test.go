@@ -0,0 +1,234 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"go.uber.org/zap"
+
+	"github.com/bryonbaker/beacon/internal/config"
+	"github.com/bryonbaker/beacon/internal/database"
+	"github.com/bryonbaker/beacon/internal/metrics"
+	"github.com/bryonbaker/beacon/internal/models"
+)
+
+const testTopic = "beacon-events"
+
+// kafkaTestConfig returns a config that delivers to the given brokers.
+func kafkaTestConfig(brokers []string) *config.Config {
+	cfg := testConfig()
+	cfg.Sink = config.SinkConfig{
+		Type: config.SinkTypeKafka,
+		Kafka: config.KafkaConfig{
+			Brokers:        brokers,
+			Topic:          testTopic,
+			ClientID:       "beacon-test",
+			Key:            config.KafkaKeyUID,
+			Acks:           config.KafkaAcksAll,
+			ProduceTimeout: config.Duration{Duration: 10 * time.Second},
+		},
+	}
+	return cfg
+}
+
+// newFakeCluster starts an in-process Kafka cluster with the test topic.
+func newFakeCluster(t *testing.T) *kfake.Cluster {
+	t.Helper()
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(1, testTopic))
+	require.NoError(t, err)
+	t.Cleanup(cluster.Close)
+	return cluster
+}
+
+// consume reads n records from the test topic.
+func consume(t *testing.T, brokers []string, n int) []*kgo.Record {
+	t.Helper()
+	client, err := kgo.NewClient(
+		kgo.SeedBrokers(brokers...),
+		kgo.ConsumeTopics(testTopic),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+	)
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var records []*kgo.Record
+	for len(records) < n {
+		fetches := client.PollFetches(ctx)
+		require.NoError(t, ctx.Err(), "timed out waiting for records")
+		fetches.EachRecord(func(r *kgo.Record) { records = append(records, r) })
+	}
+	return records
+}
+
+func header(r *kgo.Record, key string) string {
+	for _, h := range r.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func testEvent(cfg *config.Config, id, uid string) *models.CloudEvent {
+	obj := testObject()
+	obj.ID = id
+	obj.ResourceUID = uid
+	return buildCloudEvent(obj, "created", cfg)
+}
+
+func TestKafkaSink_StructuredMode(t *testing.T) {
+	cluster := newFakeCluster(t)
+	cfg := kafkaTestConfig(cluster.ListenAddrs())
+
+	sink, err := NewKafkaSink(cfg, zap.NewNop())
+	require.NoError(t, err)
+	defer sink.Close()
+
+	results := sink.SendBatch(context.Background(), []*models.CloudEvent{
+		testEvent(cfg, "evt-1", "uid-1"),
+		testEvent(cfg, "evt-2", "uid-2"),
+	})
+	require.Len(t, results, 2)
+	assert.NoError(t, results[0])
+	assert.NoError(t, results[1])
+
+	records := consume(t, cluster.ListenAddrs(), 2)
+	byKey := map[string]*kgo.Record{}
+	for _, r := range records {
+		byKey[string(r.Key)] = r
+	}
+	require.Contains(t, byKey, "uid-1")
+	rec := byKey["uid-1"]
+	assert.Equal(t, "application/cloudevents+json; charset=UTF-8", header(rec, "content-type"))
+
+	var envelope map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Value, &envelope))
+	assert.Equal(t, "evt-1:created", envelope["id"])
+	assert.Equal(t, "1.0", envelope["specversion"])
+}
+
+func TestKafkaSink_BinaryMode(t *testing.T) {
+	cluster := newFakeCluster(t)
+	cfg := kafkaTestConfig(cluster.ListenAddrs())
+	cfg.CloudEvents.Mode = config.CloudEventsModeBinary
+	cfg.CloudEvents.Extensions = []config.ExtensionConfig{{Name: "cluster", Value: "prod-east"}}
+	n, _ := newTestNotifier(cfg, new(database.MockDatabase), new(MockHTTPClient))
+
+	sink, err := NewKafkaSink(cfg, zap.NewNop())
+	require.NoError(t, err)
+	defer sink.Close()
+
+	require.NoError(t, sink.Send(context.Background(), n.cloudEvent(testObject(), "created")))
+
+	rec := consume(t, cluster.ListenAddrs(), 1)[0]
+	assert.Equal(t, "uid-aaa-bbb", string(rec.Key))
+	assert.Equal(t, "application/json", header(rec, "content-type"))
+	assert.Equal(t, "1.0", header(rec, "ce_specversion"))
+	assert.Equal(t, "obj-001:created", header(rec, "ce_id"))
+	assert.Equal(t, "net.bakerapps.beacon.resource.created", header(rec, "ce_type"))
+	assert.Equal(t, "/beacon/default/ConfigMap", header(rec, "ce_source"))
+	assert.Equal(t, "prod-east", header(rec, "ce_cluster"))
+
+	var data map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Value, &data))
+	assert.Contains(t, data, "resource")
+	assert.NotContains(t, data, "specversion")
+}
+
+func TestKafkaSink_Key(t *testing.T) {
+	cfg := kafkaTestConfig([]string{"localhost:9092"})
+	sink := &KafkaSink{cfg: cfg}
+	ce := testEvent(cfg, "evt-1", "uid-1")
+	ce.Extensions = map[string]string{"partitionkey": "tenant-a"}
+
+	assert.Equal(t, []byte("uid-1"), sink.key(ce))
+
+	cfg.Sink.Kafka.Key = config.KafkaKeyNamespacedName
+	assert.Equal(t, []byte("default/my-config"), sink.key(ce))
+
+	cfg.Sink.Kafka.Key = config.KafkaKeyPartitionKey
+	assert.Equal(t, []byte("tenant-a"), sink.key(ce))
+
+	cfg.Sink.Kafka.Key = config.KafkaKeyNone
+	assert.Nil(t, sink.key(ce))
+}
+
+// fakeProducer returns a fixed error for every record.
+type fakeProducer struct {
+	err error
+}
+
+func (p *fakeProducer) ProduceSync(_ context.Context, rs ...*kgo.Record) kgo.ProduceResults {
+	results := make(kgo.ProduceResults, 0, len(rs))
+	for _, r := range rs {
+		results = append(results, kgo.ProduceResult{Record: r, Err: p.err})
+	}
+	return results
+}
+
+func (p *fakeProducer) Close() {}
+
+func TestNotifier_KafkaSinkOutcomes(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		expect func(m *database.MockDatabase, id string)
+	}{
+		{"delivered", nil, func(m *database.MockDatabase, id string) {
+			m.On("UpdateNotificationStatus", id, "created", mock.AnythingOfType("time.Time")).Return(nil)
+		}},
+		{"broker unavailable is retried", kerr.NotEnoughReplicas, func(m *database.MockDatabase, id string) {
+			m.On("IncrementNotificationAttempts", id, mock.AnythingOfType("time.Time")).Return(nil)
+		}},
+		{"timeout is retried", kgo.ErrRecordTimeout, func(m *database.MockDatabase, id string) {
+			m.On("IncrementNotificationAttempts", id, mock.AnythingOfType("time.Time")).Return(nil)
+		}},
+		{"oversized record fails permanently", kerr.MessageTooLarge, func(m *database.MockDatabase, id string) {
+			m.On("MarkNotificationFailed", id, 0).Return(nil)
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := kafkaTestConfig([]string{"localhost:9092"})
+			mockDB := new(database.MockDatabase)
+			sink := &KafkaSink{producer: &fakeProducer{err: tc.err}, cfg: cfg, logger: zap.NewNop()}
+			n := NewNotifierWithSink(mockDB, sink, cfg, metrics.NewMetrics(prometheus.NewRegistry()), zap.NewNop())
+
+			obj := testObject()
+			tc.expect(mockDB, obj.ID)
+
+			n.processBatch(context.Background(), []*models.ManagedObject{obj})
+
+			mockDB.AssertExpectations(t)
+		})
+	}
+}
+
+func TestClassifyKafkaError(t *testing.T) {
+	assert.NoError(t, classifyKafkaError(nil))
+
+	var permErr *PermanentError
+	assert.True(t, errors.As(classifyKafkaError(kerr.InvalidRecord), &permErr))
+	assert.False(t, errors.As(classifyKafkaError(kerr.LeaderNotAvailable), &permErr))
+}
+
+func TestKafkaOptions_TLSMissingCA(t *testing.T) {
+	k := kafkaTestConfig([]string{"localhost:9092"}).Sink.Kafka
+	k.TLS = config.KafkaTLSConfig{Enabled: true, CAFile: "/nonexistent/ca.pem"}
+	_, err := kafkaOptions(&k)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "kafka CA file")
+}
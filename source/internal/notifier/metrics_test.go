@@ -0,0 +1,88 @@
+package notifier
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bryonbaker/beacon/internal/database"
+	"github.com/bryonbaker/beacon/internal/models"
+)
+
+// histogram returns the current state of a histogram series.
+func histogram(t *testing.T, o prometheus.Observer) *dto.Histogram {
+	t.Helper()
+	var m dto.Metric
+	require.NoError(t, o.(prometheus.Metric).Write(&m))
+	return m.GetHistogram()
+}
+
+func TestProcessNotification_RecordsDeliveryMetrics(t *testing.T) {
+	cfg := testConfig()
+	mockDB := new(database.MockDatabase)
+	mockClient := new(MockHTTPClient)
+	n, _ := newTestNotifier(cfg, mockDB, mockClient)
+
+	obj := testObject()
+	obj.CreatedAt = time.Now().Add(-30 * time.Second)
+	obj.NotificationAttempts = 2
+	mockClient.On("Do", mock.Anything).Return(
+		&http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(""))}, nil)
+	mockDB.On("UpdateNotificationStatus", obj.ID, "created", mock.AnythingOfType("time.Time")).Return(nil)
+
+	n.processNotification(context.Background(), obj)
+
+	latency := histogram(t, n.metrics.NotificationLatency.WithLabelValues("ConfigMap", "created"))
+	assert.Equal(t, uint64(1), latency.GetSampleCount())
+	assert.InDelta(t, 30, latency.GetSampleSum(), 1, "latency is measured from detection")
+
+	attempts := histogram(t, n.metrics.NotificationAttemptsTotal.WithLabelValues("ConfigMap", "created"))
+	assert.Equal(t, 3.0, attempts.GetSampleSum(), "two failed attempts and the successful one")
+
+	duration := histogram(t, n.metrics.NotificationDuration.WithLabelValues("ConfigMap", "created", "success"))
+	assert.Equal(t, uint64(1), duration.GetSampleCount())
+	assert.Greater(t, testutil.ToFloat64(n.metrics.EndpointLastSuccess), float64(0))
+}
+
+func TestHandleResult_RecordsRetryBackoff(t *testing.T) {
+	cfg := testConfig()
+	mockDB := new(database.MockDatabase)
+	n, _ := newTestNotifier(cfg, mockDB, new(MockHTTPClient))
+
+	obj := testObject()
+	obj.NotificationAttempts = 1 // 1s * 2^1 = 2s
+	mockDB.On("IncrementNotificationAttempts", obj.ID, mock.AnythingOfType("time.Time")).Return(nil)
+
+	n.handleResult(context.Background(), obj, "created", &StatusError{StatusCode: http.StatusInternalServerError})
+
+	backoff := histogram(t, n.metrics.NotificationRetryBackoff.WithLabelValues("2"))
+	assert.Equal(t, uint64(1), backoff.GetSampleCount())
+	assert.InDelta(t, 2, backoff.GetSampleSum(), 0.5)
+}
+
+func TestPoll_RecordsBacklogAndHealth(t *testing.T) {
+	cfg := testConfig()
+	mockDB := new(database.MockDatabase)
+	n, _ := newTestNotifier(cfg, mockDB, new(MockHTTPClient))
+
+	mockDB.On("CountPendingNotifications").Return([]*models.PendingCount{
+		{ResourceType: "ConfigMap", EventType: "created", Pending: 5, Due: 2},
+	}, nil)
+	mockDB.On("GetPendingNotifications", mock.Anything, mock.Anything).Return([]*models.ManagedObject{}, nil)
+
+	n.poll(context.Background())
+
+	assert.Equal(t, float64(5), testutil.ToFloat64(n.metrics.NotificationsPendingTotal.WithLabelValues("ConfigMap", "created")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(n.metrics.WorkerQueueSize.WithLabelValues("notifier")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(n.metrics.ComponentUp.WithLabelValues("notifier")))
+}
@@ -1,51 +1,163 @@
 // Package notifier implements the notification worker that polls the database
-// for pending managed-object events and delivers them to the configured HTTP
-// endpoint with exponential-backoff retry logic.
+// for pending managed-object events and delivers them through the configured
+// sink (an HTTP endpoint or a Kafka topic) with exponential-backoff retry
+// logic.
 package notifier
 
 import (
-	"bytes"
 	"context"
-	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
 	mrand "math/rand"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 
+	"github.com/bryonbaker/beacon/internal/audit"
 	"github.com/bryonbaker/beacon/internal/config"
 	"github.com/bryonbaker/beacon/internal/database"
 	"github.com/bryonbaker/beacon/internal/metrics"
 	"github.com/bryonbaker/beacon/internal/models"
+	"github.com/bryonbaker/beacon/internal/payload"
+	"github.com/bryonbaker/beacon/internal/schema"
+	"github.com/bryonbaker/beacon/internal/tracing"
 )
 
-// HTTPClient is the interface used to send HTTP requests. *http.Client satisfies
-// this interface, and it can be replaced with a mock in tests.
-type HTTPClient interface {
-	Do(req *http.Request) (*http.Response, error)
-}
-
 // Notifier polls the database for managed objects that need notification and
-// delivers the corresponding event to the configured endpoint.
+// delivers the corresponding event through the configured sink. When events
+// are routed to several named endpoints, the Notifier that polls delegates
+// delivery to one Notifier per endpoint.
 type Notifier struct {
 	db      database.Database
-	client  HTTPClient
+	sink    Sink
+	store   deliveryStore
 	cfg     *config.Config
 	metrics *metrics.Metrics
 	logger  *zap.Logger
+	filter  *payload.Filter
+	tracer  trace.Tracer
+
+	// name is the endpoint this Notifier delivers to when routing, and ""
+	// for the single endpoint.
+	name string
+
+	// routes and endpoints are set on the Notifier that routes events.
+	routes    []route
+	endpoints []*Notifier
+
+	extensions []extension
+	validator  *schema.Validator
+
+	// pausedUntil is set when the endpoint asks for all deliveries to stop
+	// with a Retry-After header.
+	pauseMu     sync.Mutex
+	pausedUntil time.Time
+
+	breaker         *circuitBreaker
+	circuitObserver func(endpoint, state string)
+
+	// audit records attempts and transitions when the audit log is enabled.
+	audit *audit.Log
 }
 
-// NewNotifier creates a Notifier with the given dependencies.
+// NewNotifier creates a Notifier that delivers to the HTTP endpoint using
+// client.
 func NewNotifier(db database.Database, client HTTPClient, cfg *config.Config, m *metrics.Metrics, logger *zap.Logger) *Notifier {
-	return &Notifier{
-		db:      db,
-		client:  client,
-		cfg:     cfg,
-		metrics: m,
-		logger:  logger,
+	return NewNotifierWithSink(db, NewHTTPSink(client, cfg, logger), cfg, m, logger)
+}
+
+// NewNotifierWithSink creates a Notifier that delivers through sink.
+func NewNotifierWithSink(db database.Database, sink Sink, cfg *config.Config, m *metrics.Metrics, logger *zap.Logger) *Notifier {
+	filter, err := payload.NewFilter(&cfg.Payload)
+	if err != nil {
+		logger.Error("invalid payload filter, labels and annotations omitted", zap.Error(err))
+	}
+	extensions, err := compileExtensions(cfg.CloudEvents.Extensions)
+	if err != nil {
+		logger.Error("invalid CloudEvents extensions, extension attributes disabled", zap.Error(err))
+	}
+	var validator *schema.Validator
+	if cfg.CloudEvents.Schema.Validate {
+		if validator, err = schema.NewValidator(); err != nil {
+			logger.Error("failed to load data schema, payload validation disabled", zap.Error(err))
+		}
+	}
+
+	n := &Notifier{
+		db:         db,
+		sink:       sink,
+		store:      objectStore{db: db},
+		cfg:        cfg,
+		metrics:    m,
+		logger:     logger,
+		filter:     filter,
+		tracer:     tracing.Tracer("notifier"),
+		extensions: extensions,
+		validator:  validator,
+	}
+	n.breaker = newCircuitBreaker(cfg.Endpoint.CircuitBreaker, n.circuitChanged)
+	return n
+}
+
+// OnCircuitStateChange registers fn to be called with the circuit breaker
+// state ("closed", "open", or "half-open") now and whenever it changes. When
+// routing, fn is called for each named endpoint; otherwise endpoint is "". It
+// must be called before Start.
+func (n *Notifier) OnCircuitStateChange(fn func(endpoint, state string)) {
+	if len(n.endpoints) > 0 {
+		for _, ep := range n.endpoints {
+			ep.OnCircuitStateChange(fn)
+		}
+		return
+	}
+	n.circuitObserver = fn
+	fn(n.name, n.breaker.currentState().String())
+}
+
+// circuitChanged logs a circuit breaker state change and reports it to the
+// registered observer.
+func (n *Notifier) circuitChanged(from, to circuitState) {
+	fields := []zap.Field{
+		zap.String("from", from.String()),
+		zap.String("to", to.String()),
+	}
+	switch to {
+	case circuitOpen:
+		n.logger.Warn("endpoint circuit breaker opened, suspending deliveries",
+			append(fields, zap.Duration("open_duration", n.cfg.Endpoint.CircuitBreaker.OpenDuration.Duration))...)
+	case circuitHalfOpen:
+		n.logger.Info("endpoint circuit breaker half-open, sending probe", fields...)
+	default:
+		n.logger.Info("endpoint circuit breaker closed, resuming deliveries", fields...)
+	}
+	if n.circuitObserver != nil {
+		n.circuitObserver(n.name, to.String())
+	}
+}
+
+// recordEndpointResult feeds the outcome of one delivery request to the
+// circuit breaker and updates the endpoint health metrics.
+func (n *Notifier) recordEndpointResult(failed bool) {
+	n.breaker.record(failed)
+	up := !failed && n.breaker.currentState() == circuitClosed
+	if n.name != "" {
+		n.metrics.RecordRoutedEndpointHealth(n.name, up)
+		return
+	}
+	n.metrics.RecordEndpointHealth(up, n.breaker.consecutiveFailures())
+}
+
+// recordRouted counts the outcome of a delivery to a named endpoint.
+func (n *Notifier) recordRouted(eventType, result string) {
+	if n.name != "" {
+		n.metrics.RecordRoutedDelivery(n.name, eventType, result)
 	}
 }
 
@@ -72,11 +184,86 @@ func (n *Notifier) Start(ctx context.Context) {
 	}
 }
 
-// poll fetches a batch of pending notifications and processes each one.
+// poll fetches a batch of pending notifications and delivers them. While the
+// circuit breaker is open nothing is fetched; when it is half-open a single
+// event is sent as a probe.
 func (n *Notifier) poll(ctx context.Context) {
-	pending, err := n.db.GetPendingNotifications(n.cfg.Worker.BatchSize)
+	n.metrics.RecordHeartbeat("notifier")
+	n.recordBacklog()
+	if len(n.endpoints) > 0 {
+		n.pollRoutes(ctx)
+		return
+	}
+
+	limit, ok := n.deliveryLimit(n.cfg.Worker.BatchSize)
+	if !ok {
+		return
+	}
+
+	pending, err := n.db.GetPendingNotifications(limit, n.cfg.Worker.OrderingKey)
 	if err != nil {
 		n.logger.Error("failed to fetch pending notifications", zap.Error(err))
+		n.metrics.RecordComponentHealth("notifier", false)
+		return
+	}
+	n.metrics.RecordComponentHealth("notifier", true)
+
+	start := time.Now()
+	n.deliver(ctx, pending)
+	if len(pending) > 0 {
+		n.metrics.RecordWorkerCycle("notifier", len(pending), time.Since(start))
+	}
+}
+
+// recordBacklog updates the pending notification and queue size gauges.
+func (n *Notifier) recordBacklog() {
+	counts, err := n.db.CountPendingNotifications()
+	if err != nil {
+		n.logger.Error("failed to count pending notifications", zap.Error(err))
+		return
+	}
+	n.metrics.RecordPending(counts)
+}
+
+// deliveryLimit returns how many of limit events may be sent to the endpoint
+// now: none while it is paused or its circuit breaker is open, and a single
+// probe while the breaker is half-open. ok is false when none may be sent.
+func (n *Notifier) deliveryLimit(limit int) (int, bool) {
+	if until, paused := n.paused(); paused {
+		n.logger.Debug("endpoint paused by Retry-After, skipping poll", zap.Time("paused_until", until))
+		return 0, false
+	}
+
+	switch n.breaker.currentState() {
+	case circuitOpen:
+		n.logger.Debug("endpoint circuit breaker open, skipping poll")
+		return 0, false
+	case circuitHalfOpen:
+		return 1, true
+	}
+	return limit, true
+}
+
+// resumeAt returns when deliveries to the endpoint may resume after a
+// Retry-After pause or an open circuit breaker, or the zero time if they are
+// not held back.
+func (n *Notifier) resumeAt() time.Time {
+	until, _ := n.paused()
+	if open := n.breaker.openUntil(); open.After(until) {
+		until = open
+	}
+	if until.After(time.Now()) {
+		return until
+	}
+	return time.Time{}
+}
+
+// deliver processes each pending object in turn, or delivers them as
+// CloudEvents batches when batch mode is enabled and the circuit breaker is
+// closed.
+func (n *Notifier) deliver(ctx context.Context, pending []*models.ManagedObject) {
+	if n.batching() && n.breaker.currentState() == circuitClosed {
+		n.processBatch(ctx, pending)
 		return
 	}
 
@@ -85,61 +272,222 @@ func (n *Notifier) poll(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		default:
-			n.processNotification(ctx, obj)
+			if _, paused := n.paused(); paused {
+				return
+			}
+			if !n.breaker.allow() {
+				return
+			}
+			if !n.processNotification(ctx, obj) {
+				n.breaker.release()
+			}
 		}
 	}
 }
 
-// processNotification determines the event type, builds the payload, sends the
-// HTTP request, and handles the response.
-func (n *Notifier) processNotification(ctx context.Context, obj *models.ManagedObject) {
-	// Determine event type.
-	var eventType string
+// paused reports whether deliveries are paused and until when.
+func (n *Notifier) paused() (time.Time, bool) {
+	n.pauseMu.Lock()
+	defer n.pauseMu.Unlock()
+	return n.pausedUntil, time.Now().Before(n.pausedUntil)
+}
+
+// pause stops deliveries to the endpoint until the given time. An existing
+// longer pause is kept.
+func (n *Notifier) pause(until time.Time) {
+	n.pauseMu.Lock()
+	defer n.pauseMu.Unlock()
+	if until.After(n.pausedUntil) {
+		n.pausedUntil = until
+	}
+}
+
+// eventTypeFor returns the event that is due for obj, or "" when nothing is
+// pending.
+func eventTypeFor(obj *models.ManagedObject) string {
 	if !obj.NotifiedCreated {
-		eventType = "created"
-	} else if obj.ClusterState == models.ClusterStateDeleted && !obj.NotifiedDeleted {
-		eventType = "deleted"
-	} else {
-		// Nothing to notify.
-		return
+		return "created"
+	}
+	if obj.ClusterState == models.ClusterStateDeleted && !obj.NotifiedDeleted {
+		return "deleted"
 	}
+	return ""
+}
 
-	// Build the CloudEvents envelope.
-	ce := buildCloudEvent(obj, eventType, n.cfg)
+// validatePayload checks ce against the data schema when validation is
+// enabled. A payload that violates the published schema will never succeed,
+// so it is failed permanently rather than retried; false is returned in that
+// case.
+func (n *Notifier) validatePayload(ctx context.Context, obj *models.ManagedObject, eventType string, ce *models.CloudEvent) bool {
+	if n.validator == nil {
+		return true
+	}
+	err := n.validator.Validate(ce.Data)
+	if err == nil {
+		return true
+	}
 
-	// Build the HTTP request.
-	req, err := n.buildRequest(ce)
-	if err != nil {
-		n.logger.Error("failed to build notification request",
+	n.logger.Error("notification payload failed schema validation",
+		zap.String("object_id", obj.ID),
+		zap.String("event_type", eventType),
+		zap.Error(err),
+	)
+	if dbErr := n.store.failed(ctx, obj, eventType, 0); dbErr != nil {
+		n.logger.Error("failed to mark notification as failed",
 			zap.String("object_id", obj.ID),
-			zap.Error(err),
+			zap.Error(dbErr),
 		)
-		return
 	}
+	n.metrics.RecordNotificationFailed(eventType, 0)
+	n.recordRouted(eventType, "failed")
+	return false
+}
 
-	// Send the request with the configured timeout.
-	sendCtx, cancel := context.WithTimeout(ctx, n.cfg.Endpoint.Timeout.Duration)
-	defer cancel()
-	req = req.WithContext(sendCtx)
+// processNotification determines the event type, builds the payload, delivers
+// it through the sink, and records the outcome. The delivery is traced in a
+// span that continues the trace in which the event was detected, and the
+// span's trace context is sent with the event. It reports whether a request
+// was sent to the endpoint.
+func (n *Notifier) processNotification(ctx context.Context, obj *models.ManagedObject) bool {
+	ctx, span := n.tracer.Start(tracing.ContextWithTraceParent(ctx, traceParentOf(obj, eventTypeFor(obj))),
+		"notifier.processNotification", trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(n.spanAttributes(obj)...))
+	defer span.End()
+
+	if !n.ackTimedOut(ctx, obj) {
+		return false
+	}
+	eventType := n.nextEvent(ctx, obj)
+	if eventType == "" {
+		// Nothing to notify.
+		return false
+	}
+	span.SetAttributes(attribute.String("beacon.event.type", eventType))
+
+	// Build the CloudEvents envelope.
+	ce := n.cloudEvent(obj, eventType)
+	setTraceParent(ce, tracing.TraceParent(ctx))
+	if !n.validatePayload(ctx, obj, eventType, ce) {
+		return false
+	}
+
+	start := time.Now()
+	err := n.sink.Send(ctx, ce)
+	latency := time.Since(start)
+	recordResult(span, err)
+	n.recordEndpointResult(isEndpointFailure(err))
+	n.metrics.RecordNotificationDuration(obj.ResourceType, eventType, resultStatus(err), latency)
+	n.recordAttempt(ctx, obj, eventType, err, latency)
+	n.auditAttempt(obj, eventType, ce, err, latency)
+	n.handleResult(ctx, obj, eventType, err)
+	return true
+}
+
+// resultStatus returns the status label of a delivery attempt's outcome.
+func resultStatus(err error) string {
+	var statusErr *StatusError
+	var permErr *PermanentError
+	switch {
+	case err == nil:
+		return "success"
+	case errors.Is(err, ErrAwaitingAck):
+		return "accepted"
+	case errors.As(err, &statusErr):
+		if isRetriable(statusErr.StatusCode) {
+			return "retry"
+		}
+		return "failed"
+	case errors.As(err, &permErr):
+		return "failed"
+	default:
+		return "retry"
+	}
+}
+
+// recordDelivered records the metrics of an event the destination has
+// received: the latency since the event was detected, and how many attempts
+// its delivery took.
+func (n *Notifier) recordDelivered(obj *models.ManagedObject, eventType string) {
+	detected := obj.CreatedAt
+	if eventType != "created" && obj.DeletedAt != nil {
+		detected = *obj.DeletedAt
+	}
+	n.metrics.RecordNotificationSent(eventType)
+	n.metrics.RecordNotificationDelivered(obj.ResourceType, eventType, time.Since(detected), obj.NotificationAttempts+1)
+	if n.name == "" {
+		n.metrics.RecordEndpointSuccess()
+	}
+}
+
+// spanAttributes returns the attributes of the span delivering obj's events.
+func (n *Notifier) spanAttributes(obj *models.ManagedObject) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.String("beacon.object.id", obj.ID),
+		attribute.String("beacon.resource.uid", obj.ResourceUID),
+		attribute.String("beacon.resource.type", obj.ResourceType),
+		attribute.Int("beacon.delivery.attempt", obj.NotificationAttempts+1),
+	}
+	if n.name != "" {
+		attrs = append(attrs, attribute.String("beacon.endpoint", n.name))
+	}
+	return attrs
+}
 
-	resp, sendErr := n.client.Do(req)
-	if resp != nil && resp.Body != nil {
-		defer resp.Body.Close()
+// traceParentOf returns the trace context in which eventType of obj was
+// detected; an ephemeral event takes that of the deletion it replaces.
+func traceParentOf(obj *models.ManagedObject, eventType string) string {
+	if eventType == "deleted" || eventType == eventTypeEphemeral {
+		return obj.DeletedTraceParent
 	}
+	return obj.CreatedTraceParent
+}
 
-	n.handleResponse(obj, eventType, resp, sendErr)
+// recordResult records the outcome of a delivery on span.
+func recordResult(span trace.Span, err error) {
+	var statusErr *StatusError
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrAwaitingAck):
+		span.SetAttributes(attribute.Bool("beacon.awaiting_ack", true))
+	case errors.As(err, &statusErr):
+		span.SetAttributes(attribute.Int("http.response.status_code", statusErr.StatusCode))
+		tracing.Fail(span, err)
+	default:
+		tracing.Fail(span, err)
+	}
+}
+
+// cloudEvent builds the CloudEvent for obj and re-applies the payload deny
+// rules and redact action, so rows persisted before such a rule was added do
+// not leak the values it protects.
+func (n *Notifier) cloudEvent(obj *models.ManagedObject, eventType string) *models.CloudEvent {
+	ce := buildCloudEvent(obj, eventType, n.cfg)
+	ce.Data.Metadata.Labels = n.filter.SanitizeStoredLabels(ce.Data.Metadata.Labels)
+	ce.Data.Metadata.Annotations = n.filter.SanitizeStoredAnnotations(ce.Data.Metadata.Annotations)
+	if err := n.applyExtensions(ce, obj, eventType); err != nil {
+		n.logger.Warn("failed to set CloudEvents extension attributes",
+			zap.String("object_id", obj.ID),
+			zap.Error(err),
+		)
+	}
+	setSequence(ce, obj, eventType)
+	if eventType == eventTypeEphemeral {
+		ce.Data.Lifespan = lifespanOf(obj)
+	}
+	return ce
 }
 
 // buildCloudEvent constructs a CloudEvents v1.0 envelope from a ManagedObject.
 func buildCloudEvent(obj *models.ManagedObject, eventType string, cfg *config.Config) *models.CloudEvent {
 	ce := &models.CloudEvent{
 		SpecVersion:     "1.0",
-		ID:              obj.ID,
+		ID:              eventID(obj.ID, eventType),
 		Source:          fmt.Sprintf("%s/%s/%s", cfg.CloudEvents.Source, obj.ResourceNamespace, obj.ResourceType),
 		Type:            fmt.Sprintf("%s.%s", cfg.CloudEvents.TypePrefix, eventType),
 		Subject:         obj.ResourceName,
 		Time:            time.Now().UTC().Format(time.RFC3339),
 		DataContentType: "application/json",
+		DataSchema:      cfg.CloudEvents.DataSchema,
 		Data: models.CloudEventData{
 			Resource: models.NotificationResource{
 				UID:             obj.ResourceUID,
@@ -170,30 +518,65 @@ func buildCloudEvent(obj *models.ManagedObject, eventType string, cfg *config.Co
 		}
 	}
 
+	// Parse extracted fields, keeping numbers exact so integers are not
+	// re-encoded as floats.
+	if obj.Fields != "" {
+		var fields map[string]interface{}
+		dec := json.NewDecoder(strings.NewReader(obj.Fields))
+		dec.UseNumber()
+		if err := dec.Decode(&fields); err == nil && len(fields) > 0 {
+			ce.Data.Fields = fields
+		}
+	}
+
 	return ce
 }
 
-// handleResponse inspects the HTTP response (or error) and updates the
-// database and metrics accordingly.
-func (n *Notifier) handleResponse(obj *models.ManagedObject, eventType string, resp *http.Response, err error) {
-	// Network error or timeout: treat as retriable.
-	if err != nil {
-		n.logger.Warn("notification request failed",
-			zap.String("object_id", obj.ID),
-			zap.String("event_type", eventType),
-			zap.Error(err),
-		)
-		n.incrementAttempts(obj)
-		n.metrics.RecordEndpointHealth(false)
-		return
+// handleResult updates the database and metrics for the outcome of one
+// delivery attempt. err is nil on success, ErrAwaitingAck when the
+// destination will acknowledge the event later, a *StatusError when the
+// destination rejected the event, a *PermanentError when the event can never
+// be delivered, and any other error for transient failures.
+func (n *Notifier) handleResult(ctx context.Context, obj *models.ManagedObject, eventType string, err error) {
+	var statusErr *StatusError
+	var permErr *PermanentError
+	switch {
+	case err == nil:
+		n.handleStatus(ctx, obj, eventType, http.StatusOK, 0)
+	case errors.Is(err, ErrAwaitingAck):
+		n.handleAccepted(ctx, obj, eventType)
+	case errors.As(err, &statusErr):
+		n.handleStatus(ctx, obj, eventType, statusErr.StatusCode, statusErr.RetryAfter, responseFields(statusErr)...)
+	case errors.As(err, &permErr):
+		n.handlePermanentError(ctx, obj, eventType, permErr)
+	default:
+		n.handleSendError(ctx, obj, eventType, err)
 	}
+}
 
-	statusCode := resp.StatusCode
+// handleSendError records a delivery that produced no response. Network
+// errors and timeouts are treated as retriable.
+func (n *Notifier) handleSendError(ctx context.Context, obj *models.ManagedObject, eventType string, err error) {
+	n.logger.Warn("notification request failed",
+		zap.String("object_id", obj.ID),
+		zap.String("event_type", eventType),
+		zap.Error(err),
+	)
+	n.incrementAttempts(ctx, obj, eventType, n.backoff(obj))
+}
 
+// handleStatus updates the database and metrics for an event the destination
+// answered with statusCode. Statuses use HTTP semantics; sinks without status
+// codes report success as 200. retryAfter is the delay requested by the
+// destination's Retry-After header, if any, and response describes the
+// destination's response in failure logs.
+func (n *Notifier) handleStatus(ctx context.Context, obj *models.ManagedObject, eventType string, statusCode int, retryAfter time.Duration, response ...zap.Field) {
 	switch {
 	case statusCode >= 200 && statusCode < 300:
 		// Success: mark as notified.
-		if dbErr := n.db.UpdateNotificationStatus(obj.ID, eventType, time.Now().UTC()); dbErr != nil {
+		if eventType == eventTypeEphemeral {
+			n.markCoalesced(ctx, obj, models.CoalescedEphemeral)
+		} else if dbErr := n.store.sent(ctx, obj, eventType, time.Now().UTC()); dbErr != nil {
 			n.logger.Error("failed to update notification status",
 				zap.String("object_id", obj.ID),
 				zap.Error(dbErr),
@@ -204,52 +587,103 @@ func (n *Notifier) handleResponse(obj *models.ManagedObject, eventType string, r
 			zap.String("event_type", eventType),
 			zap.Int("status_code", statusCode),
 		)
-		n.metrics.RecordNotificationSent(eventType)
-		n.metrics.RecordEndpointHealth(true)
+		n.recordDelivered(obj, eventType)
+		n.recordRouted(eventType, "sent")
 
 	case isRetriable(statusCode):
-		// Retriable server/rate-limit error: increment attempts with backoff.
-		backoff := calculateBackoff(
-			obj.NotificationAttempts,
-			n.cfg.Endpoint.Retry.InitialBackoff.Duration,
-			n.cfg.Endpoint.Retry.MaxBackoff.Duration,
-			n.cfg.Endpoint.Retry.BackoffMultiplier,
-			n.cfg.Endpoint.Retry.Jitter,
-		)
-		n.logger.Warn("retriable notification failure",
+		// Retriable server/rate-limit error: schedule the next attempt after
+		// the backoff, or after the requested Retry-After delay if longer.
+		backoff := n.backoff(obj)
+		if limit := n.cfg.Endpoint.RetryAfter.MaxDelay.Duration; limit > 0 && retryAfter > limit {
+			retryAfter = limit
+		}
+		if retryAfter > backoff {
+			backoff = retryAfter
+		}
+		n.logger.Warn("retriable notification failure", append([]zap.Field{
 			zap.String("object_id", obj.ID),
 			zap.String("event_type", eventType),
 			zap.Int("status_code", statusCode),
 			zap.Int("attempt", obj.NotificationAttempts+1),
+			zap.Duration("retry_after", retryAfter),
 			zap.Duration("next_backoff", backoff),
-		)
-		n.incrementAttempts(obj)
-		n.metrics.RecordEndpointHealth(false)
+		}, response...)...)
+		if retryAfter > 0 && n.pausesEndpoint(statusCode) {
+			n.logger.Warn("endpoint requested a pause, suspending deliveries",
+				zap.Int("status_code", statusCode),
+				zap.Duration("retry_after", retryAfter),
+			)
+			n.pause(time.Now().Add(retryAfter))
+		}
+		n.incrementAttempts(ctx, obj, eventType, backoff)
+		n.recordRouted(eventType, "retry")
 
 	default:
 		// Non-retriable client error (400, 401, 403, 404, 422, etc.).
-		ce := buildCloudEvent(obj, eventType, n.cfg)
+		ce := n.cloudEvent(obj, eventType)
 		payloadBytes, _ := json.Marshal(ce)
-		n.logger.Error("non-retriable notification failure",
+		n.logger.Error("non-retriable notification failure", append([]zap.Field{
 			zap.String("object_id", obj.ID),
 			zap.String("event_type", eventType),
 			zap.Int("status_code", statusCode),
 			zap.String("payload", string(payloadBytes)),
-		)
-		if dbErr := n.db.MarkNotificationFailed(obj.ID, statusCode); dbErr != nil {
+		}, response...)...)
+		if dbErr := n.store.failed(ctx, obj, eventType, statusCode); dbErr != nil {
 			n.logger.Error("failed to mark notification as failed",
 				zap.String("object_id", obj.ID),
 				zap.Error(dbErr),
 			)
 		}
 		n.metrics.RecordNotificationFailed(eventType, statusCode)
-		n.metrics.RecordEndpointHealth(false)
+		n.recordRouted(eventType, "failed")
+	}
+}
+
+// handlePermanentError fails an event that the sink reports can never be
+// delivered, without waiting for the retry budget to run out.
+func (n *Notifier) handlePermanentError(ctx context.Context, obj *models.ManagedObject, eventType string, err error) {
+	n.logger.Error("non-retriable notification failure",
+		zap.String("object_id", obj.ID),
+		zap.String("event_type", eventType),
+		zap.Error(err),
+	)
+	if dbErr := n.store.failed(ctx, obj, eventType, 0); dbErr != nil {
+		n.logger.Error("failed to mark notification as failed",
+			zap.String("object_id", obj.ID),
+			zap.Error(dbErr),
+		)
+	}
+	n.metrics.RecordNotificationFailed(eventType, 0)
+	n.recordRouted(eventType, "failed")
+}
+
+// pausesEndpoint reports whether a Retry-After on statusCode applies to the
+// whole endpoint rather than only to the affected event.
+func (n *Notifier) pausesEndpoint(statusCode int) bool {
+	for _, code := range n.cfg.Endpoint.RetryAfter.PauseStatuses {
+		if code == statusCode {
+			return true
+		}
 	}
+	return false
+}
+
+// backoff returns the retry delay for obj's next attempt.
+func (n *Notifier) backoff(obj *models.ManagedObject) time.Duration {
+	return calculateBackoff(
+		obj.NotificationAttempts,
+		n.cfg.Endpoint.Retry.InitialBackoff.Duration,
+		n.cfg.Endpoint.Retry.MaxBackoff.Duration,
+		n.cfg.Endpoint.Retry.BackoffMultiplier,
+		n.cfg.Endpoint.Retry.Jitter,
+	)
 }
 
-// incrementAttempts bumps the notification attempt counter in the database.
-func (n *Notifier) incrementAttempts(obj *models.ManagedObject) {
-	if err := n.db.IncrementNotificationAttempts(obj.ID); err != nil {
+// incrementAttempts bumps the notification attempt counter in the database
+// and schedules the next attempt after delay.
+func (n *Notifier) incrementAttempts(ctx context.Context, obj *models.ManagedObject, eventType string, delay time.Duration) {
+	n.metrics.RecordRetryBackoff(obj.NotificationAttempts+1, delay)
+	if err := n.store.retry(ctx, obj, eventType, time.Now().Add(delay)); err != nil {
 		n.logger.Error("failed to increment notification attempts",
 			zap.String("object_id", obj.ID),
 			zap.Error(err),
@@ -294,48 +728,3 @@ func isRetriable(statusCode int) bool {
 		return false
 	}
 }
-
-// buildRequest constructs the HTTP POST request for a CloudEvents envelope.
-func (n *Notifier) buildRequest(ce *models.CloudEvent) (*http.Request, error) {
-	body, err := json.Marshal(ce)
-	if err != nil {
-		return nil, fmt.Errorf("marshalling CloudEvent: %w", err)
-	}
-
-	req, err := http.NewRequest(http.MethodPost, n.cfg.Endpoint.URL, bytes.NewReader(body))
-	if err != nil {
-		return nil, fmt.Errorf("creating HTTP request: %w", err)
-	}
-
-	// Standard headers.
-	req.Header.Set("User-Agent", fmt.Sprintf("beacon/%s", n.cfg.App.Version))
-	req.Header.Set("X-Request-ID", newUUID())
-
-	// Bearer token authentication.
-	if n.cfg.AuthToken != "" {
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", n.cfg.AuthToken))
-	}
-
-	// Custom headers from configuration.
-	for k, v := range n.cfg.Endpoint.Headers {
-		req.Header.Set(k, v)
-	}
-
-	// CloudEvents structured content mode — set after custom headers to
-	// prevent accidental override.
-	req.Header.Set("Content-Type", "application/cloudevents+json; charset=UTF-8")
-
-	return req, nil
-}
-
-// newUUID generates a version-4 UUID string without requiring an external
-// dependency.
-func newUUID() string {
-	var uuid [16]byte
-	_, _ = rand.Read(uuid[:])
-	// Set version 4 and variant bits per RFC 4122.
-	uuid[6] = (uuid[6] & 0x0f) | 0x40
-	uuid[8] = (uuid[8] & 0x3f) | 0x80
-	return fmt.Sprintf("%08x-%04x-%04x-%04x-%012x",
-		uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:16])
-}
@@ -1,6 +1,7 @@
 package notifier
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -12,6 +13,8 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"go.uber.org/zap/zaptest/observer"
@@ -84,6 +87,12 @@ func newTestNotifier(cfg *config.Config, mockDB *database.MockDatabase, mockClie
 	return n, logs
 }
 
+// httpSink returns the HTTP sink a Notifier created by newTestNotifier
+// delivers through.
+func httpSink(n *Notifier) *HTTPSink {
+	return n.sink.(*HTTPSink)
+}
+
 // --- Tests ---
 
 func TestHandleResponse_200_MarksNotified(t *testing.T) {
@@ -101,11 +110,11 @@ func TestHandleResponse_200_MarksNotified(t *testing.T) {
 
 	mockDB.On("UpdateNotificationStatus", obj.ID, "created", mock.AnythingOfType("time.Time")).Return(nil)
 
-	n.handleResponse(obj, "created", resp, nil)
+	n.handleResult(context.Background(), obj, "created", responseError(resp, nil))
 
 	mockDB.AssertCalled(t, "UpdateNotificationStatus", obj.ID, "created", mock.AnythingOfType("time.Time"))
 	mockDB.AssertNotCalled(t, "MarkNotificationFailed", mock.Anything, mock.Anything)
-	mockDB.AssertNotCalled(t, "IncrementNotificationAttempts", mock.Anything)
+	mockDB.AssertNotCalled(t, "IncrementNotificationAttempts", mock.Anything, mock.Anything)
 }
 
 func TestHandleResponse_500_IncrementsAttempts(t *testing.T) {
@@ -121,11 +130,11 @@ func TestHandleResponse_500_IncrementsAttempts(t *testing.T) {
 		Body:       io.NopCloser(strings.NewReader("")),
 	}
 
-	mockDB.On("IncrementNotificationAttempts", obj.ID).Return(nil)
+	mockDB.On("IncrementNotificationAttempts", obj.ID, mock.AnythingOfType("time.Time")).Return(nil)
 
-	n.handleResponse(obj, "created", resp, nil)
+	n.handleResult(context.Background(), obj, "created", responseError(resp, nil))
 
-	mockDB.AssertCalled(t, "IncrementNotificationAttempts", obj.ID)
+	mockDB.AssertCalled(t, "IncrementNotificationAttempts", obj.ID, mock.AnythingOfType("time.Time"))
 	mockDB.AssertNotCalled(t, "UpdateNotificationStatus", mock.Anything, mock.Anything, mock.Anything)
 	mockDB.AssertNotCalled(t, "MarkNotificationFailed", mock.Anything, mock.Anything)
 }
@@ -145,7 +154,7 @@ func TestHandleResponse_400_LogsPayloadAndMarksFailed(t *testing.T) {
 
 	mockDB.On("MarkNotificationFailed", obj.ID, http.StatusBadRequest).Return(nil)
 
-	n.handleResponse(obj, "created", resp, nil)
+	n.handleResult(context.Background(), obj, "created", responseError(resp, nil))
 
 	// Verify MarkNotificationFailed was called with the status code.
 	mockDB.AssertCalled(t, "MarkNotificationFailed", obj.ID, http.StatusBadRequest)
@@ -169,7 +178,7 @@ func TestHandleResponse_400_LogsPayloadAndMarksFailed(t *testing.T) {
 	assert.True(t, found, "expected ERROR log with 'payload' field for non-retriable failure")
 
 	mockDB.AssertNotCalled(t, "UpdateNotificationStatus", mock.Anything, mock.Anything, mock.Anything)
-	mockDB.AssertNotCalled(t, "IncrementNotificationAttempts", mock.Anything)
+	mockDB.AssertNotCalled(t, "IncrementNotificationAttempts", mock.Anything, mock.Anything)
 }
 
 func TestHandleResponse_NetworkError_IncrementsAttempts(t *testing.T) {
@@ -181,11 +190,11 @@ func TestHandleResponse_NetworkError_IncrementsAttempts(t *testing.T) {
 
 	obj := testObject()
 
-	mockDB.On("IncrementNotificationAttempts", obj.ID).Return(nil)
+	mockDB.On("IncrementNotificationAttempts", obj.ID, mock.AnythingOfType("time.Time")).Return(nil)
 
-	n.handleResponse(obj, "created", nil, assert.AnError)
+	n.handleResult(context.Background(), obj, "created", responseError(nil, assert.AnError))
 
-	mockDB.AssertCalled(t, "IncrementNotificationAttempts", obj.ID)
+	mockDB.AssertCalled(t, "IncrementNotificationAttempts", obj.ID, mock.AnythingOfType("time.Time"))
 	mockDB.AssertNotCalled(t, "UpdateNotificationStatus", mock.Anything, mock.Anything, mock.Anything)
 	mockDB.AssertNotCalled(t, "MarkNotificationFailed", mock.Anything, mock.Anything)
 }
@@ -261,7 +270,7 @@ func TestBuildRequest_ValidRequest(t *testing.T) {
 	obj := testObject()
 	ce := buildCloudEvent(obj, "created", cfg)
 
-	req, err := n.buildRequest(ce)
+	req, err := httpSink(n).buildRequest(ce)
 	require.NoError(t, err)
 
 	assert.Equal(t, http.MethodPost, req.Method)
@@ -283,7 +292,7 @@ func TestBuildRequest_Headers(t *testing.T) {
 	obj := testObject()
 	ce := buildCloudEvent(obj, "created", cfg)
 
-	req, err := n.buildRequest(ce)
+	req, err := httpSink(n).buildRequest(ce)
 	require.NoError(t, err)
 
 	// Content-Type must be CloudEvents structured content mode.
@@ -318,7 +327,7 @@ func TestBuildRequest_NoAuthTokenOmitsHeader(t *testing.T) {
 	obj := testObject()
 	ce := buildCloudEvent(obj, "created", cfg)
 
-	req, err := n.buildRequest(ce)
+	req, err := httpSink(n).buildRequest(ce)
 	require.NoError(t, err)
 
 	assert.Empty(t, req.Header.Get("Authorization"), "Authorization header should be absent when no token is configured")
@@ -331,7 +340,8 @@ func TestBuildCloudEvent(t *testing.T) {
 	ce := buildCloudEvent(obj, "created", cfg)
 
 	assert.Equal(t, "1.0", ce.SpecVersion)
-	assert.Equal(t, obj.ID, ce.ID)
+	assert.Equal(t, obj.ID+":created", ce.ID)
+	assert.Equal(t, obj.ID+":deleted", buildCloudEvent(obj, "deleted", cfg).ID, "each event of an object has its own id")
 	assert.Equal(t, "/beacon/default/ConfigMap", ce.Source)
 	assert.Equal(t, "net.bakerapps.beacon.resource.created", ce.Type)
 	assert.Equal(t, obj.ResourceName, ce.Subject)
@@ -369,6 +379,211 @@ func TestBuildCloudEvent_EmptyAnnotationsOmitted(t *testing.T) {
 	assert.Nil(t, ce.Data.Metadata.Annotations)
 }
 
+func TestBuildCloudEvent_WithFields(t *testing.T) {
+	cfg := testConfig()
+	obj := testObject()
+	obj.Fields = `{"model":"llama","replicas":3,"big":9007199254740993}`
+
+	ce := buildCloudEvent(obj, "created", cfg)
+	require.NotNil(t, ce.Data.Fields)
+	assert.Equal(t, "llama", ce.Data.Fields["model"])
+
+	body, err := json.Marshal(ce)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `"replicas":3`)
+	assert.Contains(t, string(body), `"big":9007199254740993`)
+}
+
+func TestBuildCloudEvent_NoFieldsOmitted(t *testing.T) {
+	cfg := testConfig()
+	ce := buildCloudEvent(testObject(), "created", cfg)
+
+	body, err := json.Marshal(ce)
+	require.NoError(t, err)
+	assert.NotContains(t, string(body), `"fields"`)
+}
+
+func TestCloudEvent_AppliesRedaction(t *testing.T) {
+	cfg := testConfig()
+	cfg.Payload.Redact = []config.RedactConfig{
+		{Keys: []string{"example.com/owner"}},
+		{Keys: []string{"example.com/email"}, Action: "sha256"},
+	}
+	cfg.Payload.LabelFilter.Deny = []string{"env"}
+	n, _ := newTestNotifier(cfg, new(database.MockDatabase), new(MockHTTPClient))
+
+	// Row persisted before the deny and redact rules were configured, with
+	// a value hashed at ingestion.
+	obj := testObject()
+	obj.Labels = `{"app":"web","env":"prod"}`
+	obj.Annotations = `{"example.com/owner":"team-platform","example.com/email":"sha256:0a1b"}`
+
+	ce := n.cloudEvent(obj, "created")
+
+	assert.Equal(t, map[string]string{"app": "web"}, ce.Data.Metadata.Labels)
+	assert.Equal(t, map[string]string{"example.com/owner": "[REDACTED]", "example.com/email": "sha256:0a1b"},
+		ce.Data.Metadata.Annotations, "stored hashes are not hashed again")
+}
+
+func TestBuildRequest_BinaryMode(t *testing.T) {
+	cfg := testConfig()
+	cfg.CloudEvents.Mode = config.CloudEventsModeBinary
+	cfg.CloudEvents.DataSchema = "https://example.com/schemas/data.json"
+	cfg.CloudEvents.Extensions = []config.ExtensionConfig{
+		{Name: "cluster", Value: "prod-east"},
+		{Name: "partitionkey", Template: "{{ .Namespace }}/{{ .Name }}"},
+	}
+	n, _ := newTestNotifier(cfg, new(database.MockDatabase), new(MockHTTPClient))
+
+	obj := testObject()
+	req, err := httpSink(n).buildRequest(n.cloudEvent(obj, "created"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+	assert.Equal(t, "1.0", req.Header.Get("ce-specversion"))
+	assert.Equal(t, obj.ID+":created", req.Header.Get("ce-id"))
+	assert.Equal(t, "/beacon/default/ConfigMap", req.Header.Get("ce-source"))
+	assert.Equal(t, "net.bakerapps.beacon.resource.created", req.Header.Get("ce-type"))
+	assert.Equal(t, obj.ResourceName, req.Header.Get("ce-subject"))
+	assert.NotEmpty(t, req.Header.Get("ce-time"))
+	assert.Equal(t, "https://example.com/schemas/data.json", req.Header.Get("ce-dataschema"))
+	assert.Equal(t, "prod-east", req.Header.Get("ce-cluster"))
+	assert.Equal(t, "default/my-config", req.Header.Get("ce-partitionkey"))
+
+	// The body is the bare data payload, not an envelope.
+	body, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	var data map[string]interface{}
+	require.NoError(t, json.Unmarshal(body, &data))
+	assert.Contains(t, data, "resource")
+	assert.NotContains(t, data, "specversion")
+}
+
+func TestBuildRequest_StructuredModeExtensions(t *testing.T) {
+	cfg := testConfig()
+	cfg.CloudEvents.Extensions = []config.ExtensionConfig{
+		{Name: "partitionkey", Template: "{{ .UID }}"},
+	}
+	n, _ := newTestNotifier(cfg, new(database.MockDatabase), new(MockHTTPClient))
+
+	req, err := httpSink(n).buildRequest(n.cloudEvent(testObject(), "created"))
+	require.NoError(t, err)
+	assert.Equal(t, "application/cloudevents+json; charset=UTF-8", req.Header.Get("Content-Type"))
+	assert.Empty(t, req.Header.Get("ce-id"))
+
+	body, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	var envelope map[string]interface{}
+	require.NoError(t, json.Unmarshal(body, &envelope))
+	assert.Equal(t, "uid-aaa-bbb", envelope["partitionkey"])
+}
+
+func TestCloudEvent_ExtensionTemplateErrorOmitsAttribute(t *testing.T) {
+	cfg := testConfig()
+	cfg.CloudEvents.Extensions = []config.ExtensionConfig{
+		{Name: "owner", Template: `{{ index .Labels "owner" }}`},
+		{Name: "bad", Template: "{{ .Missing }}"},
+	}
+	n, logs := newTestNotifier(cfg, new(database.MockDatabase), new(MockHTTPClient))
+
+	ce := n.cloudEvent(testObject(), "created")
+	assert.NotContains(t, ce.Extensions, "bad")
+	assert.NotContains(t, ce.Extensions, "owner", "empty values are not sent")
+	assert.Equal(t, 1, logs.FilterMessage("failed to set CloudEvents extension attributes").Len())
+}
+
+func TestCloudEvent_Sequence(t *testing.T) {
+	cfg := testConfig()
+	cfg.CloudEvents.Mode = config.CloudEventsModeBinary
+	n, _ := newTestNotifier(cfg, new(database.MockDatabase), new(MockHTTPClient))
+
+	obj := testObject()
+	obj.CreatedSequence = 41
+	obj.DeletedSequence = 1234
+	assert.Equal(t, "0000000000000000041", n.cloudEvent(obj, "created").Extensions["sequence"])
+
+	req, err := httpSink(n).buildRequest(n.cloudEvent(obj, "deleted"))
+	require.NoError(t, err)
+	assert.Equal(t, "0000000000000001234", req.Header.Get("ce-sequence"))
+
+	obj.CreatedSequence = 0
+	assert.NotContains(t, n.cloudEvent(obj, "created").Extensions, "sequence", "events recorded without a sequence omit it")
+}
+
+func TestEncodeHeaderValue(t *testing.T) {
+	assert.Equal(t, "default/web", encodeHeaderValue("default/web"))
+	assert.Equal(t, "100%25 %22ok%22", encodeHeaderValue(`100% "ok"`))
+	assert.Equal(t, "caf%C3%A9", encodeHeaderValue("café"))
+}
+
+func TestProcessNotification_SchemaViolationMarksFailed(t *testing.T) {
+	cfg := testConfig()
+	cfg.CloudEvents.Schema.Validate = true
+	mockDB := new(database.MockDatabase)
+	mockClient := new(MockHTTPClient)
+	n, _ := newTestNotifier(cfg, mockDB, mockClient)
+
+	obj := testObject()
+	obj.ResourceUID = ""
+	mockDB.On("MarkNotificationFailed", obj.ID, 0).Return(nil)
+
+	n.processNotification(context.Background(), obj)
+
+	mockDB.AssertExpectations(t)
+	mockClient.AssertNotCalled(t, "Do", mock.Anything)
+}
+
+func TestProcessNotification_RecordsFailedAttempt(t *testing.T) {
+	cfg := testConfig()
+	cfg.Endpoint.Diagnostics = config.DiagnosticsConfig{MaxBodyBytes: 16, Headers: []string{"x-trace-id"}, MaxAttempts: 3}
+	mockDB := new(database.MockDatabase)
+	mockClient := new(MockHTTPClient)
+	n, logs := newTestNotifier(cfg, mockDB, mockClient)
+
+	obj := testObject()
+	resp := &http.Response{
+		StatusCode: http.StatusUnprocessableEntity,
+		Header:     http.Header{"X-Trace-Id": {"abc123"}, "Server": {"receiver"}},
+		Body:       io.NopCloser(strings.NewReader(`{"error":"resource.uid is not a known workload"}`)),
+	}
+	mockClient.On("Do", mock.Anything).Return(resp, nil)
+	mockDB.On("RecordDeliveryAttempt", mock.MatchedBy(func(a *models.DeliveryAttempt) bool {
+		return a.ObjectID == obj.ID &&
+			a.EventType == "created" &&
+			a.StatusCode == http.StatusUnprocessableEntity &&
+			a.ResponseBody == `{"error":"resour` &&
+			assert.ObjectsAreEqual(map[string]string{"X-Trace-Id": "abc123"}, a.ResponseHeaders) &&
+			a.Error != ""
+	}), 3).Return(nil)
+	mockDB.On("MarkNotificationFailed", obj.ID, http.StatusUnprocessableEntity).Return(nil)
+
+	n.processNotification(context.Background(), obj)
+
+	mockDB.AssertExpectations(t)
+	entries := logs.FilterMessage("non-retriable notification failure").All()
+	require.Len(t, entries, 1)
+	assert.Equal(t, `{"error":"resour`, entries[0].ContextMap()["response_body"])
+}
+
+func TestProcessNotification_RecordsNetworkError(t *testing.T) {
+	cfg := testConfig()
+	cfg.Endpoint.Diagnostics.MaxAttempts = 5
+	mockDB := new(database.MockDatabase)
+	mockClient := new(MockHTTPClient)
+	n, _ := newTestNotifier(cfg, mockDB, mockClient)
+
+	obj := testObject()
+	mockClient.On("Do", mock.Anything).Return(nil, assert.AnError)
+	mockDB.On("RecordDeliveryAttempt", mock.MatchedBy(func(a *models.DeliveryAttempt) bool {
+		return a.StatusCode == 0 && a.Error == assert.AnError.Error() && a.ResponseBody == ""
+	}), 5).Return(nil)
+	mockDB.On("IncrementNotificationAttempts", obj.ID, mock.AnythingOfType("time.Time")).Return(nil)
+
+	n.processNotification(context.Background(), obj)
+
+	mockDB.AssertExpectations(t)
+}
+
 func TestBuildCloudEvent_DeletedEvent(t *testing.T) {
 	cfg := testConfig()
 	obj := testObject()
@@ -390,7 +605,7 @@ func TestBuildRequest_BodyStructure(t *testing.T) {
 	obj := testObject()
 	ce := buildCloudEvent(obj, "created", cfg)
 
-	req, err := n.buildRequest(ce)
+	req, err := httpSink(n).buildRequest(ce)
 	require.NoError(t, err)
 
 	body, err := io.ReadAll(req.Body)
@@ -400,7 +615,7 @@ func TestBuildRequest_BodyStructure(t *testing.T) {
 	require.NoError(t, json.Unmarshal(body, &envelope))
 
 	assert.Equal(t, "1.0", envelope["specversion"])
-	assert.Equal(t, obj.ID, envelope["id"])
+	assert.Equal(t, obj.ID+":created", envelope["id"])
 	assert.Equal(t, "/beacon/default/ConfigMap", envelope["source"])
 	assert.Equal(t, "net.bakerapps.beacon.resource.created", envelope["type"])
 	assert.Equal(t, obj.ResourceName, envelope["subject"])
@@ -422,7 +637,7 @@ func TestHandleResponse_201_MarksNotified(t *testing.T) {
 
 	mockDB.On("UpdateNotificationStatus", obj.ID, "created", mock.AnythingOfType("time.Time")).Return(nil)
 
-	n.handleResponse(obj, "created", resp, nil)
+	n.handleResult(context.Background(), obj, "created", responseError(resp, nil))
 
 	mockDB.AssertCalled(t, "UpdateNotificationStatus", obj.ID, "created", mock.AnythingOfType("time.Time"))
 }
@@ -440,11 +655,11 @@ func TestHandleResponse_429_IncrementsAttempts(t *testing.T) {
 		Body:       io.NopCloser(strings.NewReader("")),
 	}
 
-	mockDB.On("IncrementNotificationAttempts", obj.ID).Return(nil)
+	mockDB.On("IncrementNotificationAttempts", obj.ID, mock.AnythingOfType("time.Time")).Return(nil)
 
-	n.handleResponse(obj, "created", resp, nil)
+	n.handleResult(context.Background(), obj, "created", responseError(resp, nil))
 
-	mockDB.AssertCalled(t, "IncrementNotificationAttempts", obj.ID)
+	mockDB.AssertCalled(t, "IncrementNotificationAttempts", obj.ID, mock.AnythingOfType("time.Time"))
 	mockDB.AssertNotCalled(t, "MarkNotificationFailed", mock.Anything, mock.Anything)
 }
 
@@ -463,7 +678,45 @@ func TestHandleResponse_422_MarksFailed(t *testing.T) {
 
 	mockDB.On("MarkNotificationFailed", obj.ID, http.StatusUnprocessableEntity).Return(nil)
 
-	n.handleResponse(obj, "created", resp, nil)
+	n.handleResult(context.Background(), obj, "created", responseError(resp, nil))
 
 	mockDB.AssertCalled(t, "MarkNotificationFailed", obj.ID, http.StatusUnprocessableEntity)
 }
+
+func TestProcessNotification_ContinuesDetectionTrace(t *testing.T) {
+	cfg := testConfig()
+	mockDB := new(database.MockDatabase)
+	mockClient := new(MockHTTPClient)
+	n, _ := newTestNotifier(cfg, mockDB, mockClient)
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	n.tracer = provider.Tracer("test")
+
+	const detection = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	obj := testObject()
+	obj.CreatedTraceParent = detection
+
+	var req *http.Request
+	mockClient.On("Do", mock.Anything).Run(func(args mock.Arguments) {
+		req = args.Get(0).(*http.Request)
+	}).Return(&http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(""))}, nil)
+	mockDB.On("UpdateNotificationStatus", obj.ID, "created", mock.AnythingOfType("time.Time")).Return(nil)
+
+	n.processNotification(context.Background(), obj)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	span := spans[0]
+	assert.Equal(t, "notifier.processNotification", span.Name)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", span.Parent.SpanID().String())
+
+	// The request and the event both carry the delivery span.
+	require.NotNil(t, req)
+	delivery := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + span.SpanContext.SpanID().String() + "-01"
+	assert.Equal(t, delivery, req.Header.Get("traceparent"))
+	var ce map[string]interface{}
+	require.NoError(t, json.NewDecoder(req.Body).Decode(&ce))
+	assert.Equal(t, delivery, ce["traceparent"])
+}
@@ -0,0 +1,115 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+
+	"github.com/bryonbaker/beacon/internal/config"
+)
+
+// tokenSource supplies bearer tokens for endpoint requests.
+type tokenSource interface {
+	// Token returns a valid access token, fetching a new one if needed.
+	Token(ctx context.Context) (string, error)
+
+	// Invalidate discards token if it is still the cached token, so the next
+	// Token call fetches a fresh one.
+	Invalidate(token string)
+}
+
+// oauth2TokenSource obtains access tokens with the OAuth2 client credentials
+// grant and caches them until shortly before they expire.
+type oauth2TokenSource struct {
+	cfg    *config.OAuth2Config
+	logger *zap.Logger
+	now    func() time.Time
+
+	// mu is held while fetching so concurrent workers share one request.
+	mu    sync.Mutex
+	token *oauth2.Token
+}
+
+// Ensure oauth2TokenSource satisfies the tokenSource interface at compile time.
+var _ tokenSource = (*oauth2TokenSource)(nil)
+
+// newOAuth2TokenSource creates an oauth2TokenSource for the configuration.
+func newOAuth2TokenSource(cfg *config.OAuth2Config, logger *zap.Logger) *oauth2TokenSource {
+	return &oauth2TokenSource{cfg: cfg, logger: logger, now: time.Now}
+}
+
+// Token returns the cached token, or fetches a new one if there is none or
+// the cached token expires within the configured refreshBefore window. If a
+// proactive refresh fails while the cached token is still valid, the cached
+// token is returned.
+func (s *oauth2TokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if s.token != nil && !s.expiresBy(now.Add(s.cfg.RefreshBefore.Duration)) {
+		return s.token.AccessToken, nil
+	}
+
+	token, err := s.fetch(ctx)
+	if err != nil {
+		if s.token != nil && !s.expiresBy(now) {
+			s.logger.Warn("failed to refresh OAuth2 token, using cached token", zap.Error(err))
+			return s.token.AccessToken, nil
+		}
+		return "", err
+	}
+
+	s.logger.Debug("obtained OAuth2 access token", zap.Time("expiry", token.Expiry))
+	s.token = token
+	return token.AccessToken, nil
+}
+
+// Invalidate discards the cached token if it matches token.
+func (s *oauth2TokenSource) Invalidate(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != nil && s.token.AccessToken == token {
+		s.token = nil
+	}
+}
+
+// expiresBy reports whether the cached token expires at or before t. Tokens
+// without an expiry never expire.
+func (s *oauth2TokenSource) expiresBy(t time.Time) bool {
+	return !s.token.Expiry.IsZero() && !t.Before(s.token.Expiry)
+}
+
+// fetch requests a new token from the token endpoint. The client secret is
+// read on every request so it can be rotated without a restart.
+func (s *oauth2TokenSource) fetch(ctx context.Context) (*oauth2.Token, error) {
+	secret, err := os.ReadFile(s.cfg.ClientSecretFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading OAuth2 client secret: %w", err)
+	}
+
+	cc := clientcredentials.Config{
+		ClientID:     s.cfg.ClientID,
+		ClientSecret: strings.TrimSpace(string(secret)),
+		TokenURL:     s.cfg.TokenURL,
+		Scopes:       s.cfg.Scopes,
+	}
+	if s.cfg.Audience != "" {
+		cc.EndpointParams = url.Values{"audience": {s.cfg.Audience}}
+	}
+
+	token, err := cc.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("fetching OAuth2 token: %w", err)
+	}
+	return token, nil
+}
@@ -0,0 +1,269 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/bryonbaker/beacon/internal/config"
+	"github.com/bryonbaker/beacon/internal/database"
+	"github.com/bryonbaker/beacon/internal/metrics"
+)
+
+// fakeTokenServer is a local OAuth2 token endpoint that issues tok-1, tok-2,
+// ... for the client credentials grant.
+type fakeTokenServer struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	issued    int
+	expiresIn int
+	fail      bool
+	lastForm  map[string]string
+}
+
+func newFakeTokenServer(t *testing.T) *fakeTokenServer {
+	t.Helper()
+	ts := &fakeTokenServer{expiresIn: 3600}
+	ts.Server = httptest.NewServer(http.HandlerFunc(ts.handle))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func (ts *fakeTokenServer) handle(w http.ResponseWriter, r *http.Request) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	id, secret, ok := r.BasicAuth()
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if ts.fail || !ok || id != "beacon" || secret != "s3cret" || r.PostForm.Get("grant_type") != "client_credentials" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"error":"invalid_client"}`)
+		return
+	}
+	ts.lastForm = map[string]string{"scope": r.PostForm.Get("scope"), "audience": r.PostForm.Get("audience")}
+	ts.issued++
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": fmt.Sprintf("tok-%d", ts.issued),
+		"token_type":   "Bearer",
+		"expires_in":   ts.expiresIn,
+	})
+}
+
+func (ts *fakeTokenServer) count() int {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return ts.issued
+}
+
+// oauth2TestConfig returns an OAuth2 configuration for the token server with
+// the client secret written to a temporary file.
+func oauth2TestConfig(t *testing.T, tokenURL string) *config.OAuth2Config {
+	t.Helper()
+	secretFile := filepath.Join(t.TempDir(), "client-secret")
+	require.NoError(t, os.WriteFile(secretFile, []byte("s3cret\n"), 0o600))
+	return &config.OAuth2Config{
+		TokenURL:         tokenURL,
+		ClientID:         "beacon",
+		ClientSecretFile: secretFile,
+		Scopes:           []string{"events:write", "events:read"},
+		Audience:         "https://platform.example.com",
+		RefreshBefore:    config.Duration{Duration: time.Minute},
+	}
+}
+
+func TestOAuth2TokenSource_CachesToken(t *testing.T) {
+	ts := newFakeTokenServer(t)
+	src := newOAuth2TokenSource(oauth2TestConfig(t, ts.URL), zap.NewNop())
+
+	for i := 0; i < 3; i++ {
+		token, err := src.Token(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "tok-1", token)
+	}
+	assert.Equal(t, 1, ts.count())
+	assert.Equal(t, "events:write events:read", ts.lastForm["scope"])
+	assert.Equal(t, "https://platform.example.com", ts.lastForm["audience"])
+}
+
+func TestOAuth2TokenSource_RefreshesBeforeExpiry(t *testing.T) {
+	ts := newFakeTokenServer(t)
+	src := newOAuth2TokenSource(oauth2TestConfig(t, ts.URL), zap.NewNop())
+	now := time.Now()
+	src.now = func() time.Time { return now }
+
+	token, err := src.Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "tok-1", token)
+
+	// Still cached just outside the refresh window.
+	now = now.Add(time.Hour - 2*time.Minute)
+	token, _ = src.Token(context.Background())
+	assert.Equal(t, "tok-1", token)
+
+	// Refreshed once inside the refresh window, before the token expires.
+	now = now.Add(90 * time.Second)
+	token, err = src.Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "tok-2", token)
+}
+
+func TestOAuth2TokenSource_RefreshFailureUsesValidCachedToken(t *testing.T) {
+	ts := newFakeTokenServer(t)
+	src := newOAuth2TokenSource(oauth2TestConfig(t, ts.URL), zap.NewNop())
+	now := time.Now()
+	src.now = func() time.Time { return now }
+
+	_, err := src.Token(context.Background())
+	require.NoError(t, err)
+
+	ts.mu.Lock()
+	ts.fail = true
+	ts.mu.Unlock()
+
+	// Inside the refresh window but not yet expired: the cached token is used.
+	now = now.Add(time.Hour - 30*time.Second)
+	token, err := src.Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "tok-1", token)
+
+	// Expired: the refresh error is returned.
+	now = now.Add(time.Minute)
+	_, err = src.Token(context.Background())
+	assert.ErrorContains(t, err, "fetching OAuth2 token")
+}
+
+func TestOAuth2TokenSource_InvalidateOnlyCurrentToken(t *testing.T) {
+	ts := newFakeTokenServer(t)
+	src := newOAuth2TokenSource(oauth2TestConfig(t, ts.URL), zap.NewNop())
+
+	_, err := src.Token(context.Background())
+	require.NoError(t, err)
+
+	src.Invalidate("some-older-token")
+	token, _ := src.Token(context.Background())
+	assert.Equal(t, "tok-1", token)
+
+	src.Invalidate("tok-1")
+	token, _ = src.Token(context.Background())
+	assert.Equal(t, "tok-2", token)
+}
+
+func TestOAuth2TokenSource_MissingSecretFile(t *testing.T) {
+	cfg := oauth2TestConfig(t, "https://auth.example.com/token")
+	cfg.ClientSecretFile = filepath.Join(t.TempDir(), "missing")
+	src := newOAuth2TokenSource(cfg, zap.NewNop())
+
+	_, err := src.Token(context.Background())
+	assert.ErrorContains(t, err, "reading OAuth2 client secret")
+}
+
+// oauth2Endpoint is a notification endpoint that accepts only the listed
+// access tokens and records the tokens it was sent.
+func oauth2Endpoint(t *testing.T, accepted ...string) (*httptest.Server, *[]string) {
+	t.Helper()
+	var mu sync.Mutex
+	var seen []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		auth := r.Header.Get("Authorization")
+		seen = append(seen, auth)
+		for _, tok := range accepted {
+			if auth == "Bearer "+tok {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &seen
+}
+
+func oauth2SinkConfig(t *testing.T, tokenURL, endpointURL string) *config.Config {
+	cfg := testConfig()
+	cfg.Endpoint.URL = endpointURL
+	cfg.AuthToken = "static-token-is-ignored"
+	cfg.Endpoint.Auth = config.AuthConfig{Type: config.AuthTypeOAuth2, OAuth2: *oauth2TestConfig(t, tokenURL)}
+	return cfg
+}
+
+func TestHTTPSink_OAuth2UnauthorizedRefreshesAndRetriesOnce(t *testing.T) {
+	ts := newFakeTokenServer(t)
+	endpoint, seen := oauth2Endpoint(t, "tok-2")
+	cfg := oauth2SinkConfig(t, ts.URL, endpoint.URL)
+	sink := NewHTTPSink(http.DefaultClient, cfg, zap.NewNop())
+
+	err := sink.Send(context.Background(), buildCloudEvent(testObject(), "created", cfg))
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Bearer tok-1", "Bearer tok-2"}, *seen)
+	assert.Equal(t, 2, ts.count())
+}
+
+func TestHTTPSink_OAuth2PersistentUnauthorized(t *testing.T) {
+	ts := newFakeTokenServer(t)
+	endpoint, seen := oauth2Endpoint(t)
+	cfg := oauth2SinkConfig(t, ts.URL, endpoint.URL)
+	sink := NewHTTPSink(http.DefaultClient, cfg, zap.NewNop())
+
+	err := sink.Send(context.Background(), buildCloudEvent(testObject(), "created", cfg))
+
+	var statusErr *StatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusUnauthorized, statusErr.StatusCode)
+	assert.Len(t, *seen, 2, "a 401 is retried exactly once")
+}
+
+func TestHTTPSink_OAuth2TokenFailureIsRetriable(t *testing.T) {
+	ts := newFakeTokenServer(t)
+	ts.fail = true
+	endpoint, seen := oauth2Endpoint(t, "tok-1")
+	cfg := oauth2SinkConfig(t, ts.URL, endpoint.URL)
+	sink := NewHTTPSink(http.DefaultClient, cfg, zap.NewNop())
+
+	err := sink.Send(context.Background(), buildCloudEvent(testObject(), "created", cfg))
+
+	require.Error(t, err)
+	var statusErr *StatusError
+	var permErr *PermanentError
+	assert.False(t, errors.As(err, &statusErr))
+	assert.False(t, errors.As(err, &permErr))
+	assert.Empty(t, *seen, "no request is sent without a token")
+}
+
+func TestProcessNotification_OAuth2UnauthorizedRecovers(t *testing.T) {
+	ts := newFakeTokenServer(t)
+	endpoint, _ := oauth2Endpoint(t, "tok-2")
+	cfg := oauth2SinkConfig(t, ts.URL, endpoint.URL)
+	mockDB := new(database.MockDatabase)
+	n := NewNotifier(mockDB, http.DefaultClient, cfg, metrics.NewMetrics(prometheus.NewRegistry()), zap.NewNop())
+
+	obj := testObject()
+	mockDB.On("UpdateNotificationStatus", obj.ID, "created", mock.AnythingOfType("time.Time")).Return(nil)
+
+	n.processNotification(context.Background(), obj)
+
+	mockDB.AssertExpectations(t)
+	mockDB.AssertNotCalled(t, "MarkNotificationFailed", mock.Anything, mock.Anything)
+}
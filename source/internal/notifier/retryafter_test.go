@@ -0,0 +1,128 @@
+package notifier
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bryonbaker/beacon/internal/database"
+)
+
+// scheduledWithin matches a next-attempt time between min and max from now.
+func scheduledWithin(min, max time.Duration) interface{} {
+	return mock.MatchedBy(func(t time.Time) bool {
+		delay := time.Until(t)
+		return delay >= min-time.Second && delay <= max+time.Second
+	})
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, 120*time.Second, parseRetryAfter("120", now))
+	assert.Equal(t, 90*time.Second, parseRetryAfter(now.Add(90*time.Second).Format(http.TimeFormat), now))
+	assert.Zero(t, parseRetryAfter(now.Add(-time.Minute).Format(http.TimeFormat), now), "dates in the past are ignored")
+	assert.Zero(t, parseRetryAfter("", now))
+	assert.Zero(t, parseRetryAfter("-5", now))
+	assert.Zero(t, parseRetryAfter("soon", now))
+}
+
+func TestResponseError_RetryAfter(t *testing.T) {
+	resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"30"}}}
+
+	var statusErr *StatusError
+	require.ErrorAs(t, responseError(resp, nil), &statusErr)
+	assert.Equal(t, 30*time.Second, statusErr.RetryAfter)
+}
+
+func TestHandleResult_RetriableSchedulesBackoff(t *testing.T) {
+	cfg := testConfig()
+	mockDB := new(database.MockDatabase)
+	n, _ := newTestNotifier(cfg, mockDB, new(MockHTTPClient))
+
+	obj := testObject()
+	obj.NotificationAttempts = 2 // 1s * 2^2 = 4s
+	mockDB.On("IncrementNotificationAttempts", obj.ID, scheduledWithin(3600*time.Millisecond, 4400*time.Millisecond)).Return(nil)
+
+	n.handleResult(context.Background(), obj, "created", &StatusError{StatusCode: http.StatusInternalServerError})
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestHandleResult_RetryAfterPausesEndpoint(t *testing.T) {
+	cfg := testConfig()
+	cfg.Endpoint.RetryAfter.PauseStatuses = []int{429, 503}
+	mockDB := new(database.MockDatabase)
+	n, _ := newTestNotifier(cfg, mockDB, new(MockHTTPClient))
+
+	obj := testObject()
+	mockDB.On("IncrementNotificationAttempts", obj.ID, scheduledWithin(2*time.Minute, 2*time.Minute)).Return(nil)
+
+	n.handleResult(context.Background(), obj, "created", &StatusError{StatusCode: http.StatusServiceUnavailable, RetryAfter: 2 * time.Minute})
+
+	mockDB.AssertExpectations(t)
+	until, paused := n.paused()
+	assert.True(t, paused)
+	assert.WithinDuration(t, time.Now().Add(2*time.Minute), until, time.Second)
+
+	// While paused, polling does not fetch or send anything.
+	mockDB.On("CountPendingNotifications").Return(nil, nil)
+	n.poll(context.Background())
+	mockDB.AssertNotCalled(t, "GetPendingNotifications", mock.Anything, mock.Anything)
+}
+
+func TestHandleResult_RetryAfterOnlyDelaysEvent(t *testing.T) {
+	cfg := testConfig()
+	cfg.Endpoint.RetryAfter.PauseStatuses = []int{503}
+	mockDB := new(database.MockDatabase)
+	n, _ := newTestNotifier(cfg, mockDB, new(MockHTTPClient))
+
+	obj := testObject()
+	mockDB.On("IncrementNotificationAttempts", obj.ID, scheduledWithin(10*time.Minute, 10*time.Minute)).Return(nil)
+
+	n.handleResult(context.Background(), obj, "created", &StatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: 10 * time.Minute})
+
+	mockDB.AssertExpectations(t)
+	_, paused := n.paused()
+	assert.False(t, paused, "429 is not a pause status in this configuration")
+}
+
+func TestHandleResult_RetryAfterCappedAtMaxDelay(t *testing.T) {
+	cfg := testConfig()
+	cfg.Endpoint.RetryAfter.MaxDelay.Duration = time.Hour
+	mockDB := new(database.MockDatabase)
+	n, _ := newTestNotifier(cfg, mockDB, new(MockHTTPClient))
+
+	obj := testObject()
+	mockDB.On("IncrementNotificationAttempts", obj.ID, scheduledWithin(time.Hour, time.Hour)).Return(nil)
+
+	n.handleResult(context.Background(), obj, "created", &StatusError{StatusCode: http.StatusServiceUnavailable, RetryAfter: 48 * time.Hour})
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestHTTPSink_RateLimit(t *testing.T) {
+	cfg := testConfig()
+	cfg.Endpoint.RateLimit.RequestsPerSecond = 20
+	cfg.Endpoint.RateLimit.Burst = 1
+	mockClient := new(MockHTTPClient)
+	n, _ := newTestNotifier(cfg, new(database.MockDatabase), mockClient)
+	mockClient.On("Do", mock.Anything).Return(
+		&http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(""))}, nil)
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		require.NoError(t, httpSink(n).Send(context.Background(), buildCloudEvent(testObject(), "created", cfg)))
+	}
+
+	// The first request uses the burst; the next three wait 50ms each.
+	assert.GreaterOrEqual(t, time.Since(start), 140*time.Millisecond)
+	mockClient.AssertNumberOfCalls(t, "Do", 4)
+}
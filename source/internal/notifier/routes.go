@@ -0,0 +1,353 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/bryonbaker/beacon/internal/config"
+	"github.com/bryonbaker/beacon/internal/database"
+	"github.com/bryonbaker/beacon/internal/metrics"
+	"github.com/bryonbaker/beacon/internal/models"
+)
+
+// route is an entry of the routes configuration with its endpoints resolved.
+type route struct {
+	match     config.RouteMatch
+	endpoints []*Notifier
+}
+
+// matches reports whether obj, whose stored labels are labels, satisfies
+// every criterion of the route.
+func (r *route) matches(obj *models.ManagedObject, labels map[string]string) bool {
+	m := r.match
+	if len(m.ResourceTypes) > 0 && !contains(m.ResourceTypes, obj.ResourceType) {
+		return false
+	}
+	if len(m.Namespaces) > 0 && !contains(m.Namespaces, obj.ResourceNamespace) {
+		return false
+	}
+	if len(m.AnnotationValues) > 0 && !contains(m.AnnotationValues, obj.AnnotationValue) {
+		return false
+	}
+	for k, v := range m.Labels {
+		if actual, ok := labels[k]; !ok || actual != v {
+			return false
+		}
+	}
+	return true
+}
+
+// contains reports whether list includes s.
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// NewRoutingNotifier creates a Notifier that routes events to the named
+// endpoints in cfg.Endpoints according to cfg.Routes. sinks holds the sink
+// for each endpoint, keyed by name.
+func NewRoutingNotifier(db database.Database, sinks map[string]Sink, cfg *config.Config, m *metrics.Metrics, logger *zap.Logger) *Notifier {
+	n := NewNotifierWithSink(db, nil, cfg, m, logger)
+
+	byName := make(map[string]*Notifier, len(cfg.Endpoints))
+	for _, ep := range cfg.Endpoints {
+		child := &Notifier{
+			db:         db,
+			sink:       sinks[ep.Name],
+			store:      endpointStore{db: db, endpoint: ep.Name},
+			cfg:        cfg.ForEndpoint(ep.Name),
+			metrics:    m,
+			logger:     logger.With(zap.String("endpoint", ep.Name)),
+			filter:     n.filter,
+			tracer:     n.tracer,
+			name:       ep.Name,
+			extensions: n.extensions,
+			validator:  n.validator,
+		}
+		child.breaker = newCircuitBreaker(child.cfg.Endpoint.CircuitBreaker, child.circuitChanged)
+		n.endpoints = append(n.endpoints, child)
+		byName[ep.Name] = child
+	}
+	for _, rc := range cfg.Routes {
+		r := route{match: rc.Match}
+		for _, name := range rc.Endpoints {
+			if child, ok := byName[name]; ok {
+				r.endpoints = append(r.endpoints, child)
+			}
+		}
+		n.routes = append(n.routes, r)
+	}
+	return n
+}
+
+// routedObject is a pending object and the endpoints it is routed to.
+type routedObject struct {
+	obj     *models.ManagedObject
+	targets []*Notifier
+}
+
+// pollRoutes fetches pending notifications and delivers each event to every
+// endpoint its resource is routed to. Each endpoint keeps its own delivery
+// state, backoff, and circuit breaker, so an endpoint that is failing only
+// delays its own deliveries.
+func (n *Notifier) pollRoutes(ctx context.Context) {
+	pending, err := n.db.GetPendingNotifications(n.cfg.Worker.BatchSize, n.cfg.Worker.OrderingKey)
+	if err != nil {
+		n.logger.Error("failed to fetch pending notifications", zap.Error(err))
+		n.metrics.RecordComponentHealth("notifier", false)
+		return
+	}
+	n.metrics.RecordComponentHealth("notifier", true)
+	start := time.Now()
+	defer func() {
+		if len(pending) > 0 {
+			n.metrics.RecordWorkerCycle("notifier", len(pending), time.Since(start))
+		}
+	}()
+
+	work := make(map[*Notifier][]*models.ManagedObject, len(n.endpoints))
+	var routed []routedObject
+	for _, obj := range pending {
+		targets := n.targets(obj)
+		if len(targets) == 0 {
+			n.markUnrouted(obj)
+			continue
+		}
+		deliveries, err := n.db.GetEndpointDeliveries(obj.ID)
+		if err != nil {
+			n.logger.Error("failed to fetch endpoint deliveries",
+				zap.String("object_id", obj.ID),
+				zap.Error(err),
+			)
+			continue
+		}
+		for _, ep := range targets {
+			if view := ep.view(obj, deliveries); view != nil {
+				work[ep] = append(work[ep], view)
+			}
+		}
+		routed = append(routed, routedObject{obj: obj, targets: targets})
+	}
+
+	for _, ep := range n.endpoints {
+		objs := work[ep]
+		if len(objs) == 0 {
+			continue
+		}
+		limit, ok := ep.deliveryLimit(len(objs))
+		if !ok {
+			continue
+		}
+		ep.deliver(ctx, objs[:limit])
+	}
+
+	for _, r := range routed {
+		n.settle(r.obj, r.targets)
+	}
+}
+
+// targets returns the endpoints obj is routed to, in configuration order and
+// without duplicates.
+func (n *Notifier) targets(obj *models.ManagedObject) []*Notifier {
+	var labels map[string]string
+	if obj.Labels != "" {
+		_ = json.Unmarshal([]byte(obj.Labels), &labels)
+	}
+
+	seen := make(map[*Notifier]bool)
+	var targets []*Notifier
+	for i := range n.routes {
+		if !n.routes[i].matches(obj, labels) {
+			continue
+		}
+		for _, ep := range n.routes[i].endpoints {
+			if !seen[ep] {
+				seen[ep] = true
+				targets = append(targets, ep)
+			}
+		}
+	}
+	return targets
+}
+
+// markUnrouted marks the pending events of an object that matches no route
+// as handled, since there is nowhere to deliver them.
+func (n *Notifier) markUnrouted(obj *models.ManagedObject) {
+	n.logger.Debug("no route matches resource, skipping its events",
+		zap.String("object_id", obj.ID),
+		zap.String("resource_type", obj.ResourceType),
+		zap.String("resource_name", obj.ResourceName),
+	)
+	now := time.Now().UTC()
+	for {
+		eventType := eventTypeFor(obj)
+		if eventType == "" {
+			return
+		}
+		if err := n.db.UpdateNotificationStatus(obj.ID, eventType, now); err != nil {
+			n.logger.Error("failed to update notification status",
+				zap.String("object_id", obj.ID),
+				zap.Error(err),
+			)
+			return
+		}
+		if eventType == "created" {
+			obj.NotifiedCreated = true
+		} else {
+			obj.NotifiedDeleted = true
+		}
+	}
+}
+
+// findDelivery returns the delivery of eventType to endpoint, or nil if it
+// has not been attempted.
+func findDelivery(deliveries []*models.EndpointDelivery, endpoint, eventType string) *models.EndpointDelivery {
+	for _, d := range deliveries {
+		if d.Endpoint == endpoint && d.EventType == eventType {
+			return d
+		}
+	}
+	return nil
+}
+
+// deliveryStatus returns the status of d, treating a delivery that has not
+// been attempted as pending.
+func deliveryStatus(d *models.EndpointDelivery) string {
+	if d == nil {
+		return models.NotificationPending
+	}
+	return d.Status
+}
+
+// view returns a copy of obj whose notification state is its delivery state
+// at this endpoint, for the endpoint's Notifier to process, or nil when no
+// event is due for the endpoint. Once an event has failed permanently at an
+// endpoint, no further events of the object are sent to it.
+func (n *Notifier) view(obj *models.ManagedObject, deliveries []*models.EndpointDelivery) *models.ManagedObject {
+	created := findDelivery(deliveries, n.name, "created")
+	deleted := findDelivery(deliveries, n.name, "deleted")
+	if deliveryStatus(created) == models.NotificationFailed || deliveryStatus(deleted) == models.NotificationFailed {
+		return nil
+	}
+
+	v := *obj
+	v.NotifiedCreated = deliveryStatus(created) == models.NotificationSent
+	v.NotifiedDeleted = deliveryStatus(deleted) == models.NotificationSent
+	if eventTypeFor(&v) == "" {
+		return nil
+	}
+
+	due := created
+	if v.NotifiedCreated {
+		due = deleted
+	}
+	v.NotificationAttempts, v.LastNotificationAttempt, v.NextAttemptAt = 0, nil, nil
+	if due != nil {
+		if due.NextAttemptAt != nil && due.NextAttemptAt.After(time.Now()) {
+			return nil
+		}
+		v.NotificationAttempts = due.Attempts
+		v.LastNotificationAttempt = due.LastAttempt
+		v.NextAttemptAt = due.NextAttemptAt
+	}
+	return &v
+}
+
+// settle updates obj's own notification state from its deliveries to the
+// target endpoints. An event counts as notified once every endpoint has
+// received it or failed it permanently. A deleted object whose deliveries are
+// all finished is marked failed if any endpoint failed, so the record is kept
+// for diagnosis. While deliveries remain, the object's next attempt is set to
+// the earliest time one of them is due. The deliveries are read and the
+// object updated in one transaction.
+func (n *Notifier) settle(obj *models.ManagedObject, targets []*Notifier) {
+	if err := n.db.WithTx(func(tx database.Database) error {
+		return n.settleTx(tx, obj, targets)
+	}); err != nil {
+		n.logger.Error("failed to settle notification state",
+			zap.String("object_id", obj.ID),
+			zap.Error(err),
+		)
+	}
+}
+
+// settleTx settles obj within the transaction tx.
+func (n *Notifier) settleTx(tx database.Database, obj *models.ManagedObject, targets []*Notifier) error {
+	deliveries, err := tx.GetEndpointDeliveries(obj.ID)
+	if err != nil {
+		return fmt.Errorf("fetching endpoint deliveries: %w", err)
+	}
+
+	isDeleted := obj.ClusterState == models.ClusterStateDeleted
+	createdDone, deletedDone := true, true
+	failed, failedCode := false, 0
+	var next time.Time
+	due := func(ep *Notifier, d *models.EndpointDelivery) {
+		at := ep.resumeAt()
+		if d != nil && d.NextAttemptAt != nil && d.NextAttemptAt.After(at) {
+			at = *d.NextAttemptAt
+		}
+		if next.IsZero() || at.Before(next) {
+			next = at
+		}
+	}
+	for _, ep := range targets {
+		created := findDelivery(deliveries, ep.name, "created")
+		deleted := findDelivery(deliveries, ep.name, "deleted")
+		switch {
+		case deliveryStatus(created) == models.NotificationFailed:
+			failed, failedCode = true, created.FailedCode
+		case deliveryStatus(deleted) == models.NotificationFailed:
+			failed, failedCode = true, deleted.FailedCode
+		case deliveryStatus(created) != models.NotificationSent:
+			createdDone, deletedDone = false, false
+			due(ep, created)
+		case isDeleted && deliveryStatus(deleted) != models.NotificationSent:
+			deletedDone = false
+			due(ep, deleted)
+		}
+	}
+
+	now := time.Now().UTC()
+	if createdDone {
+		switch mode := n.coalesceMode(obj); {
+		case mode != "" && deletedDone:
+			decision := models.CoalescedEphemeral
+			if mode == config.CoalesceModeSuppress {
+				decision = models.CoalescedSuppressed
+			}
+			err = tx.MarkCoalesced(obj.ID, decision, now)
+		default:
+			if !obj.NotifiedCreated {
+				err = tx.UpdateNotificationStatus(obj.ID, "created", now)
+			}
+			if err == nil && isDeleted && deletedDone && !obj.NotifiedDeleted {
+				err = tx.UpdateNotificationStatus(obj.ID, "deleted", now)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("updating notification status: %w", err)
+		}
+	}
+
+	switch {
+	case isDeleted && createdDone && deletedDone && failed:
+		err = tx.MarkNotificationFailed(obj.ID, failedCode)
+	case !next.IsZero() && next.After(time.Now()):
+		err = tx.IncrementNotificationAttempts(obj.ID, next)
+	default:
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("updating notification state: %w", err)
+	}
+	return nil
+}
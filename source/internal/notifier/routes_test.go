@@ -0,0 +1,211 @@
+package notifier
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/bryonbaker/beacon/internal/config"
+	"github.com/bryonbaker/beacon/internal/database"
+	"github.com/bryonbaker/beacon/internal/metrics"
+	"github.com/bryonbaker/beacon/internal/models"
+)
+
+// fakeSink records the events it is sent and answers with err.
+type fakeSink struct {
+	mu     sync.Mutex
+	err    error
+	events []*models.CloudEvent
+}
+
+func (s *fakeSink) Send(_ context.Context, ce *models.CloudEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, ce)
+	return s.err
+}
+
+func (s *fakeSink) SendBatch(ctx context.Context, events []*models.CloudEvent) []error {
+	errs := make([]error, len(events))
+	for i, ce := range events {
+		errs[i] = s.Send(ctx, ce)
+	}
+	return errs
+}
+
+func (s *fakeSink) Close() error { return nil }
+
+// types returns the CloudEvent types the sink was sent.
+func (s *fakeSink) types() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var types []string
+	for _, ce := range s.events {
+		types = append(types, ce.Type)
+	}
+	return types
+}
+
+// routingConfig routes LLM serving resources to billing, Pods to inventory,
+// and resources annotated "premium" to sla.
+func routingConfig() *config.Config {
+	cfg := testConfig()
+	for _, name := range []string{"billing", "inventory", "sla"} {
+		ep := cfg.Endpoint
+		ep.Name = name
+		ep.URL = "https://" + name + ".example.com/events"
+		ep.CircuitBreaker = config.CircuitBreakerConfig{ConsecutiveFailures: 5, WindowSize: 20}
+		cfg.Endpoints = append(cfg.Endpoints, ep)
+	}
+	cfg.Routes = []config.RouteConfig{
+		{Match: config.RouteMatch{ResourceTypes: []string{"LLMInferenceService"}}, Endpoints: []string{"billing"}},
+		{Match: config.RouteMatch{ResourceTypes: []string{"Pod"}}, Endpoints: []string{"inventory"}},
+		{Match: config.RouteMatch{AnnotationValues: []string{"premium"}}, Endpoints: []string{"sla", "billing"}},
+	}
+	return cfg
+}
+
+// newRoutingTest creates a routing Notifier over an in-memory database with a
+// fake sink per endpoint.
+func newRoutingTest(t *testing.T, cfg *config.Config) (*Notifier, *database.SQLiteDB, map[string]*fakeSink) {
+	t.Helper()
+	db, err := database.NewSQLiteDB(":memory:", zap.NewNop())
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	fakes := make(map[string]*fakeSink)
+	sinks := make(map[string]Sink)
+	for _, ep := range cfg.Endpoints {
+		fakes[ep.Name] = &fakeSink{}
+		sinks[ep.Name] = fakes[ep.Name]
+	}
+	m := metrics.NewMetrics(prometheus.NewRegistry())
+	return NewRoutingNotifier(db, sinks, cfg, m, zap.NewNop()), db, fakes
+}
+
+// routedPod returns a Pod with the given annotation value.
+func routedPod(id, annotationValue string) *models.ManagedObject {
+	obj := testObject()
+	obj.ID, obj.ResourceUID = id, "uid-"+id
+	obj.ResourceType = "Pod"
+	obj.AnnotationValue = annotationValue
+	obj.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	return obj
+}
+
+func TestRoutes_FanOut(t *testing.T) {
+	n, db, sinks := newRoutingTest(t, routingConfig())
+	require.NoError(t, db.InsertManagedObject(routedPod("pod-1", "premium")))
+
+	n.poll(context.Background())
+
+	created := "net.bakerapps.beacon.resource.created"
+	assert.Equal(t, []string{created}, sinks["inventory"].types())
+	assert.Equal(t, []string{created}, sinks["sla"].types())
+	assert.Equal(t, []string{created}, sinks["billing"].types(), "premium route also includes billing")
+
+	got, err := db.GetManagedObjectByID("pod-1")
+	require.NoError(t, err)
+	assert.True(t, got.NotifiedCreated)
+	deliveries, err := db.GetEndpointDeliveries("pod-1")
+	require.NoError(t, err)
+	assert.Len(t, deliveries, 3)
+}
+
+func TestRoutes_Matching(t *testing.T) {
+	cfg := routingConfig()
+	cfg.Routes = append(cfg.Routes, config.RouteConfig{
+		Match:     config.RouteMatch{Namespaces: []string{"default"}, Labels: map[string]string{"env": "prod"}},
+		Endpoints: []string{"sla"},
+	})
+	n, db, sinks := newRoutingTest(t, cfg)
+	require.NoError(t, db.InsertManagedObject(routedPod("pod-1", "standard")))
+	unrouted := routedPod("cm-1", "standard")
+	unrouted.ResourceType = "ConfigMap"
+	require.NoError(t, db.InsertManagedObject(unrouted))
+
+	n.poll(context.Background())
+
+	assert.Len(t, sinks["inventory"].types(), 1)
+	assert.Empty(t, sinks["sla"].types(), "labels do not match env=prod")
+	assert.Empty(t, sinks["billing"].types())
+
+	got, err := db.GetManagedObjectByID("cm-1")
+	require.NoError(t, err)
+	assert.True(t, got.NotifiedCreated, "events without a route are not left pending")
+}
+
+func TestRoutes_FailingEndpointDoesNotBlockOthers(t *testing.T) {
+	n, db, sinks := newRoutingTest(t, routingConfig())
+	sinks["inventory"].err = &StatusError{StatusCode: 503}
+	require.NoError(t, db.InsertManagedObject(routedPod("pod-1", "premium")))
+
+	n.poll(context.Background())
+
+	deliveries, err := db.GetEndpointDeliveries("pod-1")
+	require.NoError(t, err)
+	inventory := findDelivery(deliveries, "inventory", "created")
+	require.NotNil(t, inventory)
+	assert.Equal(t, models.NotificationPending, inventory.Status)
+	assert.Equal(t, 1, inventory.Attempts)
+	require.NotNil(t, inventory.NextAttemptAt)
+	assert.Equal(t, models.NotificationSent, findDelivery(deliveries, "sla", "created").Status)
+
+	got, err := db.GetManagedObjectByID("pod-1")
+	require.NoError(t, err)
+	assert.False(t, got.NotifiedCreated)
+	require.NotNil(t, got.NextAttemptAt, "the object waits for the inventory retry")
+
+	// The deletion is delivered to the healthy endpoints straight away.
+	now := time.Now()
+	require.NoError(t, db.UpdateClusterState("uid-pod-1", models.ClusterStateDeleted, &now))
+	n.poll(context.Background())
+
+	deleted := "net.bakerapps.beacon.resource.deleted"
+	assert.Contains(t, sinks["sla"].types(), deleted)
+	assert.Contains(t, sinks["billing"].types(), deleted)
+	assert.Len(t, sinks["inventory"].types(), 1, "inventory is not retried before its backoff")
+	assert.Equal(t, 1.0, testutil.ToFloat64(n.metrics.RoutedDeliveriesTotal.WithLabelValues("inventory", "created", "retry")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(n.metrics.RoutedDeliveriesTotal.WithLabelValues("sla", "deleted", "sent")))
+}
+
+func TestRoutes_PermanentFailureAtOneEndpoint(t *testing.T) {
+	n, db, sinks := newRoutingTest(t, routingConfig())
+	sinks["inventory"].err = &StatusError{StatusCode: 400}
+	require.NoError(t, db.InsertManagedObject(routedPod("pod-1", "premium")))
+
+	n.poll(context.Background())
+
+	got, err := db.GetManagedObjectByID("pod-1")
+	require.NoError(t, err)
+	assert.True(t, got.NotifiedCreated)
+	assert.False(t, got.NotificationFailed, "other endpoints still need the deleted event")
+
+	now := time.Now()
+	require.NoError(t, db.UpdateClusterState("uid-pod-1", models.ClusterStateDeleted, &now))
+	n.poll(context.Background())
+
+	assert.Len(t, sinks["inventory"].types(), 1, "no further events after a permanent failure")
+	assert.Len(t, sinks["sla"].types(), 2)
+	got, err = db.GetManagedObjectByID("pod-1")
+	require.NoError(t, err)
+	assert.True(t, got.NotifiedDeleted)
+	assert.True(t, got.NotificationFailed, "the record is kept for diagnosis")
+	assert.Equal(t, 400, got.NotificationFailedCode)
+}
+
+func TestRoutes_CircuitStatePerEndpoint(t *testing.T) {
+	n, _, _ := newRoutingTest(t, routingConfig())
+
+	states := make(map[string]string)
+	n.OnCircuitStateChange(func(endpoint, state string) { states[endpoint] = state })
+
+	assert.Equal(t, map[string]string{"billing": "closed", "inventory": "closed", "sla": "closed"}, states)
+}
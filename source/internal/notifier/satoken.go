@@ -0,0 +1,76 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// serviceAccountTokenSource reads a projected ServiceAccount token from a
+// file. The kubelet rotates the token by replacing the file, so it is re-read
+// whenever its modification time changes.
+type serviceAccountTokenSource struct {
+	path   string
+	logger *zap.Logger
+
+	mu      sync.Mutex
+	modTime time.Time
+	token   string
+}
+
+// Ensure serviceAccountTokenSource satisfies the tokenSource interface at
+// compile time.
+var _ tokenSource = (*serviceAccountTokenSource)(nil)
+
+// newServiceAccountTokenSource creates a serviceAccountTokenSource for the
+// token file at path.
+func newServiceAccountTokenSource(path string, logger *zap.Logger) *serviceAccountTokenSource {
+	return &serviceAccountTokenSource{path: path, logger: logger}
+}
+
+// Token returns the current token, re-reading the file if it has changed.
+func (s *serviceAccountTokenSource) Token(_ context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return "", fmt.Errorf("reading service account token: %w", err)
+	}
+	if s.token != "" && info.ModTime().Equal(s.modTime) {
+		return s.token, nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return "", fmt.Errorf("reading service account token: %w", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", errors.New("reading service account token: file is empty")
+	}
+
+	if s.token != "" {
+		s.logger.Info("service account token rotated", zap.String("path", s.path))
+	}
+	s.token = token
+	s.modTime = info.ModTime()
+	return token, nil
+}
+
+// Invalidate forces the next Token call to re-read the file if token is the
+// cached token.
+func (s *serviceAccountTokenSource) Invalidate(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token == token {
+		s.token = ""
+	}
+}
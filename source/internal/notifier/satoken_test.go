@@ -0,0 +1,68 @@
+package notifier
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/bryonbaker/beacon/internal/config"
+)
+
+// writeToken writes token to path with the given modification time.
+func writeToken(t *testing.T, path, token string, modTime time.Time) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(token+"\n"), 0o600))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestServiceAccountTokenSource_RereadsOnRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	now := time.Now()
+	writeToken(t, path, "sa-token-1", now)
+	src := newServiceAccountTokenSource(path, zap.NewNop())
+
+	token, err := src.Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "sa-token-1", token)
+
+	writeToken(t, path, "sa-token-2", now.Add(time.Minute))
+	token, err = src.Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "sa-token-2", token)
+}
+
+func TestServiceAccountTokenSource_Errors(t *testing.T) {
+	dir := t.TempDir()
+	_, err := newServiceAccountTokenSource(filepath.Join(dir, "missing"), zap.NewNop()).Token(context.Background())
+	assert.ErrorContains(t, err, "reading service account token")
+
+	empty := filepath.Join(dir, "empty")
+	require.NoError(t, os.WriteFile(empty, nil, 0o600))
+	_, err = newServiceAccountTokenSource(empty, zap.NewNop()).Token(context.Background())
+	assert.ErrorContains(t, err, "empty")
+}
+
+func TestHTTPSink_ServiceAccountToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	writeToken(t, path, "sa-token-1", time.Now())
+	endpoint, seen := oauth2Endpoint(t, "sa-token-1")
+
+	cfg := testConfig()
+	cfg.Endpoint.URL = endpoint.URL
+	cfg.AuthToken = "static-token-is-ignored"
+	cfg.Endpoint.Auth = config.AuthConfig{
+		Type:                config.AuthTypeServiceAccountToken,
+		ServiceAccountToken: config.ServiceAccountTokenConfig{Path: path},
+	}
+	sink := NewHTTPSink(http.DefaultClient, cfg, zap.NewNop())
+
+	require.NoError(t, sink.Send(context.Background(), buildCloudEvent(testObject(), "created", cfg)))
+	assert.Equal(t, []string{"Bearer sa-token-1"}, *seen)
+}
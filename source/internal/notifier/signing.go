@@ -0,0 +1,103 @@
+package notifier
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/bryonbaker/beacon/internal/config"
+	"github.com/bryonbaker/beacon/pkg/webhook"
+)
+
+// requestSigner adds Standard Webhooks signature headers to outbound
+// requests. When a secrets file is configured it is re-read whenever its
+// modification time changes, so rotated secrets take effect without a
+// restart.
+type requestSigner struct {
+	cfg    *config.SigningConfig
+	logger *zap.Logger
+
+	mu      sync.Mutex
+	modTime time.Time
+	signer  *webhook.Signer
+}
+
+// newRequestSigner creates a requestSigner for the signing configuration.
+// Secrets are loaded on first use.
+func newRequestSigner(cfg *config.SigningConfig, logger *zap.Logger) *requestSigner {
+	return &requestSigner{cfg: cfg, logger: logger}
+}
+
+// current returns a signer for the configured secrets: those from the
+// environment followed by those in the secrets file.
+func (s *requestSigner) current() (*webhook.Signer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cfg.SecretsFile == "" {
+		if s.signer == nil {
+			signer, err := webhook.NewSigner(s.cfg.Secrets)
+			if err != nil {
+				return nil, fmt.Errorf("loading signing secrets: %w", err)
+			}
+			s.signer = signer
+		}
+		return s.signer, nil
+	}
+
+	info, err := os.Stat(s.cfg.SecretsFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading signing secrets: %w", err)
+	}
+	if s.signer != nil && info.ModTime().Equal(s.modTime) {
+		return s.signer, nil
+	}
+
+	fileSecrets, err := webhook.ReadSecretsFile(s.cfg.SecretsFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading signing secrets: %w", err)
+	}
+	secrets := append(append([]string(nil), s.cfg.Secrets...), fileSecrets...)
+	signer, err := webhook.NewSigner(secrets)
+	if err != nil {
+		return nil, fmt.Errorf("loading signing secrets from %s: %w", s.cfg.SecretsFile, err)
+	}
+
+	s.logger.Info("loaded signing secrets",
+		zap.String("path", s.cfg.SecretsFile),
+		zap.Int("secret_count", len(secrets)),
+	)
+	s.signer = signer
+	s.modTime = info.ModTime()
+	return signer, nil
+}
+
+// sign sets the webhook-id, webhook-timestamp, and webhook-signature headers
+// on req. msgID is the message identifier receivers use to deduplicate.
+func (s *requestSigner) sign(req *http.Request, msgID string) error {
+	signer, err := s.current()
+	if err != nil {
+		return err
+	}
+
+	var body []byte
+	if req.GetBody != nil {
+		rc, err := req.GetBody()
+		if err != nil {
+			return fmt.Errorf("reading request body for signing: %w", err)
+		}
+		body, err = io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("reading request body for signing: %w", err)
+		}
+	}
+
+	signer.SignHeaders(req.Header, msgID, time.Now(), body)
+	return nil
+}
@@ -0,0 +1,172 @@
+package notifier
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/bryonbaker/beacon/internal/database"
+	"github.com/bryonbaker/beacon/internal/models"
+	"github.com/bryonbaker/beacon/pkg/webhook"
+)
+
+const (
+	signingSecretA = "whsec_MfKQ9r8GKYqrTwjUPD8ILPZIo2LaLaSw"
+	signingSecretB = "whsec_c2Vjb25kLXNlY3JldC1mb3Itcm90YXRpb24="
+)
+
+// captureRequest configures mockClient to record the request and its body
+// and respond with 200.
+func captureRequest(mockClient *MockHTTPClient, req **http.Request, body *[]byte) {
+	mockClient.On("Do", mock.AnythingOfType("*http.Request")).Run(func(args mock.Arguments) {
+		r := args.Get(0).(*http.Request)
+		*req = r
+		*body, _ = io.ReadAll(r.Body)
+	}).Return(&http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(""))}, nil)
+}
+
+func TestHTTPSink_SignsRequests(t *testing.T) {
+	cfg := testConfig()
+	cfg.Endpoint.Signing.Enabled = true
+	cfg.Endpoint.Signing.Secrets = []string{signingSecretA}
+	mockClient := new(MockHTTPClient)
+	n, _ := newTestNotifier(cfg, new(database.MockDatabase), mockClient)
+
+	var req *http.Request
+	var body []byte
+	captureRequest(mockClient, &req, &body)
+
+	ce := buildCloudEvent(testObject(), "created", cfg)
+	require.NoError(t, httpSink(n).Send(context.Background(), ce))
+
+	assert.Equal(t, ce.ID, req.Header.Get(webhook.HeaderID))
+	verifier, err := webhook.NewVerifier([]string{signingSecretA})
+	require.NoError(t, err)
+	assert.NoError(t, verifier.Verify(req.Header, body))
+}
+
+func TestHTTPSink_SignsBatchRequests(t *testing.T) {
+	cfg := batchTestConfig("allOrNothing")
+	cfg.Endpoint.Signing.Enabled = true
+	cfg.Endpoint.Signing.Secrets = []string{signingSecretA}
+	mockClient := new(MockHTTPClient)
+	n, _ := newTestNotifier(cfg, new(database.MockDatabase), mockClient)
+
+	var req *http.Request
+	var body []byte
+	captureRequest(mockClient, &req, &body)
+
+	events := []*models.CloudEvent{buildCloudEvent(testObject(), "created", cfg)}
+	require.NoError(t, httpSink(n).SendBatch(context.Background(), events)[0])
+
+	msgID := req.Header.Get(webhook.HeaderID)
+	assert.True(t, strings.HasPrefix(msgID, "batch_"))
+	verifier, err := webhook.NewVerifier([]string{signingSecretA})
+	require.NoError(t, err)
+	assert.NoError(t, verifier.Verify(req.Header, body))
+
+	// A retried batch is the same message.
+	require.NoError(t, httpSink(n).SendBatch(context.Background(), events)[0])
+	assert.Equal(t, msgID, req.Header.Get(webhook.HeaderID))
+	assert.NotEqual(t, req.Header.Get("X-Request-ID"), msgID)
+
+	events = append(events, buildCloudEvent(testObject(), "deleted", cfg))
+	require.NoError(t, httpSink(n).SendBatch(context.Background(), events)[0])
+	assert.NotEqual(t, msgID, req.Header.Get(webhook.HeaderID), "a batch of other events is another message")
+}
+
+func TestHTTPSink_SignsAfterRateLimiterWait(t *testing.T) {
+	cfg := testConfig()
+	cfg.Endpoint.Signing.Enabled = true
+	cfg.Endpoint.Signing.Secrets = []string{signingSecretA}
+	cfg.Endpoint.RateLimit.RequestsPerSecond = 1
+	cfg.Endpoint.RateLimit.Burst = 1
+	mockClient := new(MockHTTPClient)
+	n, _ := newTestNotifier(cfg, new(database.MockDatabase), mockClient)
+
+	var req *http.Request
+	var body []byte
+	captureRequest(mockClient, &req, &body)
+
+	ce := buildCloudEvent(testObject(), "created", cfg)
+	require.NoError(t, httpSink(n).Send(context.Background(), ce))
+
+	// The second request waits for the limiter.
+	start := time.Now()
+	require.NoError(t, httpSink(n).Send(context.Background(), ce))
+	waited := time.Since(start)
+	signedAt, err := strconv.ParseInt(req.Header.Get(webhook.HeaderTimestamp), 10, 64)
+	require.NoError(t, err)
+
+	require.GreaterOrEqual(t, waited, 900*time.Millisecond)
+	assert.GreaterOrEqual(t, signedAt, start.Add(900*time.Millisecond).Unix(), "the request is signed after waiting")
+	assert.Equal(t, ce.ID, req.Header.Get(webhook.HeaderID))
+}
+
+func TestHTTPSink_UnsignedWhenDisabled(t *testing.T) {
+	cfg := testConfig()
+	n, _ := newTestNotifier(cfg, new(database.MockDatabase), new(MockHTTPClient))
+
+	req, err := httpSink(n).buildRequest(buildCloudEvent(testObject(), "created", cfg))
+	require.NoError(t, err)
+	require.NoError(t, httpSink(n).sign(req, "evt-1"))
+
+	assert.Empty(t, req.Header.Get(webhook.HeaderSignature))
+}
+
+func TestRequestSigner_ReloadsSecretsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets")
+	require.NoError(t, os.WriteFile(path, []byte(signingSecretA+"\n"), 0o600))
+
+	cfg := testConfig()
+	cfg.Endpoint.Signing.Enabled = true
+	cfg.Endpoint.Signing.SecretsFile = path
+	signer := newRequestSigner(&cfg.Endpoint.Signing, zap.NewNop())
+
+	signedWith := func(secret string) error {
+		req, err := http.NewRequest(http.MethodPost, "https://example.com", strings.NewReader(`{}`))
+		require.NoError(t, err)
+		require.NoError(t, signer.sign(req, "msg-1"))
+		verifier, err := webhook.NewVerifier([]string{secret})
+		require.NoError(t, err)
+		return verifier.Verify(req.Header, []byte(`{}`))
+	}
+
+	assert.NoError(t, signedWith(signingSecretA))
+	assert.Error(t, signedWith(signingSecretB))
+
+	// Rotate: add the new secret alongside the old one.
+	require.NoError(t, os.WriteFile(path, []byte(signingSecretA+"\n"+signingSecretB+"\n"), 0o600))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Minute)))
+
+	assert.NoError(t, signedWith(signingSecretA))
+	assert.NoError(t, signedWith(signingSecretB))
+}
+
+func TestProcessNotification_SigningFailureIsRetried(t *testing.T) {
+	cfg := testConfig()
+	cfg.Endpoint.Signing.Enabled = true
+	cfg.Endpoint.Signing.SecretsFile = filepath.Join(t.TempDir(), "missing")
+	mockDB := new(database.MockDatabase)
+	mockClient := new(MockHTTPClient)
+	n, _ := newTestNotifier(cfg, mockDB, mockClient)
+
+	obj := testObject()
+	mockDB.On("IncrementNotificationAttempts", obj.ID, mock.AnythingOfType("time.Time")).Return(nil)
+
+	n.processNotification(context.Background(), obj)
+
+	mockDB.AssertExpectations(t)
+	mockClient.AssertNotCalled(t, "Do", mock.Anything)
+}
@@ -0,0 +1,75 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bryonbaker/beacon/internal/models"
+)
+
+// Sink delivers CloudEvents to a destination. The notifier owns persistence
+// and retry decisions; a sink only reports the outcome of each delivery.
+//
+// Send and SendBatch return nil for a delivered event, ErrAwaitingAck for an
+// event the destination accepted and will acknowledge later, a *StatusError
+// when the destination answered with a failure status, a *PermanentError when
+// the event can never be delivered, and any other error for transient
+// failures that should be retried.
+type Sink interface {
+	// Send delivers a single event.
+	Send(ctx context.Context, ce *models.CloudEvent) error
+
+	// SendBatch delivers several events, grouping them where the destination
+	// supports it, and returns one result per event in the same order.
+	SendBatch(ctx context.Context, events []*models.CloudEvent) []error
+
+	// Close releases any connections held by the sink.
+	Close() error
+}
+
+// ErrAwaitingAck reports that the destination accepted an event for
+// processing (HTTP 202) and will confirm or reject it through the
+// acknowledgement callback. Sinks only return it in acknowledgement mode.
+var ErrAwaitingAck = errors.New("destination accepted the event and will acknowledge it later")
+
+// StatusError reports that the destination rejected an event. StatusCode uses
+// HTTP semantics so that retriable and non-retriable failures are classified
+// the same way for every sink. RetryAfter is the delay the destination asked
+// for before the next attempt, or zero if it did not ask for one. Body and
+// Headers hold the start of the response body and selected response headers,
+// where the sink captures them, to explain the failure.
+type StatusError struct {
+	StatusCode int
+	RetryAfter time.Duration
+	Body       string
+	Headers    map[string]string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("destination returned status %d", e.StatusCode)
+}
+
+// PermanentError wraps a failure that will not succeed on retry, such as an
+// event that cannot be encoded or a record the broker rejects as invalid.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return fmt.Sprintf("permanent delivery failure: %v", e.Err)
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// repeatError returns a result slice reporting err for each of n events.
+func repeatError(n int, err error) []error {
+	errs := make([]error, n)
+	for i := range errs {
+		errs[i] = err
+	}
+	return errs
+}
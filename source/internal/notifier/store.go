@@ -0,0 +1,106 @@
+package notifier
+
+import (
+	"context"
+	"time"
+
+	"github.com/bryonbaker/beacon/internal/database"
+	"github.com/bryonbaker/beacon/internal/models"
+)
+
+// deliveryStore persists the outcome of deliveries. The notifier for the
+// single endpoint records outcomes on the managed object itself; the notifier
+// for a named endpoint records them per event and endpoint. Database calls
+// are traced as children of the delivery span in ctx.
+type deliveryStore interface {
+	// sent records that eventType was delivered at the given time.
+	sent(ctx context.Context, obj *models.ManagedObject, eventType string, at time.Time) error
+
+	// failed records that eventType can never be delivered.
+	failed(ctx context.Context, obj *models.ManagedObject, eventType string, statusCode int) error
+
+	// retry records a failed attempt and schedules the next one.
+	retry(ctx context.Context, obj *models.ManagedObject, eventType string, next time.Time) error
+
+	// coalesced records that the created and deleted events were replaced
+	// by decision.
+	coalesced(ctx context.Context, obj *models.ManagedObject, decision string, at time.Time) error
+}
+
+// objectStore records delivery outcomes on the managed object.
+type objectStore struct {
+	db database.Database
+}
+
+func (s objectStore) sent(ctx context.Context, obj *models.ManagedObject, eventType string, at time.Time) error {
+	return database.WithContext(ctx, s.db).UpdateNotificationStatus(obj.ID, eventType, at)
+}
+
+func (s objectStore) failed(ctx context.Context, obj *models.ManagedObject, _ string, statusCode int) error {
+	return database.WithContext(ctx, s.db).MarkNotificationFailed(obj.ID, statusCode)
+}
+
+func (s objectStore) retry(ctx context.Context, obj *models.ManagedObject, _ string, next time.Time) error {
+	return database.WithContext(ctx, s.db).IncrementNotificationAttempts(obj.ID, next)
+}
+
+func (s objectStore) coalesced(ctx context.Context, obj *models.ManagedObject, decision string, at time.Time) error {
+	return database.WithContext(ctx, s.db).MarkCoalesced(obj.ID, decision, at)
+}
+
+// endpointStore records delivery outcomes for one named endpoint in the
+// endpoint_deliveries table. The object it is given is a view whose attempt
+// counters are those of the endpoint (see Notifier.view).
+type endpointStore struct {
+	db       database.Database
+	endpoint string
+}
+
+func (s endpointStore) sent(ctx context.Context, obj *models.ManagedObject, eventType string, at time.Time) error {
+	d := s.delivery(obj, eventType)
+	d.Status = models.NotificationSent
+	d.NextAttemptAt = nil
+	d.SentAt = &at
+	return database.WithContext(ctx, s.db).SaveEndpointDelivery(d)
+}
+
+func (s endpointStore) failed(ctx context.Context, obj *models.ManagedObject, eventType string, statusCode int) error {
+	d := s.delivery(obj, eventType)
+	d.Status = models.NotificationFailed
+	d.NextAttemptAt = nil
+	d.FailedCode = statusCode
+	return database.WithContext(ctx, s.db).SaveEndpointDelivery(d)
+}
+
+func (s endpointStore) retry(ctx context.Context, obj *models.ManagedObject, eventType string, next time.Time) error {
+	now := time.Now()
+	d := s.delivery(obj, eventType)
+	d.Attempts++
+	d.LastAttempt = &now
+	d.NextAttemptAt = &next
+	return database.WithContext(ctx, s.db).SaveEndpointDelivery(d)
+}
+
+func (s endpointStore) coalesced(ctx context.Context, obj *models.ManagedObject, _ string, at time.Time) error {
+	if err := s.sent(ctx, obj, "created", at); err != nil {
+		return err
+	}
+	return s.sent(ctx, obj, "deleted", at)
+}
+
+// delivery returns the stored state of eventType at the endpoint, as carried
+// by the view obj. An ephemeral event takes the place of the created event.
+func (s endpointStore) delivery(obj *models.ManagedObject, eventType string) *models.EndpointDelivery {
+	if eventType == eventTypeEphemeral {
+		eventType = "created"
+	}
+	return &models.EndpointDelivery{
+		ObjectID:      obj.ID,
+		Endpoint:      s.endpoint,
+		EventType:     eventType,
+		Status:        models.NotificationPending,
+		Attempts:      obj.NotificationAttempts,
+		LastAttempt:   obj.LastNotificationAttempt,
+		NextAttemptAt: obj.NextAttemptAt,
+	}
+}
@@ -0,0 +1,108 @@
+// Package payload builds the notification payload content extracted from a
+// watched Kubernetes object. It is shared by the watcher and the reconciler so
+// that objects detected by either path carry identical payload data.
+package payload
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/client-go/util/jsonpath"
+
+	"github.com/bryonbaker/beacon/internal/config"
+)
+
+// compiledField is a parsed payload.fields entry.
+type compiledField struct {
+	name string
+	path *jsonpath.JSONPath
+}
+
+// FieldExtractor evaluates the configured payload.fields JSONPath expressions
+// against the full object. A nil *FieldExtractor extracts nothing.
+type FieldExtractor struct {
+	fields []compiledField
+}
+
+// NewFieldExtractor parses every configured field expression. Missing keys are
+// tolerated at evaluation time so that optional spec/status fields simply
+// drop out of the payload.
+func NewFieldExtractor(fields []config.FieldConfig) (*FieldExtractor, error) {
+	e := &FieldExtractor{}
+	for _, f := range fields {
+		jp := jsonpath.New(f.Name)
+		jp.AllowMissingKeys(true)
+		if err := jp.Parse(f.Template()); err != nil {
+			return nil, fmt.Errorf("parsing jsonPath for field %q: %w", f.Name, err)
+		}
+		e.fields = append(e.fields, compiledField{name: f.Name, path: jp})
+	}
+	return e, nil
+}
+
+// Enabled reports whether any fields are configured.
+func (e *FieldExtractor) Enabled() bool {
+	return e != nil && len(e.fields) > 0
+}
+
+// Extract evaluates each field against obj, which must be the unstructured
+// representation of a Kubernetes object. Values keep their JSON type: a
+// single match is returned as-is and multiple matches as a list. Fields that
+// match nothing are omitted. The returned error aggregates evaluation
+// failures; successfully extracted fields are still returned alongside it.
+func (e *FieldExtractor) Extract(obj map[string]interface{}) (map[string]interface{}, error) {
+	if !e.Enabled() {
+		return nil, nil
+	}
+
+	out := make(map[string]interface{}, len(e.fields))
+	var errs []error
+	for _, f := range e.fields {
+		results, err := f.path.FindResults(obj)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("field %q: %w", f.name, err))
+			continue
+		}
+
+		var values []interface{}
+		for _, set := range results {
+			for _, v := range set {
+				if v.IsValid() && v.CanInterface() {
+					values = append(values, v.Interface())
+				}
+			}
+		}
+
+		switch len(values) {
+		case 0:
+			continue
+		case 1:
+			out[f.name] = values[0]
+		default:
+			out[f.name] = values
+		}
+	}
+
+	if len(out) == 0 {
+		out = nil
+	}
+	if len(errs) > 0 {
+		return out, fmt.Errorf("extracting payload fields: %v", errs)
+	}
+	return out, nil
+}
+
+// ExtractJSON is a convenience wrapper around Extract that returns the result
+// serialised for storage in the managed_objects.fields column. An empty string
+// is returned when no fields were extracted.
+func (e *FieldExtractor) ExtractJSON(obj map[string]interface{}) (string, error) {
+	fields, err := e.Extract(obj)
+	if len(fields) == 0 {
+		return "", err
+	}
+	data, mErr := json.Marshal(fields)
+	if mErr != nil {
+		return "", fmt.Errorf("marshalling payload fields: %w", mErr)
+	}
+	return string(data), err
+}
@@ -0,0 +1,129 @@
+package payload
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bryonbaker/beacon/internal/config"
+)
+
+// llmService returns an unstructured LLMInferenceService-like object.
+func llmService() map[string]interface{} {
+	return map[string]interface{}{
+		"apiVersion": "serving.kserve.io/v1alpha1",
+		"kind":       "LLMInferenceService",
+		"metadata": map[string]interface{}{
+			"name":      "llama",
+			"namespace": "tenant-a",
+		},
+		"spec": map[string]interface{}{
+			"model": map[string]interface{}{
+				"name": "meta-llama/Llama-3-8B",
+			},
+			"replicas": int64(3),
+			"router": map[string]interface{}{
+				"enabled": true,
+			},
+		},
+		"status": map[string]interface{}{
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "Ready", "status": "True"},
+				map[string]interface{}{"type": "Routed", "status": "False"},
+			},
+		},
+	}
+}
+
+func TestFieldConfig_Template(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"{.spec.replicas}", "{.spec.replicas}"},
+		{".spec.replicas", "{.spec.replicas}"},
+		{"$.spec.replicas", "{.spec.replicas}"},
+		{"spec.replicas", "{.spec.replicas}"},
+	}
+	for _, tc := range tests {
+		assert.Equal(t, tc.want, config.FieldConfig{Name: "f", JSONPath: tc.in}.Template(), tc.in)
+	}
+}
+
+func TestExtract_PreservesTypes(t *testing.T) {
+	e, err := NewFieldExtractor([]config.FieldConfig{
+		{Name: "model", JSONPath: ".spec.model.name"},
+		{Name: "replicas", JSONPath: ".spec.replicas"},
+		{Name: "router", JSONPath: ".spec.router.enabled"},
+		{Name: "conditionTypes", JSONPath: ".status.conditions[*].type"},
+	})
+	require.NoError(t, err)
+
+	fields, err := e.Extract(llmService())
+	require.NoError(t, err)
+
+	assert.Equal(t, "meta-llama/Llama-3-8B", fields["model"])
+	assert.Equal(t, int64(3), fields["replicas"])
+	assert.Equal(t, true, fields["router"])
+	assert.Equal(t, []interface{}{"Ready", "Routed"}, fields["conditionTypes"])
+}
+
+func TestExtract_MissingFieldOmitted(t *testing.T) {
+	e, err := NewFieldExtractor([]config.FieldConfig{
+		{Name: "gpu", JSONPath: ".spec.resources.gpu"},
+		{Name: "replicas", JSONPath: ".spec.replicas"},
+	})
+	require.NoError(t, err)
+
+	fields, err := e.Extract(llmService())
+	require.NoError(t, err)
+
+	assert.NotContains(t, fields, "gpu")
+	assert.Equal(t, int64(3), fields["replicas"])
+}
+
+func TestExtract_FilterExpression(t *testing.T) {
+	e, err := NewFieldExtractor([]config.FieldConfig{
+		{Name: "ready", JSONPath: `{.status.conditions[?(@.type=="Ready")].status}`},
+	})
+	require.NoError(t, err)
+
+	fields, err := e.Extract(llmService())
+	require.NoError(t, err)
+	assert.Equal(t, "True", fields["ready"])
+}
+
+func TestExtractJSON(t *testing.T) {
+	e, err := NewFieldExtractor([]config.FieldConfig{
+		{Name: "replicas", JSONPath: ".spec.replicas"},
+	})
+	require.NoError(t, err)
+
+	s, err := e.ExtractJSON(llmService())
+	require.NoError(t, err)
+
+	var decoded map[string]json.Number
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	require.NoError(t, dec.Decode(&decoded))
+	assert.Equal(t, json.Number("3"), decoded["replicas"])
+}
+
+func TestExtract_NilExtractor(t *testing.T) {
+	var e *FieldExtractor
+	assert.False(t, e.Enabled())
+
+	fields, err := e.Extract(llmService())
+	assert.NoError(t, err)
+	assert.Nil(t, fields)
+}
+
+func TestNewFieldExtractor_InvalidPath(t *testing.T) {
+	_, err := NewFieldExtractor([]config.FieldConfig{
+		{Name: "bad", JSONPath: "{.spec[}"},
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,331 @@
+package payload
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/bryonbaker/beacon/internal/config"
+)
+
+// Redaction actions supported by payload.redact entries.
+const (
+	RedactActionRedact = "redact"
+	RedactActionSHA256 = "sha256"
+)
+
+// RedactedValue replaces the value of keys redacted with the "redact" action.
+const RedactedValue = "[REDACTED]"
+
+// sha256Prefix is prepended to the digest of values hashed by the sha256
+// action.
+const sha256Prefix = "sha256:"
+
+// regexPrefix marks a key pattern as a regular expression rather than a glob.
+const regexPrefix = "regex:"
+
+// keyMatcher matches label or annotation keys. Patterns are exact keys, globs
+// using path.Match syntax (e.g. "*.kubernetes.io/*"), or regular expressions
+// prefixed with "regex:".
+type keyMatcher struct {
+	exact map[string]struct{}
+	globs []string
+	regex []*regexp.Regexp
+}
+
+// newKeyMatcher compiles the given patterns. field names the config entry for
+// error messages.
+func newKeyMatcher(field string, patterns []string) (*keyMatcher, error) {
+	m := &keyMatcher{exact: make(map[string]struct{})}
+	for i, p := range patterns {
+		switch {
+		case strings.HasPrefix(p, regexPrefix):
+			re, err := regexp.Compile(strings.TrimPrefix(p, regexPrefix))
+			if err != nil {
+				return nil, fmt.Errorf("%s[%d]: invalid regular expression %q: %w", field, i, p, err)
+			}
+			m.regex = append(m.regex, re)
+		case strings.ContainsAny(p, "*?["):
+			if _, err := path.Match(p, ""); err != nil {
+				return nil, fmt.Errorf("%s[%d]: invalid glob %q: %w", field, i, p, err)
+			}
+			m.globs = append(m.globs, p)
+		default:
+			m.exact[p] = struct{}{}
+		}
+	}
+	return m, nil
+}
+
+// empty reports whether no patterns were configured.
+func (m *keyMatcher) empty() bool {
+	return len(m.exact) == 0 && len(m.globs) == 0 && len(m.regex) == 0
+}
+
+// match reports whether key matches any configured pattern.
+func (m *keyMatcher) match(key string) bool {
+	if _, ok := m.exact[key]; ok {
+		return true
+	}
+	for _, g := range m.globs {
+		if ok, _ := path.Match(g, key); ok {
+			return true
+		}
+	}
+	for _, re := range m.regex {
+		if re.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// redaction is a compiled payload.redact entry.
+type redaction struct {
+	keys   *keyMatcher
+	action string
+}
+
+// Filter applies the payload allow/deny rules and value redaction to label and
+// annotation maps. The watcher and reconciler apply it before objects are
+// persisted; the notifier re-applies the rules that are safe to apply twice
+// when building the CloudEvent, so that rows stored under an older
+// configuration are also covered by them.
+//
+// The exact-key lists payload.labels and payload.annotations are read from the
+// config on every call; the pattern rules are compiled once by NewFilter. A
+// nil *Filter, as left by an invalid configuration, selects nothing, so that
+// the values it would protect are never stored or sent.
+type Filter struct {
+	cfg             *config.PayloadConfig
+	labelAllow      *keyMatcher
+	labelDeny       *keyMatcher
+	annotationAllow *keyMatcher
+	annotationDeny  *keyMatcher
+	redactions      []redaction
+}
+
+// NewFilter compiles the pattern rules in cfg.
+func NewFilter(cfg *config.PayloadConfig) (*Filter, error) {
+	f := &Filter{cfg: cfg}
+	var err error
+
+	if f.labelAllow, err = newKeyMatcher("payload.labelFilter.allow", cfg.LabelFilter.Allow); err != nil {
+		return nil, err
+	}
+	if f.labelDeny, err = newKeyMatcher("payload.labelFilter.deny", cfg.LabelFilter.Deny); err != nil {
+		return nil, err
+	}
+	if f.annotationAllow, err = newKeyMatcher("payload.annotationFilter.allow", cfg.AnnotationFilter.Allow); err != nil {
+		return nil, err
+	}
+	if f.annotationDeny, err = newKeyMatcher("payload.annotationFilter.deny", cfg.AnnotationFilter.Deny); err != nil {
+		return nil, err
+	}
+
+	for i, r := range cfg.Redact {
+		keys, err := newKeyMatcher(fmt.Sprintf("payload.redact[%d].keys", i), r.Keys)
+		if err != nil {
+			return nil, err
+		}
+		action := r.Action
+		if action == "" {
+			action = RedactActionRedact
+		}
+		switch action {
+		case RedactActionRedact, RedactActionSHA256:
+		default:
+			return nil, fmt.Errorf("payload.redact[%d].action must be one of: redact, sha256; got %q", i, r.Action)
+		}
+		f.redactions = append(f.redactions, redaction{keys: keys, action: action})
+	}
+
+	return f, nil
+}
+
+// Labels returns the labels to include in the payload. When neither
+// payload.labels nor payload.labelFilter.allow is configured every label is
+// allowed. Denied keys are then removed and redaction is applied.
+func (f *Filter) Labels(all map[string]string) map[string]string {
+	if f == nil {
+		return nil
+	}
+	allowAll := len(f.cfg.Labels) == 0 && f.labelAllow.empty()
+	if all == nil && allowAll {
+		return nil
+	}
+	out := make(map[string]string, len(all))
+	for k, v := range all {
+		if !allowAll && !containsKey(f.cfg.Labels, k) && !f.labelAllow.match(k) {
+			continue
+		}
+		if f.labelDeny.match(k) {
+			continue
+		}
+		out[k] = f.redact(k, v, false)
+	}
+	return out
+}
+
+// Annotations returns the annotations to include in the payload. Only keys
+// listed in payload.annotations or matched by payload.annotationFilter.allow
+// are included; denied keys are then removed and redaction is applied. nil is
+// returned when nothing is selected.
+func (f *Filter) Annotations(all map[string]string) map[string]string {
+	if f == nil || (len(f.cfg.Annotations) == 0 && f.annotationAllow.empty()) {
+		return nil
+	}
+	out := make(map[string]string)
+	for k, v := range all {
+		if !containsKey(f.cfg.Annotations, k) && !f.annotationAllow.match(k) {
+			continue
+		}
+		if f.annotationDeny.match(k) {
+			continue
+		}
+		out[k] = f.redact(k, v, false)
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// SanitizeLabels removes denied label keys and redacts values without
+// applying the allow rules. It is used for the full metadata snapshot and the
+// object payload fields are extracted from.
+func (f *Filter) SanitizeLabels(all map[string]string) map[string]string {
+	return f.sanitize(all, f.denyLabels(), false)
+}
+
+// SanitizeAnnotations removes denied annotation keys and redacts values
+// without applying the allow rules.
+func (f *Filter) SanitizeAnnotations(all map[string]string) map[string]string {
+	return f.sanitize(all, f.denyAnnotations(), false)
+}
+
+// SanitizeStoredLabels re-applies the deny rules and the redact action to
+// labels that were filtered before they were persisted. Values of keys
+// hashed with the sha256 action are kept as stored: a stored value cannot be
+// told apart from one hashed at ingestion, and hashing it again would change
+// it.
+func (f *Filter) SanitizeStoredLabels(stored map[string]string) map[string]string {
+	return f.sanitize(stored, f.denyLabels(), true)
+}
+
+// SanitizeStoredAnnotations is SanitizeStoredLabels for annotations.
+func (f *Filter) SanitizeStoredAnnotations(stored map[string]string) map[string]string {
+	return f.sanitize(stored, f.denyAnnotations(), true)
+}
+
+// Object returns a copy of obj, the unstructured representation of a
+// Kubernetes object, whose labels and annotations are sanitized, so that
+// payload.fields expressions cannot select denied or unredacted values. Only
+// the metadata is copied; the rest of obj is shared.
+func (f *Filter) Object(obj map[string]interface{}) map[string]interface{} {
+	meta, ok := obj["metadata"].(map[string]interface{})
+	if !ok {
+		return obj
+	}
+	out := make(map[string]interface{}, len(obj))
+	for k, v := range obj {
+		out[k] = v
+	}
+	sanitized := make(map[string]interface{}, len(meta))
+	for k, v := range meta {
+		sanitized[k] = v
+	}
+	out["metadata"] = sanitized
+
+	for key, sanitize := range map[string]func(map[string]string) map[string]string{
+		"labels":      f.SanitizeLabels,
+		"annotations": f.SanitizeAnnotations,
+	} {
+		values, ok := meta[key].(map[string]interface{})
+		if !ok {
+			delete(sanitized, key)
+			continue
+		}
+		in := make(map[string]string, len(values))
+		for k, v := range values {
+			if s, ok := v.(string); ok {
+				in[k] = s
+			}
+		}
+		kept := sanitize(in)
+		if kept == nil {
+			delete(sanitized, key)
+			continue
+		}
+		result := make(map[string]interface{}, len(kept))
+		for k, v := range kept {
+			result[k] = v
+		}
+		sanitized[key] = result
+	}
+	return out
+}
+
+func (f *Filter) denyLabels() *keyMatcher {
+	if f == nil {
+		return nil
+	}
+	return f.labelDeny
+}
+
+func (f *Filter) denyAnnotations() *keyMatcher {
+	if f == nil {
+		return nil
+	}
+	return f.annotationDeny
+}
+
+// sanitize drops keys matched by deny and redacts the remaining values. stored
+// values keep the values of keys hashed with the sha256 action.
+func (f *Filter) sanitize(all map[string]string, deny *keyMatcher, stored bool) map[string]string {
+	if f == nil || all == nil {
+		return nil
+	}
+	out := make(map[string]string, len(all))
+	for k, v := range all {
+		if deny.match(k) {
+			continue
+		}
+		out[k] = f.redact(k, v, stored)
+	}
+	return out
+}
+
+// redact applies the first matching redaction rule to value. A stored value
+// of a key hashed with the sha256 action is returned unchanged.
+func (f *Filter) redact(key, value string, stored bool) string {
+	for _, r := range f.redactions {
+		if !r.keys.match(key) {
+			continue
+		}
+		switch r.action {
+		case RedactActionSHA256:
+			if stored {
+				return value
+			}
+			sum := sha256.Sum256([]byte(value))
+			return sha256Prefix + hex.EncodeToString(sum[:])
+		default:
+			return RedactedValue
+		}
+	}
+	return value
+}
+
+// containsKey reports whether keys contains key.
+func containsKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
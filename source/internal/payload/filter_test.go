@@ -0,0 +1,184 @@
+package payload
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bryonbaker/beacon/internal/config"
+)
+
+func TestFilterLabels_NoConfigAllowsAll(t *testing.T) {
+	f, err := NewFilter(&config.PayloadConfig{})
+	require.NoError(t, err)
+
+	labels := map[string]string{"app": "web", "env": "prod"}
+	assert.Equal(t, labels, f.Labels(labels))
+}
+
+func TestFilterLabels_AllowGlobAndExact(t *testing.T) {
+	f, err := NewFilter(&config.PayloadConfig{
+		Labels:      []string{"app"},
+		LabelFilter: config.KeyFilterConfig{Allow: []string{"team.example.com/*"}},
+	})
+	require.NoError(t, err)
+
+	got := f.Labels(map[string]string{
+		"app":                    "web",
+		"team.example.com/owner": "platform",
+		"env":                    "prod",
+	})
+	assert.Equal(t, map[string]string{"app": "web", "team.example.com/owner": "platform"}, got)
+}
+
+func TestFilterLabels_DenyWinsOverAllow(t *testing.T) {
+	f, err := NewFilter(&config.PayloadConfig{
+		Labels:      []string{"app", "secret-hash"},
+		LabelFilter: config.KeyFilterConfig{Deny: []string{"regex:^secret-"}},
+	})
+	require.NoError(t, err)
+
+	got := f.Labels(map[string]string{"app": "web", "secret-hash": "abc"})
+	assert.Equal(t, map[string]string{"app": "web"}, got)
+}
+
+func TestFilterAnnotations_PatternAllowAndDeny(t *testing.T) {
+	f, err := NewFilter(&config.PayloadConfig{
+		AnnotationFilter: config.KeyFilterConfig{
+			Allow: []string{"example.com/*"},
+			Deny:  []string{"kubectl.kubernetes.io/*", "example.com/token"},
+		},
+	})
+	require.NoError(t, err)
+
+	got := f.Annotations(map[string]string{
+		"example.com/owner": "team-a",
+		"example.com/token": "s3cret",
+		"kubectl.kubernetes.io/last-applied-configuration": "{}",
+	})
+	assert.Equal(t, map[string]string{"example.com/owner": "team-a"}, got)
+}
+
+func TestFilterAnnotations_NothingConfiguredReturnsNil(t *testing.T) {
+	f, err := NewFilter(&config.PayloadConfig{})
+	require.NoError(t, err)
+	assert.Nil(t, f.Annotations(map[string]string{"example.com/owner": "team-a"}))
+}
+
+func TestRedact_Actions(t *testing.T) {
+	f, err := NewFilter(&config.PayloadConfig{
+		Annotations: []string{"example.com/api-key", "example.com/email"},
+		Redact: []config.RedactConfig{
+			{Keys: []string{"*/api-key"}},
+			{Keys: []string{"example.com/email"}, Action: RedactActionSHA256},
+		},
+	})
+	require.NoError(t, err)
+
+	got := f.Annotations(map[string]string{
+		"example.com/api-key": "abc123",
+		"example.com/email":   "dev@example.com",
+	})
+	assert.Equal(t, RedactedValue, got["example.com/api-key"])
+	assert.True(t, strings.HasPrefix(got["example.com/email"], "sha256:"))
+	assert.NotContains(t, got["example.com/email"], "dev@example.com")
+
+	// Re-applying the filter to the stored values must not hash the hash.
+	assert.Equal(t, got, f.SanitizeStoredAnnotations(got))
+}
+
+func TestRedact_SHA256HashesPrefixedValues(t *testing.T) {
+	f, err := NewFilter(&config.PayloadConfig{
+		Annotations: []string{"example.com/email"},
+		Redact:      []config.RedactConfig{{Keys: []string{"example.com/email"}, Action: RedactActionSHA256}},
+	})
+	require.NoError(t, err)
+
+	// A raw value that looks hashed is hashed all the same.
+	got := f.Annotations(map[string]string{"example.com/email": "sha256:alice@example.com"})
+	assert.True(t, strings.HasPrefix(got["example.com/email"], "sha256:"))
+	assert.NotContains(t, got["example.com/email"], "alice@example.com")
+}
+
+func TestSanitizeStored_AppliesDenyAndRedact(t *testing.T) {
+	f, err := NewFilter(&config.PayloadConfig{
+		LabelFilter: config.KeyFilterConfig{Deny: []string{"env"}},
+		Redact: []config.RedactConfig{
+			{Keys: []string{"owner"}},
+			{Keys: []string{"email"}, Action: RedactActionSHA256},
+		},
+	})
+	require.NoError(t, err)
+
+	got := f.SanitizeStoredLabels(map[string]string{"app": "web", "env": "prod", "owner": "alice", "email": "sha256:abc"})
+	assert.Equal(t, map[string]string{"app": "web", "owner": RedactedValue, "email": "sha256:abc"}, got)
+}
+
+func TestObject_SanitizesMetadata(t *testing.T) {
+	f, err := NewFilter(&config.PayloadConfig{
+		AnnotationFilter: config.KeyFilterConfig{Deny: []string{"example.com/token"}},
+		Redact:           []config.RedactConfig{{Keys: []string{"example.com/email"}}},
+	})
+	require.NoError(t, err)
+
+	obj := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":   "web",
+			"labels": map[string]interface{}{"example.com/email": "dev@example.com"},
+			"annotations": map[string]interface{}{
+				"example.com/token": "s3cret",
+				"example.com/owner": "team-a",
+			},
+		},
+		"spec": map[string]interface{}{"replicas": int64(2)},
+	}
+
+	got := f.Object(obj)
+
+	assert.Equal(t, map[string]interface{}{
+		"name":        "web",
+		"labels":      map[string]interface{}{"example.com/email": RedactedValue},
+		"annotations": map[string]interface{}{"example.com/owner": "team-a"},
+	}, got["metadata"])
+	assert.Equal(t, obj["spec"], got["spec"])
+	assert.Equal(t, "s3cret", obj["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})["example.com/token"],
+		"the original object is unchanged")
+}
+
+func TestSanitize_IgnoresAllowRules(t *testing.T) {
+	f, err := NewFilter(&config.PayloadConfig{
+		Labels:      []string{"app"},
+		LabelFilter: config.KeyFilterConfig{Deny: []string{"internal/*"}},
+		Redact:      []config.RedactConfig{{Keys: []string{"owner"}}},
+	})
+	require.NoError(t, err)
+
+	got := f.SanitizeLabels(map[string]string{"app": "web", "owner": "alice", "internal/id": "42", "env": "prod"})
+	assert.Equal(t, map[string]string{"app": "web", "owner": RedactedValue, "env": "prod"}, got)
+}
+
+func TestFilter_NilSelectsNothing(t *testing.T) {
+	var f *Filter
+	labels := map[string]string{"app": "web"}
+	assert.Nil(t, f.Labels(labels))
+	assert.Nil(t, f.SanitizeAnnotations(labels))
+	assert.Nil(t, f.SanitizeStoredLabels(labels))
+	assert.Nil(t, f.Annotations(labels))
+
+	got := f.Object(map[string]interface{}{"metadata": map[string]interface{}{"name": "web", "labels": map[string]interface{}{"app": "web"}}})
+	assert.Equal(t, map[string]interface{}{"name": "web"}, got["metadata"])
+}
+
+func TestNewFilter_InvalidPatterns(t *testing.T) {
+	_, err := NewFilter(&config.PayloadConfig{
+		LabelFilter: config.KeyFilterConfig{Deny: []string{"regex:("}},
+	})
+	assert.Error(t, err)
+
+	_, err = NewFilter(&config.PayloadConfig{
+		Redact: []config.RedactConfig{{Keys: []string{"a"}, Action: "encrypt"}},
+	})
+	assert.Error(t, err)
+}
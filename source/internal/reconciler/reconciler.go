@@ -7,13 +7,17 @@ package reconciler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
@@ -22,6 +26,8 @@ import (
 	"github.com/bryonbaker/beacon/internal/database"
 	"github.com/bryonbaker/beacon/internal/metrics"
 	"github.com/bryonbaker/beacon/internal/models"
+	"github.com/bryonbaker/beacon/internal/payload"
+	"github.com/bryonbaker/beacon/internal/tracing"
 )
 
 // Reconciler periodically compares the cluster state with the database to
@@ -33,6 +39,9 @@ type Reconciler struct {
 	cfg         *config.Config
 	metrics     *metrics.Metrics
 	logger      *zap.Logger
+	fields      *payload.FieldExtractor
+	filter      *payload.Filter
+	tracer      trace.Tracer
 }
 
 // NewReconciler creates a new Reconciler with the provided dependencies.
@@ -44,6 +53,17 @@ func NewReconciler(
 	m *metrics.Metrics,
 	logger *zap.Logger,
 ) *Reconciler {
+	fields, err := payload.NewFieldExtractor(cfg.Payload.Fields)
+	if err != nil {
+		// Expressions are validated when the config is loaded, so this only
+		// happens for hand-built configs; fall back to extracting nothing.
+		logger.Error("invalid payload fields, field extraction disabled", zap.Error(err))
+	}
+	filter, err := payload.NewFilter(&cfg.Payload)
+	if err != nil {
+		logger.Error("invalid payload filter, labels and annotations omitted", zap.Error(err))
+	}
+
 	return &Reconciler{
 		db:          db,
 		typedClient: typedClient,
@@ -51,6 +71,9 @@ func NewReconciler(
 		cfg:         cfg,
 		metrics:     m,
 		logger:      logger,
+		fields:      fields,
+		filter:      filter,
+		tracer:      tracing.Tracer("reconciler"),
 	}
 }
 
@@ -93,7 +116,10 @@ func (r *Reconciler) Start(ctx context.Context) {
 // Objects present in the cluster but absent from the database are treated as
 // missed creations and inserted. Objects present in the database but absent
 // from the cluster are treated as missed deletions and marked as deleted.
-func (r *Reconciler) Reconcile(ctx context.Context) error {
+func (r *Reconciler) Reconcile(ctx context.Context) (err error) {
+	ctx, span := r.tracer.Start(ctx, "reconciler.Reconcile")
+	defer func() { tracing.End(span, err) }()
+
 	start := time.Now()
 	r.logger.Info("reconciliation started")
 
@@ -115,10 +141,12 @@ func (r *Reconciler) Reconcile(ctx context.Context) error {
 
 	if reconcileErr != nil {
 		r.metrics.ReconciliationRunsTotal.WithLabelValues("error").Inc()
+		r.metrics.RecordComponentHealth("reconciler", false)
 		return fmt.Errorf("reconciliation completed with errors: %w", reconcileErr)
 	}
 
 	r.metrics.ReconciliationRunsTotal.WithLabelValues("success").Inc()
+	r.metrics.RecordComponentHealth("reconciler", true)
 	r.logger.Info("reconciliation completed",
 		zap.Duration("duration", duration),
 	)
@@ -126,7 +154,13 @@ func (r *Reconciler) Reconcile(ctx context.Context) error {
 }
 
 // reconcileResource performs the diff for a single resource type.
-func (r *Reconciler) reconcileResource(ctx context.Context, res config.ResourceConfig, resourceType string) error {
+func (r *Reconciler) reconcileResource(ctx context.Context, res config.ResourceConfig, resourceType string) (err error) {
+	ctx, span := r.tracer.Start(ctx, "reconciler.reconcileResource", trace.WithAttributes(
+		attribute.String("beacon.resource.type", resourceType),
+	))
+	defer func() { tracing.End(span, err) }()
+	db := database.WithContext(ctx, r.db)
+
 	// List annotated objects from the cluster.
 	clusterUIDs, clusterObjects, err := r.listClusterObjects(ctx, res)
 	if err != nil {
@@ -134,7 +168,7 @@ func (r *Reconciler) reconcileResource(ctx context.Context, res config.ResourceC
 	}
 
 	// Get all active objects from the database for this resource type.
-	dbObjects, err := r.db.GetAllActiveObjects(resourceType)
+	dbObjects, err := db.GetAllActiveObjects(resourceType)
 	if err != nil {
 		return fmt.Errorf("querying active objects for %s: %w", resourceType, err)
 	}
@@ -159,7 +193,7 @@ func (r *Reconciler) reconcileResource(ctx context.Context, res config.ResourceC
 			clusterObj.DetectionSource = models.DetectionSourceReconciliation
 			clusterObj.ClusterState = models.ClusterStateExists
 
-			if err := r.db.InsertManagedObject(clusterObj); err != nil {
+			if err := r.insertMissed(ctx, clusterObj); err != nil {
 				r.logger.Error("failed to insert missed object",
 					zap.String("resource_uid", uid),
 					zap.Error(err),
@@ -169,6 +203,7 @@ func (r *Reconciler) reconcileResource(ctx context.Context, res config.ResourceC
 
 			missedCreations++
 			r.metrics.ReconciliationDriftDetected.WithLabelValues(resourceType, "missed_creation").Inc()
+			r.metrics.RecordMissedEvent(resourceType, "missed_creation")
 			r.metrics.ReconciliationObjectsProcessed.WithLabelValues(resourceType, "insert").Inc()
 		}
 	}
@@ -185,7 +220,14 @@ func (r *Reconciler) reconcileResource(ctx context.Context, res config.ResourceC
 				zap.String("namespace", dbObj.ResourceNamespace),
 			)
 
-			if err := r.db.UpdateClusterState(uid, models.ClusterStateDeleted, &now); err != nil {
+			if err := r.markMissedDeletion(ctx, dbObj, now); errors.Is(err, models.ErrInvalidTransition) {
+				// The watcher recorded the deletion since the objects
+				// were listed.
+				r.logger.Debug("deletion already recorded",
+					zap.String("resource_uid", uid),
+				)
+				continue
+			} else if err != nil {
 				r.logger.Error("failed to mark missed deletion",
 					zap.String("resource_uid", uid),
 					zap.Error(err),
@@ -195,6 +237,7 @@ func (r *Reconciler) reconcileResource(ctx context.Context, res config.ResourceC
 
 			missedDeletions++
 			r.metrics.ReconciliationDriftDetected.WithLabelValues(resourceType, "missed_deletion").Inc()
+			r.metrics.RecordMissedEvent(resourceType, "missed_deletion")
 			r.metrics.ReconciliationObjectsProcessed.WithLabelValues(resourceType, "delete").Inc()
 		}
 	}
@@ -203,7 +246,7 @@ func (r *Reconciler) reconcileResource(ctx context.Context, res config.ResourceC
 	reconciledAt := time.Now()
 	for uid, dbObj := range dbUIDMap {
 		if _, exists := clusterUIDs[uid]; exists {
-			if err := r.db.UpdateLastReconciled(dbObj.ID, reconciledAt); err != nil {
+			if err := db.UpdateLastReconciled(dbObj.ID, reconciledAt); err != nil {
 				r.logger.Error("failed to update last_reconciled",
 					zap.String("resource_uid", uid),
 					zap.Error(err),
@@ -224,6 +267,49 @@ func (r *Reconciler) reconcileResource(ctx context.Context, res config.ResourceC
 	return nil
 }
 
+// insertMissed records a creation found by reconciliation, within a span
+// whose trace context is stored with the object so that the created event's
+// delivery continues the trace.
+func (r *Reconciler) insertMissed(ctx context.Context, obj *models.ManagedObject) (err error) {
+	ctx, span := r.tracer.Start(ctx, "reconciler.missedCreation", trace.WithAttributes(resourceAttributes(obj)...))
+	defer func() { tracing.End(span, err) }()
+
+	obj.CreatedTraceParent = tracing.TraceParent(ctx)
+	return database.WithContext(ctx, r.db).InsertManagedObject(obj)
+}
+
+// markMissedDeletion marks obj as deleted at deletedAt, within a span whose
+// trace context is stored with the object so that the deleted event's
+// delivery continues the trace. Both are written in one transaction. An
+// object whose deletion the watcher has recorded since it was listed is left
+// unchanged and an error wrapping models.ErrInvalidTransition returned.
+func (r *Reconciler) markMissedDeletion(ctx context.Context, obj *models.ManagedObject, deletedAt time.Time) (err error) {
+	ctx, span := r.tracer.Start(ctx, "reconciler.missedDeletion", trace.WithAttributes(resourceAttributes(obj)...))
+	defer func() { tracing.End(span, err) }()
+
+	return database.WithContext(ctx, r.db).WithTx(func(tx database.Database) error {
+		if traceParent := tracing.TraceParent(ctx); traceParent != "" {
+			if err := tx.SetDeletedTraceParent(obj.ResourceUID, traceParent); err != nil {
+				r.logger.Warn("failed to record trace context of deletion",
+					zap.String("resource_uid", obj.ResourceUID),
+					zap.Error(err),
+				)
+			}
+		}
+		return tx.UpdateClusterState(obj.ResourceUID, models.ClusterStateDeleted, &deletedAt)
+	})
+}
+
+// resourceAttributes returns the span attributes identifying the resource of
+// obj.
+func resourceAttributes(obj *models.ManagedObject) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("beacon.resource.uid", obj.ResourceUID),
+		attribute.String("beacon.resource.name", obj.ResourceName),
+		attribute.String("k8s.namespace.name", obj.ResourceNamespace),
+	}
+}
+
 // listClusterObjects queries the Kubernetes API for annotated objects of the
 // given resource type. It returns a set of UIDs and a map of UID to
 // ManagedObject for objects that carry the configured annotation.
@@ -257,13 +343,20 @@ func (r *Reconciler) listPods(ctx context.Context, res config.ResourceConfig) (m
 				continue
 			}
 
-			labelsJSON, _ := json.Marshal(r.filterLabels(pod.Labels))
+			labelsJSON, _ := json.Marshal(r.filter.Labels(pod.Labels))
 			var annotationsJSON []byte
-			if extracted := r.extractConfiguredAnnotations(pod.Annotations); extracted != nil {
+			if extracted := r.filter.Annotations(pod.Annotations); extracted != nil {
 				annotationsJSON, _ = json.Marshal(extracted)
 			}
 
 			uid := string(pod.UID)
+			var fieldsJSON string
+			if r.fields.Enabled() {
+				if u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(pod); err == nil {
+					fieldsJSON = r.extractFields(u, uid)
+				}
+			}
+
 			uidSet[uid] = struct{}{}
 			objMap[uid] = &models.ManagedObject{
 				ID:                uuid.New().String(),
@@ -275,6 +368,7 @@ func (r *Reconciler) listPods(ctx context.Context, res config.ResourceConfig) (m
 				ResourceVersion:   pod.ResourceVersion,
 				Labels:            string(labelsJSON),
 				Annotations:       string(annotationsJSON),
+				Fields:            fieldsJSON,
 				CreatedAt:         time.Now(),
 			}
 		}
@@ -312,13 +406,18 @@ func (r *Reconciler) listDynamic(ctx context.Context, res config.ResourceConfig)
 				continue
 			}
 
-			labelsJSON, _ := json.Marshal(r.filterLabels(item.GetLabels()))
+			labelsJSON, _ := json.Marshal(r.filter.Labels(item.GetLabels()))
 			var annotationsJSON []byte
-			if extracted := r.extractConfiguredAnnotations(annotations); extracted != nil {
+			if extracted := r.filter.Annotations(annotations); extracted != nil {
 				annotationsJSON, _ = json.Marshal(extracted)
 			}
 
 			uid := string(item.GetUID())
+			var fieldsJSON string
+			if r.fields.Enabled() {
+				fieldsJSON = r.extractFields(item.Object, uid)
+			}
+
 			uidSet[uid] = struct{}{}
 			objMap[uid] = &models.ManagedObject{
 				ID:                uuid.New().String(),
@@ -330,6 +429,7 @@ func (r *Reconciler) listDynamic(ctx context.Context, res config.ResourceConfig)
 				ResourceVersion:   item.GetResourceVersion(),
 				Labels:            string(labelsJSON),
 				Annotations:       string(annotationsJSON),
+				Fields:            fieldsJSON,
 				CreatedAt:         time.Now(),
 			}
 		}
@@ -338,39 +438,17 @@ func (r *Reconciler) listDynamic(ctx context.Context, res config.ResourceConfig)
 	return uidSet, objMap, nil
 }
 
-// filterLabels returns a filtered copy of allLabels containing only the keys
-// listed in cfg.Payload.Labels. If no label filter is configured, all labels
-// are returned unchanged.
-func (r *Reconciler) filterLabels(allLabels map[string]string) map[string]string {
-	if len(r.cfg.Payload.Labels) == 0 {
-		return allLabels
-	}
-	filtered := make(map[string]string, len(r.cfg.Payload.Labels))
-	for _, key := range r.cfg.Payload.Labels {
-		if val, ok := allLabels[key]; ok {
-			filtered[key] = val
-		}
-	}
-	return filtered
-}
-
-// extractConfiguredAnnotations returns a map containing only the annotation
-// keys listed in cfg.Payload.Annotations. If no annotation keys are configured,
-// nil is returned.
-func (r *Reconciler) extractConfiguredAnnotations(allAnnotations map[string]string) map[string]string {
-	if len(r.cfg.Payload.Annotations) == 0 {
-		return nil
-	}
-	extracted := make(map[string]string, len(r.cfg.Payload.Annotations))
-	for _, key := range r.cfg.Payload.Annotations {
-		if val, ok := allAnnotations[key]; ok {
-			extracted[key] = val
-		}
-	}
-	if len(extracted) == 0 {
-		return nil
+// extractFields evaluates the configured payload fields against the
+// unstructured object and returns them as JSON.
+func (r *Reconciler) extractFields(obj map[string]interface{}, uid string) string {
+	fieldsJSON, err := r.fields.ExtractJSON(r.filter.Object(obj))
+	if err != nil {
+		r.logger.Warn("failed to extract payload fields",
+			zap.String("resource_uid", uid),
+			zap.Error(err),
+		)
 	}
-	return extracted
+	return fieldsJSON
 }
 
 // getAnnotation checks whether the given annotations map contains the
@@ -2,10 +2,12 @@ package reconciler
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -125,6 +127,8 @@ func TestReconcile_MissedCreation(t *testing.T) {
 
 	require.NoError(t, err)
 	mockDB.AssertExpectations(t)
+	assert.Equal(t, float64(1), testutil.ToFloat64(r.metrics.EventsMissedTotal.WithLabelValues("Pod", "missed_creation")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(r.metrics.ComponentUp.WithLabelValues("reconciler")))
 }
 
 func TestReconcile_MissedDeletion(t *testing.T) {
@@ -158,6 +162,29 @@ func TestReconcile_MissedDeletion(t *testing.T) {
 	mockDB.AssertExpectations(t)
 }
 
+func TestReconcile_DeletionAlreadyRecorded(t *testing.T) {
+	// The watcher records the deletion after the objects are listed.
+	mockDB := new(database.MockDatabase)
+	r := newTestReconciler(mockDB)
+
+	dbObj := &models.ManagedObject{
+		ID:           "db-id-gone",
+		ResourceUID:  "uid-gone",
+		ResourceType: "Pod",
+		ClusterState: models.ClusterStateExists,
+	}
+
+	mockDB.On("GetAllActiveObjects", "Pod").Return([]*models.ManagedObject{dbObj}, nil).Once()
+	mockDB.On("UpdateClusterState", "uid-gone", models.ClusterStateDeleted, mock.Anything).
+		Return(fmt.Errorf("update cluster state: %w", models.ErrInvalidTransition)).Once()
+
+	err := r.Reconcile(context.Background())
+
+	require.NoError(t, err)
+	mockDB.AssertExpectations(t)
+	assert.Equal(t, float64(0), testutil.ToFloat64(r.metrics.EventsMissedTotal.WithLabelValues("Pod", "missed_deletion")))
+}
+
 func TestReconcile_ContextCancellation(t *testing.T) {
 	// Verify that Start stops when the context is cancelled.
 	mockDB := new(database.MockDatabase)
@@ -0,0 +1,74 @@
+// Package schema embeds the JSON Schema describing the data payload of the
+// CloudEvents beacon sends, publishes it over HTTP, and validates payloads
+// against it.
+package schema
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+//go:embed data.json
+var dataSchema []byte
+
+// dataSchemaURL is the resource name the schema is registered under in the
+// compiler; it only needs to be unique within the compiler.
+const dataSchemaURL = "beacon://schemas/data.json"
+
+// DataSchema returns the raw JSON Schema document for the CloudEvent data
+// payload.
+func DataSchema() []byte {
+	out := make([]byte, len(dataSchema))
+	copy(out, dataSchema)
+	return out
+}
+
+// Handler serves the data schema document.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/schema+json")
+		_, _ = w.Write(dataSchema)
+	})
+}
+
+// Validator checks CloudEvent data payloads against the embedded schema.
+type Validator struct {
+	schema *jsonschema.Schema
+}
+
+// NewValidator compiles the embedded schema.
+func NewValidator() (*Validator, error) {
+	c := jsonschema.NewCompiler()
+	if err := c.AddResource(dataSchemaURL, bytes.NewReader(dataSchema)); err != nil {
+		return nil, fmt.Errorf("loading data schema: %w", err)
+	}
+	s, err := c.Compile(dataSchemaURL)
+	if err != nil {
+		return nil, fmt.Errorf("compiling data schema: %w", err)
+	}
+	return &Validator{schema: s}, nil
+}
+
+// Validate marshals data to JSON and validates the result, so any value that
+// encodes to the payload shape (e.g. models.CloudEventData) can be checked.
+func (v *Validator) Validate(data interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("marshalling data: %w", err)
+	}
+	var doc interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return fmt.Errorf("decoding data: %w", err)
+	}
+	if err := v.schema.Validate(doc); err != nil {
+		return fmt.Errorf("data does not match schema: %w", err)
+	}
+	return nil
+}
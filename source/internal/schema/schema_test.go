@@ -0,0 +1,68 @@
+package schema
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bryonbaker/beacon/internal/models"
+)
+
+func validData() models.CloudEventData {
+	return models.CloudEventData{
+		Resource: models.NotificationResource{
+			UID:             "uid-1",
+			Type:            "Pod",
+			Name:            "web",
+			Namespace:       "default",
+			AnnotationValue: "true",
+		},
+		Metadata: models.NotificationMetadata{
+			Labels:          map[string]string{"app": "web"},
+			ResourceVersion: "42",
+		},
+		Fields: map[string]interface{}{"replicas": json.Number("3")},
+	}
+}
+
+func TestValidate_Valid(t *testing.T) {
+	v, err := NewValidator()
+	require.NoError(t, err)
+	assert.NoError(t, v.Validate(validData()))
+}
+
+func TestValidate_MissingUID(t *testing.T) {
+	v, err := NewValidator()
+	require.NoError(t, err)
+
+	data := validData()
+	data.Resource.UID = ""
+	err = v.Validate(data)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "does not match schema")
+}
+
+func TestValidate_UnexpectedProperty(t *testing.T) {
+	v, err := NewValidator()
+	require.NoError(t, err)
+
+	err = v.Validate(map[string]interface{}{
+		"resource": map[string]interface{}{"uid": "u", "type": "Pod", "name": "n", "namespace": "", "annotationValue": ""},
+		"metadata": map[string]interface{}{},
+		"extra":    true,
+	})
+	assert.Error(t, err)
+}
+
+func TestHandler_ServesSchema(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/schemas/data.json", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/schema+json", rec.Header().Get("Content-Type"))
+	assert.JSONEq(t, string(DataSchema()), rec.Body.String())
+}
@@ -1,7 +1,9 @@
 // Package storage implements the volume and database size monitoring loop.
 // It periodically checks filesystem usage, inode consumption, and database
 // file size, updating Prometheus metrics and logging warnings when
-// configurable thresholds are exceeded.
+// configurable thresholds are exceeded. Under storage pressure it frees space
+// by cleaning up records early and, when usage is critical, by compacting
+// delivered records and truncating the write-ahead log.
 package storage
 
 import (
@@ -17,6 +19,19 @@ import (
 	"github.com/bryonbaker/beacon/internal/metrics"
 )
 
+// Storage pressure levels, as reported by the event_storage_pressure gauge.
+const (
+	PressureNone     = "none"
+	PressureWarning  = "warning"
+	PressureCritical = "critical"
+)
+
+// Cleaner removes records older than a retention period. It is implemented
+// by *cleaner.Cleaner.
+type Cleaner interface {
+	CleanupOlderThan(ctx context.Context, retention time.Duration) error
+}
+
 // Monitor periodically inspects the storage volume and database to report
 // usage metrics and detect storage pressure.
 type Monitor struct {
@@ -24,6 +39,7 @@ type Monitor struct {
 	cfg     *config.Config
 	metrics *metrics.Metrics
 	logger  *zap.Logger
+	cleaner Cleaner
 }
 
 // NewMonitor creates a new Monitor with the provided dependencies.
@@ -36,6 +52,12 @@ func NewMonitor(db database.Database, cfg *config.Config, m *metrics.Metrics, lo
 	}
 }
 
+// SetCleaner sets the cleaner run early under storage pressure. Without one,
+// no records are cleaned up early.
+func (m *Monitor) SetCleaner(c Cleaner) {
+	m.cleaner = c
+}
+
 // Start begins the storage monitoring loop, running at the configured
 // monitor interval. The loop stops when ctx is cancelled.
 func (m *Monitor) Start(ctx context.Context) {
@@ -65,7 +87,10 @@ func (m *Monitor) Start(ctx context.Context) {
 // Check performs a single storage check. It gathers filesystem statistics
 // using syscall.Statfs, queries the database size, calculates usage
 // percentages, updates all storage-related Prometheus metrics, and logs
-// warnings when warning or critical thresholds are exceeded.
+// warnings when warning or critical thresholds are exceeded. If responses to
+// storage pressure are enabled, it then acts to relieve the pressure and,
+// while usage is critical, reports the storage component as degraded so that
+// readiness fails.
 func (m *Monitor) Check(ctx context.Context) error {
 	// Check for context cancellation before proceeding.
 	select {
@@ -77,6 +102,7 @@ func (m *Monitor) Check(ctx context.Context) error {
 	// Gather filesystem statistics.
 	var stat syscall.Statfs_t
 	if err := syscall.Statfs(m.cfg.Storage.VolumePath, &stat); err != nil {
+		m.metrics.RecordComponentHealth("storage", false)
 		return fmt.Errorf("statfs on %s: %w", m.cfg.Storage.VolumePath, err)
 	}
 
@@ -113,8 +139,26 @@ func (m *Monitor) Check(ctx context.Context) error {
 		m.metrics.DBSizeBytes.Set(float64(dbSizeBytes))
 	}
 
-	// Evaluate storage pressure thresholds.
-	m.evaluatePressure(usagePercent)
+	// Get database row counts.
+	exists, deleted, err := m.db.CountByState()
+	if err != nil {
+		m.logger.Error("failed to count database rows", zap.Error(err))
+	} else {
+		m.metrics.RecordDBRows(exists, deleted)
+	}
+
+	// Evaluate storage pressure thresholds and respond to them.
+	level := m.evaluatePressure(usagePercent)
+	if m.cfg.Storage.Pressure.Enabled {
+		m.relievePressure(ctx, level)
+	}
+	if level == PressureCritical && m.cfg.Storage.Pressure.Enabled {
+		m.metrics.RecordComponentDegraded("storage", fmt.Sprintf(
+			"volume usage %.1f%% is above the critical threshold of %d%%",
+			usagePercent, m.cfg.Storage.CriticalThreshold))
+	} else {
+		m.metrics.RecordComponentHealth("storage", true)
+	}
 
 	m.logger.Debug("storage check completed",
 		zap.Float64("usage_percent", usagePercent),
@@ -130,30 +174,84 @@ func (m *Monitor) Check(ctx context.Context) error {
 }
 
 // evaluatePressure sets the storage pressure gauges and logs warnings based
-// on the current usage percentage and the configured thresholds.
-func (m *Monitor) evaluatePressure(usagePercent float64) {
+// on the current usage percentage and the configured thresholds, and returns
+// the pressure level.
+func (m *Monitor) evaluatePressure(usagePercent float64) string {
 	warningThreshold := float64(m.cfg.Storage.WarningThreshold)
 	criticalThreshold := float64(m.cfg.Storage.CriticalThreshold)
 
 	// Reset pressure gauges.
-	m.metrics.StoragePressure.WithLabelValues("none").Set(0)
-	m.metrics.StoragePressure.WithLabelValues("warning").Set(0)
-	m.metrics.StoragePressure.WithLabelValues("critical").Set(0)
+	m.metrics.StoragePressure.WithLabelValues(PressureNone).Set(0)
+	m.metrics.StoragePressure.WithLabelValues(PressureWarning).Set(0)
+	m.metrics.StoragePressure.WithLabelValues(PressureCritical).Set(0)
 
+	level := PressureNone
 	switch {
 	case usagePercent >= criticalThreshold:
-		m.metrics.StoragePressure.WithLabelValues("critical").Set(1)
+		level = PressureCritical
 		m.logger.Error("CRITICAL: storage usage exceeds critical threshold",
 			zap.Float64("usage_percent", usagePercent),
 			zap.Float64("critical_threshold", criticalThreshold),
 		)
 	case usagePercent >= warningThreshold:
-		m.metrics.StoragePressure.WithLabelValues("warning").Set(1)
+		level = PressureWarning
 		m.logger.Warn("storage usage exceeds warning threshold",
 			zap.Float64("usage_percent", usagePercent),
 			zap.Float64("warning_threshold", warningThreshold),
 		)
-	default:
-		m.metrics.StoragePressure.WithLabelValues("none").Set(1)
+	}
+	m.metrics.StoragePressure.WithLabelValues(level).Set(1)
+	return level
+}
+
+// relievePressure frees space according to the pressure level. At the
+// warning level it cleans up records older than the warning retention. At
+// the critical level it cleans up records older than the critical retention,
+// drops the optional data of delivered records, reclaims the freed pages and
+// truncates the write-ahead log. Each action works in small batches or single
+// statements, so that events keep being recorded meanwhile. A failed action
+// is logged and does not stop the others.
+func (m *Monitor) relievePressure(ctx context.Context, level string) {
+	if level == PressureNone {
+		return
+	}
+
+	retention := m.cfg.Storage.Pressure.WarningRetention.Duration
+	if level == PressureCritical {
+		retention = m.cfg.Storage.Pressure.CriticalRetention.Duration
+	}
+	if m.cleaner != nil {
+		m.logger.Info("cleaning up early to relieve storage pressure",
+			zap.String("level", level),
+			zap.Duration("retention", retention),
+		)
+		err := m.cleaner.CleanupOlderThan(ctx, retention)
+		m.metrics.RecordStoragePressureAction("cleanup", err)
+		if err != nil {
+			m.logger.Error("early cleanup failed", zap.Error(err))
+		}
+	}
+	if level != PressureCritical || ctx.Err() != nil {
+		return
+	}
+
+	compacted, err := m.db.CompactDeliveredRecords()
+	m.metrics.RecordStoragePressureAction("compact", err)
+	if err != nil {
+		m.logger.Error("failed to compact delivered records", zap.Int64("compacted", compacted), zap.Error(err))
+	} else {
+		m.logger.Info("compacted delivered records", zap.Int64("compacted", compacted))
+	}
+
+	err = m.db.RunIncrementalVacuum()
+	m.metrics.RecordStoragePressureAction("vacuum", err)
+	if err != nil {
+		m.logger.Error("incremental vacuum failed", zap.Error(err))
+	}
+
+	err = m.db.CheckpointWAL()
+	m.metrics.RecordStoragePressureAction("wal_checkpoint", err)
+	if err != nil {
+		m.logger.Error("failed to checkpoint the write-ahead log", zap.Error(err))
 	}
 }
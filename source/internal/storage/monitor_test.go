@@ -2,10 +2,12 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -49,6 +51,7 @@ func TestCheck_DBSizeMetricUpdated(t *testing.T) {
 	mon, m := newTestMonitor(mockDB)
 
 	mockDB.On("GetDatabaseSizeBytes").Return(int64(1048576), nil).Once()
+	mockDB.On("CountByState").Return(7, 3, nil).Once()
 
 	err := mon.Check(context.Background())
 
@@ -58,6 +61,12 @@ func TestCheck_DBSizeMetricUpdated(t *testing.T) {
 	// Verify the DB size metric was set.
 	dbSize := getGaugeValue(m.DBSizeBytes)
 	assert.Equal(t, float64(1048576), dbSize, "DBSizeBytes metric should be set to 1 MiB")
+
+	// Verify the row counts and component health were recorded.
+	assert.Equal(t, float64(7), getGaugeValue(m.DBRowsTotal.WithLabelValues("managed_objects", "exists")))
+	assert.Equal(t, float64(3), getGaugeValue(m.DBRowsTotal.WithLabelValues("managed_objects", "deleted")))
+	assert.Equal(t, float64(1), getGaugeValue(m.ComponentUp.WithLabelValues("storage")))
+	assert.Greater(t, getGaugeValue(m.ComponentLastSuccess.WithLabelValues("storage")), float64(0))
 }
 
 func TestCheck_VolumeMetricsUpdated(t *testing.T) {
@@ -65,6 +74,7 @@ func TestCheck_VolumeMetricsUpdated(t *testing.T) {
 	mon, m := newTestMonitor(mockDB)
 
 	mockDB.On("GetDatabaseSizeBytes").Return(int64(512000), nil).Once()
+	mockDB.On("CountByState").Return(0, 0, nil).Once()
 
 	err := mon.Check(context.Background())
 
@@ -92,6 +102,105 @@ func TestCheck_VolumeMetricsUpdated(t *testing.T) {
 	}
 }
 
+// fakeCleaner records the retention of each early cleanup.
+type fakeCleaner struct {
+	retentions []time.Duration
+}
+
+func (f *fakeCleaner) CleanupOlderThan(_ context.Context, retention time.Duration) error {
+	f.retentions = append(f.retentions, retention)
+	return nil
+}
+
+// newPressureMonitor returns a Monitor with responses to storage pressure
+// enabled and thresholds that put the test volume at the given level.
+func newPressureMonitor(mockDB *database.MockDatabase, level string) (*Monitor, *metrics.Metrics, *metrics.HealthChecks, *fakeCleaner) {
+	mon, m := newTestMonitor(mockDB)
+	mon.cfg.Storage.Pressure.Enabled = true
+	mon.cfg.Storage.Pressure.WarningRetention.Duration = 12 * time.Hour
+	mon.cfg.Storage.Pressure.CriticalRetention.Duration = time.Hour
+	switch level {
+	case PressureWarning:
+		mon.cfg.Storage.WarningThreshold = 1
+		mon.cfg.Storage.CriticalThreshold = 101
+	case PressureCritical:
+		mon.cfg.Storage.WarningThreshold = 1
+		mon.cfg.Storage.CriticalThreshold = 1
+	default:
+		mon.cfg.Storage.WarningThreshold = 101
+		mon.cfg.Storage.CriticalThreshold = 101
+	}
+
+	hc := metrics.NewHealthChecks()
+	m.SetHealthChecks(hc)
+	c := &fakeCleaner{}
+	mon.SetCleaner(c)
+
+	mockDB.On("GetDatabaseSizeBytes").Return(int64(512000), nil).Once()
+	mockDB.On("CountByState").Return(0, 0, nil).Once()
+	return mon, m, hc, c
+}
+
+func TestCheck_NoPressure_NoAction(t *testing.T) {
+	mockDB := new(database.MockDatabase)
+	mon, m, hc, c := newPressureMonitor(mockDB, PressureNone)
+
+	require.NoError(t, mon.Check(context.Background()))
+
+	mockDB.AssertExpectations(t)
+	assert.Empty(t, c.retentions)
+	assert.Equal(t, float64(1), getGaugeValue(m.StoragePressure.WithLabelValues(PressureNone)))
+	assert.Equal(t, "ok", hc.All()["storage"])
+}
+
+func TestCheck_WarningPressure_CleansUpEarly(t *testing.T) {
+	mockDB := new(database.MockDatabase)
+	mon, m, hc, c := newPressureMonitor(mockDB, PressureWarning)
+
+	require.NoError(t, mon.Check(context.Background()))
+
+	mockDB.AssertExpectations(t)
+	mockDB.AssertNotCalled(t, "CompactDeliveredRecords")
+	mockDB.AssertNotCalled(t, "CheckpointWAL")
+	assert.Equal(t, []time.Duration{12 * time.Hour}, c.retentions)
+	assert.Equal(t, float64(1), getGaugeValue(m.StoragePressure.WithLabelValues(PressureWarning)))
+	assert.Equal(t, "ok", hc.All()["storage"], "readiness is kept at the warning level")
+}
+
+func TestCheck_CriticalPressure_CompactsAndDegradesReadiness(t *testing.T) {
+	mockDB := new(database.MockDatabase)
+	mon, m, hc, c := newPressureMonitor(mockDB, PressureCritical)
+	mockDB.On("CompactDeliveredRecords").Return(int64(42), nil).Once()
+	mockDB.On("RunIncrementalVacuum").Return(nil).Once()
+	mockDB.On("CheckpointWAL").Return(errors.New("database is locked")).Once()
+
+	require.NoError(t, mon.Check(context.Background()))
+
+	mockDB.AssertExpectations(t)
+	assert.Equal(t, []time.Duration{time.Hour}, c.retentions)
+	assert.Equal(t, float64(1), getGaugeValue(m.StoragePressure.WithLabelValues(PressureCritical)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.StoragePressureActions.WithLabelValues("compact", "success")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.StoragePressureActions.WithLabelValues("wal_checkpoint", "error")))
+
+	status := hc.All()["storage"]
+	assert.Contains(t, status, "degraded: volume usage")
+	assert.Contains(t, status, "above the critical threshold of 1%")
+	assert.False(t, hc.AllOK())
+	assert.Equal(t, float64(0), getGaugeValue(m.ComponentUp.WithLabelValues("storage")))
+}
+
+func TestCheck_CriticalPressure_Disabled(t *testing.T) {
+	mockDB := new(database.MockDatabase)
+	mon, _, hc, c := newPressureMonitor(mockDB, PressureCritical)
+	mon.cfg.Storage.Pressure.Enabled = false
+
+	require.NoError(t, mon.Check(context.Background()))
+
+	mockDB.AssertExpectations(t)
+	assert.Empty(t, c.retentions)
+	assert.Equal(t, "ok", hc.All()["storage"])
+}
+
 func TestNewMonitor_ReturnsNonNil(t *testing.T) {
 	mockDB := new(database.MockDatabase)
 	mon, _ := newTestMonitor(mockDB)
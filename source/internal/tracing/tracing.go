@@ -0,0 +1,124 @@
+// Package tracing sets up OpenTelemetry tracing for the beacon service and
+// carries trace context between components, and across restarts, in the W3C
+// traceparent format.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/bryonbaker/beacon/internal/config"
+)
+
+// TraceParentKey is the name of the W3C trace context header and of the
+// CloudEvents distributed tracing extension attribute.
+const TraceParentKey = "traceparent"
+
+// instrumentationPrefix is prepended to component names to form the
+// instrumentation scope of their tracers.
+const instrumentationPrefix = "github.com/bryonbaker/beacon/internal/"
+
+// propagator encodes and decodes W3C trace context.
+var propagator = propagation.TraceContext{}
+
+// Tracer returns the tracer for a beacon component, e.g. "watcher". Its spans
+// are recorded by the provider installed by Setup; until then, and when
+// tracing is disabled, they are no-ops.
+func Tracer(component string) trace.Tracer {
+	return otel.Tracer(instrumentationPrefix + component)
+}
+
+// Setup installs the global tracer provider, exporting spans with OTLP over
+// HTTP, when tracing is enabled. The returned function flushes and stops the
+// exporter; it must be called on shutdown.
+func Setup(ctx context.Context, cfg *config.Config, logger *zap.Logger) (func(context.Context) error, error) {
+	if !cfg.Tracing.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var opts []otlptracehttp.Option
+	if cfg.Tracing.Endpoint != "" {
+		opts = append(opts, otlptracehttp.WithEndpointURL(cfg.Tracing.Endpoint))
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating OTLP trace exporter: %w", err)
+	}
+
+	provider := NewProvider(exporter, cfg)
+	otel.SetTracerProvider(provider)
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		logger.Warn("failed to export trace spans", zap.Error(err))
+	}))
+	return provider.Shutdown, nil
+}
+
+// NewProvider creates a tracer provider that batches spans to exporter and
+// samples new traces at the configured ratio. Spans with a parent follow
+// their parent's sampling decision, so a delivery is recorded whenever its
+// detection was.
+func NewProvider(exporter sdktrace.SpanExporter, cfg *config.Config) *sdktrace.TracerProvider {
+	res := resource.NewSchemaless(
+		semconv.ServiceName(cfg.Tracing.ServiceName),
+		semconv.ServiceVersion(cfg.App.Version),
+	)
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.Tracing.SampleRatio))),
+	)
+}
+
+// TraceParent returns the traceparent of the span in ctx, or "" when ctx
+// carries no valid span context.
+func TraceParent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	return carrier.Get(TraceParentKey)
+}
+
+// ContextWithTraceParent returns ctx with the remote span context encoded in
+// traceParent, so that spans started from it continue that trace. ctx is
+// returned unchanged when traceParent is empty or malformed.
+func ContextWithTraceParent(ctx context.Context, traceParent string) context.Context {
+	if traceParent == "" {
+		return ctx
+	}
+	return propagator.Extract(ctx, propagation.MapCarrier{TraceParentKey: traceParent})
+}
+
+// SpanContext returns the span context encoded in traceParent, which is
+// invalid when traceParent is empty or malformed.
+func SpanContext(traceParent string) trace.SpanContext {
+	return trace.SpanContextFromContext(ContextWithTraceParent(context.Background(), traceParent))
+}
+
+// Inject sets the traceparent header of the span in ctx on h.
+func Inject(ctx context.Context, h http.Header) {
+	propagator.Inject(ctx, propagation.HeaderCarrier(h))
+}
+
+// Fail records err on span and marks the span as failed.
+func Fail(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// End records err, if any, on span and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		Fail(span, err)
+	}
+	span.End()
+}
@@ -0,0 +1,88 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/bryonbaker/beacon/internal/config"
+)
+
+const testTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestTraceParentRoundTrip(t *testing.T) {
+	ctx := ContextWithTraceParent(context.Background(), testTraceParent)
+	assert.Equal(t, testTraceParent, TraceParent(ctx))
+
+	sc := SpanContext(testTraceParent)
+	require.True(t, sc.IsValid())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID().String())
+	assert.True(t, sc.IsRemote())
+
+	h := make(http.Header)
+	Inject(ctx, h)
+	assert.Equal(t, testTraceParent, h.Get(TraceParentKey))
+}
+
+func TestTraceParentMissingOrMalformed(t *testing.T) {
+	assert.Empty(t, TraceParent(context.Background()))
+	assert.False(t, SpanContext("").IsValid())
+	assert.False(t, SpanContext("not-a-traceparent").IsValid())
+	assert.Empty(t, TraceParent(ContextWithTraceParent(context.Background(), "00-zz")))
+}
+
+func TestSetupDisabled(t *testing.T) {
+	shutdown, err := Setup(context.Background(), &config.Config{}, zap.NewNop())
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+}
+
+func TestSetupExportsSpans(t *testing.T) {
+	received := make(chan *collectortrace.ExportTraceServiceRequest, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		req := &collectortrace.ExportTraceServiceRequest{}
+		require.NoError(t, proto.Unmarshal(body, req))
+		received <- req
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer collector.Close()
+
+	cfg := &config.Config{Tracing: config.TracingConfig{
+		Enabled:     true,
+		Endpoint:    collector.URL + "/v1/traces",
+		ServiceName: "beacon-test",
+		SampleRatio: 1,
+	}}
+	shutdown, err := Setup(context.Background(), cfg, zap.NewNop())
+	require.NoError(t, err)
+
+	_, span := Tracer("test").Start(context.Background(), "test.span")
+	span.End()
+	require.NoError(t, shutdown(context.Background()))
+
+	req := <-received
+	require.Len(t, req.ResourceSpans, 1)
+	rs := req.ResourceSpans[0]
+	var service string
+	for _, attr := range rs.Resource.Attributes {
+		if attr.Key == "service.name" {
+			service = attr.Value.GetStringValue()
+		}
+	}
+	assert.Equal(t, "beacon-test", service)
+	require.Len(t, rs.ScopeSpans, 1)
+	assert.Equal(t, instrumentationPrefix+"test", rs.ScopeSpans[0].Scope.Name)
+	require.Len(t, rs.ScopeSpans[0].Spans, 1)
+	assert.Equal(t, "test.span", rs.ScopeSpans[0].Spans[0].Name)
+}
@@ -0,0 +1,151 @@
+package watcher
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/cache"
+)
+
+// connectionCheckInterval is how often the state of the watch connections is
+// re-evaluated.
+const connectionCheckInterval = 5 * time.Second
+
+// syncState is the part of an informer used to tell whether its watch is
+// connected.
+type syncState interface {
+	HasSynced() bool
+	LastSyncResourceVersion() string
+}
+
+// connection tracks whether the watch of one informer is connected. A watch
+// is connected once the informer has synced, and again after a failure once
+// the informer has listed or watched past the resource version it had
+// reached when the watch failed.
+type connection struct {
+	informer     syncState
+	resourceType string
+
+	mu       sync.Mutex
+	failed   bool
+	failedAt string
+}
+
+// fail records that the watch failed.
+func (c *connection) fail() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failed = true
+	c.failedAt = c.informer.LastSyncResourceVersion()
+}
+
+// connected reports whether the watch is connected.
+func (c *connection) connected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.informer.HasSynced() {
+		return false
+	}
+	if c.failed {
+		if c.informer.LastSyncResourceVersion() == c.failedAt {
+			return false
+		}
+		c.failed = false
+	}
+	return true
+}
+
+// track registers informer's watch for connection tracking. It must be
+// called before the informer is started.
+func (w *Watcher) track(informer cache.SharedIndexInformer, resourceType string) {
+	conn := &connection{informer: informer, resourceType: resourceType}
+	if err := informer.SetWatchErrorHandler(func(r *cache.Reflector, err error) {
+		cache.DefaultWatchErrorHandler(r, err)
+		w.watchFailed(conn, err)
+	}); err != nil {
+		w.logger.Warn("failed to set watch error handler, connection status will not be tracked",
+			zap.String("resource_type", resourceType),
+			zap.Error(err),
+		)
+	}
+
+	w.connMu.Lock()
+	defer w.connMu.Unlock()
+	w.connections = append(w.connections, conn)
+}
+
+// watchFailed records a failed watch. Watches that the API server closed
+// normally are not failures; watches that expired are re-established from a
+// fresh list without the connection being lost.
+func (w *Watcher) watchFailed(conn *connection, err error) {
+	switch {
+	case err == io.EOF:
+		return
+	case apierrors.IsResourceExpired(err) || apierrors.IsGone(err):
+		w.metrics.RecordReconnect(conn.resourceType, "expired")
+		return
+	case err == io.ErrUnexpectedEOF:
+		w.metrics.RecordReconnect(conn.resourceType, "unexpected_eof")
+	default:
+		w.metrics.RecordReconnect(conn.resourceType, "error")
+	}
+	conn.fail()
+	w.metrics.RecordConnectionStatus(conn.resourceType, false)
+	w.metrics.RecordComponentHealth("watcher", false)
+}
+
+// monitorConnections waits for the informers to sync, then periodically
+// records the connection status of each resource type's watches until ctx is
+// cancelled. The watcher is not reported healthy before the informers have
+// synced.
+func (w *Watcher) monitorConnections(ctx context.Context) {
+	w.connMu.Lock()
+	synced := make([]cache.InformerSynced, 0, len(w.connections))
+	for _, conn := range w.connections {
+		synced = append(synced, conn.informer.HasSynced)
+	}
+	w.connMu.Unlock()
+
+	if !cache.WaitForCacheSync(ctx.Done(), synced...) {
+		return
+	}
+	w.logger.Info("informers synced", zap.Int("informers", len(synced)))
+	w.checkConnections()
+
+	ticker := time.NewTicker(connectionCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.checkConnections()
+		}
+	}
+}
+
+// checkConnections records whether the watches of each resource type are
+// connected, and the watcher as healthy when all of them are.
+func (w *Watcher) checkConnections() {
+	w.connMu.Lock()
+	connections := append([]*connection(nil), w.connections...)
+	w.connMu.Unlock()
+
+	byType := make(map[string]bool)
+	for _, conn := range connections {
+		up, seen := byType[conn.resourceType]
+		byType[conn.resourceType] = conn.connected() && (up || !seen)
+	}
+
+	all := true
+	for resourceType, up := range byType {
+		w.metrics.RecordConnectionStatus(resourceType, up)
+		all = all && up
+	}
+	w.metrics.RecordComponentHealth("watcher", all)
+}
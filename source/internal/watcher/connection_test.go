@@ -0,0 +1,106 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/bryonbaker/beacon/internal/database"
+	"github.com/bryonbaker/beacon/internal/metrics"
+)
+
+// fakeSyncState is a syncState whose progress the test controls.
+type fakeSyncState struct {
+	mu      sync.Mutex
+	synced  bool
+	version string
+}
+
+func (f *fakeSyncState) HasSynced() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.synced
+}
+
+func (f *fakeSyncState) LastSyncResourceVersion() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.version
+}
+
+func (f *fakeSyncState) set(synced bool, version string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.synced, f.version = synced, version
+}
+
+func TestCheckConnections_TracksWatchFailureAndRecovery(t *testing.T) {
+	w := newTestWatcher(new(database.MockDatabase))
+	informer := &fakeSyncState{}
+	conn := &connection{informer: informer, resourceType: "Pod"}
+	w.connections = append(w.connections, conn)
+	status := w.metrics.ConnectionStatus.WithLabelValues("Pod")
+	up := w.metrics.ComponentUp.WithLabelValues("watcher")
+
+	w.checkConnections()
+	assert.Equal(t, float64(0), testutil.ToFloat64(status), "not connected before the initial sync")
+
+	informer.set(true, "10")
+	w.checkConnections()
+	assert.Equal(t, float64(1), testutil.ToFloat64(status))
+	assert.Equal(t, float64(1), testutil.ToFloat64(up))
+
+	w.watchFailed(conn, errors.New("connection refused"))
+	assert.Equal(t, float64(0), testutil.ToFloat64(status))
+	assert.Equal(t, float64(0), testutil.ToFloat64(up))
+	assert.Equal(t, float64(1), testutil.ToFloat64(w.metrics.ReconnectsTotal.WithLabelValues("Pod", "error")))
+
+	w.checkConnections()
+	assert.Equal(t, float64(0), testutil.ToFloat64(status), "still down until the informer makes progress")
+
+	informer.set(true, "11")
+	w.checkConnections()
+	assert.Equal(t, float64(1), testutil.ToFloat64(status))
+	assert.Equal(t, float64(1), testutil.ToFloat64(up))
+}
+
+func TestWatchFailed_ClosedAndExpiredWatchesStayConnected(t *testing.T) {
+	w := newTestWatcher(new(database.MockDatabase))
+	informer := &fakeSyncState{synced: true, version: "10"}
+	conn := &connection{informer: informer, resourceType: "Pod"}
+
+	w.watchFailed(conn, io.EOF)
+	w.watchFailed(conn, apierrors.NewResourceExpired("too old resource version"))
+	w.watchFailed(conn, apierrors.NewGone("gone"))
+
+	assert.True(t, conn.connected())
+	assert.Equal(t, float64(2), testutil.ToFloat64(w.metrics.ReconnectsTotal.WithLabelValues("Pod", "expired")))
+	assert.Equal(t, 1, testutil.CollectAndCount(w.metrics.ReconnectsTotal))
+}
+
+func TestMonitorConnections_ReportsHealthyOnlyAfterSync(t *testing.T) {
+	w := newTestWatcher(new(database.MockDatabase))
+	health := metrics.NewHealthChecks()
+	w.metrics.SetHealthChecks(health)
+	informer := &fakeSyncState{}
+	w.connections = append(w.connections, &connection{informer: informer, resourceType: "Pod"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.monitorConnections(ctx)
+
+	time.Sleep(150 * time.Millisecond)
+	assert.NotContains(t, health.All(), "watcher", "no health is reported while the informers sync")
+
+	informer.set(true, "1")
+	assert.Eventually(t, func() bool {
+		return health.All()["watcher"] == "ok"
+	}, 2*time.Second, 10*time.Millisecond)
+}
@@ -5,12 +5,17 @@ package watcher
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -27,6 +32,8 @@ import (
 	"github.com/bryonbaker/beacon/internal/database"
 	"github.com/bryonbaker/beacon/internal/metrics"
 	"github.com/bryonbaker/beacon/internal/models"
+	"github.com/bryonbaker/beacon/internal/payload"
+	"github.com/bryonbaker/beacon/internal/tracing"
 )
 
 // Watcher monitors Kubernetes resources for annotation changes and persists
@@ -38,7 +45,13 @@ type Watcher struct {
 	cfg         *config.Config
 	metrics     *metrics.Metrics
 	logger      *zap.Logger
+	fields      *payload.FieldExtractor
+	filter      *payload.Filter
+	tracer      trace.Tracer
 	stopChs     []chan struct{}
+
+	connMu      sync.Mutex
+	connections []*connection
 }
 
 // NewWatcher creates a new Watcher with the provided dependencies.
@@ -50,6 +63,19 @@ func NewWatcher(
 	m *metrics.Metrics,
 	logger *zap.Logger,
 ) *Watcher {
+	fields, err := payload.NewFieldExtractor(cfg.Payload.Fields)
+	if err != nil {
+		// Expressions are validated when the config is loaded, so this only
+		// happens for hand-built configs; fall back to extracting nothing.
+		logger.Error("invalid payload fields, field extraction disabled", zap.Error(err))
+	}
+	filter, err := payload.NewFilter(&cfg.Payload)
+	if err != nil {
+		// Patterns are validated when the config is loaded; without a filter
+		// no labels or annotations are selected, so none leak unfiltered.
+		logger.Error("invalid payload filter, labels and annotations omitted", zap.Error(err))
+	}
+
 	return &Watcher{
 		db:          db,
 		typedClient: typedClient,
@@ -57,6 +83,9 @@ func NewWatcher(
 		cfg:         cfg,
 		metrics:     m,
 		logger:      logger,
+		fields:      fields,
+		filter:      filter,
+		tracer:      tracing.Tracer("watcher"),
 	}
 }
 
@@ -87,6 +116,7 @@ func (w *Watcher) Start(ctx context.Context) error {
 			zap.Strings("namespaces", res.Namespaces),
 		)
 	}
+	go w.monitorConnections(ctx)
 	return nil
 }
 
@@ -100,7 +130,7 @@ func (w *Watcher) Stop() {
 
 // startTypedPodInformer creates a typed informer for Pod resources using the
 // shared informer factory.
-func (w *Watcher) startTypedPodInformer(_ context.Context, res config.ResourceConfig, resourceType string, stopCh chan struct{}) error {
+func (w *Watcher) startTypedPodInformer(ctx context.Context, res config.ResourceConfig, resourceType string, stopCh chan struct{}) error {
 	if len(res.Namespaces) > 0 {
 		// Use the first namespace; for multiple namespaces, create one informer each.
 		for _, ns := range res.Namespaces {
@@ -113,18 +143,7 @@ func (w *Watcher) startTypedPodInformer(_ context.Context, res config.ResourceCo
 				informers.WithNamespace(ns),
 			)
 
-			informer := factory.Core().V1().Pods().Informer()
-			informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-				AddFunc: func(obj interface{}) {
-					w.handleAdd(obj, resourceType, models.DetectionSourceWatch)
-				},
-				UpdateFunc: func(oldObj, newObj interface{}) {
-					w.handleUpdate(oldObj, newObj, resourceType)
-				},
-				DeleteFunc: func(obj interface{}) {
-					w.handleDelete(obj, resourceType)
-				},
-			})
+			w.register(ctx, factory.Core().V1().Pods().Informer(), resourceType)
 
 			go factory.Start(nsStopCh)
 		}
@@ -133,25 +152,14 @@ func (w *Watcher) startTypedPodInformer(_ context.Context, res config.ResourceCo
 
 	// Watch all namespaces.
 	factory := informers.NewSharedInformerFactory(w.typedClient, 0)
-	informer := factory.Core().V1().Pods().Informer()
-	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: func(obj interface{}) {
-			w.handleAdd(obj, resourceType, models.DetectionSourceWatch)
-		},
-		UpdateFunc: func(oldObj, newObj interface{}) {
-			w.handleUpdate(oldObj, newObj, resourceType)
-		},
-		DeleteFunc: func(obj interface{}) {
-			w.handleDelete(obj, resourceType)
-		},
-	})
+	w.register(ctx, factory.Core().V1().Pods().Informer(), resourceType)
 
 	go factory.Start(stopCh)
 	return nil
 }
 
 // startDynamicInformer creates a dynamic informer for custom resources.
-func (w *Watcher) startDynamicInformer(_ context.Context, res config.ResourceConfig, resourceType string, stopCh chan struct{}) error {
+func (w *Watcher) startDynamicInformer(ctx context.Context, res config.ResourceConfig, resourceType string, stopCh chan struct{}) error {
 	gvr, err := parseGVR(res.APIVersion, res.Kind, res.Resource)
 	if err != nil {
 		return fmt.Errorf("parsing GVR for %s/%s: %w", res.APIVersion, res.Kind, err)
@@ -169,18 +177,7 @@ func (w *Watcher) startDynamicInformer(_ context.Context, res config.ResourceCon
 				nil,
 			)
 
-			informer := factory.ForResource(gvr).Informer()
-			informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-				AddFunc: func(obj interface{}) {
-					w.handleAdd(obj, resourceType, models.DetectionSourceWatch)
-				},
-				UpdateFunc: func(oldObj, newObj interface{}) {
-					w.handleUpdate(oldObj, newObj, resourceType)
-				},
-				DeleteFunc: func(obj interface{}) {
-					w.handleDelete(obj, resourceType)
-				},
-			})
+			w.register(ctx, factory.ForResource(gvr).Informer(), resourceType)
 
 			go factory.Start(nsStopCh)
 		}
@@ -189,52 +186,80 @@ func (w *Watcher) startDynamicInformer(_ context.Context, res config.ResourceCon
 
 	// Watch all namespaces.
 	factory := dynamicinformer.NewDynamicSharedInformerFactory(w.dynClient, 0)
-	informer := factory.ForResource(gvr).Informer()
+	w.register(ctx, factory.ForResource(gvr).Informer(), resourceType)
+
+	go factory.Start(stopCh)
+	return nil
+}
+
+// register adds the event handlers for resourceType to informer and tracks
+// its watch connection.
+func (w *Watcher) register(ctx context.Context, informer cache.SharedIndexInformer, resourceType string) {
 	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
-			w.handleAdd(obj, resourceType, models.DetectionSourceWatch)
+			w.handleAdd(ctx, obj, resourceType, models.DetectionSourceWatch)
 		},
 		UpdateFunc: func(oldObj, newObj interface{}) {
-			w.handleUpdate(oldObj, newObj, resourceType)
+			w.handleUpdate(ctx, oldObj, newObj, resourceType)
 		},
 		DeleteFunc: func(obj interface{}) {
-			w.handleDelete(obj, resourceType)
+			w.handleDelete(ctx, obj, resourceType)
 		},
 	})
-
-	go factory.Start(stopCh)
-	return nil
+	w.track(informer, resourceType)
 }
 
 // handleAdd processes a newly observed resource. If the resource carries the
-// configured annotation, it is inserted into the database.
-func (w *Watcher) handleAdd(obj interface{}, resourceType string, detectionSource string) {
+// configured annotation, it is inserted into the database along with the
+// trace context of the detection, so that the created event's delivery
+// continues the trace.
+func (w *Watcher) handleAdd(ctx context.Context, obj interface{}, resourceType string, detectionSource string) {
+	// Resources without the annotation are ignored before a span is started,
+	// so that only tracked resources are traced.
+	annotated, annotationValue := w.hasAnnotation(obj, w.cfg.Annotation.Key)
+	if !annotated {
+		return
+	}
+
+	ctx, span := w.tracer.Start(ctx, "watcher.handleAdd", trace.WithAttributes(
+		attribute.String("beacon.resource.type", resourceType),
+		attribute.String("beacon.detection_source", detectionSource),
+	))
+	defer span.End()
+
 	mo, err := w.extractManagedObject(obj, resourceType)
 	if err != nil {
 		w.logger.Error("failed to extract managed object on add",
 			zap.String("resource_type", resourceType),
 			zap.Error(err),
 		)
+		tracing.Fail(span, err)
 		return
 	}
-
-	annotated, annotationValue := w.hasAnnotation(obj, w.cfg.Annotation.Key)
-	if !annotated {
-		return
-	}
+	span.SetAttributes(resourceAttributes(mo)...)
 
 	mo.AnnotationValue = annotationValue
 	mo.DetectionSource = detectionSource
 	mo.ClusterState = models.ClusterStateExists
+	mo.CreatedTraceParent = tracing.TraceParent(ctx)
+
+	// Hold the created event for the coalescing window so that a resource
+	// deleted within it can be coalesced.
+	if rule := w.cfg.CoalesceFor(resourceType); rule != nil {
+		holdUntil := mo.CreatedAt.Add(rule.Window.Duration)
+		mo.NextAttemptAt = &holdUntil
+	}
 
-	if err := w.db.InsertManagedObject(mo); err != nil {
+	if err := database.WithContext(ctx, w.db).InsertManagedObject(mo); err != nil {
 		w.logger.Error("failed to insert managed object",
 			zap.String("resource_uid", mo.ResourceUID),
 			zap.String("resource_name", mo.ResourceName),
 			zap.Error(err),
 		)
+		tracing.Fail(span, err)
 		return
 	}
+	span.SetAttributes(attribute.String("beacon.object.id", mo.ID))
 
 	w.metrics.RecordResourceEvent(resourceType, "add")
 	w.logger.Info("tracked new annotated resource",
@@ -252,9 +277,18 @@ func (w *Watcher) handleAdd(obj interface{}, resourceType string, detectionSourc
 //     event with detection_source "mutation".
 //   - Annotation removed (old has it, new does not): treated as a logical
 //     deletion with detection_source "mutation".
-func (w *Watcher) handleUpdate(oldObj, newObj interface{}, resourceType string) {
+func (w *Watcher) handleUpdate(ctx context.Context, oldObj, newObj interface{}, resourceType string) {
 	oldAnnotated, _ := w.hasAnnotation(oldObj, w.cfg.Annotation.Key)
 	newAnnotated, newAnnotationValue := w.hasAnnotation(newObj, w.cfg.Annotation.Key)
+	if !oldAnnotated && !newAnnotated {
+		// Updates of resources that are not tracked are ignored.
+		return
+	}
+
+	ctx, span := w.tracer.Start(ctx, "watcher.handleUpdate", trace.WithAttributes(
+		attribute.String("beacon.resource.type", resourceType),
+	))
+	defer span.End()
 
 	switch {
 	case !oldAnnotated && newAnnotated:
@@ -264,7 +298,7 @@ func (w *Watcher) handleUpdate(oldObj, newObj interface{}, resourceType string)
 			zap.String("annotation_value", newAnnotationValue),
 		)
 		w.metrics.RecordAnnotationMutation(resourceType, "added")
-		w.handleAdd(newObj, resourceType, models.DetectionSourceMutation)
+		w.handleAdd(ctx, newObj, resourceType, models.DetectionSourceMutation)
 
 	case oldAnnotated && !newAnnotated:
 		// Annotation was removed via mutation.
@@ -274,8 +308,10 @@ func (w *Watcher) handleUpdate(oldObj, newObj interface{}, resourceType string)
 				zap.String("resource_type", resourceType),
 				zap.Error(err),
 			)
+			tracing.Fail(span, err)
 			return
 		}
+		span.SetAttributes(resourceAttributes(mo)...)
 
 		w.logger.Warn("annotation removed via mutation",
 			zap.String("resource_type", resourceType),
@@ -283,12 +319,13 @@ func (w *Watcher) handleUpdate(oldObj, newObj interface{}, resourceType string)
 			zap.String("resource_name", mo.ResourceName),
 		)
 
-		now := time.Now()
-		if err := w.db.UpdateClusterState(mo.ResourceUID, models.ClusterStateDeleted, &now); err != nil {
+		db := database.WithContext(ctx, w.db)
+		if _, err := w.markDeleted(ctx, db, mo.ResourceUID); err != nil {
 			w.logger.Error("failed to update cluster state on annotation removal",
 				zap.String("resource_uid", mo.ResourceUID),
 				zap.Error(err),
 			)
+			tracing.Fail(span, err)
 			return
 		}
 
@@ -303,7 +340,12 @@ func (w *Watcher) handleUpdate(oldObj, newObj interface{}, resourceType string)
 
 // handleDelete processes resource deletion events. If the resource was being
 // tracked (found in the database by UID), its cluster state is set to deleted.
-func (w *Watcher) handleDelete(obj interface{}, resourceType string) {
+func (w *Watcher) handleDelete(ctx context.Context, obj interface{}, resourceType string) {
+	ctx, span := w.tracer.Start(ctx, "watcher.handleDelete", trace.WithAttributes(
+		attribute.String("beacon.resource.type", resourceType),
+	))
+	defer span.End()
+
 	// Handle DeletedFinalStateUnknown tombstones.
 	if d, ok := obj.(cache.DeletedFinalStateUnknown); ok {
 		obj = d.Obj
@@ -315,31 +357,30 @@ func (w *Watcher) handleDelete(obj interface{}, resourceType string) {
 			zap.String("resource_type", resourceType),
 			zap.Error(err),
 		)
+		tracing.Fail(span, err)
 		return
 	}
+	span.SetAttributes(resourceAttributes(mo)...)
 
-	// Check if this object is tracked in the database.
-	existing, err := w.db.GetManagedObjectByUID(mo.ResourceUID)
+	// Record the deletion if this object is tracked in the database.
+	db := database.WithContext(ctx, w.db)
+	existing, err := w.markDeleted(ctx, db, mo.ResourceUID)
 	if err != nil {
-		w.logger.Debug("deleted resource not found in database, ignoring",
+		w.logger.Error("failed to update cluster state on delete",
 			zap.String("resource_uid", mo.ResourceUID),
-			zap.String("resource_type", resourceType),
+			zap.Error(err),
 		)
+		tracing.Fail(span, err)
 		return
 	}
-
 	if existing == nil {
-		return
-	}
-
-	now := time.Now()
-	if err := w.db.UpdateClusterState(mo.ResourceUID, models.ClusterStateDeleted, &now); err != nil {
-		w.logger.Error("failed to update cluster state on delete",
+		w.logger.Debug("deleted resource not tracked or already deleted, ignoring",
 			zap.String("resource_uid", mo.ResourceUID),
-			zap.Error(err),
+			zap.String("resource_type", resourceType),
 		)
 		return
 	}
+	span.SetAttributes(attribute.String("beacon.object.id", existing.ID))
 
 	w.metrics.RecordResourceEvent(resourceType, "delete")
 	w.logger.Info("tracked resource deleted",
@@ -350,6 +391,63 @@ func (w *Watcher) handleDelete(obj interface{}, resourceType string) {
 	)
 }
 
+// markDeleted records the deletion of the tracked resource with uid, and the
+// trace context of ctx in which it was detected, in one transaction. It
+// returns the deleted object, or nil if the resource is not tracked or its
+// deletion was already recorded, for example by the reconciler.
+func (w *Watcher) markDeleted(ctx context.Context, db database.Database, uid string) (*models.ManagedObject, error) {
+	var deleted *models.ManagedObject
+	err := db.WithTx(func(tx database.Database) error {
+		// A resource whose annotation was added back has older, deleted
+		// records; the lookup returns the one that still exists.
+		existing, err := tx.GetManagedObjectByUID(uid)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if existing == nil || existing.ClusterState == models.ClusterStateDeleted {
+			return nil
+		}
+
+		w.recordDeletionTrace(ctx, tx, uid)
+		now := time.Now()
+		if err := tx.UpdateClusterState(uid, models.ClusterStateDeleted, &now); err != nil {
+			return err
+		}
+		deleted = existing
+		return nil
+	})
+	return deleted, err
+}
+
+// recordDeletionTrace stores the trace context of the span in ctx as the one
+// in which the deletion of the resource with uid was detected. Tracing is
+// best effort: a failure is logged and the deletion is still recorded.
+func (w *Watcher) recordDeletionTrace(ctx context.Context, db database.Database, uid string) {
+	traceParent := tracing.TraceParent(ctx)
+	if traceParent == "" {
+		return
+	}
+	if err := db.SetDeletedTraceParent(uid, traceParent); err != nil {
+		w.logger.Warn("failed to record trace context of deletion",
+			zap.String("resource_uid", uid),
+			zap.Error(err),
+		)
+	}
+}
+
+// resourceAttributes returns the span attributes identifying the resource of
+// mo.
+func resourceAttributes(mo *models.ManagedObject) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("beacon.resource.uid", mo.ResourceUID),
+		attribute.String("beacon.resource.name", mo.ResourceName),
+		attribute.String("k8s.namespace.name", mo.ResourceNamespace),
+	}
+}
+
 // extractManagedObject builds a ManagedObject from a Kubernetes runtime object.
 // It handles typed *corev1.Pod objects and *unstructured.Unstructured objects
 // (used for custom resources).
@@ -372,20 +470,23 @@ func (w *Watcher) extractManagedObject(obj interface{}, resourceType string) (*m
 
 // extractFromPod extracts a ManagedObject from a typed Pod.
 func (w *Watcher) extractFromPod(pod *corev1.Pod, resourceType string) (*models.ManagedObject, error) {
-	labelsJSON, err := json.Marshal(w.filterLabels(pod.Labels))
+	labelsJSON, err := json.Marshal(w.filter.Labels(pod.Labels))
 	if err != nil {
 		labelsJSON = []byte("{}")
 	}
 
 	var annotationsJSON []byte
-	if extracted := w.extractConfiguredAnnotations(pod.Annotations); extracted != nil {
+	if extracted := w.filter.Annotations(pod.Annotations); extracted != nil {
 		annotationsJSON, err = json.Marshal(extracted)
 		if err != nil {
 			annotationsJSON = nil
 		}
 	}
 
-	metadataJSON, err := json.Marshal(pod.ObjectMeta)
+	meta := *pod.ObjectMeta.DeepCopy()
+	meta.Labels = w.filter.SanitizeLabels(meta.Labels)
+	meta.Annotations = w.filter.SanitizeAnnotations(meta.Annotations)
+	metadataJSON, err := json.Marshal(meta)
 	if err != nil {
 		metadataJSON = []byte("{}")
 	}
@@ -395,6 +496,19 @@ func (w *Watcher) extractFromPod(pod *corev1.Pod, resourceType string) (*models.
 		annotationValue = pod.Annotations[w.cfg.Annotation.Key]
 	}
 
+	var fieldsJSON string
+	if w.fields.Enabled() {
+		u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(pod)
+		if err != nil {
+			w.logger.Warn("failed to convert pod for field extraction",
+				zap.String("resource_uid", string(pod.UID)),
+				zap.Error(err),
+			)
+		} else {
+			fieldsJSON = w.extractFields(u, string(pod.UID))
+		}
+	}
+
 	return &models.ManagedObject{
 		ID:                uuid.New().String(),
 		ResourceUID:       string(pod.UID),
@@ -406,19 +520,20 @@ func (w *Watcher) extractFromPod(pod *corev1.Pod, resourceType string) (*models.
 		Labels:            string(labelsJSON),
 		Annotations:       string(annotationsJSON),
 		FullMetadata:      string(metadataJSON),
+		Fields:            fieldsJSON,
 		CreatedAt:         time.Now(),
 	}, nil
 }
 
 // extractFromUnstructured extracts a ManagedObject from an unstructured object.
 func (w *Watcher) extractFromUnstructured(obj *unstructured.Unstructured, resourceType string) (*models.ManagedObject, error) {
-	labelsJSON, err := json.Marshal(w.filterLabels(obj.GetLabels()))
+	labelsJSON, err := json.Marshal(w.filter.Labels(obj.GetLabels()))
 	if err != nil {
 		labelsJSON = []byte("{}")
 	}
 
 	var annotationsJSON []byte
-	if extracted := w.extractConfiguredAnnotations(obj.GetAnnotations()); extracted != nil {
+	if extracted := w.filter.Annotations(obj.GetAnnotations()); extracted != nil {
 		annotationsJSON, err = json.Marshal(extracted)
 		if err != nil {
 			annotationsJSON = nil
@@ -430,8 +545,8 @@ func (w *Watcher) extractFromUnstructured(obj *unstructured.Unstructured, resour
 		"namespace":       obj.GetNamespace(),
 		"uid":             obj.GetUID(),
 		"resourceVersion": obj.GetResourceVersion(),
-		"labels":          obj.GetLabels(),
-		"annotations":     obj.GetAnnotations(),
+		"labels":          w.filter.SanitizeLabels(obj.GetLabels()),
+		"annotations":     w.filter.SanitizeAnnotations(obj.GetAnnotations()),
 	}
 	metadataJSON, err := json.Marshal(metadata)
 	if err != nil {
@@ -444,6 +559,11 @@ func (w *Watcher) extractFromUnstructured(obj *unstructured.Unstructured, resour
 		annotationValue = annotations[w.cfg.Annotation.Key]
 	}
 
+	var fieldsJSON string
+	if w.fields.Enabled() {
+		fieldsJSON = w.extractFields(obj.Object, string(obj.GetUID()))
+	}
+
 	return &models.ManagedObject{
 		ID:                uuid.New().String(),
 		ResourceUID:       string(obj.GetUID()),
@@ -455,43 +575,24 @@ func (w *Watcher) extractFromUnstructured(obj *unstructured.Unstructured, resour
 		Labels:            string(labelsJSON),
 		Annotations:       string(annotationsJSON),
 		FullMetadata:      string(metadataJSON),
+		Fields:            fieldsJSON,
 		CreatedAt:         time.Now(),
 	}, nil
 }
 
-// filterLabels returns a filtered copy of allLabels containing only the keys
-// listed in cfg.Payload.Labels. If no label filter is configured, all labels
-// are returned unchanged.
-func (w *Watcher) filterLabels(allLabels map[string]string) map[string]string {
-	if len(w.cfg.Payload.Labels) == 0 {
-		return allLabels
-	}
-	filtered := make(map[string]string, len(w.cfg.Payload.Labels))
-	for _, key := range w.cfg.Payload.Labels {
-		if val, ok := allLabels[key]; ok {
-			filtered[key] = val
-		}
-	}
-	return filtered
-}
-
-// extractConfiguredAnnotations returns a map containing only the annotation
-// keys listed in cfg.Payload.Annotations. If no annotation keys are configured,
-// nil is returned.
-func (w *Watcher) extractConfiguredAnnotations(allAnnotations map[string]string) map[string]string {
-	if len(w.cfg.Payload.Annotations) == 0 {
-		return nil
-	}
-	extracted := make(map[string]string, len(w.cfg.Payload.Annotations))
-	for _, key := range w.cfg.Payload.Annotations {
-		if val, ok := allAnnotations[key]; ok {
-			extracted[key] = val
-		}
-	}
-	if len(extracted) == 0 {
-		return nil
+// extractFields evaluates the configured payload fields against the
+// unstructured object, with its labels and annotations filtered, and returns
+// them as JSON. Evaluation errors are logged and any fields that could be
+// extracted are still returned.
+func (w *Watcher) extractFields(obj map[string]interface{}, uid string) string {
+	fieldsJSON, err := w.fields.ExtractJSON(w.filter.Object(obj))
+	if err != nil {
+		w.logger.Warn("failed to extract payload fields",
+			zap.String("resource_uid", uid),
+			zap.Error(err),
+		)
 	}
-	return extracted
+	return fieldsJSON
 }
 
 // hasAnnotation checks whether a Kubernetes object carries the specified
@@ -1,6 +1,8 @@
 package watcher
 
 import (
+	"context"
+	"strings"
 	"testing"
 	"time"
 
@@ -8,6 +10,8 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	"go.uber.org/zap"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -87,7 +91,21 @@ func TestHandleAdd_AnnotatedPod_InsertsObject(t *testing.T) {
 			obj.ClusterState == models.ClusterStateExists
 	})).Return(nil).Once()
 
-	w.handleAdd(pod, "Pod", models.DetectionSourceWatch)
+	w.handleAdd(context.Background(), pod, "Pod", models.DetectionSourceWatch)
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestHandleAdd_CoalescedTypeHoldsCreatedEvent(t *testing.T) {
+	mockDB := new(database.MockDatabase)
+	w := newTestWatcher(mockDB)
+	w.cfg.Resources[0].Coalesce = config.CoalesceConfig{Window: config.Duration{Duration: 30 * time.Second}, Mode: config.CoalesceModeEphemeral}
+
+	mockDB.On("InsertManagedObject", mock.MatchedBy(func(obj *models.ManagedObject) bool {
+		return obj.NextAttemptAt != nil && obj.NextAttemptAt.Sub(obj.CreatedAt) == 30*time.Second
+	})).Return(nil).Once()
+
+	w.handleAdd(context.Background(), newAnnotatedPod("job-pod", "default", "uid-job", "enabled"), "Pod", models.DetectionSourceWatch)
 
 	mockDB.AssertExpectations(t)
 }
@@ -99,7 +117,7 @@ func TestHandleAdd_UnannotatedPod_DoesNotInsert(t *testing.T) {
 	pod := newUnannotatedPod("my-pod", "default", "uid-456")
 
 	// InsertManagedObject should NOT be called.
-	w.handleAdd(pod, "Pod", models.DetectionSourceWatch)
+	w.handleAdd(context.Background(), pod, "Pod", models.DetectionSourceWatch)
 
 	mockDB.AssertNotCalled(t, "InsertManagedObject", mock.Anything)
 }
@@ -117,7 +135,7 @@ func TestHandleUpdate_AnnotationAdded_InsertsWithMutationSource(t *testing.T) {
 			obj.AnnotationValue == "enabled"
 	})).Return(nil).Once()
 
-	w.handleUpdate(oldPod, newPod, "Pod")
+	w.handleUpdate(context.Background(), oldPod, newPod, "Pod")
 
 	mockDB.AssertExpectations(t)
 }
@@ -129,6 +147,11 @@ func TestHandleUpdate_AnnotationRemoved_UpdatesClusterState(t *testing.T) {
 	oldPod := newAnnotatedPod("my-pod", "default", "uid-abc", "enabled")
 	newPod := newUnannotatedPod("my-pod", "default", "uid-abc")
 
+	mockDB.On("GetManagedObjectByUID", "uid-abc").Return(&models.ManagedObject{
+		ID:           "internal-id",
+		ResourceUID:  "uid-abc",
+		ClusterState: models.ClusterStateExists,
+	}, nil).Once()
 	mockDB.On("UpdateClusterState",
 		"uid-abc",
 		models.ClusterStateDeleted,
@@ -137,7 +160,7 @@ func TestHandleUpdate_AnnotationRemoved_UpdatesClusterState(t *testing.T) {
 		}),
 	).Return(nil).Once()
 
-	w.handleUpdate(oldPod, newPod, "Pod")
+	w.handleUpdate(context.Background(), oldPod, newPod, "Pod")
 
 	mockDB.AssertExpectations(t)
 }
@@ -162,7 +185,7 @@ func TestHandleDelete_TrackedPod_UpdatesClusterState(t *testing.T) {
 		}),
 	).Return(nil).Once()
 
-	w.handleDelete(pod, "Pod")
+	w.handleDelete(context.Background(), pod, "Pod")
 
 	mockDB.AssertExpectations(t)
 }
@@ -176,11 +199,96 @@ func TestHandleDelete_UntrackedPod_NoOp(t *testing.T) {
 	// GetManagedObjectByUID returns nil (not tracked).
 	mockDB.On("GetManagedObjectByUID", "uid-untracked").Return(nil, nil).Once()
 
-	w.handleDelete(pod, "Pod")
+	w.handleDelete(context.Background(), pod, "Pod")
+
+	mockDB.AssertNotCalled(t, "UpdateClusterState", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestHandleDelete_AlreadyDeleted_NoOp(t *testing.T) {
+	mockDB := new(database.MockDatabase)
+	w := newTestWatcher(mockDB)
+
+	// The reconciler recorded the deletion first.
+	mockDB.On("GetManagedObjectByUID", "uid-del").Return(&models.ManagedObject{
+		ID:           "internal-id",
+		ResourceUID:  "uid-del",
+		ClusterState: models.ClusterStateDeleted,
+	}, nil).Once()
+
+	w.handleDelete(context.Background(), newAnnotatedPod("my-pod", "default", "uid-del", "enabled"), "Pod")
 
+	mockDB.AssertExpectations(t)
+	mockDB.AssertNotCalled(t, "SetDeletedTraceParent", mock.Anything, mock.Anything)
 	mockDB.AssertNotCalled(t, "UpdateClusterState", mock.Anything, mock.Anything, mock.Anything)
 }
 
+func TestHandleDelete_AfterReannotation_DeletesLiveRecord(t *testing.T) {
+	db, err := database.NewSQLiteDB(":memory:", zap.NewNop())
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	w := newTestWatcher(nil)
+	w.db = db
+
+	annotated := newAnnotatedPod("my-pod", "default", "uid-re", "enabled")
+	unannotated := newUnannotatedPod("my-pod", "default", "uid-re")
+	ctx := context.Background()
+
+	w.handleAdd(ctx, annotated, "Pod", models.DetectionSourceWatch)
+	w.handleUpdate(ctx, annotated, unannotated, "Pod")
+	w.handleUpdate(ctx, unannotated, annotated, "Pod")
+	w.handleDelete(ctx, annotated, "Pod")
+
+	exists, deleted, err := db.CountByState()
+	require.NoError(t, err)
+	assert.Zero(t, exists, "the record of the re-added annotation is deleted")
+	assert.Equal(t, 2, deleted)
+
+	pending, err := db.GetPendingNotifications(10, models.OrderingKeyUID)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, models.ClusterStateDeleted, pending[0].ClusterState)
+}
+
+func TestHandleAdd_RecordsDetectionTrace(t *testing.T) {
+	mockDB := new(database.MockDatabase)
+	w := newTestWatcher(mockDB)
+	exporter := tracetest.NewInMemoryExporter()
+	w.tracer = sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)).Tracer("test")
+
+	var inserted *models.ManagedObject
+	mockDB.On("InsertManagedObject", mock.Anything).Run(func(args mock.Arguments) {
+		inserted = args.Get(0).(*models.ManagedObject)
+	}).Return(nil).Once()
+
+	w.handleAdd(context.Background(), newAnnotatedPod("my-pod", "default", "uid-trace", "enabled"), "Pod", models.DetectionSourceWatch)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "watcher.handleAdd", spans[0].Name)
+	require.NotNil(t, inserted)
+	sc := spans[0].SpanContext
+	assert.Equal(t, "00-"+sc.TraceID().String()+"-"+sc.SpanID().String()+"-01", inserted.CreatedTraceParent)
+}
+
+func TestHandleDelete_RecordsDeletionTrace(t *testing.T) {
+	mockDB := new(database.MockDatabase)
+	w := newTestWatcher(mockDB)
+	w.tracer = sdktrace.NewTracerProvider().Tracer("test")
+
+	mockDB.On("GetManagedObjectByUID", "uid-del").Return(&models.ManagedObject{
+		ID:          "internal-id",
+		ResourceUID: "uid-del",
+	}, nil).Once()
+	mockDB.On("SetDeletedTraceParent", "uid-del", mock.MatchedBy(func(tp string) bool {
+		return strings.HasPrefix(tp, "00-")
+	})).Return(nil).Once()
+	mockDB.On("UpdateClusterState", "uid-del", models.ClusterStateDeleted, mock.Anything).Return(nil).Once()
+
+	w.handleDelete(context.Background(), newAnnotatedPod("my-pod", "default", "uid-del", "enabled"), "Pod")
+
+	mockDB.AssertExpectations(t)
+}
+
 func TestExtractManagedObject_Pod(t *testing.T) {
 	mockDB := new(database.MockDatabase)
 	w := newTestWatcher(mockDB)
@@ -341,6 +449,29 @@ func TestExtractManagedObject_Pod_NoAnnotationConfigEmpty(t *testing.T) {
 	assert.Empty(t, mo.Annotations)
 }
 
+func TestExtractManagedObject_Pod_DenyAndRedact(t *testing.T) {
+	mockDB := new(database.MockDatabase)
+	cfg := &config.Config{}
+	cfg.Annotation.Key = testAnnotationKey
+	cfg.Payload.AnnotationFilter.Allow = []string{"example.com/*"}
+	cfg.Payload.AnnotationFilter.Deny = []string{"example.com/token"}
+	cfg.Payload.Redact = []config.RedactConfig{{Keys: []string{"example.com/owner"}}}
+	w := NewWatcher(mockDB, fake.NewSimpleClientset(), nil, cfg, metrics.NewMetrics(prometheus.NewRegistry()), zap.NewNop())
+
+	pod := newAnnotatedPod("test-pod", "default", "uid-dr", "enabled")
+	pod.Annotations["example.com/owner"] = "team-platform"
+	pod.Annotations["example.com/token"] = "s3cret"
+
+	mo, err := w.extractManagedObject(pod, "Pod")
+	require.NoError(t, err)
+
+	assert.Contains(t, mo.Annotations, `"example.com/owner":"[REDACTED]"`)
+	assert.NotContains(t, mo.Annotations, "example.com/token")
+	// The full metadata snapshot must not leak denied or redacted values.
+	assert.NotContains(t, mo.FullMetadata, "s3cret")
+	assert.NotContains(t, mo.FullMetadata, "team-platform")
+}
+
 func TestExtractManagedObject_Unstructured_FilteredLabels(t *testing.T) {
 	mockDB := new(database.MockDatabase)
 	w := newTestWatcher(mockDB)
@@ -405,6 +536,99 @@ func TestExtractManagedObject_Unstructured_ExtractsConfiguredAnnotations(t *test
 	assert.NotContains(t, mo.Annotations, `"example.com/other"`)
 }
 
+func TestExtractManagedObject_Unstructured_PayloadFields(t *testing.T) {
+	mockDB := new(database.MockDatabase)
+	cfg := &config.Config{}
+	cfg.Annotation.Key = testAnnotationKey
+	cfg.Payload.Fields = []config.FieldConfig{
+		{Name: "model", JSONPath: ".spec.model.name"},
+		{Name: "replicas", JSONPath: ".spec.replicas"},
+	}
+	w := NewWatcher(mockDB, fake.NewSimpleClientset(), nil, cfg, metrics.NewMetrics(prometheus.NewRegistry()), zap.NewNop())
+
+	obj := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "serving.kserve.io/v1alpha1",
+			"kind":       "LLMInferenceService",
+			"metadata": map[string]interface{}{
+				"name":      "llama",
+				"namespace": "tenant-a",
+				"uid":       "llm-uid-1",
+				"annotations": map[string]interface{}{
+					testAnnotationKey: "true",
+				},
+			},
+			"spec": map[string]interface{}{
+				"model":    map[string]interface{}{"name": "meta-llama/Llama-3-8B"},
+				"replicas": int64(2),
+			},
+		},
+	}
+
+	mo, err := w.extractManagedObject(obj, "LLMInferenceService")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"model":"meta-llama/Llama-3-8B","replicas":2}`, mo.Fields)
+}
+
+func TestExtractManagedObject_Pod_PayloadFields(t *testing.T) {
+	mockDB := new(database.MockDatabase)
+	cfg := &config.Config{}
+	cfg.Annotation.Key = testAnnotationKey
+	cfg.Payload.Fields = []config.FieldConfig{
+		{Name: "node", JSONPath: ".spec.nodeName"},
+	}
+	w := NewWatcher(mockDB, fake.NewSimpleClientset(), nil, cfg, metrics.NewMetrics(prometheus.NewRegistry()), zap.NewNop())
+
+	pod := newAnnotatedPod("p", "ns", "uid-f", "true")
+	pod.Spec.NodeName = "worker-1"
+
+	mo, err := w.extractManagedObject(pod, "Pod")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"node":"worker-1"}`, mo.Fields)
+}
+
+func TestExtractManagedObject_Pod_PayloadFieldsFiltered(t *testing.T) {
+	mockDB := new(database.MockDatabase)
+	cfg := &config.Config{}
+	cfg.Annotation.Key = testAnnotationKey
+	cfg.Payload.AnnotationFilter.Deny = []string{"example.com/token"}
+	cfg.Payload.Redact = []config.RedactConfig{{Keys: []string{"example.com/owner"}}}
+	cfg.Payload.Fields = []config.FieldConfig{
+		{Name: "annotations", JSONPath: ".metadata.annotations"},
+	}
+	w := NewWatcher(mockDB, fake.NewSimpleClientset(), nil, cfg, metrics.NewMetrics(prometheus.NewRegistry()), zap.NewNop())
+
+	pod := newAnnotatedPod("p", "ns", "uid-ff", "true")
+	pod.Annotations["example.com/owner"] = "team-platform"
+	pod.Annotations["example.com/token"] = "s3cret"
+
+	mo, err := w.extractManagedObject(pod, "Pod")
+	require.NoError(t, err)
+	assert.Contains(t, mo.Fields, `"example.com/owner":"[REDACTED]"`)
+	assert.NotContains(t, mo.Fields, "s3cret")
+	assert.NotContains(t, mo.Fields, "team-platform")
+}
+
+func TestExtractManagedObject_InvalidFilterOmitsMetadata(t *testing.T) {
+	mockDB := new(database.MockDatabase)
+	cfg := &config.Config{}
+	cfg.Annotation.Key = testAnnotationKey
+	cfg.Payload.Annotations = []string{"example.com/owner"}
+	cfg.Payload.LabelFilter.Deny = []string{"regex:("}
+	w := NewWatcher(mockDB, fake.NewSimpleClientset(), nil, cfg, metrics.NewMetrics(prometheus.NewRegistry()), zap.NewNop())
+
+	pod := newAnnotatedPod("p", "ns", "uid-if", "true")
+	pod.Labels = map[string]string{"secret-hash": "abc"}
+	pod.Annotations["example.com/owner"] = "team-platform"
+
+	mo, err := w.extractManagedObject(pod, "Pod")
+	require.NoError(t, err)
+	assert.NotContains(t, mo.Labels, "abc")
+	assert.Empty(t, mo.Annotations)
+	assert.NotContains(t, mo.FullMetadata, "abc")
+	assert.NotContains(t, mo.FullMetadata, "team-platform")
+}
+
 func TestParseGVR(t *testing.T) {
 	tests := []struct {
 		apiVersion string
@@ -0,0 +1,219 @@
+// Package webhook implements Standard Webhooks (https://www.standardwebhooks.com)
+// HMAC-SHA256 signing and verification for beacon notifications.
+//
+// A signed request carries three headers:
+//
+//	webhook-id:        unique message identifier, stable across retries
+//	webhook-timestamp: Unix seconds at which the request was signed
+//	webhook-signature: space-separated list of "v1,<base64 signature>"
+//
+// The signature is HMAC-SHA256 over "<id>.<timestamp>.<body>". A sender
+// configured with several secrets includes one signature per secret, so
+// receivers holding any one of them can verify the request while secrets are
+// being rotated.
+package webhook
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Header names defined by the Standard Webhooks specification.
+const (
+	HeaderID        = "webhook-id"
+	HeaderTimestamp = "webhook-timestamp"
+	HeaderSignature = "webhook-signature"
+)
+
+// DefaultTolerance is the maximum age, and maximum clock skew into the
+// future, of a timestamp accepted by a Verifier.
+const DefaultTolerance = 5 * time.Minute
+
+// secretPrefix marks a base64-encoded Standard Webhooks secret.
+const secretPrefix = "whsec_"
+
+// signatureVersion is the signature scheme identifier for HMAC-SHA256.
+const signatureVersion = "v1"
+
+// minSecretBytes is the minimum decoded secret length.
+const minSecretBytes = 16
+
+// Verification errors.
+var (
+	ErrMissingHeaders    = errors.New("missing webhook signature headers")
+	ErrInvalidTimestamp  = errors.New("invalid webhook timestamp")
+	ErrTimestampTooOld   = errors.New("webhook timestamp too old")
+	ErrTimestampTooNew   = errors.New("webhook timestamp too new")
+	ErrNoMatchingSecrets = errors.New("no matching webhook signature")
+)
+
+// ParseSecret decodes a secret in the Standard Webhooks format: "whsec_"
+// followed by base64-encoded key bytes. The prefix is optional.
+func ParseSecret(secret string) ([]byte, error) {
+	encoded := strings.TrimPrefix(strings.TrimSpace(secret), secretPrefix)
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("decoding secret: %w", err)
+	}
+	if len(key) < minSecretBytes {
+		return nil, fmt.Errorf("secret must be at least %d bytes, got %d", minSecretBytes, len(key))
+	}
+	return key, nil
+}
+
+// SplitSecrets splits a comma- or whitespace-separated list of secrets, as
+// used in environment variables.
+func SplitSecrets(list string) []string {
+	return strings.FieldsFunc(list, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	})
+}
+
+// ReadSecretsFile reads secrets from a file containing one secret per line.
+// Blank lines and lines starting with '#' are ignored.
+func ReadSecretsFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading secrets file: %w", err)
+	}
+
+	var secrets []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		secrets = append(secrets, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading secrets file: %w", err)
+	}
+	return secrets, nil
+}
+
+// parseSecrets decodes every secret in the list. At least one is required.
+func parseSecrets(secrets []string) ([][]byte, error) {
+	if len(secrets) == 0 {
+		return nil, errors.New("at least one secret is required")
+	}
+	keys := make([][]byte, 0, len(secrets))
+	for i, s := range secrets {
+		key, err := ParseSecret(s)
+		if err != nil {
+			return nil, fmt.Errorf("secret %d: %w", i, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// sign computes the base64 HMAC-SHA256 signature of the message with key.
+func sign(key []byte, id string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s.%d.", id, timestamp)
+	mac.Write(body)
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Signer signs outbound requests with one or more secrets.
+type Signer struct {
+	keys [][]byte
+}
+
+// NewSigner creates a Signer from secrets in the Standard Webhooks format.
+func NewSigner(secrets []string) (*Signer, error) {
+	keys, err := parseSecrets(secrets)
+	if err != nil {
+		return nil, err
+	}
+	return &Signer{keys: keys}, nil
+}
+
+// Signature returns the webhook-signature header value for the message: one
+// "v1,<signature>" entry per secret, separated by spaces.
+func (s *Signer) Signature(id string, ts time.Time, body []byte) string {
+	sigs := make([]string, 0, len(s.keys))
+	for _, key := range s.keys {
+		sigs = append(sigs, signatureVersion+","+sign(key, id, ts.Unix(), body))
+	}
+	return strings.Join(sigs, " ")
+}
+
+// SignHeaders sets the webhook-id, webhook-timestamp, and webhook-signature
+// headers for the message on h.
+func (s *Signer) SignHeaders(h http.Header, id string, ts time.Time, body []byte) {
+	h.Set(HeaderID, id)
+	h.Set(HeaderTimestamp, strconv.FormatInt(ts.Unix(), 10))
+	h.Set(HeaderSignature, s.Signature(id, ts, body))
+}
+
+// Verifier checks the signatures of inbound requests.
+type Verifier struct {
+	keys [][]byte
+
+	// Tolerance is the maximum allowed difference between the signed
+	// timestamp and the current time. Requests outside it are rejected to
+	// limit replay.
+	Tolerance time.Duration
+
+	now func() time.Time
+}
+
+// NewVerifier creates a Verifier that accepts signatures made with any of the
+// given secrets.
+func NewVerifier(secrets []string) (*Verifier, error) {
+	keys, err := parseSecrets(secrets)
+	if err != nil {
+		return nil, err
+	}
+	return &Verifier{keys: keys, Tolerance: DefaultTolerance, now: time.Now}, nil
+}
+
+// Verify checks the signature headers in h against body. It returns nil if
+// the timestamp is within tolerance and at least one v1 signature matches
+// one of the verifier's secrets.
+func (v *Verifier) Verify(h http.Header, body []byte) error {
+	id := h.Get(HeaderID)
+	tsHeader := h.Get(HeaderTimestamp)
+	sigHeader := h.Get(HeaderSignature)
+	if id == "" || tsHeader == "" || sigHeader == "" {
+		return ErrMissingHeaders
+	}
+
+	ts, err := strconv.ParseInt(tsHeader, 10, 64)
+	if err != nil {
+		return ErrInvalidTimestamp
+	}
+	now := v.now()
+	signedAt := time.Unix(ts, 0)
+	if now.Sub(signedAt) > v.Tolerance {
+		return ErrTimestampTooOld
+	}
+	if signedAt.Sub(now) > v.Tolerance {
+		return ErrTimestampTooNew
+	}
+
+	for _, entry := range strings.Fields(sigHeader) {
+		version, sig, ok := strings.Cut(entry, ",")
+		if !ok || version != signatureVersion {
+			continue
+		}
+		for _, key := range v.keys {
+			if hmac.Equal([]byte(sig), []byte(sign(key, id, ts, body))) {
+				return nil
+			}
+		}
+	}
+	return ErrNoMatchingSecrets
+}
@@ -0,0 +1,135 @@
+package webhook
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	secretA = "whsec_MfKQ9r8GKYqrTwjUPD8ILPZIo2LaLaSw"
+	secretB = "whsec_c2Vjb25kLXNlY3JldC1mb3Itcm90YXRpb24="
+)
+
+// testVerifier returns a Verifier whose clock is fixed at now.
+func testVerifier(t *testing.T, now time.Time, secrets ...string) *Verifier {
+	t.Helper()
+	v, err := NewVerifier(secrets)
+	require.NoError(t, err)
+	v.now = func() time.Time { return now }
+	return v
+}
+
+func TestSignature_StandardWebhooksVector(t *testing.T) {
+	// Test vector from the Standard Webhooks reference libraries.
+	s, err := NewSigner([]string{secretA})
+	require.NoError(t, err)
+
+	sig := s.Signature("msg_p5jXN8AQM9LWM0D4loKWxJek", time.Unix(1614265330, 0), []byte(`{"test": 2432232314}`))
+	assert.Equal(t, "v1,g0hM9SsE+OTPJTGt/tmIKtSyZlE3uFJELVlNIOLJ1OE=", sig)
+}
+
+func TestSignAndVerify(t *testing.T) {
+	now := time.Now()
+	body := []byte(`{"id":"evt-1"}`)
+	s, err := NewSigner([]string{secretA})
+	require.NoError(t, err)
+
+	h := make(http.Header)
+	s.SignHeaders(h, "evt-1", now, body)
+
+	assert.Equal(t, "evt-1", h.Get(HeaderID))
+	assert.NoError(t, testVerifier(t, now, secretA).Verify(h, body))
+	assert.ErrorIs(t, testVerifier(t, now, secretA).Verify(h, []byte(`{"id":"evt-2"}`)), ErrNoMatchingSecrets)
+	assert.ErrorIs(t, testVerifier(t, now, secretB).Verify(h, body), ErrNoMatchingSecrets)
+}
+
+func TestSignAndVerify_Rotation(t *testing.T) {
+	now := time.Now()
+	body := []byte(`{}`)
+
+	// During rotation the sender signs with both secrets.
+	s, err := NewSigner([]string{secretA, secretB})
+	require.NoError(t, err)
+	h := make(http.Header)
+	s.SignHeaders(h, "msg-1", now, body)
+	assert.Len(t, strings.Fields(h.Get(HeaderSignature)), 2)
+
+	// Receivers holding either secret accept the request.
+	assert.NoError(t, testVerifier(t, now, secretA).Verify(h, body))
+	assert.NoError(t, testVerifier(t, now, secretB).Verify(h, body))
+}
+
+func TestVerify_Timestamp(t *testing.T) {
+	now := time.Now()
+	body := []byte(`{}`)
+	s, err := NewSigner([]string{secretA})
+	require.NoError(t, err)
+	v := testVerifier(t, now, secretA)
+
+	h := make(http.Header)
+	s.SignHeaders(h, "msg-1", now.Add(-DefaultTolerance-time.Second), body)
+	assert.ErrorIs(t, v.Verify(h, body), ErrTimestampTooOld)
+
+	s.SignHeaders(h, "msg-1", now.Add(DefaultTolerance+time.Second), body)
+	assert.ErrorIs(t, v.Verify(h, body), ErrTimestampTooNew)
+
+	h.Set(HeaderTimestamp, "yesterday")
+	assert.ErrorIs(t, v.Verify(h, body), ErrInvalidTimestamp)
+}
+
+func TestVerify_MissingHeaders(t *testing.T) {
+	v := testVerifier(t, time.Now(), secretA)
+	assert.ErrorIs(t, v.Verify(make(http.Header), nil), ErrMissingHeaders)
+}
+
+func TestVerify_IgnoresUnknownVersions(t *testing.T) {
+	now := time.Now()
+	body := []byte(`{}`)
+	s, err := NewSigner([]string{secretA})
+	require.NoError(t, err)
+	h := make(http.Header)
+	s.SignHeaders(h, "msg-1", now, body)
+	h.Set(HeaderSignature, "v1a,abc "+h.Get(HeaderSignature))
+
+	assert.NoError(t, testVerifier(t, now, secretA).Verify(h, body))
+}
+
+func TestParseSecret(t *testing.T) {
+	_, err := ParseSecret(secretA)
+	assert.NoError(t, err)
+
+	_, err = ParseSecret(strings.TrimPrefix(secretA, "whsec_"))
+	assert.NoError(t, err, "prefix is optional")
+
+	_, err = ParseSecret("whsec_not base64!")
+	assert.Error(t, err)
+
+	_, err = ParseSecret("whsec_c2hvcnQ=")
+	assert.ErrorContains(t, err, "at least 16 bytes")
+
+	_, err = NewSigner(nil)
+	assert.Error(t, err)
+}
+
+func TestSplitSecrets(t *testing.T) {
+	assert.Equal(t, []string{"a", "b", "c"}, SplitSecrets("a,b c\n"))
+}
+
+func TestReadSecretsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets")
+	require.NoError(t, os.WriteFile(path, []byte("# current\n"+secretA+"\n\n"+secretB+"\n"), 0o600))
+
+	secrets, err := ReadSecretsFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{secretA, secretB}, secrets)
+
+	_, err = ReadSecretsFile(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
@@ -29,7 +29,10 @@ func main() {
 	log.Printf("starting test-endpoint on port %d (mode=%s, path=%s)",
 		cfg.Server.Port, cfg.Behavior.Mode, cfg.Server.Path)
 
-	srv := server.New(cfg)
+	srv, err := server.New(cfg)
+	if err != nil {
+		log.Fatalf("failed to create server: %v", err)
+	}
 
 	httpServer := &http.Server{
 		Addr:         fmt.Sprintf(":%d", cfg.Server.Port),
@@ -16,6 +16,9 @@ type Config struct {
 	Behavior    BehaviorConfig    `yaml:"behavior"`
 	Logging     LoggingConfig     `yaml:"logging"`
 	Idempotency IdempotencyConfig `yaml:"idempotency"`
+	Signing     SigningConfig     `yaml:"signing"`
+	Auth        AuthConfig        `yaml:"auth"`
+	Ack         AckConfig         `yaml:"ack"`
 }
 
 // ServerConfig holds HTTP server settings.
@@ -28,7 +31,10 @@ type ServerConfig struct {
 
 // BehaviorConfig controls how the test endpoint responds to incoming events.
 type BehaviorConfig struct {
-	// Mode determines response behavior: "success", "failure", "delay", or "random".
+	// Mode determines response behavior: "success", "failure", "delay",
+	// "random", or "async". In async mode events are answered with 202
+	// Accepted and acknowledged later through beacon's callback (see
+	// AckConfig).
 	Mode string `yaml:"mode"`
 	// FailureRate is the probability of failure when Mode is "random" (0.0-1.0).
 	FailureRate float64 `yaml:"failureRate"`
@@ -58,6 +64,60 @@ type IdempotencyConfig struct {
 	MaxTracked int `yaml:"maxTracked"`
 }
 
+// SigningConfig controls verification of Standard Webhooks request
+// signatures.
+type SigningConfig struct {
+	// Enabled rejects requests without a valid signature when true.
+	Enabled bool `yaml:"enabled"`
+	// Secrets are the accepted signing secrets in "whsec_..." format.
+	Secrets []string `yaml:"secrets"`
+	// SecretsFile is a file containing further accepted secrets, one per line.
+	SecretsFile string `yaml:"secretsFile"`
+	// Tolerance is the maximum difference between the signed timestamp and
+	// the current time.
+	Tolerance time.Duration `yaml:"tolerance"`
+}
+
+// AuthConfig controls authentication of incoming requests.
+type AuthConfig struct {
+	TokenReview TokenReviewConfig `yaml:"tokenReview"`
+}
+
+// TokenReviewConfig controls validation of bearer tokens with the Kubernetes
+// TokenReview API, for beacon's serviceAccountToken auth mode.
+type TokenReviewConfig struct {
+	// Enabled rejects requests without a token the API server accepts.
+	Enabled bool `yaml:"enabled"`
+	// Audiences are the audiences the token must be valid for. Empty uses
+	// the API server's default audience.
+	Audiences []string `yaml:"audiences"`
+	// AllowedUsers restricts accepted tokens to these usernames, e.g.
+	// "system:serviceaccount:beacon:beacon". Empty accepts any authenticated
+	// user.
+	AllowedUsers []string `yaml:"allowedUsers"`
+	// CacheTTL is how long a successful review is cached.
+	CacheTTL time.Duration `yaml:"cacheTTL"`
+}
+
+// AckConfig controls the acknowledgement callbacks sent in async mode, for
+// beacon's endpoint.ack mode.
+type AckConfig struct {
+	// CallbackURL is beacon's acknowledgement endpoint, e.g.
+	// "http://beacon:8080/ack".
+	CallbackURL string `yaml:"callbackURL"`
+	// Token is sent as a bearer token; it must match beacon's
+	// ENDPOINT_ACK_TOKEN.
+	Token string `yaml:"token"`
+	// Delay is how long after accepting an event the callback is sent.
+	Delay time.Duration `yaml:"delay"`
+	// RejectRate is the probability (0.0-1.0) that an event is rejected
+	// rather than confirmed.
+	RejectRate float64 `yaml:"rejectRate"`
+	// DropRate is the probability (0.0-1.0) that no callback is sent, so
+	// beacon's acknowledgement timeout applies.
+	DropRate float64 `yaml:"dropRate"`
+}
+
 // Defaults returns a Config populated with default values.
 func Defaults() Config {
 	return Config{
@@ -83,6 +143,19 @@ func Defaults() Config {
 			Enabled:    true,
 			MaxTracked: 10000,
 		},
+		Signing: SigningConfig{
+			Enabled:   false,
+			Tolerance: 5 * time.Minute,
+		},
+		Auth: AuthConfig{
+			TokenReview: TokenReviewConfig{
+				Enabled:  false,
+				CacheTTL: time.Minute,
+			},
+		},
+		Ack: AckConfig{
+			Delay: 30 * time.Second,
+		},
 	}
 }
 
@@ -115,8 +188,19 @@ func validate(cfg Config) error {
 	switch cfg.Behavior.Mode {
 	case "success", "failure", "delay", "random":
 		// valid
+	case "async":
+		if cfg.Ack.CallbackURL == "" {
+			return fmt.Errorf("async mode requires ack.callbackURL")
+		}
 	default:
-		return fmt.Errorf("invalid behavior mode %q: must be success, failure, delay, or random", cfg.Behavior.Mode)
+		return fmt.Errorf("invalid behavior mode %q: must be success, failure, delay, random, or async", cfg.Behavior.Mode)
+	}
+
+	if cfg.Ack.RejectRate < 0.0 || cfg.Ack.RejectRate > 1.0 {
+		return fmt.Errorf("ack.rejectRate must be between 0.0 and 1.0, got %f", cfg.Ack.RejectRate)
+	}
+	if cfg.Ack.DropRate < 0.0 || cfg.Ack.DropRate > 1.0 {
+		return fmt.Errorf("ack.dropRate must be between 0.0 and 1.0, got %f", cfg.Ack.DropRate)
 	}
 
 	if cfg.Behavior.FailureRate < 0.0 || cfg.Behavior.FailureRate > 1.0 {
@@ -134,5 +218,9 @@ func validate(cfg Config) error {
 		return fmt.Errorf("server port must be between 1 and 65535, got %d", cfg.Server.Port)
 	}
 
+	if cfg.Signing.Enabled && len(cfg.Signing.Secrets) == 0 && cfg.Signing.SecretsFile == "" {
+		return fmt.Errorf("signing requires secrets or secretsFile")
+	}
+
 	return nil
 }
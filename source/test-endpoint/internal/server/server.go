@@ -3,8 +3,11 @@
 package server
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"math/rand"
 	"net/http"
@@ -12,6 +15,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/bryonbaker/beacon/pkg/webhook"
 	"github.com/bryonbaker/beacon/test-endpoint/internal/config"
 	"github.com/bryonbaker/beacon/test-endpoint/internal/stats"
 )
@@ -22,6 +26,15 @@ type Server struct {
 	stats *stats.Stats
 	mux   *http.ServeMux
 
+	// verifier checks request signatures; nil when signing is disabled.
+	verifier *webhook.Verifier
+
+	// reviewer authenticates bearer tokens; nil when TokenReview is disabled.
+	reviewer *tokenReviewer
+
+	// ackClient sends acknowledgement callbacks in async mode.
+	ackClient *http.Client
+
 	// idempotency tracking
 	seenMu   sync.Mutex
 	seenIDs  map[string]struct{}
@@ -29,19 +42,46 @@ type Server struct {
 }
 
 // New creates a new Server with the given configuration.
-func New(cfg config.Config) *Server {
+func New(cfg config.Config) (*Server, error) {
 	s := &Server{
 		cfg:     cfg,
 		stats:   stats.New(),
 		mux:     http.NewServeMux(),
 		seenIDs: make(map[string]struct{}),
+
+		ackClient: &http.Client{Timeout: 10 * time.Second},
+	}
+
+	if cfg.Signing.Enabled {
+		secrets := cfg.Signing.Secrets
+		if cfg.Signing.SecretsFile != "" {
+			fileSecrets, err := webhook.ReadSecretsFile(cfg.Signing.SecretsFile)
+			if err != nil {
+				return nil, err
+			}
+			secrets = append(append([]string(nil), secrets...), fileSecrets...)
+		}
+		verifier, err := webhook.NewVerifier(secrets)
+		if err != nil {
+			return nil, fmt.Errorf("loading signing secrets: %w", err)
+		}
+		verifier.Tolerance = cfg.Signing.Tolerance
+		s.verifier = verifier
+	}
+
+	if cfg.Auth.TokenReview.Enabled {
+		reviewer, err := newTokenReviewer(cfg.Auth.TokenReview)
+		if err != nil {
+			return nil, err
+		}
+		s.reviewer = reviewer
 	}
 
 	s.mux.HandleFunc(cfg.Server.Path, s.handleEvent)
 	s.mux.HandleFunc("/stats", s.handleStats)
 	s.mux.HandleFunc("/health", s.handleHealth)
 
-	return s
+	return s, nil
 }
 
 // Handler returns the http.Handler for use with an http.Server.
@@ -65,17 +105,20 @@ func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// handleEvent processes incoming event notifications.
+// handleEvent processes incoming event notifications. A single event in
+// CloudEvents structured content mode and a CloudEvents JSON batch are both
+// accepted.
 func (s *Server) handleEvent(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Validate Content-Type — require CloudEvents structured content mode.
+	// Validate Content-Type — require CloudEvents structured or batch mode.
 	ct := r.Header.Get("Content-Type")
-	if !strings.HasPrefix(ct, "application/cloudevents+json") {
-		http.Error(w, `{"error":"Content-Type must be application/cloudevents+json"}`, http.StatusUnsupportedMediaType)
+	batch := strings.HasPrefix(ct, "application/cloudevents-batch+json")
+	if !batch && !strings.HasPrefix(ct, "application/cloudevents+json") {
+		http.Error(w, `{"error":"Content-Type must be application/cloudevents+json or application/cloudevents-batch+json"}`, http.StatusUnsupportedMediaType)
 		return
 	}
 
@@ -91,14 +134,125 @@ func (s *Server) handleEvent(w http.ResponseWriter, r *http.Request) {
 		s.logInfo("headers: X-Request-ID=%s", requestID)
 	}
 
+	// Authenticate the bearer token with the TokenReview API.
+	if s.reviewer != nil {
+		username, err := s.reviewer.authenticate(r.Context(), r)
+		if err != nil {
+			s.stats.RecordAuthFailure()
+			s.logError("rejected request %s: %v", requestID, err)
+			status := http.StatusUnauthorized
+			if errors.Is(err, errUserDenied) {
+				status = http.StatusForbidden
+			}
+			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, http.StatusText(status)), status)
+			return
+		}
+		if s.cfg.Logging.IncludeHeaders {
+			s.logInfo("authenticated request %s as %s", requestID, username)
+		}
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, `{"error":"failed to read request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	// Verify the Standard Webhooks signature over the raw body.
+	if s.verifier != nil {
+		if err := s.verifier.Verify(r.Header, body); err != nil {
+			s.stats.RecordSignatureFailure()
+			s.logError("rejected request %s: %v", requestID, err)
+			http.Error(w, fmt.Sprintf(`{"error":"invalid signature: %s"}`, err.Error()), http.StatusUnauthorized)
+			return
+		}
+	}
+
+	if batch {
+		s.handleBatch(w, body)
+		return
+	}
+
 	// Parse JSON body into a generic map so any payload shape is accepted
 	// and logged without requiring struct changes.
 	var payload map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+	if err := json.Unmarshal(body, &payload); err != nil {
 		http.Error(w, fmt.Sprintf(`{"error":"invalid JSON: %s"}`, err.Error()), http.StatusBadRequest)
 		return
 	}
 
+	s.applyDelay()
+
+	eventID, _ := payload["id"].(string)
+	status, duplicate := s.processEvent(payload)
+	if duplicate {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"status":"duplicate","message":"event already processed"}`)
+		return
+	}
+	if status == http.StatusAccepted {
+		ceType, _ := payload["type"].(string)
+		s.scheduleAck(eventID, ceType)
+		s.respondAccepted(w, eventID)
+		return
+	}
+	if status != http.StatusOK {
+		s.respondFailure(w, eventID, status)
+		return
+	}
+	s.respondSuccess(w, eventID)
+}
+
+// batchResult is the per-event outcome reported for a batch request, in the
+// format beacon reads under the perItem partial failure policy.
+type batchResult struct {
+	ID     string `json:"id"`
+	Status int    `json:"status"`
+}
+
+// handleBatch processes a CloudEvents JSON batch. The request always
+// succeeds; the outcome of each event, including simulated failures, is
+// reported in the results list.
+func (s *Server) handleBatch(w http.ResponseWriter, body []byte) {
+	var events []map[string]interface{}
+	if err := json.Unmarshal(body, &events); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"invalid JSON batch: %s"}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	s.applyDelay()
+
+	results := make([]batchResult, 0, len(events))
+	for _, payload := range events {
+		eventID, _ := payload["id"].(string)
+		status, _ := s.processEvent(payload)
+		if status == http.StatusAccepted {
+			ceType, _ := payload["type"].(string)
+			s.scheduleAck(eventID, ceType)
+		}
+		results = append(results, batchResult{ID: eventID, Status: status})
+	}
+	s.logInfo("processed batch of %d events", len(events))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"results": results}); err != nil {
+		s.logError("failed to encode batch response: %v", err)
+	}
+}
+
+// applyDelay sleeps for the configured delay in delay mode.
+func (s *Server) applyDelay() {
+	if s.cfg.Behavior.Mode == "delay" {
+		time.Sleep(time.Duration(s.cfg.Behavior.DelayMs) * time.Millisecond)
+	}
+}
+
+// processEvent logs, de-duplicates, and records a single CloudEvents envelope
+// and returns the HTTP status the configured behaviour mode assigns to it.
+// duplicate is true when the event ID was already seen.
+func (s *Server) processEvent(payload map[string]interface{}) (status int, duplicate bool) {
 	// Extract event ID from the CloudEvents envelope body.
 	eventID, _ := payload["id"].(string)
 
@@ -113,10 +267,7 @@ func (s *Server) handleEvent(w http.ResponseWriter, r *http.Request) {
 		if eventID != "" && s.isDuplicate(eventID) {
 			s.stats.RecordDuplicate()
 			s.logInfo("duplicate event detected: %s", eventID)
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			fmt.Fprint(w, `{"status":"duplicate","message":"event already processed"}`)
-			return
+			return http.StatusOK, true
 		}
 		if eventID != "" {
 			s.trackEventID(eventID)
@@ -141,44 +292,106 @@ func (s *Server) handleEvent(w http.ResponseWriter, r *http.Request) {
 	// Apply behavior mode
 	switch s.cfg.Behavior.Mode {
 	case "failure":
-		s.respondFailure(w, eventID)
-		return
-
-	case "delay":
-		time.Sleep(time.Duration(s.cfg.Behavior.DelayMs) * time.Millisecond)
-		s.respondSuccess(w, eventID)
-		return
+		return s.failureStatus(), false
 
 	case "random":
 		if rand.Float64() < s.cfg.Behavior.FailureRate {
-			s.respondFailure(w, eventID)
-			return
+			return s.failureStatus(), false
 		}
-		s.respondSuccess(w, eventID)
-		return
+		return http.StatusOK, false
 
-	default: // "success"
-		s.respondSuccess(w, eventID)
-		return
+	case "async":
+		return http.StatusAccepted, false
+
+	default: // "success", "delay"
+		return http.StatusOK, false
 	}
 }
 
+// failureStatus returns the configured simulated failure status code.
+func (s *Server) failureStatus() int {
+	if s.cfg.Behavior.StatusCode == 0 {
+		return http.StatusInternalServerError
+	}
+	return s.cfg.Behavior.StatusCode
+}
+
 func (s *Server) respondSuccess(w http.ResponseWriter, eventID string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintf(w, `{"status":"accepted","event_id":"%s"}`, eventID)
 }
 
-func (s *Server) respondFailure(w http.ResponseWriter, eventID string) {
-	statusCode := s.cfg.Behavior.StatusCode
-	if statusCode == 0 {
-		statusCode = http.StatusInternalServerError
-	}
+func (s *Server) respondAccepted(w http.ResponseWriter, eventID string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintf(w, `{"status":"pending","event_id":"%s"}`, eventID)
+}
+
+func (s *Server) respondFailure(w http.ResponseWriter, eventID string, statusCode int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 	fmt.Fprintf(w, `{"status":"error","event_id":"%s","message":"simulated failure"}`, eventID)
 }
 
+// scheduleAck sends the acknowledgement callback for an event accepted in
+// async mode once the configured delay has passed. Depending on the
+// configured rates the event is confirmed, rejected, or never acknowledged.
+func (s *Server) scheduleAck(eventID, ceType string) {
+	if eventID == "" {
+		return
+	}
+	if rand.Float64() < s.cfg.Ack.DropRate {
+		s.logInfo("dropping acknowledgement for event %s", eventID)
+		return
+	}
+	status := "delivered"
+	if rand.Float64() < s.cfg.Ack.RejectRate {
+		status = "rejected"
+	}
+	time.AfterFunc(s.cfg.Ack.Delay, func() {
+		s.sendAck(eventID, ceType, status)
+	})
+}
+
+// sendAck posts an acknowledgement callback to beacon.
+func (s *Server) sendAck(eventID, ceType, status string) {
+	callback := map[string]string{"id": eventID, "type": ceType, "status": status}
+	if status == "rejected" {
+		callback["reason"] = "simulated rejection"
+	}
+	body, err := json.Marshal(callback)
+	if err != nil {
+		s.logError("failed to encode acknowledgement for event %s: %v", eventID, err)
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, s.cfg.Ack.CallbackURL, bytes.NewReader(body))
+	if err != nil {
+		s.stats.RecordAckFailure()
+		s.logError("failed to create acknowledgement request for event %s: %v", eventID, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.cfg.Ack.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.cfg.Ack.Token)
+	}
+
+	resp, err := s.ackClient.Do(req)
+	if err != nil {
+		s.stats.RecordAckFailure()
+		s.logError("acknowledgement for event %s failed: %v", eventID, err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		s.stats.RecordAckFailure()
+		s.logError("acknowledgement for event %s returned status %d", eventID, resp.StatusCode)
+		return
+	}
+	s.stats.RecordAck(status)
+	s.logInfo("acknowledged event %s as %s", eventID, status)
+}
+
 // isDuplicate checks whether the given event ID has already been seen.
 func (s *Server) isDuplicate(eventID string) bool {
 	s.seenMu.Lock()
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	authv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"github.com/bryonbaker/beacon/test-endpoint/internal/config"
+)
+
+// Errors returned by tokenReviewer.authenticate.
+var (
+	errMissingToken = errors.New("missing bearer token")
+	errInvalidToken = errors.New("token not authenticated")
+	errUserDenied   = errors.New("user not allowed")
+)
+
+// tokenReviewer authenticates bearer tokens with the Kubernetes TokenReview
+// API and caches successful reviews.
+type tokenReviewer struct {
+	client    kubernetes.Interface
+	audiences []string
+	allowed   map[string]struct{}
+	ttl       time.Duration
+
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte]cachedReview
+}
+
+// cachedReview is a successful review result.
+type cachedReview struct {
+	username string
+	expires  time.Time
+}
+
+// newTokenReviewer creates a tokenReviewer using the in-cluster API server
+// configuration.
+func newTokenReviewer(cfg config.TokenReviewConfig) (*tokenReviewer, error) {
+	restCfg, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("loading in-cluster config for TokenReview: %w", err)
+	}
+	client, err := kubernetes.NewForConfig(restCfg)
+	if err != nil {
+		return nil, fmt.Errorf("creating Kubernetes client: %w", err)
+	}
+
+	allowed := make(map[string]struct{}, len(cfg.AllowedUsers))
+	for _, u := range cfg.AllowedUsers {
+		allowed[u] = struct{}{}
+	}
+	return &tokenReviewer{
+		client:    client,
+		audiences: cfg.Audiences,
+		allowed:   allowed,
+		ttl:       cfg.CacheTTL,
+		cache:     make(map[[sha256.Size]byte]cachedReview),
+	}, nil
+}
+
+// authenticate validates the request's bearer token and returns the
+// authenticated username.
+func (t *tokenReviewer) authenticate(ctx context.Context, r *http.Request) (string, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return "", errMissingToken
+	}
+
+	key := sha256.Sum256([]byte(token))
+	t.mu.Lock()
+	cached, hit := t.cache[key]
+	t.mu.Unlock()
+	if hit && time.Now().Before(cached.expires) {
+		return cached.username, nil
+	}
+
+	review, err := t.client.AuthenticationV1().TokenReviews().Create(ctx, &authv1.TokenReview{
+		Spec: authv1.TokenReviewSpec{Token: token, Audiences: t.audiences},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return "", fmt.Errorf("creating TokenReview: %w", err)
+	}
+	if !review.Status.Authenticated {
+		return "", fmt.Errorf("%w: %s", errInvalidToken, review.Status.Error)
+	}
+
+	username := review.Status.User.Username
+	if len(t.allowed) > 0 {
+		if _, ok := t.allowed[username]; !ok {
+			return username, errUserDenied
+		}
+	}
+
+	now := time.Now()
+	t.mu.Lock()
+	for k, c := range t.cache {
+		if now.After(c.expires) {
+			delete(t.cache, k)
+		}
+	}
+	t.cache[key] = cachedReview{username: username, expires: now.Add(t.ttl)}
+	t.mu.Unlock()
+	return username, nil
+}
@@ -14,6 +14,10 @@ type Stats struct {
 	eventsByType       map[string]int64
 	eventsByResType    map[string]int64
 	duplicatesDetected int64
+	signatureFailures  int64
+	authFailures       int64
+	acksSent           map[string]int64
+	ackFailures        int64
 	lastEventTimestamp time.Time
 }
 
@@ -22,6 +26,7 @@ func New() *Stats {
 	return &Stats{
 		eventsByType:    make(map[string]int64),
 		eventsByResType: make(map[string]int64),
+		acksSent:        make(map[string]int64),
 	}
 }
 
@@ -44,12 +49,49 @@ func (s *Stats) RecordDuplicate() {
 	s.duplicatesDetected++
 }
 
+// RecordSignatureFailure increments the rejected signature counter.
+func (s *Stats) RecordSignatureFailure() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.signatureFailures++
+}
+
+// RecordAuthFailure increments the rejected token counter.
+func (s *Stats) RecordAuthFailure() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.authFailures++
+}
+
+// RecordAck counts an acknowledgement callback beacon accepted, by status
+// ("delivered" or "rejected").
+func (s *Stats) RecordAck(status string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.acksSent[status]++
+}
+
+// RecordAckFailure increments the failed acknowledgement callback counter.
+func (s *Stats) RecordAckFailure() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ackFailures++
+}
+
 // StatsResponse is the JSON-serialisable snapshot of current statistics.
 type StatsResponse struct {
 	TotalEvents        int64            `json:"total_events"`
 	EventsByType       map[string]int64 `json:"events_by_type"`
 	EventsByResourceType map[string]int64 `json:"events_by_resource_type"`
 	DuplicatesDetected int64            `json:"duplicates_detected"`
+	SignatureFailures  int64            `json:"signature_failures"`
+	AuthFailures       int64            `json:"auth_failures"`
+	AcksSent           map[string]int64 `json:"acks_sent"`
+	AckFailures        int64            `json:"ack_failures"`
 	LastEventTimestamp  string           `json:"last_event_timestamp"`
 }
 
@@ -68,6 +110,11 @@ func (s *Stats) Snapshot() StatsResponse {
 		byResType[k] = v
 	}
 
+	acks := make(map[string]int64, len(s.acksSent))
+	for k, v := range s.acksSent {
+		acks[k] = v
+	}
+
 	var ts string
 	if !s.lastEventTimestamp.IsZero() {
 		ts = s.lastEventTimestamp.Format(time.RFC3339)
@@ -78,6 +125,10 @@ func (s *Stats) Snapshot() StatsResponse {
 		EventsByType:         byType,
 		EventsByResourceType: byResType,
 		DuplicatesDetected:   s.duplicatesDetected,
+		SignatureFailures:    s.signatureFailures,
+		AuthFailures:         s.authFailures,
+		AcksSent:             acks,
+		AckFailures:          s.ackFailures,
 		LastEventTimestamp:    ts,
 	}
 }
@@ -3,18 +3,22 @@
 package integration_test
 
 import (
+	"context"
 	"testing"
 	"time"
 
+	"github.com/bryonbaker/beacon/internal/cleaner"
 	"github.com/bryonbaker/beacon/internal/models"
 	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-// TestCleanup_RespectsRetentionPeriod verifies that GetCleanupEligible only
-// returns records whose deleted_at timestamp is older than the configured
-// retention period, and that records deleted more recently are not eligible.
+// TestCleanup_RespectsRetentionPeriod verifies that the delivered retention
+// policy only expires records whose deleted_at timestamp is older than the
+// configured retention period, and that records deleted more recently are not
+// eligible.
 func TestCleanup_RespectsRetentionPeriod(t *testing.T) {
 	env, cleanup := setupTestEnv(t)
 	defer cleanup()
@@ -71,7 +75,7 @@ func TestCleanup_RespectsRetentionPeriod(t *testing.T) {
 	require.NoError(t, env.DB.UpdateNotificationStatus(recentObj.ID, "deleted", time.Now()))
 
 	// Query for cleanup-eligible records.
-	eligible, err := env.DB.GetCleanupEligible(retentionPeriod)
+	eligible, err := env.DB.GetExpiredRecords(models.RetentionDelivered, time.Now().Add(-retentionPeriod), nil, -1)
 	require.NoError(t, err)
 
 	// Only the old record should be eligible.
@@ -125,7 +129,7 @@ func TestCleanup_SkipsFailedNotifications(t *testing.T) {
 	require.NoError(t, env.DB.UpdateClusterState(obj.ResourceUID, models.ClusterStateDeleted, &pastDeletion))
 
 	// The record should NOT be eligible for cleanup because notification_failed=true.
-	eligible, err := env.DB.GetCleanupEligible(retentionPeriod)
+	eligible, err := env.DB.GetExpiredRecords(models.RetentionDelivered, time.Now().Add(-retentionPeriod), nil, -1)
 	require.NoError(t, err)
 	assert.Empty(t, eligible, "records with failed notifications must not be eligible for cleanup")
 
@@ -168,7 +172,7 @@ func TestCleanup_SkipsUnnotifiedRecords(t *testing.T) {
 	require.NoError(t, env.DB.UpdateClusterState(obj.ResourceUID, models.ClusterStateDeleted, &pastDeletion))
 
 	// Without the deletion notification sent, it should not be eligible.
-	eligible, err := env.DB.GetCleanupEligible(retentionPeriod)
+	eligible, err := env.DB.GetExpiredRecords(models.RetentionDelivered, time.Now().Add(-retentionPeriod), nil, -1)
 	require.NoError(t, err)
 	assert.Empty(t, eligible, "records without deletion notification must not be eligible for cleanup")
 
@@ -176,7 +180,7 @@ func TestCleanup_SkipsUnnotifiedRecords(t *testing.T) {
 	require.NoError(t, env.DB.UpdateNotificationStatus(obj.ID, "deleted", time.Now()))
 
 	// Now it should be eligible (deleted_at is 30 minutes ago, beyond 1s retention).
-	eligible, err = env.DB.GetCleanupEligible(retentionPeriod)
+	eligible, err = env.DB.GetExpiredRecords(models.RetentionDelivered, time.Now().Add(-retentionPeriod), nil, -1)
 	require.NoError(t, err)
 	require.Len(t, eligible, 1)
 	assert.Equal(t, obj.ID, eligible[0].ID)
@@ -208,7 +212,7 @@ func TestCleanup_SkipsExistingRecords(t *testing.T) {
 	require.NoError(t, env.DB.UpdateNotificationStatus(obj.ID, "created", time.Now()))
 
 	// Object is still in "exists" state -- it must never be eligible.
-	eligible, err := env.DB.GetCleanupEligible(retentionPeriod)
+	eligible, err := env.DB.GetExpiredRecords(models.RetentionDelivered, time.Now().Add(-retentionPeriod), nil, -1)
 	require.NoError(t, err)
 	assert.Empty(t, eligible, "objects in 'exists' state must never be eligible for cleanup")
 
@@ -249,3 +253,48 @@ func TestCleanup_DeleteRecordAndVacuum(t *testing.T) {
 	assert.Equal(t, 0, exists)
 	assert.Equal(t, 0, deleted)
 }
+
+// TestCleanup_RetentionPolicies runs a cleanup pass with the stale policy
+// enabled. It removes delivered records past the retention period and
+// delivered records of resource types no longer configured that were not
+// reconciled within the stale period. Records of a configured type, and
+// records whose created event is still pending, are kept.
+func TestCleanup_RetentionPolicies(t *testing.T) {
+	env, cleanup := setupTestEnv(t)
+	defer cleanup()
+	env.Config.Retention.Stale.Intervals = 2 // 2s with the 1s reconciliation interval
+
+	insert := func(name, resourceType string, notified bool) *models.ManagedObject {
+		obj := newTestManagedObject(name, "uid-"+name)
+		obj.ResourceType = resourceType
+		obj.CreatedAt = time.Now().Add(-time.Hour)
+		require.NoError(t, env.DB.InsertManagedObject(obj))
+		if notified {
+			require.NoError(t, env.DB.UpdateNotificationStatus(obj.ID, "created", time.Now()))
+		}
+		return obj
+	}
+
+	delivered := insert("delivered", "Pod", true)
+	deletedAt := time.Now().Add(-time.Minute)
+	require.NoError(t, env.DB.UpdateClusterState(delivered.ResourceUID, models.ClusterStateDeleted, &deletedAt))
+	require.NoError(t, env.DB.UpdateNotificationStatus(delivered.ID, "deleted", time.Now()))
+	unwatched := insert("unwatched", "Deployment", true)
+	watched := insert("watched", "Pod", true)
+	pending := insert("pending", "Deployment", false)
+	reconciled := insert("reconciled", "Deployment", true)
+	require.NoError(t, env.DB.UpdateLastReconciled(reconciled.ID, time.Now()))
+
+	c := cleaner.NewCleaner(env.DB, env.Config, env.Metrics, env.Logger)
+	require.NoError(t, c.Cleanup(context.Background()))
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(env.Metrics.CleanupRecordsEligible))
+	for _, obj := range []*models.ManagedObject{delivered, unwatched} {
+		_, err := env.DB.GetManagedObjectByID(obj.ID)
+		assert.Error(t, err, "%s should have been removed", obj.ResourceName)
+	}
+	for _, obj := range []*models.ManagedObject{watched, pending, reconciled} {
+		_, err := env.DB.GetManagedObjectByID(obj.ID)
+		assert.NoError(t, err, "%s should have been kept", obj.ResourceName)
+	}
+}
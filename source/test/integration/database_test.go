@@ -155,7 +155,7 @@ func TestDatabase_ConcurrentReadWrite(t *testing.T) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			if _, readErr := db.GetPendingNotifications(10); readErr != nil {
+			if _, readErr := db.GetPendingNotifications(10, models.OrderingKeyUID); readErr != nil {
 				errCh <- fmt.Errorf("get pending failed: %w", readErr)
 			}
 			if _, readErr := db.GetAllActiveObjects("Pod"); readErr != nil {
@@ -31,7 +31,7 @@ func TestEndToEnd_CreateNotifyDeleteCleanup(t *testing.T) {
 	require.NoError(t, err)
 
 	// Verify it appears as pending.
-	pending, err := env.DB.GetPendingNotifications(10)
+	pending, err := env.DB.GetPendingNotifications(10, models.OrderingKeyUID)
 	require.NoError(t, err)
 	require.Len(t, pending, 1)
 	assert.Equal(t, obj.ID, pending[0].ID)
@@ -96,7 +96,7 @@ func TestEndToEnd_CreateNotifyDeleteCleanup(t *testing.T) {
 	// period because deleted_at was set to "now" above.
 	time.Sleep(1500 * time.Millisecond)
 
-	eligible, err := env.DB.GetCleanupEligible(env.Config.Retention.RetentionPeriod.Duration)
+	eligible, err := env.DB.GetExpiredRecords(models.RetentionDelivered, time.Now().Add(-env.Config.Retention.RetentionPeriod.Duration), nil, -1)
 	require.NoError(t, err)
 	require.Len(t, eligible, 1)
 	assert.Equal(t, obj.ID, eligible[0].ID)
@@ -53,7 +53,7 @@ func TestMutation_AnnotationAdded(t *testing.T) {
 	assert.False(t, stored.NotifiedCreated)
 
 	// Verify it is pending for creation notification.
-	pending, err := env.DB.GetPendingNotifications(10)
+	pending, err := env.DB.GetPendingNotifications(10, models.OrderingKeyUID)
 	require.NoError(t, err)
 	require.Len(t, pending, 1)
 	assert.Equal(t, obj.ID, pending[0].ID)
@@ -124,7 +124,7 @@ func TestMutation_AnnotationRemoved(t *testing.T) {
 	assert.False(t, stored.NotifiedDeleted)
 	assert.True(t, stored.IsPendingDeletionNotification())
 
-	pending, err := env.DB.GetPendingNotifications(10)
+	pending, err := env.DB.GetPendingNotifications(10, models.OrderingKeyUID)
 	require.NoError(t, err)
 	require.Len(t, pending, 1)
 	assert.Equal(t, obj.ID, pending[0].ID)
@@ -56,7 +56,7 @@ func TestReconciliation_MissedCreation(t *testing.T) {
 
 	// Verify it appears in pending notifications so the notifier will pick
 	// it up.
-	pending, err := env.DB.GetPendingNotifications(10)
+	pending, err := env.DB.GetPendingNotifications(10, models.OrderingKeyUID)
 	require.NoError(t, err)
 	require.Len(t, pending, 1)
 	assert.Equal(t, obj.ID, pending[0].ID)
@@ -111,7 +111,7 @@ func TestReconciliation_MissedDeletion(t *testing.T) {
 	assert.False(t, stored.NotifiedDeleted)
 
 	// Verify it now appears in pending notifications for deletion.
-	pending, err := env.DB.GetPendingNotifications(10)
+	pending, err := env.DB.GetPendingNotifications(10, models.OrderingKeyUID)
 	require.NoError(t, err)
 	require.Len(t, pending, 1)
 	assert.Equal(t, obj.ID, pending[0].ID)
@@ -4,7 +4,6 @@ package integration_test
 
 import (
 	"context"
-	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"sync/atomic"
@@ -35,8 +34,8 @@ func TestRetry_ServerErrorThenSuccess(t *testing.T) {
 			return
 		}
 		// Subsequent attempts: return 200 (success).
-		var payload models.NotificationPayload
-		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		payload, err := decodeNotification(r)
+		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
@@ -122,7 +121,7 @@ func TestRetry_NonRetriableError(t *testing.T) {
 	assert.False(t, updated.NotifiedCreated, "notification should NOT be marked as sent")
 
 	// Verify it is excluded from pending notifications.
-	pending, err := env.DB.GetPendingNotifications(10)
+	pending, err := env.DB.GetPendingNotifications(10, models.OrderingKeyUID)
 	require.NoError(t, err)
 	assert.Empty(t, pending, "failed notification should not appear in pending list")
 
@@ -132,7 +131,7 @@ func TestRetry_NonRetriableError(t *testing.T) {
 	err = env.DB.UpdateClusterState(obj.ResourceUID, models.ClusterStateDeleted, &pastRetention)
 	require.NoError(t, err)
 
-	eligible, err := env.DB.GetCleanupEligible(env.Config.Retention.RetentionPeriod.Duration)
+	eligible, err := env.DB.GetExpiredRecords(models.RetentionDelivered, time.Now().Add(-env.Config.Retention.RetentionPeriod.Duration), nil, -1)
 	require.NoError(t, err)
 	assert.Empty(t, eligible, "failed notifications must be exempt from cleanup")
 }
@@ -10,6 +10,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -33,7 +34,27 @@ type testEnv struct {
 
 	// mu protects received payloads.
 	mu       sync.Mutex
-	received []models.NotificationPayload
+	received []notification
+}
+
+// notification is a CloudEvent received by the mock endpoint, reduced to
+// what the tests check: the event type, the last segment of the CloudEvent
+// type, and the resource.
+type notification struct {
+	EventType string
+	Resource  models.NotificationResource
+}
+
+// decodeNotification reads the CloudEvent in r.
+func decodeNotification(r *http.Request) (notification, error) {
+	var ce models.CloudEvent
+	if err := json.NewDecoder(r.Body).Decode(&ce); err != nil {
+		return notification{}, err
+	}
+	return notification{
+		EventType: ce.Type[strings.LastIndex(ce.Type, ".")+1:],
+		Resource:  ce.Data.Resource,
+	}, nil
 }
 
 // setupTestEnv creates an in-memory SQLite database, a mock HTTP server that
@@ -61,8 +82,8 @@ func setupTestEnv(t *testing.T) (*testEnv, func()) {
 
 	// Create a mock HTTP server that records payloads.
 	env.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var payload models.NotificationPayload
-		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		payload, err := decodeNotification(r)
+		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
@@ -90,10 +111,10 @@ func setupTestEnv(t *testing.T) (*testEnv, func()) {
 
 // receivedPayloads returns a snapshot of the payloads received by the mock
 // HTTP server.
-func (e *testEnv) receivedPayloads() []models.NotificationPayload {
+func (e *testEnv) receivedPayloads() []notification {
 	e.mu.Lock()
 	defer e.mu.Unlock()
-	cp := make([]models.NotificationPayload, len(e.received))
+	cp := make([]notification, len(e.received))
 	copy(cp, e.received)
 	return cp
 }
@@ -152,6 +173,7 @@ func newTestConfig(endpointURL string) *config.Config {
 			Enabled:         true,
 			CleanupInterval: config.Duration{Duration: 500 * time.Millisecond},
 			RetentionPeriod: config.Duration{Duration: 1 * time.Second},
+			BatchSize:       500,
 		},
 		Storage: config.StorageConfig{
 			MonitorInterval:   config.Duration{Duration: 1 * time.Second},